@@ -0,0 +1,230 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+)
+
+// max. number of sent messages that can still be acknowledged, the oldest ones are forgotten first
+const maxAckableMessages = 1000
+
+var acksReceived = newCounter("xmpp_acks_total", "Acknowledgements of sent messages by their recipients.", "endpoint")
+
+var deescalated = newCounter("xmpp_deescalated_total", "Notifications of acknowledged alerts that were downgraded or suppressed.", "endpoint", "action")
+
+// what happens to the notifications of acknowledged alerts
+const (
+	deescalateDowngrade = "downgrade" // sent as info with the quiet delivery profile, without attention
+	deescalateSuppress  = "suppress"  // not sent at all
+)
+
+// reactions (XEP-0444) that acknowledge a message
+var ackReactions = map[string]bool{
+	"👍":  true,
+	"✅":  true,
+	"✔️": true,
+	"✔":  true,
+	"👀":  true,
+}
+
+// reactions to a message (XEP-0444)
+type messageReactions struct {
+	ID        string   `xml:"id,attr"`
+	Reactions []string `xml:"reaction"`
+}
+
+// message that can be acknowledged by its recipients
+type ackableMessage struct {
+	id         string
+	endpoint   string
+	source     string
+	key        string // of the alert, empty if the parser has none
+	summary    string // first line of the body
+	recipients []jid.JID
+	acked      map[string]bool // bare jids that acknowledged it already
+}
+
+// payload posted to the ack webhook
+type ackNotification struct {
+	ID       string    `json:"id"`
+	Endpoint string    `json:"endpoint"`
+	Message  string    `json:"message"`
+	By       string    `json:"by"`
+	Time     time.Time `json:"time"`
+}
+
+// acknowledgement of an alert, de-escalating its notifications
+type ackedAlert struct {
+	by string // bare jid
+	at time.Time
+}
+
+// remembers the sent messages and collects the acknowledgements of their recipients
+type ackTracker struct {
+	// acknowledgements are posted there if set
+	webhookURL   string
+	webhookToken string // sent as bearer token, optional
+	// how long the notifications of an acknowledged alert are de-escalated,
+	// disabled if 0
+	deescalateWindow time.Duration
+
+	mu       sync.Mutex
+	messages map[string]*ackableMessage // by stanza id, incl. the ids of split parts
+	order    []string                   // oldest first
+	latest   map[string]string          // bare jid -> id of the last message it got
+	alerts   map[string]ackedAlert      // acknowledged alerts by key, only with a de-escalation window
+}
+
+func newAckTracker(webhookURL, webhookToken string) *ackTracker {
+	return &ackTracker{
+		webhookURL:   webhookURL,
+		webhookToken: webhookToken,
+		messages:     make(map[string]*ackableMessage),
+		latest:       make(map[string]string),
+		alerts:       make(map[string]ackedAlert),
+	}
+}
+
+// remembers the message sent to the recipients under the stanza ids of its parts
+func (a *ackTracker) sent(m alertMessage, ids []string) {
+	summary := strings.SplitN(m.body, "\n", 2)[0]
+	msg := &ackableMessage{id: m.id, endpoint: m.endpoint, source: m.source, key: m.key, summary: summary, recipients: m.recipients, acked: make(map[string]bool)}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := a.messages[id]; !ok {
+			a.order = append(a.order, id)
+		}
+		a.messages[id] = msg
+	}
+	for _, r := range m.recipients {
+		a.latest[r.Bare().String()] = m.id
+	}
+	for len(a.order) > maxAckableMessages {
+		delete(a.messages, a.order[0])
+		a.order = a.order[1:]
+	}
+}
+
+// records the acknowledgement of the message by the jid, the last message it
+// got if id is empty; false if there is no such message or it wasn't sent to the jid
+func (a *ackTracker) ack(id string, from jid.JID) bool {
+	bare := from.Bare().String()
+	a.mu.Lock()
+	if id == "" {
+		id = a.latest[bare]
+	}
+	msg, ok := a.messages[id]
+	if !ok || !msg.sentTo(from) {
+		a.mu.Unlock()
+		return false
+	}
+	if msg.acked[bare] {
+		// acknowledged already, e.g. with a reply and a reaction
+		a.mu.Unlock()
+		return true
+	}
+	msg.acked[bare] = true
+	if msg.key != "" && a.deescalateWindow > 0 {
+		now := time.Now()
+		// forget the acknowledgements whose window is over
+		for key, acked := range a.alerts {
+			if now.Sub(acked.at) >= a.deescalateWindow {
+				delete(a.alerts, key)
+			}
+		}
+		// every acknowledgement starts the window anew
+		a.alerts[msg.key] = ackedAlert{by: bare, at: now}
+	}
+	a.mu.Unlock()
+
+	logf(msg.source, "message %s from /%s acknowledged by %s: %s", msg.id, msg.endpoint, bare, msg.summary)
+	acksReceived.inc(msg.source)
+	if a.webhookURL != "" {
+		// without blocking the session
+		go func() {
+			err := postJSON(a.webhookURL, a.webhookToken, ackNotification{ID: msg.id, Endpoint: msg.endpoint, Message: msg.summary, By: bare, Time: time.Now()})
+			if err != nil {
+				log.Printf("failed to forward the acknowledgement of %s: %s", msg.id, err)
+			}
+		}()
+	}
+	return true
+}
+
+// returns who acknowledged the alert if its notifications are to be
+// de-escalated, i.e. within the window since the acknowledgement
+func (a *ackTracker) acknowledged(key string) (string, bool) {
+	if a == nil || a.deescalateWindow == 0 || key == "" {
+		return "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	acked, ok := a.alerts[key]
+	if !ok {
+		return "", false
+	}
+	if time.Since(acked.at) >= a.deescalateWindow {
+		delete(a.alerts, key)
+		return "", false
+	}
+	return acked.by, true
+}
+
+// forgets the acknowledgement of the resolved alert, its next firing
+// notification escalates again
+func (a *ackTracker) resolved(key string) {
+	if a == nil || key == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.alerts, key)
+}
+
+// checks if the message was sent to the jid
+func (m *ackableMessage) sentTo(j jid.JID) bool {
+	for _, r := range m.recipients {
+		if r.Bare().Equal(j.Bare()) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the id of the message acknowledged by the incoming message and
+// whether it is an acknowledgement at all: a reaction, a reply starting with
+// "ack" to the message, or just "ack" for the last message
+func ackedID(msg MessageBody) (string, bool) {
+	if msg.Reactions != nil {
+		for _, r := range msg.Reactions.Reactions {
+			if ackReactions[strings.TrimSpace(r)] {
+				return msg.Reactions.ID, true
+			}
+		}
+		return "", false
+	}
+	if !isAck(msg.Body) {
+		return "", false
+	}
+	if msg.Reply != nil {
+		return msg.Reply.ID, true
+	}
+	return "", true
+}
+
+// checks if the body (without the quoted lines of a reply) starts with "ack"
+func isAck(body string) bool {
+	var lines []string
+	for _, l := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(l, ">") {
+			lines = append(lines, l)
+		}
+	}
+	fields := strings.Fields(strings.ToLower(strings.Join(lines, "\n")))
+	return len(fields) > 0 && strings.Trim(fields[0], ".,!") == "ack"
+}
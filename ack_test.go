@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+func TestDeescalate(t *testing.T) {
+	alice := jid.MustParse("alice@example.net")
+	h, messages := testHandler("oncall")
+	h.source = "oncall"
+	h.acks = newAckTracker("", "")
+	h.acks.deescalateWindow = time.Hour
+	h.deescalate = deescalateDowngrade
+	quiet := deliveryProfiles["quiet"]
+	h.deescalateProfile = &quiet
+	h.attentionCritical = true
+	firing := parser.Result{Message: "disk full", Status: parser.StatusFiring, Severity: parser.SeverityCritical, Key: "db01"}
+	send := func(result parser.Result) (responseMessage, alertMessage) {
+		handled := h.dispatch(context.Background(), result, []jid.JID{alice}, nil, false, false, 0, false)
+		select {
+		case m := <-messages:
+			h.acks.sent(m, []string{m.id})
+			return handled, m
+		default:
+			return handled, alertMessage{}
+		}
+	}
+
+	// unacknowledged alerts escalate as usual
+	_, m := send(firing)
+	if m.severity != parser.SeverityCritical || !m.attention || m.delivery != nil {
+		t.Fatalf("unacknowledged alert was de-escalated: %+v", m)
+	}
+	if !h.acks.ack(m.id, jid.MustParse("alice@example.net/phone")) {
+		t.Fatal("acknowledgement wasn't recorded")
+	}
+	handled, m := send(firing)
+	if m.severity != parser.SeverityInfo || m.attention || m.delivery == nil || m.delivery.Type != stanza.HeadlineMessage || handled.Severity != parser.SeverityInfo {
+		t.Errorf("acknowledged alert wasn't downgraded: %+v", m)
+	}
+	// other alerts aren't affected
+	if _, m := send(parser.Result{Message: "disk full", Status: parser.StatusFiring, Severity: parser.SeverityCritical, Key: "db02"}); m.severity != parser.SeverityCritical {
+		t.Errorf("alert of another key was downgraded: %+v", m)
+	}
+
+	// the resolution ends the de-escalation
+	if _, m := send(parser.Result{Message: "disk ok", Status: parser.StatusResolved, Key: "db01"}); m.body == "" {
+		t.Error("resolved notification wasn't sent")
+	}
+	if _, m := send(firing); m.severity != parser.SeverityCritical || !m.attention {
+		t.Errorf("alert firing again after its resolution was downgraded: %+v", m)
+	}
+
+	// suppressed instead of downgraded, until the window is over
+	h.deescalate = deescalateSuppress
+	_, m = send(firing)
+	h.acks.ack(m.id, alice)
+	if handled, m := send(firing); handled.Delivery != "suppressed (acknowledged)" || m.id != "" {
+		t.Errorf("acknowledged alert wasn't suppressed: %q", handled.Delivery)
+	}
+	h.acks.mu.Lock()
+	acked := h.acks.alerts["oncall/db01"]
+	acked.at = time.Now().Add(-2 * time.Hour)
+	h.acks.alerts["oncall/db01"] = acked
+	h.acks.mu.Unlock()
+	if _, m := send(firing); m.severity != parser.SeverityCritical {
+		t.Errorf("alert was de-escalated after the window: %+v", m)
+	}
+	if n := deescalated.sum(); n != 2 {
+		t.Errorf("%v notifications de-escalated, want 2", n)
+	}
+}
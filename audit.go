@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// max. number of entries waiting to be written, further ones are dropped
+// instead of holding up the delivery
+const auditQueueSize = 1000
+
+var (
+	auditDropped = newCounter("xmpp_audit_dropped_total", "Audit log entries dropped because the queue was full.")
+	auditErrors  = newCounter("xmpp_audit_errors_total", "Failed writes to the audit log.")
+)
+
+// record of a sent message in the audit log, one json object per line
+type auditEntry struct {
+	Time       time.Time         `json:"time"`
+	ID         string            `json:"id"` // stanza id, also in the response of the request
+	Endpoint   string            `json:"endpoint"`
+	Source     string            `json:"source"`
+	Severity   string            `json:"severity,omitempty"`
+	Delivery   string            `json:"delivery"` // ok, partially failed, failed, skipped or expired
+	Recipients []recipientResult `json:"recipients,omitempty"`
+	BodySHA256 string            `json:"body_sha256"`
+	Body       string            `json:"body,omitempty"` // only with XMPP_AUDIT_LOG_BODY
+}
+
+// appends an entry for every message to a file (XMPP_AUDIT_LOG), written by
+// its own goroutine and synced to disk once the queue is empty
+type auditLog struct {
+	path        string
+	includeBody bool
+	entries     chan auditEntry
+	reopens     chan chan error
+	done        chan struct{}
+}
+
+// opens the file for appending, creating it if needed
+func openAuditLog(path string, includeBody bool) (*auditLog, error) {
+	f, err := openAuditFile(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &auditLog{
+		path:        path,
+		includeBody: includeBody,
+		entries:     make(chan auditEntry, auditQueueSize),
+		reopens:     make(chan chan error),
+		done:        make(chan struct{}),
+	}
+	go a.run(f)
+	return a, nil
+}
+
+func openAuditFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+// queues the entry of the delivered (or expired) message
+func (a *auditLog) record(m alertMessage, expired bool, results []recipientResult) {
+	if a == nil {
+		return
+	}
+	sum := sha256.Sum256([]byte(m.body))
+	e := auditEntry{
+		Time:       time.Now(),
+		ID:         m.id,
+		Endpoint:   m.endpoint,
+		Source:     m.source,
+		Severity:   m.severity,
+		Delivery:   auditDelivery(expired, results),
+		Recipients: results,
+		BodySHA256: hex.EncodeToString(sum[:]),
+	}
+	if a.includeBody {
+		e.Body = m.body
+	}
+	select {
+	case a.entries <- e:
+	default:
+		auditDropped.inc()
+		logf(m.source, "audit log queue full, dropping the entry of message %s", m.id)
+	}
+}
+
+// returns the outcome of the delivery like the synchronous responses
+func auditDelivery(expired bool, results []recipientResult) string {
+	if expired {
+		return deliveryExpired
+	}
+	var ok, bad int
+	for _, r := range results {
+		switch r.Delivery {
+		case deliveryOK:
+			ok++
+		case deliveryFailed:
+			bad++
+		}
+	}
+	switch {
+	case bad > 0 && ok > 0:
+		return deliveryPartial
+	case bad > 0:
+		return deliveryFailed
+	case ok == 0:
+		return deliverySkipped
+	}
+	return deliveryOK
+}
+
+// writes the queued entries until close, batches of them are flushed and
+// synced together
+func (a *auditLog) run(f *os.File) {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	sync := func() {
+		if err := w.Flush(); err != nil {
+			auditErrors.inc()
+			log.Printf("failed to write the audit log: %s", err)
+			return
+		}
+		if err := f.Sync(); err != nil {
+			auditErrors.inc()
+			log.Printf("failed to sync the audit log: %s", err)
+		}
+	}
+	write := func(e auditEntry) {
+		if err := enc.Encode(e); err != nil {
+			auditErrors.inc()
+			log.Printf("failed to write the audit log: %s", err)
+		}
+	}
+	for {
+		select {
+		case e, ok := <-a.entries:
+			if !ok {
+				sync()
+				f.Close()
+				close(a.done)
+				return
+			}
+			write(e)
+			if len(a.entries) == 0 {
+				sync()
+			}
+		case reply := <-a.reopens:
+			// the entries queued until now still go to the old file, it's
+			// kept if the new one can't be opened
+			for len(a.entries) > 0 {
+				write(<-a.entries)
+			}
+			n, err := openAuditFile(a.path)
+			sync()
+			if err == nil {
+				f.Close()
+				f = n
+				w.Reset(f)
+			}
+			reply <- err
+		}
+	}
+}
+
+// opens the file again, e.g. after logrotate moved it away
+func (a *auditLog) reopen() error {
+	if a == nil {
+		return nil
+	}
+	reply := make(chan error)
+	a.reopens <- reply
+	return <-reply
+}
+
+// writes the remaining entries and closes the file, nothing may be recorded
+// afterwards
+func (a *auditLog) close() {
+	if a == nil {
+		return
+	}
+	close(a.entries)
+	<-a.done
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	audit, err := openAuditLog(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not connected, the send fails
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+	d := &dispatcher{client: client, presence: newPresenceTracker(), from: jid.MustParse("bot@example.net"), audit: audit}
+	alice := jid.MustParse("alice@example.net")
+	ctx := context.Background()
+	d.deliver(ctx, alertMessage{id: "a", endpoint: "grafana", source: "grafana", body: "disk full", severity: "critical", recipients: []jid.JID{alice}})
+
+	// logrotate moved the file away
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	d.deliver(ctx, alertMessage{id: "b", endpoint: "build", source: "build", body: "build failed", created: time.Now().Add(-time.Hour), ttl: time.Minute, recipients: []jid.JID{alice}})
+	audit.close()
+
+	read := func(path string) []auditEntry {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var entries []auditEntry
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			var e auditEntry
+			if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+				t.Fatalf("invalid line %s: %s", s.Text(), err)
+			}
+			entries = append(entries, e)
+		}
+		return entries
+	}
+	rotated := read(path + ".1")
+	if len(rotated) != 1 {
+		t.Fatalf("got %d entries in the rotated file", len(rotated))
+	}
+	e := rotated[0]
+	// sha-256 of "disk full"
+	if e.ID != "a" || e.Endpoint != "grafana" || e.Delivery != deliveryFailed || len(e.Recipients) != 1 || e.Recipients[0].Recipient != "alice@example.net" ||
+		e.BodySHA256 != "8c96d76f620269be0f4cbc27e6cb594426729e32474260ef82eb6fc24b2cba2f" || e.Body != "" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	current := read(path)
+	if len(current) != 1 || current[0].ID != "b" || current[0].Delivery != deliveryExpired {
+		t.Errorf("unexpected entries %+v", current)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// checks if the request carries the admin token, either as bearer token or
+// as basic auth password (for browsers), always false if no token is configured
+func isAdmin(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		provided = password
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+// max. size of a broadcast request
+const maxBroadcastSize = 64 << 10
+
+// admin api sending a message to the recipients, e.g. a maintenance notice
+type broadcastHandler struct {
+	messages   chan<- alertMessage
+	recipients []jid.JID
+	rooms      []room
+	adminToken string
+}
+
+// body of a broadcast request, also accepted as form
+type broadcastRequest struct {
+	Message    string `json:"message"`
+	Severity   string `json:"severity"`
+	Recipients string `json:"recipients"` // comma-separated jids or configured rooms, all by default
+}
+
+func (h *broadcastHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r, h.adminToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("unauthorized"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// get the message from json, a form or plain text
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBroadcastSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("failed to read request body"))
+		return
+	}
+	var req broadcastRequest
+	switch t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t {
+	case "application/json":
+		if err := json.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("failed to parse request body"))
+			return
+		}
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("failed to parse request body"))
+			return
+		}
+		req = broadcastRequest{Message: form.Get("message"), Severity: form.Get("severity"), Recipients: form.Get("recipients")}
+	default:
+		req.Message = string(body)
+		req.Recipients = r.URL.Query().Get("recipients")
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("missing message"))
+		return
+	}
+
+	// send to the given recipients and rooms, all configured ones by default
+	recipients, rooms := h.recipients, h.rooms
+	if req.Recipients != "" {
+		list, err := parseRecipients(req.Recipients)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid recipients: " + err.Error()))
+			return
+		}
+		recipients, rooms = nil, nil
+		for _, j := range list {
+			if room, ok := findRoom(h.rooms, j); ok {
+				rooms = append(rooms, room)
+			} else {
+				recipients = append(recipients, j)
+			}
+		}
+	}
+
+	m := alertMessage{
+		id:         newMessageID(),
+		endpoint:   "broadcast",
+		source:     "broadcast",
+		body:       req.Message,
+		severity:   parser.NormalizeSeverity(req.Severity),
+		created:    time.Now(),
+		recipients: recipients,
+		rooms:      rooms,
+	}
+	// the admin token doesn't tell who it is, the user name of basic auth may
+	by := r.RemoteAddr
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		by = user + " (" + r.RemoteAddr + ")"
+	}
+	logf(m.source, "broadcast %s triggered by %s to %d recipient(s) and %d room(s)", m.id, by, len(recipients), len(rooms))
+	h.messages <- m
+
+	w.Header().Set("Content-Type", "application/json")
+	body, _ = marshal(map[string]string{"status": "ok", "id": m.id})
+	_, _ = w.Write(body)
+}
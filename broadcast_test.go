@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+func TestBroadcastHandler(t *testing.T) {
+	ops := room{jid: jid.MustParse("ops@conference.example.net")}
+	alice, bob := jid.MustParse("alice@example.net"), jid.MustParse("bob@example.net")
+	messages := make(chan alertMessage, 10)
+	h := &broadcastHandler{messages: messages, recipients: []jid.JID{alice, bob}, rooms: []room{ops}, adminToken: "admin"}
+
+	tests := []struct {
+		name        string
+		token       string
+		contentType string
+		body        string
+		want        int
+		message     string
+		severity    string
+		recipients  string
+		rooms       int
+	}{
+		{name: "unauthorized", token: "guess", body: "maintenance", want: http.StatusUnauthorized},
+		{name: "plain text to all", token: "admin", body: "Maintenance tonight 22:00-23:00\n", want: http.StatusOK, message: "Maintenance tonight 22:00-23:00", severity: parser.SeverityUnknown, recipients: "alice@example.net,bob@example.net", rooms: 1},
+		{name: "json to a room and a recipient", token: "admin", contentType: "application/json", body: `{"message": "Deploying", "severity": "info", "recipients": "ops@conference.example.net,carol@example.net"}`, want: http.StatusOK, message: "Deploying", severity: parser.SeverityInfo, recipients: "carol@example.net", rooms: 1},
+		{name: "form", token: "admin", contentType: "application/x-www-form-urlencoded", body: "message=Test&recipients=bob@example.net", want: http.StatusOK, message: "Test", severity: parser.SeverityUnknown, recipients: "bob@example.net"},
+		{name: "empty", token: "admin", body: " ", want: http.StatusBadRequest},
+		{name: "invalid recipients", token: "admin", contentType: "application/json", body: `{"message": "x", "recipients": "@"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/broadcast", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		m := <-messages
+		if m.body != tt.message || m.severity != tt.severity || joinJIDs(m.recipients) != tt.recipients || len(m.rooms) != tt.rooms || m.endpoint != "broadcast" {
+			t.Errorf("%s: got %q (%s) to %s and %d room(s)", tt.name, m.body, m.severity, joinJIDs(m.recipients), len(m.rooms))
+		}
+		if !strings.Contains(w.Body.String(), `"id":"`+m.id+`"`) {
+			t.Errorf("%s: response %s", tt.name, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/broadcast", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d", w.Code)
+	}
+}
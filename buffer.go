@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// what to do with new messages if the buffer is full
+const (
+	overflowDropOldest = "drop-oldest"
+	overflowDropNewest = "drop-newest"
+	overflowBlock      = "block" // reject new requests with 503
+)
+
+var bufferDepth = newGauge("xmpp_buffer_messages", "Messages buffered while disconnected.")
+var bufferDropped = newCounter("xmpp_buffer_dropped_total", "Messages dropped because the buffer was full.", "endpoint")
+
+// holds the messages back while disconnected, so they are sent after reconnecting
+type messageBuffer struct {
+	size     int
+	overflow string
+
+	mu       sync.Mutex
+	messages []alertMessage // oldest first
+}
+
+// returns new buffer of the given size and overflow policy
+func newMessageBuffer(size int, overflow string) (*messageBuffer, error) {
+	switch overflow {
+	case overflowDropOldest, overflowDropNewest, overflowBlock:
+	default:
+		return nil, errors.New("buffer overflow policy must be " + overflowDropOldest + ", " + overflowDropNewest + " or " + overflowBlock)
+	}
+	return &messageBuffer{size: size, overflow: overflow}, nil
+}
+
+// buffers the message, drops a message if the buffer is full
+func (b *messageBuffer) push(m alertMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.messages) >= b.size {
+		if b.overflow != overflowDropOldest {
+			// with the block policy, this only happens for requests accepted before the buffer was full
+			bufferDropped.inc(m.source)
+			logf(m.source, "dropping message %s, the buffer is full", m.id)
+			return
+		}
+		bufferDropped.inc(b.messages[0].source)
+		logf(b.messages[0].source, "dropping buffered message %s, the buffer is full", b.messages[0].id)
+		b.messages = b.messages[1:]
+	}
+	b.messages = append(b.messages, m)
+	bufferDepth.set(float64(len(b.messages)))
+}
+
+// returns (and forgets) the buffered messages, oldest first
+func (b *messageBuffer) flush() []alertMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	messages := b.messages
+	b.messages = nil
+	bufferDepth.set(0)
+	return messages
+}
+
+// checks if new requests have to be rejected
+func (b *messageBuffer) blocking() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.overflow == overflowBlock && len(b.messages) >= b.size
+}
@@ -3,6 +3,7 @@
 set -xe
 
 git checkout "$1"
-docker run --rm -ti  -v "$(pwd)":/build golang:1.15-buster sh -c "cd /build && go build"
-tar -czvf "xmpp-webhook-$1-linux-amd64.tar.gz" xmpp-webhook xmpp-webhook.service README.md LICENSE THIRD-PARTY-NOTICES
+LDFLAGS="-X main.version=$1 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+docker run --rm -ti  -v "$(pwd)":/build golang:1.16-buster sh -c "cd /build && go build -ldflags '$LDFLAGS'"
+tar -czvf "xmpp-webhook-$1-linux-amd64.tar.gz" xmpp-webhook xmpp-webhook.service xmpp-webhook.socket README.md LICENSE THIRD-PARTY-NOTICES
 sha512sum "xmpp-webhook-$1-linux-amd64.tar.gz" > "xmpp-webhook-$1-linux-amd64.tar.gz.sha512"
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// connects once, sends the initial presence and optionally a test message,
+// used to validate the configuration without starting the http server
+func checkConnection(dial func() (*xmpp.Session, error), from jid.JID, to string, timeout time.Duration) error {
+	var recipient jid.JID
+	if to != "" {
+		var err error
+		recipient, err = jid.Parse(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+	}
+
+	s, err := dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect and authenticate: %w", err)
+	}
+	defer closeXMPP(s)
+	fmt.Printf("connected and authenticated as %s\n", s.LocalAddr())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = s.Send(ctx, stanza.Presence{Type: stanza.AvailablePresence}.Wrap(nil))
+	if err != nil {
+		return fmt.Errorf("failed to send presence: %w", err)
+	}
+	fmt.Println("sent presence")
+
+	if to == "" {
+		return nil
+	}
+	err = s.Encode(ctx, MessageBody{
+		Message: stanza.Message{
+			ID:   newMessageID(),
+			To:   recipient,
+			From: from,
+			Type: stanza.ChatMessage,
+		},
+		Body: "xmpp-webhook connectivity check",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send test message to %s: %w", recipient, err)
+	}
+	fmt.Printf("sent test message to %s\n", recipient)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+)
+
+// time without a new failure after which a probe counts as successful
+const circuitProbeTimeout = time.Minute
+
+var (
+	circuitsOpen    = newGauge("xmpp_circuits_open", "Recipients whose delivery is paused after repeated failures.")
+	circuitsSkipped = newCounter("xmpp_circuit_skipped_total", "Messages not sent because the circuit of the recipient is open.")
+)
+
+// states of a recipient's circuit
+const (
+	circuitClosed   = "closed"    // messages are delivered
+	circuitOpen     = "open"      // messages are skipped until the cooldown is over
+	circuitHalfOpen = "half-open" // one message was sent as probe
+)
+
+type circuit struct {
+	state       string
+	failures    int       // consecutive failures
+	lastFailure time.Time // failures older than the cooldown are forgotten
+	since       time.Time // when the circuit was opened or the probe was sent
+}
+
+// pauses the delivery to recipients whose messages bounce repeatedly, so they
+// don't slow down the delivery to everybody else
+type circuitBreaker struct {
+	threshold int           // consecutive failures that open the circuit
+	cooldown  time.Duration // how long the circuit stays open before probing
+	now       func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit // by bare jid
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now, circuits: make(map[string]*circuit)}
+}
+
+// returns whether a message may be sent to the recipient, an open circuit lets
+// a single probe through after the cooldown
+func (b *circuitBreaker) allow(recipient jid.JID) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[recipient.Bare().String()]
+	if c == nil {
+		return true
+	}
+	now := b.now()
+	switch c.state {
+	case circuitOpen:
+		if now.Sub(c.since) < b.cooldown {
+			circuitsSkipped.inc()
+			return false
+		}
+		c.state, c.since = circuitHalfOpen, now
+		log.Printf("circuit of %s is half-open, probing", recipient.Bare())
+	case circuitHalfOpen:
+		if now.Sub(c.since) < circuitProbeTimeout {
+			circuitsSkipped.inc()
+			return false
+		}
+		// the probe didn't bounce
+		b.close(recipient, c)
+	}
+	return true
+}
+
+// counts a failed delivery (a bounced message) to the recipient
+func (b *circuitBreaker) failed(recipient jid.JID) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := recipient.Bare().String()
+	c := b.circuits[key]
+	now := b.now()
+	if c == nil || (c.state == circuitClosed && now.Sub(c.lastFailure) > b.cooldown) {
+		c = &circuit{state: circuitClosed}
+		b.circuits[key] = c
+	}
+	c.failures++
+	c.lastFailure = now
+	switch {
+	case c.state == circuitHalfOpen:
+		c.state, c.since = circuitOpen, now
+		log.Printf("circuit of %s is open again, the probe failed", recipient.Bare())
+	case c.state == circuitClosed && c.failures >= b.threshold:
+		c.state, c.since = circuitOpen, now
+		circuitsOpen.add(1)
+		log.Printf("circuit of %s is open after %d failures, pausing delivery for %s", recipient.Bare(), c.failures, b.cooldown)
+	}
+}
+
+// resets the failures of the recipient, e.g. after it sent us something
+func (b *circuitBreaker) succeeded(recipient jid.JID) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[recipient.Bare().String()]; c != nil {
+		b.close(recipient, c)
+	}
+}
+
+// closes the circuit and forgets it, the lock is held by the caller
+func (b *circuitBreaker) close(recipient jid.JID, c *circuit) {
+	if c.state != circuitClosed {
+		circuitsOpen.add(-1)
+		log.Printf("circuit of %s is closed, resuming delivery", recipient.Bare())
+	}
+	delete(b.circuits, recipient.Bare().String())
+}
+
+// returns the state of the recipient's circuit
+func (b *circuitBreaker) state(recipient jid.JID) string {
+	if b == nil {
+		return circuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[recipient.Bare().String()]; c != nil {
+		return c.state
+	}
+	return circuitClosed
+}
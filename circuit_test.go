@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"mellium.im/xmpp/jid"
+)
+
+// returns a circuit breaker with a clock that is moved by the returned func
+func testCircuitBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, func(time.Duration)) {
+	b := newCircuitBreaker(threshold, cooldown)
+	now := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b, advance := testCircuitBreaker(3, 10*time.Minute)
+	bad := jid.MustParse("alice@broken.example/phone")
+	good := jid.MustParse("bob@example.net")
+
+	for i := 0; i < 2; i++ {
+		b.failed(bad)
+	}
+	if !b.allow(bad) {
+		t.Fatal("circuit open before the threshold")
+	}
+	b.failed(bad)
+	if b.allow(jid.MustParse("alice@broken.example")) {
+		t.Error("circuit of the bare jid not open after the threshold")
+	}
+	if !b.allow(good) {
+		t.Error("healthy recipient skipped")
+	}
+
+	// a single probe after the cooldown, which bounces
+	advance(10 * time.Minute)
+	if !b.allow(bad) || b.state(bad) != circuitHalfOpen {
+		t.Fatalf("no probe after the cooldown, circuit is %s", b.state(bad))
+	}
+	if b.allow(bad) {
+		t.Error("second message sent while probing")
+	}
+	b.failed(bad)
+	if b.state(bad) != circuitOpen {
+		t.Errorf("circuit %s after the probe failed", b.state(bad))
+	}
+
+	// the next probe doesn't bounce
+	advance(10 * time.Minute)
+	if !b.allow(bad) {
+		t.Fatal("no probe after the second cooldown")
+	}
+	advance(circuitProbeTimeout)
+	if !b.allow(bad) || b.state(bad) != circuitClosed {
+		t.Errorf("circuit %s after a successful probe", b.state(bad))
+	}
+}
+
+func TestCircuitBreakerForgetsFailures(t *testing.T) {
+	b, advance := testCircuitBreaker(2, time.Minute)
+	r := jid.MustParse("alice@example.net")
+
+	// failures that aren't consecutive within the cooldown don't add up
+	b.failed(r)
+	advance(2 * time.Minute)
+	b.failed(r)
+	if !b.allow(r) {
+		t.Error("circuit open after old failures")
+	}
+
+	// the recipient proves to be reachable
+	b.failed(r)
+	b.succeeded(r)
+	if b.state(r) != circuitClosed {
+		t.Errorf("circuit %s after a success", b.state(r))
+	}
+	b.failed(r)
+	if !b.allow(r) {
+		t.Error("circuit open although the failures were reset")
+	}
+
+	// disabled
+	var disabled *circuitBreaker
+	disabled.failed(r)
+	if !disabled.allow(r) {
+		t.Error("disabled circuit breaker skipped the recipient")
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+	"mellium.im/xmpp/stream"
+)
+
+// bounds for the exponential reconnect backoff
+const reconnectMinDelay = time.Second
+const reconnectMaxDelay = 5 * time.Minute
+
+var errNotConnected = errors.New("not connected to xmpp server")
+var errClosed = errors.New("xmpp client closed")
+
+var reconnectAttempts = newGauge("xmpp_reconnect_attempts", "Number of the current reconnect attempt (0 while connected).")
+
+var sendsInFlight = newGauge("xmpp_sends_in_flight", "Stanzas that are currently being sent.")
+
+var sessionMigrations = newCounter("xmpp_session_migrations_total", "Sessions replaced by new ones without a reconnect gap, e.g. after a password change.", "result")
+
+// how the initial presence of a session is sent
+const (
+	presenceBroadcast = "broadcast" // to the whole roster, by the server
+	presenceDirected  = "directed"  // only to the configured recipients
+)
+
+// where and as which resource the next session is established, changed by stream errors
+type dialTarget struct {
+	server   string // host:port given by a see-other-host error, the configured server if empty
+	resource string // resource regenerated after a conflict, the configured one if empty
+}
+
+// xmpp session that gets re-established when it's lost
+type xmppClient struct {
+	dial      func(dialTarget) (*xmpp.Session, error) // establishes a new session
+	onConnect func(*xmpp.Session) error               // called for every new session (initial presence etc.)
+	handler   xmpp.Handler
+
+	// give up (and exit) if reconnecting takes longer, 0 retries forever
+	maxReconnectDuration time.Duration
+	// max. time a single send may take, 0 is unlimited
+	sendTimeout time.Duration
+	// min. time between two sends, to stay below the rate limit of the server; 0 is unlimited
+	sendInterval time.Duration
+	// semaphore bounding the concurrent sends, shared by the sessions of a pool; unlimited if nil
+	sends chan struct{}
+	// called when the session is lost, reconnecting starts and the session is re-established, optional
+	onStateChange func(connectionEvent)
+
+	mu      sync.Mutex
+	session *xmpp.Session
+	closed  bool
+	target  dialTarget
+
+	// held by the sends while they use the session, migrate takes it to
+	// switch the sessions once they are done and holds back new ones
+	switching sync.RWMutex
+
+	sendMu   sync.Mutex
+	lastSend time.Time
+}
+
+// returns new client, the session is established by calling connect
+func newXMPPClient(dial func(dialTarget) (*xmpp.Session, error), onConnect func(*xmpp.Session) error, h xmpp.Handler) *xmppClient {
+	return &xmppClient{
+		dial:      dial,
+		onConnect: onConnect,
+		handler:   h,
+	}
+}
+
+// prepares every new session, the server forgets the presence and room
+// memberships of the last one
+type sessionSetup struct {
+	presence *presenceTracker
+	address  jid.JID
+	// recipients whose presence is needed for delivery, nil if it isn't tracked
+	subscribe []jid.JID
+	// send the initial presence only to these recipients instead of the whole roster
+	directed   bool
+	recipients []jid.JID
+	rooms      []room
+	nick       string
+}
+
+// sends the initial presence, the presence subscriptions and joins the rooms
+func (p sessionSetup) run(s *xmpp.Session) error {
+	// the presence of our contacts is unknown until the server sends it again
+	p.presence.reset()
+
+	// send initial presence, directed presence doesn't make the session
+	// available, so the server keeps the presence of the roster to itself
+	var err error
+	if p.directed {
+		for _, r := range p.recipients {
+			err = s.Send(context.TODO(), stanza.Presence{To: r.Bare(), Type: stanza.AvailablePresence}.Wrap(nil))
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		err = s.Send(context.TODO(), stanza.Presence{Type: stanza.AvailablePresence}.Wrap(nil))
+		if err != nil {
+			return err
+		}
+	}
+
+	// subscribe to the presence of the recipients if it's needed for delivery
+	for _, r := range p.subscribe {
+		err = s.Send(context.TODO(), stanza.Presence{To: r.Bare(), Type: stanza.SubscribePresence}.Wrap(nil))
+		if err != nil {
+			return err
+		}
+	}
+
+	// join the rooms
+	for _, r := range p.rooms {
+		join, err := r.join(p.address, p.nick)
+		if err != nil {
+			return err
+		}
+		err = s.Encode(context.TODO(), join)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// establishes a new session
+func (c *xmppClient) connect() error {
+	c.mu.Lock()
+	target := c.target
+	c.mu.Unlock()
+	s, err := c.dial(target)
+	if err != nil {
+		return err
+	}
+	err = c.onConnect(s)
+	if err != nil {
+		closeXMPP(s)
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the client might have been closed while connecting
+	if c.closed {
+		closeXMPP(s)
+		return errClosed
+	}
+	c.session = s
+	return nil
+}
+
+// returns the current session, nil while disconnected
+func (c *xmppClient) current() *xmpp.Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// serves incoming stanzas and reconnects whenever the session is lost
+func (c *xmppClient) serve() {
+	for {
+		c.mu.Lock()
+		s := c.session
+		c.mu.Unlock()
+		if s == nil {
+			// closed while reconnecting
+			return
+		}
+		err := s.Serve(c.handler)
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		// closed by migrate, serve the new session
+		if c.session != s {
+			c.mu.Unlock()
+			continue
+		}
+		// only the stream error tells where the server wants us to go
+		immediate := c.handleStreamError(s, err)
+		closeXMPP(s)
+		c.session = nil
+		c.mu.Unlock()
+		if err != nil {
+			bridgeError.set(err)
+		}
+		log.Printf("xmpp session lost: %v", err)
+		c.stateChanged(connectionEvent{state: stateDisconnected, at: time.Now(), err: err})
+		c.reconnect(immediate)
+	}
+}
+
+// adjusts the next dial target to the stream error the session ended with,
+// returns true if the server asked to reconnect right away; c.mu must be held
+func (c *xmppClient) handleStreamError(s *xmpp.Session, err error) bool {
+	// a redirect only applies to the next connection
+	c.target.server = ""
+	var se stream.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.Err {
+	case "see-other-host":
+		host := seeOtherHost(s)
+		if host == "" {
+			log.Printf("stream error see-other-host without an address, reconnecting to the configured server")
+			return true
+		}
+		log.Printf("stream error see-other-host, reconnecting to %s", host)
+		c.target.server = host
+		return true
+	case stream.Conflict.Err:
+		resource := c.target.resource
+		if resource == "" {
+			resource = s.LocalAddr().Resourcepart()
+		}
+		c.target.resource = regenerateResource(resource)
+		log.Printf("stream error conflict (resource %s in use elsewhere), reconnecting as %s", s.LocalAddr().Resourcepart(), c.target.resource)
+		return true
+	default:
+		log.Printf("stream error %s", se.Err)
+		return false
+	}
+}
+
+// replaces the current session by a new one without a gap in the delivery,
+// e.g. to authenticate with a new credential: the new session is established
+// next to the old one (as another resource, so they don't conflict), the sends
+// are held back while switching over and the old session is closed once its
+// sends are done. The old session is kept if the new one can't be established.
+func (c *xmppClient) migrate() error {
+	c.mu.Lock()
+	old := c.session
+	if old == nil || c.closed {
+		c.mu.Unlock()
+		return errNotConnected
+	}
+	resource := c.target.resource
+	if resource == "" {
+		resource = old.LocalAddr().Resourcepart()
+	}
+	target := dialTarget{resource: regenerateResource(resource)}
+	c.mu.Unlock()
+
+	// the session is only returned once it's authenticated
+	s, err := c.dial(target)
+	if err != nil {
+		sessionMigrations.inc("error")
+		return err
+	}
+	c.switching.Lock()
+	c.mu.Lock()
+	if c.closed || c.session != old {
+		// closed or lost meanwhile, serve reconnects on its own
+		c.mu.Unlock()
+		c.switching.Unlock()
+		closeXMPP(s)
+		sessionMigrations.inc("error")
+		return errNotConnected
+	}
+	c.session = s
+	c.target = target
+	c.mu.Unlock()
+	closeXMPP(old)
+	// the rooms are joined once the old session left them
+	err = c.onConnect(s)
+	c.switching.Unlock()
+	if err != nil {
+		// serve reconnects
+		closeXMPP(s)
+		sessionMigrations.inc("error")
+		return err
+	}
+	sessionMigrations.inc("ok")
+	log.Printf("moved the xmpp session to resource %s", s.LocalAddr().Resourcepart())
+	return nil
+}
+
+// reloads the xmpp password, returns true if it changed
+func reloadPassword(password *rotatingSecret) bool {
+	changed, err := password.reload()
+	switch {
+	case err != nil:
+		log.Printf("failed to reload the xmpp password: %s", err)
+	case !changed:
+		log.Printf("xmpp password unchanged, not reconnecting")
+	}
+	return changed
+}
+
+// moves the client and the sessions of the pool (nil if there is none) to new
+// sessions, e.g. to use reloaded settings; the ones that fail keep their
+// current session
+func migrateSessions(main *xmppClient, pool *sessionPool, reason string) {
+	clients := []*xmppClient{main}
+	if pool != nil {
+		clients = pool.clients
+	}
+	log.Printf("%s, moving %d session(s) to new connections", reason, len(clients))
+	for _, c := range clients {
+		switch err := c.migrate(); {
+		case err == errNotConnected:
+			log.Printf("xmpp session not connected, it uses the new settings when it reconnects")
+		case err != nil:
+			log.Printf("failed to establish a new xmpp session, keeping the current one: %s", err)
+		}
+	}
+}
+
+// reports the change of the connection state
+func (c *xmppClient) stateChanged(e connectionEvent) {
+	if c.onStateChange != nil {
+		c.onStateChange(e)
+	}
+}
+
+// tries to reconnect with an exponential, jittered backoff, returns the
+// number of attempts (0 if the client was closed); the first attempt isn't
+// delayed if immediate is set
+func (c *xmppClient) reconnect(immediate bool) int {
+	start := time.Now()
+	c.stateChanged(connectionEvent{state: stateReconnecting, at: start})
+	delay := reconnectMinDelay
+	jitter := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for attempt := 1; ; attempt++ {
+		reconnectAttempts.set(float64(attempt))
+		if attempt > 1 || !immediate {
+			// sleep between half and the full delay, so not all instances reconnect at once
+			time.Sleep(delay/2 + time.Duration(jitter.Int63n(int64(delay/2)+1)))
+		}
+		err := c.connect()
+		if err == nil {
+			reconnectAttempts.set(0)
+			log.Printf("reconnected after %d attempt(s)", attempt)
+			c.stateChanged(connectionEvent{state: stateConnected, at: time.Now(), attempts: attempt, took: time.Since(start)})
+			return attempt
+		}
+		if err == errClosed {
+			return 0
+		}
+		bridgeError.set(err)
+		log.Printf("reconnect attempt %d failed: %s", attempt, err)
+		c.mu.Lock()
+		if c.target.server != "" {
+			log.Printf("falling back to the configured server")
+			c.target.server = ""
+		}
+		c.mu.Unlock()
+		if c.maxReconnectDuration > 0 && time.Since(start) > c.maxReconnectDuration {
+			log.Fatalf("giving up reconnecting after %s", time.Since(start).Round(time.Second))
+		}
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// encodes v on the current session, fails if it takes longer than the send
+// timeout; waits for the send interval since the last send
+func (c *xmppClient) send(ctx context.Context, v interface{}) error {
+	if c.current() == nil {
+		return errNotConnected
+	}
+	if c.sendInterval > 0 {
+		// the wait doesn't count towards the send timeout
+		c.sendMu.Lock()
+		defer c.sendMu.Unlock()
+		if wait := time.Until(c.lastSend.Add(c.sendInterval)); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		c.lastSend = time.Now()
+	}
+	// neither does waiting for a free slot
+	if c.sends != nil {
+		select {
+		case c.sends <- struct{}{}:
+			defer func() { <-c.sends }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	sendsInFlight.add(1)
+	defer sendsInFlight.add(-1)
+	if c.sendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.sendTimeout)
+		defer cancel()
+	}
+	// the session might have been migrated while waiting
+	c.switching.RLock()
+	defer c.switching.RUnlock()
+	s := c.current()
+	if s == nil {
+		return errNotConnected
+	}
+	return s.Encode(ctx, v)
+}
+
+// sends the iq on the current session and decodes the response into v, error
+// responses fail
+func (c *xmppClient) iq(ctx context.Context, iq stanza.IQ, payload interface{}, v interface{}) error {
+	s := c.current()
+	if s == nil {
+		return errNotConnected
+	}
+	timeout := c.sendTimeout
+	if timeout <= 0 {
+		timeout = defaultIQTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	r, err := s.EncodeIQElement(ctx, payload, iq)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// the reader starts with the iq element, copy its payload to decode it with
+	// the caller's struct (the response may also be an error)
+	d := xml.NewTokenDecoder(r)
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	start, ok := tok.(xml.StartElement)
+	if !ok {
+		return errors.New("unexpected iq response")
+	}
+	var inner bytes.Buffer
+	e := xml.NewEncoder(&inner)
+	if _, err := xmlstream.Copy(e, xmlstream.Inner(d)); err != nil {
+		return err
+	}
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	var resp struct {
+		Error *stanza.Error `xml:"error"`
+	}
+	body := append(append([]byte("<iq>"), inner.Bytes()...), "</iq>"...)
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	for _, a := range start.Attr {
+		if a.Name.Local == "type" && a.Value == string(stanza.ErrorIQ) {
+			if resp.Error != nil {
+				return resp.Error
+			}
+			return errors.New("error response")
+		}
+	}
+	return xml.Unmarshal(body, v)
+}
+
+// closes the current session for good
+func (c *xmppClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.session != nil {
+		closeXMPP(c.session)
+		c.session = nil
+	}
+}
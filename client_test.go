@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+	"mellium.im/xmpp/stream"
+)
+
+// server end of an in-memory session, records everything the client sends
+type fakeConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+	sent bytes.Buffer
+}
+
+func (c *fakeConn) received() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sent.String()
+}
+
+// stands in for the xmpp server, every dial returns a new in-memory session
+type fakeServer struct {
+	// time the server takes per read, e.g. to simulate its rate limit
+	readDelay time.Duration
+
+	mu    sync.Mutex
+	conns []*fakeConn
+}
+
+func (f *fakeServer) dial(dialTarget) (*xmpp.Session, error) {
+	client, server := net.Pipe()
+	c := &fakeConn{conn: server}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			time.Sleep(f.readDelay)
+			n, err := server.Read(buf)
+			c.mu.Lock()
+			c.sent.Write(buf[:n])
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	f.mu.Lock()
+	f.conns = append(f.conns, c)
+	f.mu.Unlock()
+	// the stream is taken as negotiated, only stanzas go over the wire
+	negotiate := func(context.Context, *stream.Info, *stream.Info, *xmpp.Session, interface{}) (xmpp.SessionState, io.ReadWriter, interface{}, error) {
+		return xmpp.Ready, nil, nil, nil
+	}
+	return xmpp.NewSession(context.Background(), jid.MustParse("example.net"), jid.MustParse("bot@example.net/webhook"), client, 0, negotiate)
+}
+
+// returns the connection established by the nth dial, waits for it
+func (f *fakeServer) conn(t *testing.T, n int) *fakeConn {
+	t.Helper()
+	var c *fakeConn
+	waitFor(t, fmt.Sprintf("connection %d", n+1), func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.conns) > n {
+			c = f.conns[n]
+		}
+		return c != nil
+	})
+	return c
+}
+
+// polls the condition until it's true or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// returns the status code of the health check
+func healthStatus(status *statusHandler) int {
+	w := httptest.NewRecorder()
+	status.health(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	return w.Code
+}
+
+func TestReconnect(t *testing.T) {
+	server := &fakeServer{}
+	address := jid.MustParse("bot@example.net")
+	ops := room{jid: jid.MustParse("ops@conference.example.net")}
+	presence := newPresenceTracker()
+	setup := sessionSetup{presence: presence, address: address, nick: "bot", rooms: []room{ops}}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, setup.run, handler)
+	defer client.close()
+	status := &statusHandler{client: client}
+
+	if code := healthStatus(status); code != http.StatusServiceUnavailable {
+		t.Errorf("health before connecting: got %d, want 503", code)
+	}
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	first := server.conn(t, 0)
+	waitFor(t, "initial presence and room join", func() bool {
+		return strings.Contains(first.received(), "<presence") && strings.Contains(first.received(), `to="ops@conference.example.net/bot"`)
+	})
+	if code := healthStatus(status); code != http.StatusOK {
+		t.Errorf("health while connected: got %d, want 200", code)
+	}
+
+	buffer, err := newMessageBuffer(10, "drop-oldest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dispatcher{client: client, presence: presence, from: address, buffer: buffer}
+	messages := make(chan alertMessage)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.run(ctx, messages)
+
+	// the server drops the session
+	_ = first.conn.Close()
+	waitFor(t, "the session to be lost", func() bool { return client.current() == nil })
+	if code := healthStatus(status); code != http.StatusServiceUnavailable {
+		t.Errorf("health while disconnected: got %d, want 503", code)
+	}
+	messages <- alertMessage{id: "buffered", body: "disk full", recipients: []jid.JID{jid.MustParse("alice@example.net")}}
+
+	// presence, rooms and the buffered message on the new session
+	second := server.conn(t, 1)
+	waitFor(t, "the buffered message", func() bool { return strings.Contains(second.received(), "disk full") })
+	received := second.received()
+	if !strings.Contains(received, "<presence") {
+		t.Errorf("initial presence wasn't sent again: %s", received)
+	}
+	if !strings.Contains(received, `to="ops@conference.example.net/bot"`) {
+		t.Errorf("room wasn't joined again: %s", received)
+	}
+	if strings.Index(received, "disk full") < strings.Index(received, `to="ops@conference.example.net/bot"`) {
+		t.Errorf("buffered message was sent before joining the rooms: %s", received)
+	}
+	if n := len(buffer.flush()); n != 0 {
+		t.Errorf("%d messages left in the buffer", n)
+	}
+	if code := healthStatus(status); code != http.StatusOK {
+		t.Errorf("health after reconnecting: got %d, want 200", code)
+	}
+}
+
+func TestSendLimit(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+	client.sends = make(chan struct{}, 2)
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	conn := server.conn(t, 0)
+	alice := jid.MustParse("alice@example.net")
+
+	// both slots are taken by other sends
+	client.sends <- struct{}{}
+	client.sends <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.send(ctx, MessageBody{Message: stanza.Message{To: alice, Type: stanza.ChatMessage}, Body: "waiting"})
+	if err != context.DeadlineExceeded {
+		t.Errorf("send without a free slot: got %v", err)
+	}
+	if n := sendsInFlight.sum(); n != 0 {
+		t.Errorf("%v sends in flight, want 0", n)
+	}
+
+	<-client.sends
+	if err := client.send(context.Background(), MessageBody{Message: stanza.Message{To: alice, Type: stanza.ChatMessage}, Body: "sent"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the message", func() bool { return strings.Contains(conn.received(), "sent") })
+	if strings.Contains(conn.received(), "waiting") {
+		t.Error("message was sent without a free slot")
+	}
+	if len(client.sends) != 1 {
+		t.Errorf("%d slots taken after the send, want 1", len(client.sends))
+	}
+}
+
+func TestRotatePassword(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	password := &rotatingSecret{name: "XMPP_PASS", value: "old"}
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	server.conn(t, 0)
+
+	// without the file the password can't change
+	if _, err := password.reload(); err == nil {
+		t.Error("reloading without XMPP_PASS_FILE didn't fail")
+	}
+
+	file := filepath.Join(t.TempDir(), "pass")
+	if err := ioutil.WriteFile(file, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	password.path = file
+	if reloadPassword(password) {
+		t.Error("unchanged password was reported as changed")
+	}
+
+	if err := ioutil.WriteFile(file, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !reloadPassword(password) || password.get() != "new" {
+		t.Errorf("got password %q", password.get())
+	}
+	// moved to a new session right away, without the backoff
+	migrateSessions(client, nil, "xmpp password changed")
+	server.conn(t, 1)
+	if client.current() == nil {
+		t.Error("no session after the migration")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	var setups int32
+	var fail atomic.Value
+	fail.Store(false)
+	dial := func(target dialTarget) (*xmpp.Session, error) {
+		if fail.Load().(bool) {
+			return nil, errors.New("not authorized")
+		}
+		return server.dial(target)
+	}
+	client := newXMPPClient(dial, func(*xmpp.Session) error { atomic.AddInt32(&setups, 1); return nil }, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	server.conn(t, 0)
+	old := client.current()
+
+	if err := client.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	s := client.current()
+	if s == old || s == nil {
+		t.Fatal("session wasn't replaced")
+	}
+	// the new session is set up as another resource, the old one is closed
+	if atomic.LoadInt32(&setups) != 2 {
+		t.Errorf("new session was set up %d time(s)", atomic.LoadInt32(&setups)-1)
+	}
+	client.mu.Lock()
+	resource := client.target.resource
+	client.mu.Unlock()
+	if !strings.HasPrefix(resource, "webhook-") {
+		t.Errorf("new session as resource %q", resource)
+	}
+	waitFor(t, "the end of the old stream", func() bool { return strings.Contains(server.conn(t, 0).received(), "</stream:stream>") })
+
+	// served and used for sending, without reconnecting
+	alice := jid.MustParse("alice@example.net")
+	if err := client.send(context.Background(), MessageBody{Message: stanza.Message{To: alice, Type: stanza.ChatMessage}, Body: "after the migration"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the message", func() bool { return strings.Contains(server.conn(t, 1).received(), "after the migration") })
+	time.Sleep(50 * time.Millisecond)
+	if client.current() != s {
+		t.Error("client reconnected after the migration")
+	}
+
+	// a session that can't be established keeps the current one
+	fail.Store(true)
+	if err := client.migrate(); err == nil {
+		t.Error("migration didn't fail")
+	}
+	if client.current() != s {
+		t.Error("failed migration replaced the session")
+	}
+}
+
+func TestDirectedPresence(t *testing.T) {
+	server := &fakeServer{}
+	recipients := []jid.JID{jid.MustParse("alice@example.net/phone"), jid.MustParse("bob@example.net")}
+	setup := sessionSetup{presence: newPresenceTracker(), address: jid.MustParse("bot@example.net"), directed: true, recipients: recipients}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, setup.run, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	conn := server.conn(t, 0)
+	waitFor(t, "the directed presence", func() bool { return strings.Count(conn.received(), "<presence") == 2 })
+	received := conn.received()
+	if !strings.Contains(received, `to="alice@example.net"`) || !strings.Contains(received, `to="bob@example.net"`) {
+		t.Errorf("presence wasn't directed to the bare recipients: %s", received)
+	}
+	if strings.Count(received, "<presence") != strings.Count(received, `<presence xmlns="jabber:client" to=`) {
+		t.Errorf("presence was broadcast: %s", received)
+	}
+}
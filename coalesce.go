@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var coalescedMessages = newCounter("xmpp_coalesced_messages_total", "Repeated messages counted instead of sent.", "endpoint")
+
+// correction of an earlier message (XEP-0308)
+type messageReplace struct {
+	ID string `xml:"id,attr"`
+}
+
+// a message that was sent and its repeats since
+type coalescedMessage struct {
+	first    alertMessage
+	expires  time.Time
+	seen     int // incl. the first one
+	reported int // seen as of the last rollup
+}
+
+// counts identical messages of an endpoint within a window instead of sending
+// every copy, the count is sent in periodic rollups
+type coalescer struct {
+	window   time.Duration
+	interval time.Duration // between the rollups
+	correct  bool          // correct the first message instead of a follow-up (XEP-0308)
+	now      func() time.Time
+
+	mu       sync.Mutex
+	messages map[string]*coalescedMessage // by endpoint and body
+}
+
+func newCoalescer(window time.Duration, interval time.Duration, correct bool) *coalescer {
+	return &coalescer{window: window, interval: interval, correct: correct, now: time.Now, messages: make(map[string]*coalescedMessage)}
+}
+
+// returns the number of times the message was seen within the window, 1 for a
+// new message that has to be sent and more for repeats that aren't sent
+func (c *coalescer) seen(m alertMessage) int {
+	key := m.endpoint + "\xff" + m.body
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.messages[key]; ok && now.Before(s.expires) {
+		s.seen++
+		coalescedMessages.inc(m.source)
+		return s.seen
+	}
+	c.messages[key] = &coalescedMessage{first: m, expires: now.Add(c.window), seen: 1, reported: 1}
+	return 1
+}
+
+// returns the rollups of the messages repeated since the last one, forgets
+// the messages whose window is over
+func (c *coalescer) rollups() []alertMessage {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var rollups []alertMessage
+	for key, s := range c.messages {
+		if s.seen > s.reported {
+			rollups = append(rollups, c.rollup(s))
+			s.reported = s.seen
+		}
+		if !now.Before(s.expires) {
+			delete(c.messages, key)
+		}
+	}
+	return rollups
+}
+
+// returns the rollup of the message: the first one with the count, as a
+// reply to or a correction of it
+func (c *coalescer) rollup(s *coalescedMessage) alertMessage {
+	m := s.first
+	m.id = newMessageID()
+	m.created = c.now()
+	m.body = fmt.Sprintf("%s\n(seen %d times)", s.first.body, s.seen)
+	translations := make(map[string]string)
+	for lang, t := range s.first.translations {
+		translations[lang] = fmt.Sprintf("%s\n(seen %d times)", t, s.seen)
+	}
+	m.translations = translations
+	// the first one got the attention already
+	m.attention = false
+	m.image = ""
+	if c.correct {
+		m.replaces = s.first.id
+	} else {
+		m.replyTo = s.first.id
+	}
+	return m
+}
+
+// periodically passes the rollups to the xmpp client until stop is closed
+func (c *coalescer) run(messages chan<- alertMessage, stop <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, m := range c.rollups() {
+				messages <- m
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mellium.im/xmpp/stanza"
+)
+
+// returns a coalescer with a clock that is moved by the returned func
+func testCoalescer(correct bool) (*coalescer, func(time.Duration)) {
+	c := newCoalescer(10*time.Minute, time.Minute, correct)
+	now := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCoalescer(t *testing.T) {
+	c, advance := testCoalescer(false)
+	disk := alertMessage{id: "m1", endpoint: "grafana", body: "[FIRING] disk full", translations: map[string]string{"de": "[FIRING] Platte voll"}, attention: true}
+
+	if n := c.seen(disk); n != 1 {
+		t.Fatalf("first message seen %d times", n)
+	}
+	other := disk
+	other.endpoint = "alertmanager"
+	if n := c.seen(other); n != 1 {
+		t.Error("message of another endpoint coalesced")
+	}
+	for i := 2; i <= 5; i++ {
+		repeat := disk
+		repeat.id = fmt.Sprintf("m%d", i)
+		if n := c.seen(repeat); n != i {
+			t.Errorf("repeat seen %d times, want %d", n, i)
+		}
+	}
+
+	rollups := c.rollups()
+	if len(rollups) != 1 {
+		t.Fatalf("%d rollups, want 1", len(rollups))
+	}
+	r := rollups[0]
+	if r.body != "[FIRING] disk full\n(seen 5 times)" || r.translations["de"] != "[FIRING] Platte voll\n(seen 5 times)" {
+		t.Errorf("rollup %q, %v", r.body, r.translations)
+	}
+	if r.replyTo != "m1" || r.replaces != "" || r.attention || r.id == "m1" {
+		t.Errorf("rollup replies to %q, replaces %q, attention %v, id %s", r.replyTo, r.replaces, r.attention, r.id)
+	}
+
+	// nothing new, no rollup
+	advance(time.Minute)
+	if rollups := c.rollups(); len(rollups) != 0 {
+		t.Errorf("%d rollups without repeats", len(rollups))
+	}
+
+	// a last repeat before the window ends, the rollup forgets the message
+	c.seen(disk)
+	advance(9 * time.Minute)
+	if rollups := c.rollups(); len(rollups) != 1 || !strings.HasSuffix(rollups[0].body, "(seen 6 times)") {
+		t.Errorf("final rollups %v", rollups)
+	}
+	if n := c.seen(disk); n != 1 {
+		t.Errorf("message after the window seen %d times", n)
+	}
+}
+
+func TestCoalescerCorrect(t *testing.T) {
+	c, _ := testCoalescer(true)
+	m := alertMessage{id: "m1", endpoint: "grafana", body: "disk full"}
+	c.seen(m)
+	c.seen(m)
+	rollups := c.rollups()
+	if len(rollups) != 1 || rollups[0].replaces != "m1" || rollups[0].replyTo != "" {
+		t.Fatalf("rollups %+v", rollups)
+	}
+
+	b, err := xml.Marshal(MessageBody{Message: stanza.Message{ID: "m2", Type: stanza.ChatMessage}, Body: rollups[0].body, Replace: &messageReplace{ID: rollups[0].replaces}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `<replace xmlns="urn:xmpp:message-correct:0" id="m1"></replace>`) {
+		t.Errorf("correction %s", b)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// reply modes for incoming chat messages
+const (
+	replyOff      = "off"
+	replyEcho     = "echo"
+	replyCommands = "commands"
+)
+
+// command that can be sent to the bot in the commands reply mode
+type chatCommand struct {
+	help string
+	run  func(args string) string
+}
+
+var chatCommands = map[string]chatCommand{
+	"ping": {
+		help: "check if the bot is alive",
+		run: func(string) string {
+			return "pong"
+		},
+	},
+	"version": {
+		help: "show the running version",
+		run: func(string) string {
+			return versionString()
+		},
+	},
+}
+
+// runs the command in the message body and returns the reply
+func runChatCommand(body string) string {
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		return ""
+	}
+	name := strings.ToLower(fields[0])
+	args := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(body), fields[0]))
+
+	if name == "help" {
+		return "available commands:" + chatCommandHelp()
+	}
+	command, ok := chatCommands[name]
+	if !ok {
+		return "unknown command, try: " + chatCommandHelp()
+	}
+	return command.run(args)
+}
+
+// returns the list of available commands
+func chatCommandHelp() string {
+	var names []string
+	for name, command := range chatCommands {
+		names = append(names, name+" - "+command.help)
+	}
+	sort.Strings(names)
+	return "\n" + strings.Join(names, "\n")
+}
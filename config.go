@@ -0,0 +1,1363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"golang.org/x/net/proxy"
+	"mellium.im/sasl"
+	"mellium.im/xmpp/jid"
+)
+
+// replaces the secrets in the printed configuration
+const redacted = "<redacted>"
+
+// configuration in effect after applying the defaults, loaded once from the
+// env and used for wiring as well as printed by --print-config
+type config struct {
+	XMPP       xmppConfig       `json:"xmpp"`
+	HTTP       httpConfig       `json:"http"`
+	Recipients recipientsConfig `json:"recipients"`
+	Messages   messagesConfig   `json:"messages"`
+	Endpoints  endpointsConfig  `json:"endpoints"`
+}
+
+type xmppConfig struct {
+	ID                       account       `json:"id"`
+	Password                 secret        `json:"password"`
+	PasswordFile             string        `json:"password_file"` // the password is read from the file, it can be rotated
+	Server                   string        `json:"server"`        // host:port, empty if looked up via srv records
+	DialNetwork              string        `json:"dial_network"`  // tcp, tcp4 or tcp6
+	DirectTLS                bool          `json:"direct_tls"`
+	RequireTLS               bool          `json:"require_tls"`
+	SkipVerify               bool          `json:"skip_verify"`
+	TLSServerName            string        `json:"tls_server_name"` // verified instead of the jid's domain if set
+	CAFile                   string        `json:"ca_file"`         // verified with instead of the system certificates if set
+	Proxy                    xmppProxyURL  `json:"proxy"`
+	WebSocketURL             secretURL     `json:"websocket_url"` // connects over websocket instead of tcp if set
+	SASLMechanisms           mechanismList `json:"sasl_mechanisms"`
+	ResourceMode             string        `json:"resource_mode"`
+	InitialPresence          string        `json:"initial_presence"` // broadcast or directed
+	Lang                     string        `json:"lang"`
+	SendTimeout              duration      `json:"send_timeout"`
+	Sessions                 int           `json:"sessions"`
+	SendRate                 int           `json:"send_rate"`            // stanzas per second and session, 0 is unlimited
+	MaxConcurrentSends       int           `json:"max_concurrent_sends"` // of all sessions, 0 is unlimited
+	SendSpread               duration      `json:"send_spread"`          // window the sends of a message are spread over, 0 disables it
+	SendSpreadMin            int           `json:"send_spread_min"`      // recipients from which on the sends are spread
+	ReconnectMaxDuration     duration      `json:"reconnect_max_duration"`
+	ConnectionNotify         jidList       `json:"connection_notify"`
+	ConnectionNotifyInterval duration      `json:"connection_notify_interval"`
+	ReplyMode                string        `json:"reply_mode"`
+	RelayURL                 secretURL     `json:"relay_url"`
+	RelayToken               secret        `json:"relay_token"`
+	Acks                     bool          `json:"acks"`
+	AckWebhookURL            secretURL     `json:"ack_webhook_url"`
+	AckWebhookToken          secret        `json:"ack_webhook_token"`
+	// how long the notifications of an acknowledged alert are de-escalated
+	// (0 disables it), how and with which delivery profile
+	AckDeescalateWindow  duration `json:"ack_deescalate_window"`
+	AckDeescalate        string   `json:"ack_deescalate"`
+	AckDeescalateProfile string   `json:"ack_deescalate_profile"`
+	ackDeescalateProfile *DeliveryProfile
+	HeartbeatInterval    duration `json:"heartbeat_interval"` // 0 disables the heartbeats
+	HeartbeatRecipient   string   `json:"heartbeat_recipient"`
+	HeartbeatMessage     string   `json:"heartbeat_message"`
+	heartbeatMessage     *template.Template
+	UploadImages         bool   `json:"upload_images"`
+	UploadService        string `json:"upload_service"`  // discovered if empty
+	UploadMaxSize        int    `json:"upload_max_size"` // MiB
+}
+
+type httpConfig struct {
+	ListenAddress        string   `json:"listen_address"`
+	TLSCert              string   `json:"tls_cert"`
+	TLSKey               string   `json:"tls_key"`
+	H2C                  bool     `json:"h2c"`
+	IdleTimeout          duration `json:"idle_timeout"`
+	KeepAlive            bool     `json:"keep_alive"`
+	MaxConcurrentStreams uint32   `json:"max_concurrent_streams"`
+	ShutdownTimeout      duration `json:"shutdown_timeout"`
+	ClientTimeout        duration `json:"client_timeout"`
+	AdminToken           secret   `json:"admin_token"`
+	Middlewares          []string `json:"middlewares"`
+	EnforceContentType   bool     `json:"enforce_content_type"`
+	MaxConcurrentParses  int      `json:"max_concurrent_parses"`
+	RetryAfter           duration `json:"retry_after"`
+	RequestTimeout       duration `json:"request_timeout"` // 0 is unlimited
+	IdempotencyTTL       duration `json:"idempotency_ttl"`
+}
+
+type recipientsConfig struct {
+	Recipients     jidList   `json:"recipients"`
+	Rooms          roomList  `json:"rooms"` // room jid -> password
+	RoomNick       string    `json:"room_nick"`
+	Routes         routeList `json:"routes"`
+	DedupeBare     bool      `json:"dedupe_bare"`
+	AllowedDomains []string  `json:"allowed_domains"` // nil allows all
+	Max            int       `json:"max"`
+	MaxPolicy      string    `json:"max_policy"`
+	// endpoints whose requests may set their own recipients (* for all), the
+	// others answer ?recipients= with 403 if rejected, otherwise ignore it
+	Override       endpointSet `json:"override"`
+	OverrideReject bool        `json:"override_reject"`
+	// consecutive bounces that pause the delivery to a recipient, and for how long (0 disables it)
+	CircuitFailures int      `json:"circuit_failures"`
+	CircuitCooldown duration `json:"circuit_cooldown"`
+	RosterCheck     string   `json:"roster_check"` // warn or subscribe, disabled if empty
+	// whose subscription requests are approved, nobody's if empty
+	SubscriptionApprove []string `json:"subscription_approve"`
+	// formats of the messages per recipient (or room) by bare jid
+	Formats map[string]string `json:"formats"`
+}
+
+type messagesConfig struct {
+	MaxLength         int               `json:"max_length"`
+	LengthPolicy      string            `json:"length_policy"`
+	Timestamp         string            `json:"timestamp"`
+	TimestampPosition string            `json:"timestamp_position"`
+	Timezone          timezone          `json:"timezone"`
+	StatusPrefixes    map[string]string `json:"status_prefixes"`
+	customPrefixes    map[string]bool   // prefixes set explicitly, shown even if the body tells the status
+	Prefix            string            `json:"prefix"` // template before the messages, optional
+	Suffix            string            `json:"suffix"` // template after the messages, optional
+	TrackResolved     bool              `json:"track_resolved"`
+	BufferSize        int               `json:"buffer_size"`
+	BufferOverflow    string            `json:"buffer_overflow"`
+	QuietHoursPolicy  string            `json:"quiet_hours_policy"`
+	CoalesceWindow    duration          `json:"coalesce_window"`
+	CoalesceInterval  duration          `json:"coalesce_interval"` // between the rollups
+	CoalesceMode      string            `json:"coalesce_mode"`
+	TTL               duration          `json:"ttl"` // 0 never expires
+	// max. time messages can be scheduled ahead (deliver_at), 0 disables scheduling
+	ScheduleMaxAhead  duration `json:"schedule_max_ahead"`
+	AttentionCritical bool     `json:"attention_critical"`
+	DebugBodies       int      `json:"debug_bodies"`
+	DebugRecent       int      `json:"debug_recent"` // 0 disables it
+	Debug             bool     `json:"debug"`
+	Extensions        string   `json:"extensions"`
+	// recipients told about requests that can't be parsed, disabled if empty
+	DeadLetterRecipients jidList  `json:"dead_letter_recipients"`
+	DeadLetterBody       bool     `json:"dead_letter_body"`
+	DeadLetterInterval   duration `json:"dead_letter_interval"`
+	// max. number of messages of an endpoint within the window before it's
+	// paused for the cooldown, disabled if 0
+	FloodLimit      int      `json:"flood_limit"`
+	FloodWindow     duration `json:"flood_window"`
+	FloodCooldown   duration `json:"flood_cooldown"`
+	FloodRecipients jidList  `json:"flood_recipients"`
+	// file every sent message is appended to, disabled if empty
+	AuditLog     string `json:"audit_log"`
+	AuditLogBody bool   `json:"audit_log_body"` // the whole body instead of its hash only
+	Format       string `json:"format"`         // styling, plain or xhtml
+	// send the messages with their whitespace as parsed, not tidied
+	KeepWhitespace bool `json:"keep_whitespace"`
+}
+
+type endpointsConfig struct {
+	Types                map[string]string               `json:"types"`  // served endpoints and their parser type, nil for all built-in ones
+	Tokens               map[string]secret               `json:"tokens"` // as in the env var names
+	Templates            map[string]*parser.TemplateFile `json:"templates"`
+	Methods              map[string][]string             `json:"methods"`
+	DefaultSeverity      map[string]string               `json:"default_severity"`
+	SeverityFields       map[string]string               `json:"severity_fields"`
+	RecipientsFields     map[string]string               `json:"recipients_fields"`
+	Sources              map[string]string               `json:"sources"`
+	Nicks                map[string]string               `json:"nicks"`
+	QuietHours           map[string]*quietHours          `json:"quiet_hours"`
+	Attention            endpointSet                     `json:"attention"`
+	OnlineOnly           endpointSet                     `json:"online_only"`
+	Threads              endpointSet                     `json:"threads"`
+	StripHTML            endpointSet                     `json:"strip_html"`
+	Coalesce             endpointSet                     `json:"coalesce"`
+	SyncDelivery         endpointSet                     `json:"sync_delivery"`
+	SyncDeliveryTimeout  duration                        `json:"sync_delivery_timeout"`
+	Timeouts             map[string]duration             `json:"timeouts"` // as in the env var names
+	TTLs                 map[string]duration             `json:"ttls"`     // as in the env var names
+	Delivery             map[string]*DeliveryProfile     `json:"delivery"`
+	SuppressResolved     endpointSet                     `json:"suppress_resolved"` // as in the env var names
+	Extensions           map[string]string               `json:"extensions"`        // as in the env var names
+	Transforms           map[string]*transform           `json:"transforms"`        // as in the env var names
+	Response             string                          `json:"response"`
+	Responses            map[string]string               `json:"responses"` // as in the env var names
+	Prefixes             map[string]string               `json:"prefixes"`  // as in the env var names
+	Suffixes             map[string]string               `json:"suffixes"`  // as in the env var names
+	Command              string                          `json:"command"`
+	CommandTimeout       duration                        `json:"command_timeout"`
+	CommandMaxMemory     int64                           `json:"command_max_memory"` // MiB, 0 is unlimited
+	TwilioAuthToken      secret                          `json:"twilio_auth_token"`
+	TailscaleSecret      secret                          `json:"tailscale_secret"`
+	ShopifySecret        secret                          `json:"shopify_secret"`
+	WooCommerceSecret    secret                          `json:"woocommerce_secret"`
+	CloudflareSecret     secret                          `json:"cloudflare_secret"`
+	SystemdLogLines      int                             `json:"systemd_log_lines"`
+	CertExpiryThresholds parser.CertExpiryThresholds     `json:"certexpiry_thresholds"`
+	GrafanaURL           string                          `json:"grafana_url"`
+	GrafanaImageToken    secret                          `json:"grafana_image_token"`
+	GrafanaImageHeader   string                          `json:"grafana_image_header"`
+	AlertmanagerTemplate *parser.TemplateFile            `json:"alertmanager_template"`
+	JSONMapping          parser.FieldMapping             `json:"json_mapping"`
+	LinesFields          []string                        `json:"lines_fields"`
+	LinesDelimiter       delimiter                       `json:"lines_delimiter"`
+	LinesMode            string                          `json:"lines_mode"`
+
+	// parsed response templates by env var suffix, "" for all endpoints
+	responses map[string]*template.Template
+	// parsed prefix and suffix templates, "" for the ones of all endpoints
+	prefixes map[string]*template.Template
+	suffixes map[string]*template.Template
+}
+
+// reads the configuration from the env, exits on invalid settings; the
+// recipients are optional in check mode
+func loadConfig(check bool) config {
+	var c config
+
+	// get xmpp credentials, message recipients
+	xi := os.Getenv("XMPP_ID")
+	c.XMPP.Password = secret(getSecret("XMPP_PASS"))
+	c.XMPP.PasswordFile = os.Getenv("XMPP_PASS_FILE")
+	xr := os.Getenv("XMPP_RECIPIENTS")
+	xrooms := os.Getenv("XMPP_ROOMS")
+
+	// check if xmpp credentials and recipient list are supplied
+	if xi == "" || c.XMPP.Password == "" || (xr == "" && xrooms == "" && !check) {
+		log.Fatal("XMPP_ID, XMPP_PASS or XMPP_RECIPIENTS/XMPP_ROOMS not set")
+	}
+	myjid, err := jid.Parse(xi)
+	panicOnErr(err)
+	c.XMPP.ID = account{myjid}
+
+	// get tls settings from env
+	_, c.XMPP.SkipVerify = os.LookupEnv("XMPP_SKIP_VERIFY")
+	_, c.XMPP.DirectTLS = os.LookupEnv("XMPP_OVER_TLS")
+	// refuse unencrypted connections unless explicitly allowed
+	c.XMPP.RequireTLS = os.Getenv("XMPP_REQUIRE_TLS") != "0"
+	// get the name sent as sni and verified, instead of the jid's domain
+	c.XMPP.TLSServerName = os.Getenv("XMPP_TLS_SERVER_NAME")
+	if n := c.XMPP.TLSServerName; n != "" && (strings.ContainsAny(n, ":/@ ") || net.ParseIP(n) != nil) {
+		log.Fatal("XMPP_TLS_SERVER_NAME must be a host name, without scheme and port")
+	}
+	if c.XMPP.TLSServerName != "" && c.XMPP.SkipVerify {
+		log.Println("warning: XMPP_SKIP_VERIFY is set, XMPP_TLS_SERVER_NAME is only sent as sni and not verified")
+	}
+	// get the pem file of the ca certificates the server is verified with
+	c.XMPP.CAFile = os.Getenv("XMPP_CA_FILE")
+	if c.XMPP.CAFile != "" && c.XMPP.SkipVerify {
+		log.Println("warning: XMPP_SKIP_VERIFY is set, the certificates of XMPP_CA_FILE aren't used")
+	}
+
+	// get server if it shouldn't be looked up via the jid's domain
+	serverHost := os.Getenv("XMPP_SERVER_HOST")
+	serverPort := os.Getenv("XMPP_SERVER_PORT")
+	if serverHost != "" || serverPort != "" {
+		if serverHost == "" {
+			serverHost = myjid.Domainpart()
+		}
+		if serverPort == "" {
+			serverPort = "5222"
+			if c.XMPP.DirectTLS {
+				serverPort = "5223"
+			}
+		}
+		c.XMPP.Server = net.JoinHostPort(serverHost, serverPort)
+	}
+
+	// get the ip version of the connection, both by default
+	c.XMPP.DialNetwork = os.Getenv("XMPP_DIAL_NETWORK")
+	switch c.XMPP.DialNetwork {
+	case "":
+		c.XMPP.DialNetwork = "tcp"
+	case "tcp", "tcp4", "tcp6":
+	default:
+		log.Fatal("XMPP_DIAL_NETWORK must be tcp, tcp4 or tcp6")
+	}
+
+	// get the proxy the xmpp connection goes through (direct if unset)
+	c.XMPP.Proxy.dialer, c.XMPP.Proxy.url, err = xmppProxy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get the websocket endpoint of the server, replaces the tcp connection
+	if ws := os.Getenv("XMPP_WEBSOCKET_URL"); ws != "" {
+		u, err := parseWebSocketURL(ws, c.XMPP.RequireTLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if c.XMPP.Proxy.dialer != nil {
+			log.Fatal("XMPP_WEBSOCKET_URL can't be combined with XMPP_PROXY")
+		}
+		if c.XMPP.DirectTLS || c.XMPP.Server != "" || c.XMPP.DialNetwork != "tcp" {
+			log.Println("warning: XMPP_OVER_TLS, XMPP_SERVER_HOST, XMPP_SERVER_PORT and XMPP_DIAL_NETWORK are ignored with XMPP_WEBSOCKET_URL")
+		}
+		c.XMPP.WebSocketURL = secretURL(u.String())
+	}
+
+	// get the allowed sasl mechanisms, PLAIN only if explicitly enabled
+	xm := os.Getenv("XMPP_SASL_MECHANISMS")
+	if xm == "" {
+		xm = defaultSASLMechanisms
+	}
+	c.XMPP.SASLMechanisms, err = parseSASLMechanisms(xm)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get how recipients given as bare jid are addressed
+	c.XMPP.ResourceMode = os.Getenv("XMPP_RESOURCE_MODE")
+	switch c.XMPP.ResourceMode {
+	case "":
+		c.XMPP.ResourceMode = resourceBare
+	case resourceBare, resourceHighestPriority:
+	default:
+		log.Fatal("XMPP_RESOURCE_MODE must be " + resourceBare + " or " + resourceHighestPriority)
+	}
+	c.XMPP.Lang = os.Getenv("XMPP_LANG")
+
+	// get the max. time for sending a single message
+	c.XMPP.SendTimeout = parseDuration("XMPP_SEND_TIMEOUT", 10*time.Second)
+
+	// get the number of sessions the chat messages are spread over and their max. send rate
+	c.XMPP.Sessions = parsePositive("XMPP_SESSIONS", 1)
+	if c.XMPP.Sessions > maxSessions {
+		log.Fatalf("XMPP_SESSIONS must be at most %d", maxSessions)
+	}
+	if r := os.Getenv("XMPP_SEND_RATE"); r != "" {
+		c.XMPP.SendRate, err = strconv.Atoi(r)
+		if err != nil || c.XMPP.SendRate < 0 {
+			log.Fatal("XMPP_SEND_RATE must be a non-negative number")
+		}
+	}
+
+	// get the max. number of stanzas sent at the same time over all sessions
+	c.XMPP.MaxConcurrentSends = 4
+	if s := os.Getenv("XMPP_MAX_CONCURRENT_SENDS"); s != "" {
+		c.XMPP.MaxConcurrentSends, err = strconv.Atoi(s)
+		if err != nil || c.XMPP.MaxConcurrentSends < 0 {
+			log.Fatal("XMPP_MAX_CONCURRENT_SENDS must be a non-negative number")
+		}
+	}
+
+	// get the window the sends of a message to many recipients are spread over (disabled if unset)
+	c.XMPP.SendSpread = parseDuration("XMPP_SEND_SPREAD", 0)
+	c.XMPP.SendSpreadMin = parsePositive("XMPP_SEND_SPREAD_MIN_RECIPIENTS", 10)
+
+	// get the time after which reconnecting is given up (retry forever if unset)
+	c.XMPP.ReconnectMaxDuration = parseDuration("XMPP_RECONNECT_MAX_DURATION", 0)
+
+	// get the admins that are told about connection losses (disabled if unset)
+	c.XMPP.ConnectionNotify, err = parseRecipients(os.Getenv("XMPP_CONNECTION_NOTIFY"))
+	panicOnErr(err)
+	c.XMPP.ConnectionNotifyInterval = parseDuration("XMPP_CONNECTION_NOTIFY_INTERVAL", 10*time.Minute)
+
+	// get the behavior for incoming chat messages
+	c.XMPP.ReplyMode = os.Getenv("XMPP_REPLY_MODE")
+	if c.XMPP.ReplyMode == "" {
+		c.XMPP.ReplyMode = replyOff
+	}
+	if c.XMPP.ReplyMode != replyOff && c.XMPP.ReplyMode != replyEcho && c.XMPP.ReplyMode != replyCommands {
+		log.Fatal("XMPP_REPLY_MODE must be one of off, echo or commands")
+	}
+
+	// relay incoming chat messages from the recipients to an outbound webhook (disabled if unset)
+	if u := os.Getenv("XMPP_RELAY_URL"); u != "" {
+		c.XMPP.RelayURL = secretURL(u)
+		c.XMPP.RelayToken = secret(getSecret("XMPP_RELAY_TOKEN"))
+	}
+
+	// collect the acknowledgements of the sent messages, optionally forwarding them (disabled if unset)
+	_, c.XMPP.Acks = os.LookupEnv("XMPP_ACKS")
+	if u := os.Getenv("XMPP_ACK_WEBHOOK_URL"); u != "" {
+		c.XMPP.Acks = true
+		c.XMPP.AckWebhookURL = secretURL(u)
+		c.XMPP.AckWebhookToken = secret(getSecret("XMPP_ACK_WEBHOOK_TOKEN"))
+	}
+
+	// upload the images of alerts (XEP-0363), the service is discovered unless set
+	_, c.XMPP.UploadImages = os.LookupEnv("XMPP_UPLOAD_IMAGES")
+	c.XMPP.UploadService = os.Getenv("XMPP_UPLOAD_SERVICE")
+	if c.XMPP.UploadService != "" {
+		if _, err := jid.Parse(c.XMPP.UploadService); err != nil {
+			log.Fatal("XMPP_UPLOAD_SERVICE is not a valid jid")
+		}
+	}
+	c.XMPP.UploadMaxSize = parsePositive("XMPP_UPLOAD_MAX_SIZE", 5)
+
+	// get the heartbeats for a watchdog (disabled if unset)
+	c.XMPP.HeartbeatInterval = parseDuration("XMPP_HEARTBEAT_INTERVAL", 0)
+	c.XMPP.HeartbeatRecipient = os.Getenv("XMPP_HEARTBEAT_RECIPIENT")
+	if (c.XMPP.HeartbeatInterval > 0) != (c.XMPP.HeartbeatRecipient != "") {
+		log.Fatal("XMPP_HEARTBEAT_INTERVAL and XMPP_HEARTBEAT_RECIPIENT must be set together")
+	}
+	if c.XMPP.HeartbeatRecipient != "" {
+		if _, err := jid.Parse(c.XMPP.HeartbeatRecipient); err != nil {
+			log.Fatal("XMPP_HEARTBEAT_RECIPIENT is not a valid jid")
+		}
+	}
+	c.XMPP.HeartbeatMessage = os.Getenv("XMPP_HEARTBEAT_MESSAGE")
+	if c.XMPP.HeartbeatMessage == "" {
+		c.XMPP.HeartbeatMessage = defaultHeartbeatMessage
+	}
+	c.XMPP.heartbeatMessage, err = template.New("heartbeat").Parse(c.XMPP.HeartbeatMessage)
+	if err == nil {
+		err = c.XMPP.heartbeatMessage.Execute(ioutil.Discard, heartbeatData{Time: time.Now()})
+	}
+	if err != nil {
+		log.Fatal("XMPP_HEARTBEAT_MESSAGE: " + err.Error())
+	}
+
+	// get listen address
+	c.HTTP.ListenAddress = os.Getenv("XMPP_WEBHOOK_LISTEN_ADDRESS")
+	if len(c.HTTP.ListenAddress) == 0 {
+		c.HTTP.ListenAddress = ":4321"
+	}
+
+	// get the tuning of the http listener
+	c.HTTP.TLSCert = os.Getenv("XMPP_WEBHOOK_TLS_CERT")
+	c.HTTP.TLSKey = os.Getenv("XMPP_WEBHOOK_TLS_KEY")
+	if (c.HTTP.TLSCert == "") != (c.HTTP.TLSKey == "") {
+		log.Fatal("XMPP_WEBHOOK_TLS_CERT and XMPP_WEBHOOK_TLS_KEY must be set together")
+	}
+	_, c.HTTP.H2C = os.LookupEnv("XMPP_WEBHOOK_H2C")
+	// http.Server doesn't time out idle connections by default
+	c.HTTP.IdleTimeout = parseDuration("XMPP_WEBHOOK_IDLE_TIMEOUT", 2*time.Minute)
+	if c.HTTP.IdleTimeout < 0 {
+		log.Fatal("XMPP_WEBHOOK_IDLE_TIMEOUT is not a valid duration")
+	}
+	c.HTTP.KeepAlive = os.Getenv("XMPP_WEBHOOK_KEEPALIVE") != "0"
+	c.HTTP.MaxConcurrentStreams = 250
+	if n := os.Getenv("XMPP_WEBHOOK_MAX_CONCURRENT_STREAMS"); n != "" {
+		streams, err := strconv.ParseUint(n, 10, 32)
+		if err != nil || streams == 0 {
+			log.Fatal("XMPP_WEBHOOK_MAX_CONCURRENT_STREAMS must be a positive number")
+		}
+		c.HTTP.MaxConcurrentStreams = uint32(streams)
+	}
+
+	// get the max. time to wait for in-flight requests on shutdown
+	c.HTTP.ShutdownTimeout = parseDuration("XMPP_SHUTDOWN_TIMEOUT", 30*time.Second)
+
+	// get the timeout for outbound http requests
+	c.HTTP.ClientTimeout = parseDuration("XMPP_HTTP_CLIENT_TIMEOUT", defaultHTTPClientTimeout)
+
+	// get token for the admin features (disabled if unset)
+	c.HTTP.AdminToken = secret(getSecret("XMPP_WEBHOOK_ADMIN_TOKEN"))
+
+	// get the middlewares of the webhook endpoints, outermost first
+	c.HTTP.Middlewares, err = parseMiddlewares(os.Getenv("XMPP_MIDDLEWARES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// reject requests with unexpected content types
+	_, c.HTTP.EnforceContentType = os.LookupEnv("XMPP_ENFORCE_CONTENT_TYPE")
+
+	// get max. number of concurrent parses
+	c.HTTP.MaxConcurrentParses = parsePositive("XMPP_MAX_CONCURRENT_PARSES", 256)
+
+	// get the time senders should wait before retrying when the buffer is full
+	c.HTTP.RetryAfter = parseDuration("XMPP_RETRY_AFTER", 30*time.Second)
+	if c.HTTP.RetryAfter < duration(time.Second) {
+		log.Fatal("XMPP_RETRY_AFTER must be a duration of at least 1s")
+	}
+
+	// get how long requests may take until their messages are enqueued, for all endpoints and per endpoint
+	c.HTTP.RequestTimeout = parseDuration("XMPP_REQUEST_TIMEOUT", 30*time.Second)
+	c.Endpoints.Timeouts = make(map[string]duration)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_REQUEST_TIMEOUT_") {
+			name := strings.SplitN(e, "=", 2)[0]
+			c.Endpoints.Timeouts[strings.TrimPrefix(name, "XMPP_REQUEST_TIMEOUT_")] = parseDuration(name, 0)
+		}
+	}
+
+	// get how long the responses of requests with an idempotency key are remembered
+	c.HTTP.IdempotencyTTL = parseDuration("XMPP_IDEMPOTENCY_TTL", 24*time.Hour)
+
+	// get the recipients and rooms
+	c.Recipients.Recipients, err = parseRecipients(xr)
+	panicOnErr(err)
+	c.Recipients.Rooms, err = parseRooms(xrooms)
+	panicOnErr(err)
+	c.Recipients.RoomNick = os.Getenv("XMPP_ROOM_NICK")
+	if c.Recipients.RoomNick == "" {
+		c.Recipients.RoomNick = myjid.Localpart()
+	}
+
+	// get the routing rules
+	c.Recipients.Routes, err = parseRoutes(os.Getenv("XMPP_ROUTES"), c.Recipients.Rooms)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// allow the requests of all or some endpoints to specify their own recipients
+	c.Recipients.Override = parseEndpointSet(os.Getenv("XMPP_RECIPIENT_OVERRIDE_ENDPOINTS"))
+	if _, ok := os.LookupEnv("XMPP_RECIPIENT_OVERRIDE"); ok {
+		if len(c.Recipients.Override) > 0 {
+			log.Println("warning: XMPP_RECIPIENT_OVERRIDE is ignored, XMPP_RECIPIENT_OVERRIDE_ENDPOINTS limits the override to its endpoints")
+		} else {
+			c.Recipients.Override["*"] = true
+		}
+	}
+	_, c.Recipients.OverrideReject = os.LookupEnv("XMPP_RECIPIENT_OVERRIDE_REJECT")
+
+	// get whether duplicate recipients are compared by bare or full jid
+	switch os.Getenv("XMPP_DEDUPE_RECIPIENTS") {
+	case "", "full":
+	case "bare":
+		c.Recipients.DedupeBare = true
+	default:
+		log.Fatal("XMPP_DEDUPE_RECIPIENTS must be full or bare")
+	}
+
+	// get the domains per-request recipients may belong to, the own domain by default
+	switch d := os.Getenv("XMPP_ALLOWED_RECIPIENT_DOMAINS"); d {
+	case "":
+		c.Recipients.AllowedDomains = []string{myjid.Domainpart()}
+	case "*":
+	default:
+		for _, domain := range strings.Split(d, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				c.Recipients.AllowedDomains = append(c.Recipients.AllowedDomains, domain)
+			}
+		}
+	}
+
+	// get max. number of recipients per message and what to do if it's exceeded
+	c.Recipients.Max = parsePositive("XMPP_MAX_RECIPIENTS", 50)
+	c.Recipients.MaxPolicy = os.Getenv("XMPP_MAX_RECIPIENTS_POLICY")
+	switch c.Recipients.MaxPolicy {
+	case "":
+		c.Recipients.MaxPolicy = "truncate"
+	case "truncate", "reject":
+	default:
+		log.Fatal("XMPP_MAX_RECIPIENTS_POLICY must be truncate or reject")
+	}
+
+	// get the bounces after which the delivery to a recipient is paused
+	c.Recipients.CircuitFailures = parsePositive("XMPP_CIRCUIT_FAILURES", 5)
+	c.Recipients.CircuitCooldown = parseDuration("XMPP_CIRCUIT_COOLDOWN", 10*time.Minute)
+
+	// get whether the recipients are checked against the roster
+	c.Recipients.RosterCheck = os.Getenv("XMPP_ROSTER_CHECK")
+	switch c.Recipients.RosterCheck {
+	case "", rosterWarn, rosterSubscribe:
+	default:
+		log.Fatal("XMPP_ROSTER_CHECK must be warn or subscribe")
+	}
+
+	// get whose presence subscription requests are approved, the recipients'
+	// ones if their subscription is requested
+	switch approve, ok := os.LookupEnv("XMPP_SUBSCRIPTION_APPROVE"); {
+	case !ok && c.Recipients.RosterCheck == rosterSubscribe:
+		c.Recipients.SubscriptionApprove = []string{approveRecipients}
+	case approve == "none":
+	default:
+		c.Recipients.SubscriptionApprove, err = parseSubscriptionApprove(approve)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, e := range c.Recipients.SubscriptionApprove {
+		if e == "*" {
+			log.Println("warning: XMPP_SUBSCRIPTION_APPROVE=* approves the subscription requests of every account")
+		}
+	}
+
+	// get max. message length and what to do with longer messages
+	if l := os.Getenv("XMPP_MAX_MESSAGE_LENGTH"); l != "" {
+		c.Messages.MaxLength, err = strconv.Atoi(l)
+		if err != nil || c.Messages.MaxLength < 0 {
+			log.Fatal("XMPP_MAX_MESSAGE_LENGTH is not a valid number")
+		}
+	}
+	c.Messages.LengthPolicy = os.Getenv("XMPP_MESSAGE_LENGTH_POLICY")
+	switch c.Messages.LengthPolicy {
+	case "":
+		c.Messages.LengthPolicy = lengthTruncate
+	case lengthTruncate, lengthSplit:
+	default:
+		log.Fatal("XMPP_MESSAGE_LENGTH_POLICY must be truncate or split")
+	}
+	// split messages need room for the part number
+	if c.Messages.LengthPolicy == lengthSplit && c.Messages.MaxLength > 0 && c.Messages.MaxLength <= partPrefixLength {
+		log.Fatalf("XMPP_MAX_MESSAGE_LENGTH must exceed %d to split messages", partPrefixLength)
+	}
+
+	// get format, position and timezone of the message timestamps (disabled if unset)
+	c.Messages.Timestamp = os.Getenv("XMPP_MESSAGE_TIMESTAMP")
+	c.Messages.TimestampPosition = os.Getenv("XMPP_MESSAGE_TIMESTAMP_POSITION")
+	switch c.Messages.TimestampPosition {
+	case "":
+		c.Messages.TimestampPosition = "prepend"
+	case "prepend", "append":
+	default:
+		log.Fatal("XMPP_MESSAGE_TIMESTAMP_POSITION must be prepend or append")
+	}
+	c.Messages.Timezone = timezone{time.Local}
+	if tz := os.Getenv("XMPP_TIMEZONE"); tz != "" {
+		c.Messages.Timezone.Location, err = time.LoadLocation(tz)
+		if err != nil {
+			log.Fatal("XMPP_TIMEZONE is not a valid timezone")
+		}
+	}
+
+	// get the prefixes of firing and resolved notifications, empty disables them
+	c.Messages.StatusPrefixes = map[string]string{
+		parser.StatusFiring:   "FIRING:",
+		parser.StatusResolved: "RESOLVED:",
+	}
+	c.Messages.customPrefixes = make(map[string]bool)
+	if p, ok := os.LookupEnv("XMPP_PREFIX_FIRING"); ok {
+		c.Messages.StatusPrefixes[parser.StatusFiring] = p
+		c.Messages.customPrefixes[parser.StatusFiring] = true
+	}
+	if p, ok := os.LookupEnv("XMPP_PREFIX_RESOLVED"); ok {
+		c.Messages.StatusPrefixes[parser.StatusResolved] = p
+		c.Messages.customPrefixes[parser.StatusResolved] = true
+	}
+
+	// refer to firing alerts in resolved notifications
+	_, c.Messages.TrackResolved = os.LookupEnv("XMPP_TRACK_RESOLVED")
+
+	// get the size of the buffer for messages that arrive while disconnected, and what happens if it's full
+	c.Messages.BufferSize = 100
+	if s := os.Getenv("XMPP_BUFFER_SIZE"); s != "" {
+		c.Messages.BufferSize, err = strconv.Atoi(s)
+		if err != nil || c.Messages.BufferSize < 0 {
+			log.Fatal("XMPP_BUFFER_SIZE must be a non-negative number")
+		}
+	}
+	if c.Messages.BufferSize > 0 {
+		c.Messages.BufferOverflow = os.Getenv("XMPP_BUFFER_OVERFLOW")
+		if c.Messages.BufferOverflow == "" {
+			c.Messages.BufferOverflow = overflowDropOldest
+		}
+		if _, err := newMessageBuffer(1, c.Messages.BufferOverflow); err != nil {
+			log.Fatal("XMPP_BUFFER_OVERFLOW: " + err.Error())
+		}
+	}
+
+	// get quiet hours per endpoint and whether messages are queued or dropped during them
+	c.Endpoints.QuietHours, err = parseQuietHours(os.Getenv("XMPP_QUIET_HOURS"), c.Messages.Timezone.Location)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Messages.QuietHoursPolicy = os.Getenv("XMPP_QUIET_HOURS_POLICY")
+	switch c.Messages.QuietHoursPolicy {
+	case "":
+		c.Messages.QuietHoursPolicy = "queue"
+	case "queue", "suppress":
+	default:
+		log.Fatal("XMPP_QUIET_HOURS_POLICY must be queue or suppress")
+	}
+
+	// get endpoints whose repeated messages are counted and rolled up instead of sent
+	c.Endpoints.Coalesce = parseEndpointSet(os.Getenv("XMPP_COALESCE_ENDPOINTS"))
+	c.Messages.CoalesceWindow = parseDuration("XMPP_COALESCE_WINDOW", 10*time.Minute)
+	c.Messages.CoalesceInterval = parseDuration("XMPP_COALESCE_INTERVAL", time.Minute)
+	if len(c.Endpoints.Coalesce) > 0 && (c.Messages.CoalesceWindow <= 0 || c.Messages.CoalesceInterval <= 0) {
+		log.Fatal("XMPP_COALESCE_WINDOW and XMPP_COALESCE_INTERVAL must be positive")
+	}
+	c.Messages.CoalesceMode = os.Getenv("XMPP_COALESCE_MODE")
+	switch c.Messages.CoalesceMode {
+	case "":
+		c.Messages.CoalesceMode = "reply"
+	case "reply", "correct":
+	default:
+		log.Fatal("XMPP_COALESCE_MODE must be reply or correct")
+	}
+
+	// get how long messages may wait for their delivery, for all endpoints and per endpoint
+	c.Messages.TTL = parseDuration("XMPP_MESSAGE_TTL", 0)
+	c.Endpoints.TTLs = make(map[string]duration)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_MESSAGE_TTL_") {
+			name := strings.SplitN(e, "=", 2)[0]
+			c.Endpoints.TTLs[strings.TrimPrefix(name, "XMPP_MESSAGE_TTL_")] = parseDuration(name, 0)
+		}
+	}
+
+	// get how far ahead messages can be scheduled
+	c.Messages.ScheduleMaxAhead = parseDuration("XMPP_SCHEDULE_MAX_AHEAD", 30*24*time.Hour)
+	if c.Messages.ScheduleMaxAhead < 0 {
+		log.Fatal("XMPP_SCHEDULE_MAX_AHEAD must not be negative")
+	}
+
+	// request the recipients' attention for critical messages of every endpoint
+	_, c.Messages.AttentionCritical = os.LookupEnv("XMPP_ATTENTION_CRITICAL")
+
+	// log the bodies of requests that can't be parsed
+	if _, ok := os.LookupEnv("XMPP_DEBUG_BODIES"); ok {
+		c.Messages.DebugBodies = parsePositive("XMPP_DEBUG_BODIES_MAX", 1024)
+	}
+
+	// get the number of delivered messages kept for troubleshooting
+	c.Messages.DebugRecent = 20
+	if s := os.Getenv("XMPP_DEBUG_RECENT"); s != "" {
+		c.Messages.DebugRecent, err = strconv.Atoi(s)
+		if err != nil || c.Messages.DebugRecent < 0 {
+			log.Fatal("XMPP_DEBUG_RECENT must be a number of messages (0 disables it)")
+		}
+	}
+
+	// log debug messages
+	_, c.Messages.Debug = os.LookupEnv("XMPP_DEBUG")
+
+	// get the recipients of notices about requests that can't be parsed (disabled if unset)
+	c.Messages.DeadLetterRecipients, err = parseRecipients(os.Getenv("XMPP_DEAD_LETTER_RECIPIENTS"))
+	if err != nil {
+		log.Fatal("XMPP_DEAD_LETTER_RECIPIENTS: " + err.Error())
+	}
+	_, c.Messages.DeadLetterBody = os.LookupEnv("XMPP_DEAD_LETTER_BODY")
+	c.Messages.DeadLetterInterval = parseDuration("XMPP_DEAD_LETTER_INTERVAL", 5*time.Minute)
+
+	// pause the endpoints that flood and tell the admins about it (disabled if unset)
+	c.Messages.FloodLimit = parsePositive("XMPP_FLOOD_LIMIT", 0)
+	c.Messages.FloodWindow = parseDuration("XMPP_FLOOD_WINDOW", time.Minute)
+	c.Messages.FloodCooldown = parseDuration("XMPP_FLOOD_COOLDOWN", 10*time.Minute)
+	if c.Messages.FloodLimit > 0 && (c.Messages.FloodWindow <= 0 || c.Messages.FloodCooldown <= 0) {
+		log.Fatal("XMPP_FLOOD_WINDOW and XMPP_FLOOD_COOLDOWN must be positive")
+	}
+	c.Messages.FloodRecipients, err = parseRecipients(os.Getenv("XMPP_FLOOD_RECIPIENTS"))
+	if err != nil {
+		log.Fatal("XMPP_FLOOD_RECIPIENTS: " + err.Error())
+	}
+	if len(c.Messages.FloodRecipients) > 0 && c.Messages.FloodLimit == 0 {
+		log.Println("warning: XMPP_FLOOD_RECIPIENTS is set without XMPP_FLOOD_LIMIT, endpoints are never paused")
+	}
+
+	// get the audit log of the sent messages (disabled if unset)
+	c.Messages.AuditLog = os.Getenv("XMPP_AUDIT_LOG")
+	_, c.Messages.AuditLogBody = os.LookupEnv("XMPP_AUDIT_LOG_BODY")
+	if c.Messages.AuditLogBody && c.Messages.AuditLog == "" {
+		log.Println("warning: XMPP_AUDIT_LOG_BODY has no effect without XMPP_AUDIT_LOG")
+	}
+
+	// tidy the whitespace of the messages unless disabled
+	_, c.Messages.KeepWhitespace = os.LookupEnv("XMPP_KEEP_WHITESPACE")
+
+	// get how the messages are formatted, for everyone and per recipient
+	c.Messages.Format = formatStyling
+	if f := os.Getenv("XMPP_MESSAGE_FORMAT"); f != "" {
+		c.Messages.Format, err = parseMessageFormat(f)
+		if err != nil {
+			log.Fatal("XMPP_MESSAGE_FORMAT: " + err.Error())
+		}
+	}
+	c.Recipients.Formats, err = parseRecipientFormats(os.Getenv("XMPP_RECIPIENT_FORMATS"))
+	if err != nil {
+		log.Fatal("XMPP_RECIPIENT_FORMATS: " + err.Error())
+	}
+
+	// get templated endpoints
+	c.Endpoints.Templates, err = parseTemplates(os.Getenv("XMPP_WEBHOOK_TEMPLATES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get accepted http methods per endpoint
+	c.Endpoints.Methods, err = parseEndpointMethods(os.Getenv("XMPP_ENDPOINT_METHODS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get the default severities and severity fields per endpoint
+	c.Endpoints.DefaultSeverity, err = parseEndpointValues(os.Getenv("XMPP_DEFAULT_SEVERITY"), "default severity")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for endpoint, s := range c.Endpoints.DefaultSeverity {
+		if parser.NormalizeSeverity(s) != s || s == parser.SeverityUnknown {
+			log.Fatalf("XMPP_DEFAULT_SEVERITY of %s must be critical, warning or info", endpoint)
+		}
+	}
+	c.Endpoints.SeverityFields, err = parseEndpointValues(os.Getenv("XMPP_SEVERITY_FIELDS"), "severity field")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Endpoints.RecipientsFields, err = parseEndpointValues(os.Getenv("XMPP_RECIPIENTS_FIELDS"), "recipients field")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for e := range c.Endpoints.RecipientsFields {
+		if !c.Recipients.Override[e] && !c.Recipients.Override["*"] {
+			log.Printf("warning: XMPP_RECIPIENTS_FIELDS has no effect for %s without the recipient override (XMPP_RECIPIENT_OVERRIDE or XMPP_RECIPIENT_OVERRIDE_ENDPOINTS)", e)
+		}
+	}
+
+	// get the labels of the endpoints in logs and metrics, e.g. to tell apart
+	// several endpoints of one parser type (the endpoint name by default)
+	c.Endpoints.Sources, err = parseEndpointValues(os.Getenv("XMPP_SOURCES"), "source")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get the nicknames the messages of the endpoints are sent with (XEP-0172),
+	// as the from address of the session can't be changed per message
+	c.Endpoints.Nicks, err = parseEndpointValues(os.Getenv("XMPP_SENDER_NICKS"), "nick")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get endpoints that request the recipients' attention for every message,
+	// only notify online recipients and group their messages into threads (* for all)
+	c.Endpoints.Attention = parseEndpointSet(os.Getenv("XMPP_ATTENTION_ENDPOINTS"))
+	c.Endpoints.OnlineOnly = parseEndpointSet(os.Getenv("XMPP_ONLINE_ONLY_ENDPOINTS"))
+	c.Endpoints.Threads = parseEndpointSet(os.Getenv("XMPP_THREAD_ENDPOINTS"))
+
+	// get to whom the initial presence is sent, the presence of the recipients
+	// is only known if it's broadcast
+	c.XMPP.InitialPresence = os.Getenv("XMPP_INITIAL_PRESENCE")
+	switch c.XMPP.InitialPresence {
+	case "":
+		c.XMPP.InitialPresence = presenceBroadcast
+	case presenceBroadcast, presenceDirected:
+	default:
+		log.Fatal("XMPP_INITIAL_PRESENCE must be " + presenceBroadcast + " or " + presenceDirected)
+	}
+	if c.XMPP.InitialPresence == presenceDirected && (len(c.Endpoints.OnlineOnly) > 0 || c.XMPP.ResourceMode == resourceHighestPriority) {
+		log.Fatal("XMPP_INITIAL_PRESENCE=directed can't be combined with XMPP_ONLINE_ONLY_ENDPOINTS or XMPP_RESOURCE_MODE=highest-priority, they need the presence of the recipients")
+	}
+
+	// get the delivery profiles per endpoint, custom profiles are named by the
+	// suffix of their env var
+	custom := make(map[string]DeliveryProfile)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_DELIVERY_PROFILE_") {
+			kv := strings.SplitN(strings.TrimPrefix(e, "XMPP_DELIVERY_PROFILE_"), "=", 2)
+			custom[strings.ToLower(kv[0])], err = parseDeliveryProfile(kv[1])
+			if err != nil {
+				log.Fatal("XMPP_DELIVERY_PROFILE_" + kv[0] + ": " + err.Error())
+			}
+		}
+	}
+	c.Endpoints.Delivery, err = parseEndpointProfiles(os.Getenv("XMPP_DELIVERY_PROFILES"), custom)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// get how the notifications of acknowledged alerts are de-escalated
+	c.XMPP.AckDeescalateWindow = parseDuration("XMPP_ACK_DEESCALATE_WINDOW", 0)
+	if c.XMPP.AckDeescalateWindow < 0 {
+		log.Fatal("XMPP_ACK_DEESCALATE_WINDOW must not be negative")
+	}
+	c.XMPP.AckDeescalate = os.Getenv("XMPP_ACK_DEESCALATE")
+	switch c.XMPP.AckDeescalate {
+	case "":
+		c.XMPP.AckDeescalate = deescalateDowngrade
+	case deescalateDowngrade, deescalateSuppress:
+	default:
+		log.Fatal("XMPP_ACK_DEESCALATE must be downgrade or suppress")
+	}
+	c.XMPP.AckDeescalateProfile = os.Getenv("XMPP_ACK_DEESCALATE_PROFILE")
+	if c.XMPP.AckDeescalateProfile == "" {
+		c.XMPP.AckDeescalateProfile = "quiet"
+	}
+	profile, ok := custom[c.XMPP.AckDeescalateProfile]
+	if !ok {
+		profile, ok = deliveryProfiles[c.XMPP.AckDeescalateProfile]
+	}
+	if !ok {
+		log.Fatal("XMPP_ACK_DEESCALATE_PROFILE must be one of " + strings.Join(profileNames(custom), ", "))
+	}
+	c.XMPP.ackDeescalateProfile = &profile
+	if c.XMPP.AckDeescalateWindow > 0 && !c.XMPP.Acks {
+		log.Println("warning: XMPP_ACK_DEESCALATE_WINDOW has no effect without XMPP_ACKS")
+	}
+
+	// get endpoints that answer after the delivery with its outcome (* for all)
+	c.Endpoints.SyncDelivery = parseEndpointSet(os.Getenv("XMPP_SYNC_DELIVERY_ENDPOINTS"))
+	c.Endpoints.SyncDeliveryTimeout = parseDuration("XMPP_SYNC_DELIVERY_TIMEOUT", 30*time.Second)
+	if c.Endpoints.SyncDeliveryTimeout <= 0 {
+		log.Fatal("XMPP_SYNC_DELIVERY_TIMEOUT must be positive")
+	}
+
+	// get endpoints whose messages are converted from html to plain text
+	c.Endpoints.StripHTML = parseEndpointSet(os.Getenv("XMPP_STRIP_HTML_ENDPOINTS"))
+
+	// get endpoints that drop resolved notifications
+	c.Endpoints.SuppressResolved = make(endpointSet)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_SUPPRESS_RESOLVED_") {
+			name := strings.SplitN(e, "=", 2)[0]
+			if parseBool(name) {
+				c.Endpoints.SuppressResolved[strings.TrimPrefix(name, "XMPP_SUPPRESS_RESOLVED_")] = true
+			}
+		}
+	}
+
+	// get the raw xml elements added to the messages of all endpoints and per endpoint
+	c.Messages.Extensions, err = parseStanzaExtensions(os.Getenv("XMPP_STANZA_EXTENSIONS"))
+	if err != nil {
+		log.Fatal("XMPP_STANZA_EXTENSIONS: " + err.Error())
+	}
+	c.Endpoints.Extensions = make(map[string]string)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_STANZA_EXTENSIONS_") {
+			kv := strings.SplitN(e, "=", 2)
+			c.Endpoints.Extensions[strings.TrimPrefix(kv[0], "XMPP_STANZA_EXTENSIONS_")], err = parseStanzaExtensions(kv[1])
+			if err != nil {
+				log.Fatal(kv[0] + ": " + err.Error())
+			}
+		}
+	}
+
+	// get the jq expressions that reshape the bodies per endpoint
+	c.Endpoints.Transforms = make(map[string]*transform)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_TRANSFORM_") {
+			kv := strings.SplitN(e, "=", 2)
+			c.Endpoints.Transforms[strings.TrimPrefix(kv[0], "XMPP_TRANSFORM_")], err = parseTransform(kv[1])
+			if err != nil {
+				log.Fatal(kv[0] + ": " + err.Error())
+			}
+		}
+	}
+
+	// get the templates before and after the messages of all endpoints and per
+	// endpoint, an empty one of an endpoint leaves out the one of all
+	c.Messages.Prefix = os.Getenv("XMPP_MESSAGE_PREFIX")
+	c.Messages.Suffix = os.Getenv("XMPP_MESSAGE_SUFFIX")
+	c.Endpoints.Prefixes = make(map[string]string)
+	c.Endpoints.Suffixes = make(map[string]string)
+	c.Endpoints.prefixes = make(map[string]*template.Template)
+	c.Endpoints.suffixes = make(map[string]*template.Template)
+	c.Endpoints.prefixes[""], err = parseFrameTemplate("prefix", c.Messages.Prefix)
+	if err != nil {
+		log.Fatal("XMPP_MESSAGE_PREFIX: " + err.Error())
+	}
+	c.Endpoints.suffixes[""], err = parseFrameTemplate("suffix", c.Messages.Suffix)
+	if err != nil {
+		log.Fatal("XMPP_MESSAGE_SUFFIX: " + err.Error())
+	}
+	for _, e := range os.Environ() {
+		kv := strings.SplitN(e, "=", 2)
+		switch {
+		case strings.HasPrefix(kv[0], "XMPP_MESSAGE_PREFIX_"):
+			name := strings.TrimPrefix(kv[0], "XMPP_MESSAGE_PREFIX_")
+			c.Endpoints.Prefixes[name] = kv[1]
+			c.Endpoints.prefixes[name], err = parseFrameTemplate(name, kv[1])
+		case strings.HasPrefix(kv[0], "XMPP_MESSAGE_SUFFIX_"):
+			name := strings.TrimPrefix(kv[0], "XMPP_MESSAGE_SUFFIX_")
+			c.Endpoints.Suffixes[name] = kv[1]
+			c.Endpoints.suffixes[name], err = parseFrameTemplate(name, kv[1])
+		}
+		if err != nil {
+			log.Fatal(kv[0] + ": " + err.Error())
+		}
+	}
+
+	// get the response templates of all endpoints and per endpoint
+	c.Endpoints.Response = os.Getenv("XMPP_RESPONSE_TEMPLATE")
+	if c.Endpoints.Response == "" {
+		c.Endpoints.Response = defaultResponseTemplate
+	}
+	c.Endpoints.Responses = make(map[string]string)
+	c.Endpoints.responses = make(map[string]*template.Template)
+	c.Endpoints.responses[""], err = parseResponseTemplate("response", c.Endpoints.Response)
+	if err != nil {
+		log.Fatal("XMPP_RESPONSE_TEMPLATE: " + err.Error())
+	}
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_RESPONSE_TEMPLATE_") {
+			kv := strings.SplitN(e, "=", 2)
+			name := strings.TrimPrefix(kv[0], "XMPP_RESPONSE_TEMPLATE_")
+			c.Endpoints.Responses[name] = kv[1]
+			c.Endpoints.responses[name], err = parseResponseTemplate(name, kv[1])
+			if err != nil {
+				log.Fatal(kv[0] + ": " + err.Error())
+			}
+		}
+	}
+
+	// get external command for the command endpoint (executes external code, disabled if unset)
+	c.Endpoints.Command = os.Getenv("XMPP_WEBHOOK_COMMAND")
+	c.Endpoints.CommandTimeout = parseDuration("XMPP_WEBHOOK_COMMAND_TIMEOUT", 10*time.Second)
+	c.Endpoints.CommandMaxMemory = 1024
+	if m := os.Getenv("XMPP_WEBHOOK_COMMAND_MAX_MEMORY"); m != "" {
+		c.Endpoints.CommandMaxMemory, err = strconv.ParseInt(m, 10, 64)
+		if err != nil || c.Endpoints.CommandMaxMemory < 0 {
+			log.Fatal("XMPP_WEBHOOK_COMMAND_MAX_MEMORY must be a number of MiB (0 is unlimited)")
+		}
+	}
+
+	// get twilio auth token to verify the request signatures (not verified if unset)
+	c.Endpoints.TwilioAuthToken = secret(getSecret("XMPP_TWILIO_AUTH_TOKEN"))
+
+	// get the token for fetching the images of grafana, only sent to its own urls
+	c.Endpoints.GrafanaURL = os.Getenv("XMPP_GRAFANA_URL")
+	c.Endpoints.GrafanaImageToken = secret(getSecret("XMPP_GRAFANA_IMAGE_TOKEN"))
+	c.Endpoints.GrafanaImageHeader = os.Getenv("XMPP_GRAFANA_IMAGE_HEADER")
+	if c.Endpoints.GrafanaImageHeader == "" {
+		c.Endpoints.GrafanaImageHeader = "Authorization"
+	}
+	if c.Endpoints.GrafanaImageToken != "" {
+		u, err := url.Parse(c.Endpoints.GrafanaURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatal("XMPP_GRAFANA_IMAGE_TOKEN requires XMPP_GRAFANA_URL, the http(s) url of grafana")
+		}
+	}
+
+	// get the secret of the tailscale webhook to verify the request signatures (not verified if unset)
+	c.Endpoints.TailscaleSecret = secret(getSecret("XMPP_TAILSCALE_SECRET"))
+
+	// get the secrets of the shops to verify the signatures of their order
+	// webhooks, if either is set the requests of the other shop are rejected
+	c.Endpoints.ShopifySecret = secret(getSecret("XMPP_SHOPIFY_SECRET"))
+	c.Endpoints.WooCommerceSecret = secret(getSecret("XMPP_WOOCOMMERCE_SECRET"))
+
+	// get the secret of the cloudflare webhook, requests without it are rejected (not checked if unset)
+	c.Endpoints.CloudflareSecret = secret(getSecret("XMPP_CLOUDFLARE_SECRET"))
+
+	// get the max. number of log lines in the messages of failed systemd units
+	c.Endpoints.SystemdLogLines = parsePositive("XMPP_SYSTEMD_LOG_LINES", 10)
+
+	// get the days of remaining validity from which on certificate expiry alerts escalate
+	c.Endpoints.CertExpiryThresholds, err = parseCertExpiryThresholds(os.Getenv("XMPP_CERTEXPIRY_THRESHOLDS"))
+	if err != nil {
+		log.Fatal("XMPP_CERTEXPIRY_THRESHOLDS: " + err.Error())
+	}
+
+	// get the served endpoints and their parsers, all built-in ones if unset
+	c.Endpoints.Types, err = parseEndpoints(os.Getenv("XMPP_ENDPOINTS"), c.Endpoints.Templates)
+	if err != nil {
+		log.Fatal("XMPP_ENDPOINTS: " + err.Error())
+	}
+	for name, typ := range c.Endpoints.Types {
+		if typ == "command" && c.Endpoints.Command == "" {
+			log.Fatal("XMPP_ENDPOINTS: endpoint " + name + " requires XMPP_WEBHOOK_COMMAND")
+		}
+	}
+
+	// get the tokens the requests of an endpoint have to carry
+	c.Endpoints.Tokens = make(map[string]secret)
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "XMPP_ENDPOINT_TOKEN_") {
+			name := strings.TrimSuffix(strings.SplitN(e, "=", 2)[0], "_FILE")
+			c.Endpoints.Tokens[strings.TrimPrefix(name, "XMPP_ENDPOINT_TOKEN_")] = secret(getSecret(name))
+		}
+	}
+
+	// get the template of the alertmanager messages, the built-in one if unset
+	if p := os.Getenv("XMPP_ALERTMANAGER_TEMPLATE"); p != "" {
+		c.Endpoints.AlertmanagerTemplate, err = parser.LoadTemplateFile(p)
+		if err != nil {
+			log.Fatal("failed to load XMPP_ALERTMANAGER_TEMPLATE: " + err.Error())
+		}
+	}
+
+	// get the fields /json plucks out of the payload
+	c.Endpoints.JSONMapping, err = parser.ParseFieldMapping(os.Getenv("XMPP_JSON_MAPPING"))
+	if err != nil {
+		log.Fatal("XMPP_JSON_MAPPING: " + err.Error())
+	}
+
+	// get the format of the lines endpoint
+	c.Endpoints.LinesFields = []string{"message"}
+	if f := os.Getenv("XMPP_LINES_FIELDS"); f != "" {
+		c.Endpoints.LinesFields = strings.Split(f, ",")
+	}
+	c.Endpoints.LinesDelimiter = ','
+	switch d := os.Getenv("XMPP_LINES_DELIMITER"); {
+	case d == "":
+	case d == "tab":
+		c.Endpoints.LinesDelimiter = '\t'
+	case utf8.RuneCountInString(d) == 1:
+		r, _ := utf8.DecodeRuneInString(d)
+		c.Endpoints.LinesDelimiter = delimiter(r)
+	default:
+		log.Fatal("XMPP_LINES_DELIMITER must be a single character or tab")
+	}
+	c.Endpoints.LinesMode = os.Getenv("XMPP_LINES_MODE")
+	switch c.Endpoints.LinesMode {
+	case "":
+		c.Endpoints.LinesMode = "combined"
+	case "combined", "split":
+	default:
+		log.Fatal("XMPP_LINES_MODE must be combined or split")
+	}
+
+	return c
+}
+
+// returns the duration of the env var, the default if unset
+func parseDuration(name string, def time.Duration) duration {
+	s := os.Getenv(name)
+	if s == "" {
+		return duration(def)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatal(name + " is not a valid duration")
+	}
+	return duration(d)
+}
+
+// returns the positive number of the env var, the default if unset
+func parsePositive(name string, def int) int {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		log.Fatal(name + " is not a positive number")
+	}
+	return n
+}
+
+// returns the boolean of the set env var, an empty value is true like with
+// the flags that are only set
+func parseBool(name string) bool {
+	s := os.Getenv(name)
+	if s == "" {
+		return true
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Fatal(name + " must be true or false")
+	}
+	return b
+}
+
+// parses a comma-separated list of endpoints
+func parseEndpointSet(s string) endpointSet {
+	set := make(endpointSet)
+	for _, e := range strings.Split(s, ",") {
+		if e != "" {
+			set[e] = true
+		}
+	}
+	return set
+}
+
+// writes the configuration as indented json
+func (c config) write(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	e.SetEscapeHTML(false)
+	return e.Encode(c)
+}
+
+// encodes the value like write, without escaping <redacted>
+func marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// secret that is printed as <redacted> if set
+type secret string
+
+func (s secret) MarshalJSON() ([]byte, error) {
+	return marshal(redact(string(s)))
+}
+
+// url that may carry secrets in the userinfo or query, printed redacted
+type secretURL string
+
+func (u secretURL) MarshalJSON() ([]byte, error) {
+	return marshal(redactURL(string(u)))
+}
+
+// proxy of the xmpp connection, nil connects directly
+type xmppProxyURL struct {
+	url    *url.URL
+	dialer proxy.ContextDialer
+}
+
+func (p xmppProxyURL) MarshalJSON() ([]byte, error) {
+	if p.url == nil {
+		return marshal("")
+	}
+	return marshal(redactURL(p.url.String()))
+}
+
+// duration printed like 10s
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return marshal(time.Duration(d).String())
+}
+
+// own jid of the bot
+type account struct {
+	jid.JID
+}
+
+func (a account) MarshalJSON() ([]byte, error) {
+	return marshal(a.String())
+}
+
+type jidList []jid.JID
+
+func (l jidList) MarshalJSON() ([]byte, error) {
+	return marshal(jidStrings(l))
+}
+
+// printed as room jid -> redacted password
+type roomList []room
+
+func (l roomList) MarshalJSON() ([]byte, error) {
+	rooms := make(map[string]string)
+	for _, r := range l {
+		rooms[r.jid.String()] = redact(r.password)
+	}
+	return marshal(rooms)
+}
+
+type routeList []route
+
+func (l routeList) MarshalJSON() ([]byte, error) {
+	type printedRoute struct {
+		Conditions []string `json:"conditions"`
+		Recipients []string `json:"recipients"`
+		Rooms      []string `json:"rooms"`
+	}
+	routes := []printedRoute{}
+	for _, r := range l {
+		var p printedRoute
+		for _, c := range r.conditions {
+			if c.re != nil {
+				p.Conditions = append(p.Conditions, c.field+"~"+c.value)
+			} else {
+				p.Conditions = append(p.Conditions, c.field+"="+c.value)
+			}
+		}
+		p.Recipients = jidStrings(r.recipients)
+		for _, rm := range r.rooms {
+			p.Rooms = append(p.Rooms, rm.jid.String())
+		}
+		routes = append(routes, p)
+	}
+	return marshal(routes)
+}
+
+// printed like 22:00-07:00
+func (q *quietHours) MarshalJSON() ([]byte, error) {
+	return marshal(fmt.Sprintf("%02d:%02d-%02d:%02d", q.start/60, q.start%60, q.end/60, q.end%60))
+}
+
+type timezone struct {
+	*time.Location
+}
+
+func (tz timezone) MarshalJSON() ([]byte, error) {
+	return marshal(tz.String())
+}
+
+type mechanismList []sasl.Mechanism
+
+func (l mechanismList) MarshalJSON() ([]byte, error) {
+	return marshal(strings.Split(saslMechanismNames(l), ", "))
+}
+
+// printed as sorted list
+type endpointSet map[string]bool
+
+func (s endpointSet) MarshalJSON() ([]byte, error) {
+	return marshal(sortedKeys(s))
+}
+
+type delimiter rune
+
+func (d delimiter) MarshalJSON() ([]byte, error) {
+	return marshal(string(d))
+}
+
+// hides the secret, but still tells whether it is set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// hides the password and the query values of the url, tokens are often passed there
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	if parsed.RawQuery != "" {
+		var names []string
+		for name := range parsed.Query() {
+			names = append(names, url.QueryEscape(name)+"="+redacted)
+		}
+		sort.Strings(names)
+		parsed.RawQuery = strings.Join(names, "&")
+	}
+	if parsed.User == nil {
+		return parsed.String()
+	}
+	return parsed.Redacted()
+}
+
+// parses the thresholds of certificate expiry alerts: critical=7,warning=30,
+// an omitted one keeps its default
+func parseCertExpiryThresholds(s string) (parser.CertExpiryThresholds, error) {
+	t := parser.DefaultCertExpiryThresholds
+	values, err := parseEndpointValues(s, "threshold")
+	if err != nil {
+		return t, err
+	}
+	for name, v := range values {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return t, fmt.Errorf("threshold %s must be a number of days", name)
+		}
+		switch name {
+		case "critical":
+			t.Critical = days
+		case "warning":
+			t.Warning = days
+		default:
+			return t, fmt.Errorf("unknown threshold %s, must be critical or warning", name)
+		}
+	}
+	if t.Warning < t.Critical {
+		return t, fmt.Errorf("the warning threshold must be at least the critical one")
+	}
+	return t, nil
+}
+
+// returns the jids as strings
+func jidStrings(jids []jid.JID) []string {
+	var s []string
+	for _, j := range jids {
+		s = append(s, j.String())
+	}
+	return s
+}
+
+// returns the keys of the set, sorted
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for k, ok := range set {
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// states of the connection to the xmpp server
+const (
+	stateDisconnected = "disconnected"
+	stateReconnecting = "reconnecting"
+	stateConnected    = "connected"
+)
+
+// change of the connection state
+type connectionEvent struct {
+	state    string
+	at       time.Time
+	err      error         // why the session was lost (disconnected)
+	attempts int           // reconnect attempts it took (connected)
+	took     time.Duration // how long reconnecting took (connected)
+}
+
+// tells the admins when the connection was lost, reconnecting started and
+// the connection was re-established
+type connectionNotifier struct {
+	client     *xmppClient
+	from       jid.JID
+	recipients []jid.JID
+	// min. time between two outages that are told about, so a flapping connection doesn't spam
+	interval time.Duration
+
+	mu         sync.Mutex
+	pending    []connectionEvent // since the connection was lost, sent after reconnecting
+	lastSent   time.Time
+	suppressed int         // outages left out since the last notices
+	timer      *time.Timer // tells about the suppressed outages once the interval is over
+}
+
+// handles a change of the connection state, the notices can't be sent while
+// disconnected: they're queued and carry the time of the change as delay stamp
+func (n *connectionNotifier) changed(e connectionEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if e.state != stateConnected {
+		n.pending = append(n.pending, e)
+		return
+	}
+	pending := append(n.pending, e)
+	n.pending = nil
+	if wait := n.interval - time.Since(n.lastSent); wait > 0 {
+		n.suppressed++
+		if n.timer == nil {
+			n.timer = time.AfterFunc(wait, n.flushSuppressed)
+		}
+		return
+	}
+	for _, p := range pending {
+		n.send(n.notice(p), p.at)
+	}
+	n.lastSent = time.Now()
+}
+
+// tells about the outages left out during the interval, unless disconnected
+// again: then the next reconnect does it
+func (n *connectionNotifier) flushSuppressed() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.timer = nil
+	if n.suppressed == 0 || len(n.pending) > 0 {
+		return
+	}
+	n.send(fmt.Sprintf("xmpp-webhook lost and re-established the connection %d more time(s) during the last %s", n.suppressed, n.interval), time.Time{})
+	n.suppressed = 0
+	n.lastSent = time.Now()
+}
+
+// returns the text of the notice about the change
+func (n *connectionNotifier) notice(e connectionEvent) string {
+	switch e.state {
+	case stateDisconnected:
+		if e.err != nil {
+			return fmt.Sprintf("xmpp-webhook lost the connection: %s", e.err)
+		}
+		return "xmpp-webhook lost the connection"
+	case stateReconnecting:
+		return "xmpp-webhook is reconnecting"
+	}
+	body := fmt.Sprintf("xmpp-webhook is connected again after %s (%d attempt(s))", e.took.Round(time.Second), e.attempts)
+	if n.suppressed > 0 {
+		body += fmt.Sprintf(", the connection was lost %d more time(s) since the last notices", n.suppressed)
+		n.suppressed = 0
+	}
+	return body
+}
+
+// sends the notice to the admins, with a delay stamp unless it's zero
+func (n *connectionNotifier) send(body string, stamp time.Time) {
+	var delay *messageDelay
+	if !stamp.IsZero() && time.Since(stamp) > time.Second {
+		delay = &messageDelay{From: n.from.Domain().String(), Stamp: stamp.UTC().Format(time.RFC3339)}
+	}
+	for _, recipient := range n.recipients {
+		err := n.client.send(context.Background(), MessageBody{
+			Message: stanza.Message{
+				ID:   newMessageID(),
+				To:   recipient,
+				From: n.from,
+				Type: stanza.ChatMessage,
+			},
+			Body:  body,
+			Delay: delay,
+		})
+		if err != nil {
+			log.Printf("failed to send connection notice to %s: %s", recipient, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+// returns a notifier sending over a connected in-memory session
+func testNotifier(t *testing.T, interval time.Duration) (*connectionNotifier, *fakeConn) {
+	t.Helper()
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	t.Cleanup(func() { client.close() })
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	n := &connectionNotifier{client: client, from: jid.MustParse("bot@example.net"), recipients: []jid.JID{jid.MustParse("admin@example.net")}, interval: interval}
+	return n, server.conn(t, 0)
+}
+
+// lets the connection go through an outage
+func outage(n *connectionNotifier, lost time.Time) {
+	n.changed(connectionEvent{state: stateDisconnected, at: lost, err: errTest})
+	n.changed(connectionEvent{state: stateReconnecting, at: lost.Add(time.Second)})
+	n.changed(connectionEvent{state: stateConnected, at: time.Now(), attempts: 3, took: time.Minute})
+}
+
+type testError string
+
+func (e testError) Error() string { return string(e) }
+
+const errTest = testError("connection reset")
+
+func TestConnectionNotices(t *testing.T) {
+	n, conn := testNotifier(t, time.Hour)
+	lost := time.Now().Add(-time.Hour)
+	outage(n, lost)
+	waitFor(t, "the notices", func() bool { return strings.Contains(conn.received(), "connected again") })
+	received := conn.received()
+	for _, want := range []string{
+		"lost the connection: connection reset",
+		"is reconnecting",
+		"connected again after 1m0s (3 attempt(s))",
+		`stamp="` + lost.UTC().Format(time.RFC3339) + `"`,
+	} {
+		if !strings.Contains(received, want) {
+			t.Errorf("%q wasn't sent: %s", want, received)
+		}
+	}
+	if i, j := strings.Index(received, "lost the connection"), strings.Index(received, "is reconnecting"); i > j {
+		t.Errorf("notices out of order: %s", received)
+	}
+}
+
+func TestConnectionNoticesSuppressed(t *testing.T) {
+	n, conn := testNotifier(t, 200*time.Millisecond)
+	outage(n, time.Now())
+	waitFor(t, "the first notices", func() bool { return strings.Contains(conn.received(), "connected again") })
+	outage(n, time.Now())
+	outage(n, time.Now())
+	if c := strings.Count(conn.received(), "connected again"); c != 1 {
+		t.Errorf("%d reconnects told about during the interval, want 1", c)
+	}
+	// the suppressed outages are told about once the interval is over, without another reconnect
+	waitFor(t, "the suppressed count", func() bool { return strings.Contains(conn.received(), "2 more time(s)") })
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+// max. number of bytes of the raw body in a dead letter
+const deadLetterBodySize = 512
+
+var deadLetters = newCounter("xmpp_dead_letters_total", "Notices about requests that couldn't be parsed.", "endpoint", "action")
+
+// tells the operators about requests that couldn't be parsed, so a broken
+// integration doesn't go unnoticed
+type deadLetterNotifier struct {
+	messages   chan<- alertMessage
+	recipients []jid.JID
+	rooms      []room
+	// include the start of the raw body, it may contain personal data
+	includeBody bool
+	// min. time between two notices of an endpoint, so a broken source doesn't flood
+	interval time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	lastSent   map[string]time.Time
+	suppressed map[string]int // failures left out since the last notice, by endpoint
+}
+
+func newDeadLetterNotifier(messages chan<- alertMessage, recipients []jid.JID, rooms []room, includeBody bool, interval time.Duration) *deadLetterNotifier {
+	return &deadLetterNotifier{
+		messages:    messages,
+		recipients:  recipients,
+		rooms:       rooms,
+		includeBody: includeBody,
+		interval:    interval,
+		now:         time.Now,
+		lastSent:    make(map[string]time.Time),
+		suppressed:  make(map[string]int),
+	}
+}
+
+// sends a notice about the failed request unless the endpoint had one within
+// the interval, the failures left out are counted in the next one
+func (n *deadLetterNotifier) failed(ctx context.Context, endpoint string, source string, err error, body []byte) {
+	now := n.now()
+	n.mu.Lock()
+	if last, ok := n.lastSent[endpoint]; ok && now.Sub(last) < n.interval {
+		n.suppressed[endpoint]++
+		n.mu.Unlock()
+		deadLetters.inc(source, "suppressed")
+		return
+	}
+	suppressed := n.suppressed[endpoint]
+	n.lastSent[endpoint] = now
+	delete(n.suppressed, endpoint)
+	n.mu.Unlock()
+
+	notice := fmt.Sprintf("[xmpp-webhook] failed to parse a request to /%s: %s", endpoint, err)
+	if suppressed > 0 {
+		notice += fmt.Sprintf("\n(%d more failure(s) since the last notice)", suppressed)
+	}
+	if n.includeBody {
+		// the body is captured with one more byte, to tell if it's longer
+		if len(body) > deadLetterBodySize {
+			notice += fmt.Sprintf("\nbody: %q…", body[:deadLetterBodySize])
+		} else {
+			notice += fmt.Sprintf("\nbody: %q", body)
+		}
+	}
+	m := alertMessage{
+		id:         newMessageID(),
+		endpoint:   endpoint,
+		source:     source,
+		body:       notice,
+		severity:   parser.SeverityWarning,
+		created:    now,
+		recipients: n.recipients,
+		rooms:      n.rooms,
+	}
+	select {
+	case n.messages <- m:
+		deadLetters.inc(source, "sent")
+	case <-ctx.Done():
+	}
+}
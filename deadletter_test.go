@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+func TestDeadLetters(t *testing.T) {
+	messages := make(chan alertMessage, 10)
+	h := newMessageHandler("grafana", messages, func(r *http.Request) (parser.Result, error) {
+		_, _ = ioutil.ReadAll(r.Body)
+		return parser.Result{}, parser.BadRequestError{Reason: "missing message"}
+	})
+	now := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+	admin := []jid.JID{jid.MustParse("ops@example.net")}
+	h.deadLetters = newDeadLetterNotifier(messages, admin, nil, true, 5*time.Minute)
+	h.deadLetters.now = func() time.Time { return now }
+
+	post := func(body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("got %d", w.Code)
+		}
+	}
+	post(`{"title": "disk full"}`)
+	m := <-messages
+	if want := "[xmpp-webhook] failed to parse a request to /grafana: missing message\nbody: \"{\\\"title\\\": \\\"disk full\\\"}\""; m.body != want {
+		t.Errorf("got %q, want %q", m.body, want)
+	}
+	if len(m.recipients) != 1 || !m.recipients[0].Equal(admin[0]) || m.severity != parser.SeverityWarning {
+		t.Errorf("dead letter to %v with severity %s", m.recipients, m.severity)
+	}
+
+	// the following failures are counted until the interval is over
+	now = now.Add(time.Minute)
+	post(`{}`)
+	post(`{}`)
+	if len(messages) != 0 {
+		t.Fatalf("%d notices within the interval", len(messages))
+	}
+	now = now.Add(5 * time.Minute)
+	post(strings.Repeat("x", deadLetterBodySize+10))
+	m = <-messages
+	if !strings.Contains(m.body, "(2 more failure(s) since the last notice)") || !strings.HasSuffix(m.body, strings.Repeat("x", 10)+"\"…") {
+		t.Errorf("got %q", m.body)
+	}
+	if text := metricText(deadLetters); !strings.Contains(text, `xmpp_dead_letters_total{endpoint="grafana",action="suppressed"} 2`) {
+		t.Errorf("suppressed notices weren't counted: %s", text)
+	}
+
+	// the body is only included if enabled
+	h.deadLetters = newDeadLetterNotifier(messages, admin, nil, false, 5*time.Minute)
+	post(`{"password": "s3cret"}`)
+	if m := <-messages; strings.Contains(m.body, "s3cret") {
+		t.Errorf("body included: %q", m.body)
+	}
+}
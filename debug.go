@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+)
+
+// keeps the first max bytes read from the wrapped body
+type bodyCapture struct {
+	io.ReadCloser
+	max int
+	buf bytes.Buffer
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if remaining := c.max - c.buf.Len(); remaining > 0 {
+		if n < remaining {
+			remaining = n
+		}
+		c.buf.Write(p[:remaining])
+	}
+	return n, err
+}
+
+// returns the headers for logging, with the values of sensitive ones redacted
+func redactedHeaders(h http.Header) string {
+	var lines []string
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		if parser.SensitiveName(name) {
+			value = "[redacted]"
+		}
+		lines = append(lines, name+": "+value)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "; ")
+}
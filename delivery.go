@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"mellium.im/xmpp/stanza"
+)
+
+var receiptsReceived = newCounter("xmpp_receipts_total", "Delivery receipts of sent messages.")
+
+// storage hints (XEP-0334) of a delivery profile
+const (
+	hintStore   = "store"
+	hintNoStore = "no-store"
+)
+
+// how the direct messages of an endpoint are sent
+type DeliveryProfile struct {
+	Type      stanza.MessageType `json:"type"`     // chat or headline
+	Receipts  bool               `json:"receipts"` // request delivery receipts (XEP-0184)
+	Attention bool               `json:"attention"`
+	Hint      string             `json:"hint"` // store, no-store or empty for the server's default
+}
+
+// built-in delivery profiles by name
+var deliveryProfiles = map[string]DeliveryProfile{
+	"critical": {Type: stanza.ChatMessage, Receipts: true, Attention: true, Hint: hintStore},
+	"normal":   {Type: stanza.ChatMessage, Hint: hintStore},
+	"quiet":    {Type: stanza.HeadlineMessage, Hint: hintNoStore},
+}
+
+// asks the recipient's client to confirm the delivery (XEP-0184)
+type receiptRequest struct{}
+
+// confirms the delivery of one of our messages (XEP-0184), only received
+type receiptReceived struct {
+	ID string `xml:"id,attr"`
+}
+
+// parses the options of a custom delivery profile: chat|receipts|attention|store,
+// the type defaults to chat and the hint to the server's default
+func parseDeliveryProfile(s string) (DeliveryProfile, error) {
+	profile := DeliveryProfile{Type: stanza.ChatMessage}
+	for _, o := range strings.Split(s, "|") {
+		switch o = strings.TrimSpace(o); o {
+		case "":
+		case "chat":
+			profile.Type = stanza.ChatMessage
+		case "headline":
+			profile.Type = stanza.HeadlineMessage
+		case "receipts":
+			profile.Receipts = true
+		case "attention":
+			profile.Attention = true
+		case hintStore, hintNoStore:
+			profile.Hint = o
+		default:
+			return DeliveryProfile{}, errors.New("unknown delivery option " + o + ", must be chat, headline, receipts, attention, store or no-store")
+		}
+	}
+	return profile, nil
+}
+
+// parses a comma-separated list of delivery profiles per endpoint, e.g.
+// grafana=critical,feed=quiet; custom profiles extend (or replace) the built-in ones
+func parseEndpointProfiles(s string, custom map[string]DeliveryProfile) (map[string]*DeliveryProfile, error) {
+	names, err := parseEndpointValues(s, "delivery profile")
+	if err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]*DeliveryProfile)
+	for endpoint, name := range names {
+		profile, ok := custom[name]
+		if !ok {
+			profile, ok = deliveryProfiles[name]
+		}
+		if !ok {
+			return nil, errors.New("unknown delivery profile " + name + " of " + endpoint + ", must be one of " + strings.Join(profileNames(custom), ", "))
+		}
+		profiles[endpoint] = &profile
+	}
+	return profiles, nil
+}
+
+// returns the names of the built-in and custom profiles, sorted
+func profileNames(custom map[string]DeliveryProfile) []string {
+	var names []string
+	for name := range deliveryProfiles {
+		if _, ok := custom[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applies the profile to a direct message, nil keeps the defaults
+func (p *DeliveryProfile) apply(msg *MessageBody) {
+	if p == nil {
+		return
+	}
+	msg.Type = p.Type
+	if p.Receipts {
+		msg.Receipt = &receiptRequest{}
+	}
+	if p.Attention {
+		msg.Attention = &struct{}{}
+	}
+	switch p.Hint {
+	case hintStore:
+		msg.Store, msg.NoStore = &struct{}{}, nil
+	case hintNoStore:
+		msg.Store, msg.NoStore = nil, &struct{}{}
+	default:
+		msg.Store, msg.NoStore = nil, nil
+	}
+}
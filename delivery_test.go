@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"mellium.im/xmpp/stanza"
+)
+
+func TestParseDeliveryProfile(t *testing.T) {
+	tests := []struct {
+		spec string
+		want DeliveryProfile
+		err  bool
+	}{
+		{spec: "", want: DeliveryProfile{Type: stanza.ChatMessage}},
+		{spec: "headline|no-store", want: DeliveryProfile{Type: stanza.HeadlineMessage, Hint: hintNoStore}},
+		{spec: "chat | receipts | attention | store", want: DeliveryProfile{Type: stanza.ChatMessage, Receipts: true, Attention: true, Hint: hintStore}},
+		{spec: "groupchat", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDeliveryProfile(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: unexpected error %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseEndpointProfiles(t *testing.T) {
+	custom := map[string]DeliveryProfile{
+		"pager":  {Type: stanza.ChatMessage, Receipts: true},
+		"normal": {Type: stanza.ChatMessage},
+	}
+	profiles, err := parseEndpointProfiles("grafana=critical,feed=quiet,alert=pager,slack=normal", custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]DeliveryProfile{
+		"grafana": deliveryProfiles["critical"],
+		"feed":    deliveryProfiles["quiet"],
+		"alert":   custom["pager"],
+		"slack":   custom["normal"],
+	}
+	for endpoint, p := range want {
+		if got := profiles[endpoint]; got == nil || *got != p {
+			t.Errorf("%s: got %+v, want %+v", endpoint, got, p)
+		}
+	}
+
+	_, err = parseEndpointProfiles("grafana=loud", custom)
+	if err == nil || !strings.Contains(err.Error(), "critical, normal, pager, quiet") {
+		t.Errorf("unknown profile: got %v", err)
+	}
+}
+
+func TestDeliveryProfileApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *DeliveryProfile
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "defaults",
+			want:    []string{`type="chat"`, `<store xmlns="urn:xmpp:hints">`},
+			notWant: []string{"receipts", "attention"},
+		},
+		{
+			name:    "critical",
+			profile: &DeliveryProfile{Type: stanza.ChatMessage, Receipts: true, Attention: true, Hint: hintStore},
+			want:    []string{`type="chat"`, `<request xmlns="urn:xmpp:receipts">`, `<attention xmlns="urn:xmpp:attention:0">`, `<store xmlns="urn:xmpp:hints">`},
+		},
+		{
+			name:    "quiet",
+			profile: &DeliveryProfile{Type: stanza.HeadlineMessage, Hint: hintNoStore},
+			want:    []string{`type="headline"`, `<no-store xmlns="urn:xmpp:hints">`},
+			notWant: []string{"<store", "receipts"},
+		},
+		{
+			name:    "server default",
+			profile: &DeliveryProfile{Type: stanza.ChatMessage},
+			notWant: []string{"urn:xmpp:hints"},
+		},
+	}
+	for _, tt := range tests {
+		msg := MessageBody{Message: stanza.Message{Type: stanza.ChatMessage}, Body: "disk full", Store: &struct{}{}}
+		tt.profile.apply(&msg)
+		out, err := xml.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(string(out), w) {
+				t.Errorf("%s: %s doesn't contain %s", tt.name, out, w)
+			}
+		}
+		for _, w := range tt.notWant {
+			if strings.Contains(string(out), w) {
+				t.Errorf("%s: %s contains %s", tt.name, out, w)
+			}
+		}
+	}
+}
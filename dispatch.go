@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// how recipients given as bare jid are addressed
+const (
+	resourceBare            = "bare"             // the server decides which resources get the message
+	resourceHighestPriority = "highest-priority" // only the available resource with the highest priority
+)
+
+var messagesExpired = newCounter("xmpp_messages_expired_total", "Messages dropped because they weren't sent within their TTL.", "endpoint")
+
+// sends the messages from the webhooks to their recipients
+type dispatcher struct {
+	client *xmppClient
+	// sessions the chat messages are spread over, all go through client if nil
+	pool     *sessionPool
+	presence *presenceTracker
+	from     jid.JID
+
+	// format, position and timezone of the message timestamps, disabled if the layout is empty
+	timestampLayout string
+	timestampAppend bool
+	timezone        *time.Location
+
+	// max. message length (0 is unlimited) and what to do with longer messages
+	maxMessageLength int
+	lengthPolicy     string
+
+	// language of the message bodies (xml:lang), optional
+	lang string
+
+	// holds the messages back while disconnected, dropped if nil
+	buffer *messageBuffer
+
+	// how recipients given as bare jid are addressed
+	resourceMode string
+
+	// remembers the sent messages for acknowledgements, disabled if nil
+	acks *ackTracker
+	// pauses the delivery to recipients whose messages bounce, disabled if nil
+	circuits *circuitBreaker
+	// remembers the last delivered messages for troubleshooting, disabled if nil
+	recent *recentMessages
+	// appends a record of every message to a file, disabled if nil
+	audit *auditLog
+	// formats of the message bodies per recipient, all are styled if nil
+	formats *messageFormats
+	// uploads the images of the messages, they are dropped if nil
+	uploader *imageUploader
+
+	// window the sends of a message to at least spreadMin recipients (incl.
+	// rooms) are spread over, disabled if 0
+	spread    time.Duration
+	spreadMin int
+	// closed by stop, ends the pauses between spread sends
+	stopped chan struct{}
+	// randomizes the pauses, seeded on first use; only used by run
+	jitter *rand.Rand
+
+	// counts the messages handled after stop was called
+	stopping int32
+	drained  int
+	dropped  int
+}
+
+// sends the messages until the channel is closed
+func (d *dispatcher) run(ctx context.Context, messages <-chan alertMessage) {
+	// checks for buffered messages to send after reconnecting
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				d.flush(ctx)
+				if d.buffer != nil {
+					// still disconnected
+					d.dropped += len(d.buffer.flush())
+				}
+				return
+			}
+			if d.buffer != nil && d.client.current() == nil {
+				d.buffer.push(m)
+				continue
+			}
+			// keep the order, buffered messages go first
+			d.flush(ctx)
+			d.count(d.deliver(ctx, m))
+		case <-ticker.C:
+			d.flush(ctx)
+		}
+	}
+}
+
+// sends the buffered messages if connected
+func (d *dispatcher) flush(ctx context.Context) {
+	if d.buffer == nil || d.client.current() == nil {
+		return
+	}
+	for _, m := range d.buffer.flush() {
+		d.count(d.deliver(ctx, m))
+	}
+}
+
+// counts the messages handled during shutdown
+func (d *dispatcher) count(ok bool) {
+	if atomic.LoadInt32(&d.stopping) == 1 {
+		if ok {
+			d.drained++
+		} else {
+			d.dropped++
+		}
+	}
+}
+
+// marks the following messages as drained during shutdown
+func (d *dispatcher) stop() {
+	atomic.StoreInt32(&d.stopping, 1)
+	if d.stopped != nil {
+		close(d.stopped)
+	}
+}
+
+// returns the pause between the sends of a message to n recipients, 0 if
+// they aren't spread
+func (d *dispatcher) spreadInterval(n int) time.Duration {
+	if d.spread <= 0 || n < d.spreadMin || n < 2 {
+		return 0
+	}
+	return d.spread / time.Duration(n-1)
+}
+
+// waits for about the interval (randomized between half and one and a half of
+// it), returns right away during shutdown
+func (d *dispatcher) pause(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || atomic.LoadInt32(&d.stopping) == 1 {
+		return
+	}
+	if d.jitter == nil {
+		d.jitter = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	t := time.NewTimer(interval/2 + time.Duration(d.jitter.Int63n(int64(interval)+1)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	case <-d.stopped:
+	}
+}
+
+// sends the message to all its recipients, false if any send failed or it expired
+func (d *dispatcher) deliver(ctx context.Context, m alertMessage) bool {
+	// late alerts are useless, e.g. after a long outage or quiet hours
+	if m.expired(time.Now()) {
+		messagesExpired.inc(m.source)
+		logf(m.source, "dropping message %s from /%s, it wasn't sent within its ttl of %s", m.id, m.endpoint, m.ttl)
+		d.audit.record(m, true, nil)
+		m.report(deliveryResult{expired: true})
+		return false
+	}
+	ok := true
+	// the translations are split separately, parts beyond their length are sent without them
+	translations := make(map[string][]string)
+	for lang, t := range m.translations {
+		translations[lang] = d.parts(t, m.alertTime)
+	}
+	// recipients with an open circuit miss all parts of the message
+	var recipients []jid.JID
+	var skipped []string
+	// why recipients didn't get the message, for the outcome
+	skipReasons := make(map[string]string)
+	for _, recipient := range m.recipients {
+		if !d.circuits.allow(recipient) {
+			logf(m.source, "skipping recipient %s, its circuit is open", recipient)
+			skipped = append(skipped, recipient.String()+" (circuit open)")
+			skipReasons[recipient.String()] = "circuit open"
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+	var ids []string
+	var failed []string
+	// first error per recipient
+	failedOnce := make(map[string]error)
+	fail := func(recipient string, err error) {
+		ok = false
+		if failedOnce[recipient] == nil {
+			failedOnce[recipient] = err
+			failed = append(failed, recipient)
+		}
+	}
+	// the image of the alert follows the text as a link to the upload
+	parts := d.parts(m.body, m.alertTime)
+	text := len(parts)
+	if m.image != "" && d.uploader != nil {
+		if u, err := d.uploader.upload(ctx, m.image, m.imageAuth); err != nil {
+			imagesUploaded.inc(m.source, "error")
+			logf(m.source, "failed to upload the image of message %s, sending it without: %s", m.id, err)
+		} else {
+			imagesUploaded.inc(m.source, "ok")
+			parts = append(parts, u)
+		}
+	}
+	// messages to many recipients are sent one by one with a pause in between
+	interval := d.spreadInterval(len(recipients) + len(m.rooms))
+	if interval > 0 {
+		debugf(m.source, "spreading the sends of message %s to %d recipient(s) over %s, %s apart", m.id, len(recipients)+len(m.rooms), d.spread, interval)
+	}
+	for i, part := range parts {
+		var oob *messageOOB
+		if i >= text {
+			oob = &messageOOB{URL: part}
+		}
+		id := m.id
+		if i > 0 {
+			id = fmt.Sprintf("%s-%d", m.id, i+1)
+		}
+		ids = append(ids, id)
+		var thread *messageThread
+		if m.thread != "" {
+			thread = &messageThread{ID: m.thread}
+		}
+		var translated translatedBodies
+		for lang, parts := range translations {
+			if i < len(parts) {
+				if translated == nil {
+					translated = make(translatedBodies)
+				}
+				translated[lang] = parts[i]
+			}
+		}
+		// critical messages are delivered to offline recipients too
+		onlineOnly := m.onlineOnly && m.severity != parser.SeverityCritical
+		var sends []chatSend
+		for _, recipient := range recipients {
+			if onlineOnly && !d.presence.online(recipient) {
+				logf(m.source, "skipping offline recipient %s", recipient)
+				if i == 0 {
+					skipped = append(skipped, recipient.String()+" (offline)")
+					skipReasons[recipient.String()] = "offline"
+				}
+				continue
+			}
+			msg := MessageBody{
+				Message: stanza.Message{
+					ID:   id,
+					To:   d.target(recipient),
+					From: d.from,
+					Type: stanza.ChatMessage,
+					Lang: d.lang,
+				},
+				Body:         part,
+				Translations: translated,
+				Delay:        m.delay(d.from),
+				AMP:          m.expiry(),
+				Nick:         m.nick,
+				Thread:       thread,
+				OOB:          oob,
+				Extensions:   m.extensions,
+			}
+			if m.replyTo != "" && i == 0 {
+				msg.Reply = &messageReply{To: d.from.String(), ID: m.replyTo}
+			}
+			if m.replaces != "" && i == 0 {
+				msg.Replace = &messageReplace{ID: m.replaces}
+			}
+			// ask the server to store messages for offline recipients
+			if !onlineOnly {
+				msg.Store = &struct{}{}
+			}
+			if m.attention {
+				msg.Attention = &struct{}{}
+			}
+			m.delivery.apply(&msg)
+			// the attention was requested by the text already
+			if oob != nil {
+				msg.Attention = nil
+			} else {
+				d.formats.apply(&msg, recipient)
+			}
+			sends = append(sends, chatSend{recipient: recipient, message: msg})
+		}
+		// try to send the messages, log errors
+		for i, err := range d.spreadChats(ctx, sends, interval) {
+			if err != nil {
+				fail(sends[i].recipient.String(), err)
+				bridgeError.set(err)
+				logf(m.source, "failed to send message %s to %s: %s", id, sends[i].recipient, err)
+				continue
+			}
+			messagesSent.inc(m.source, m.metricSeverity())
+		}
+		var replace *messageReplace
+		if m.replaces != "" && i == 0 {
+			replace = &messageReplace{ID: m.replaces}
+		}
+		for j, r := range m.rooms {
+			if j > 0 || len(sends) > 0 {
+				d.pause(ctx, interval)
+			}
+			// try to send message, log errors
+			msg := MessageBody{
+				Message: stanza.Message{
+					ID:   id,
+					To:   r.jid,
+					From: d.from,
+					Type: stanza.GroupChatMessage,
+					Lang: d.lang,
+				},
+				Body:         part,
+				Translations: translated,
+				Delay:        m.delay(d.from),
+				Thread:       thread,
+				Replace:      replace,
+				OOB:          oob,
+				Extensions:   m.extensions,
+			}
+			if oob == nil {
+				d.formats.apply(&msg, r.jid)
+			}
+			err := d.client.send(ctx, msg)
+			if err != nil {
+				fail(r.jid.String(), err)
+				bridgeError.set(err)
+				logf(m.source, "failed to send message %s to room %s: %s", id, r.jid, err)
+				continue
+			}
+			messagesSent.inc(m.source, m.metricSeverity())
+		}
+	}
+	if d.acks != nil && len(m.recipients) > 0 {
+		d.acks.sent(m, ids)
+	}
+	d.recent.add(m, failed, skipped)
+	if m.result != nil || d.audit != nil {
+		var results []recipientResult
+		for _, recipient := range m.recipients {
+			results = append(results, newRecipientResult(m.id, recipient.String(), skipReasons[recipient.String()], failedOnce[recipient.String()]))
+		}
+		for _, r := range m.rooms {
+			results = append(results, newRecipientResult(m.id, r.jid.String(), "", failedOnce[r.jid.String()]))
+		}
+		d.audit.record(m, false, results)
+		m.report(deliveryResult{recipients: results})
+	}
+	return ok
+}
+
+// sends the chat messages on the pool if there is one, returns the errors in
+// the order of the messages
+func (d *dispatcher) sendChats(ctx context.Context, sends []chatSend) []error {
+	if d.pool != nil {
+		return d.pool.send(ctx, sends)
+	}
+	errs := make([]error, len(sends))
+	for i, s := range sends {
+		errs[i] = d.client.send(ctx, s.message)
+	}
+	return errs
+}
+
+// sends the chat messages one by one with a pause of about the interval in
+// between, all at once if it's 0
+func (d *dispatcher) spreadChats(ctx context.Context, sends []chatSend, interval time.Duration) []error {
+	if interval <= 0 {
+		return d.sendChats(ctx, sends)
+	}
+	errs := make([]error, len(sends))
+	for i := range sends {
+		if i > 0 {
+			d.pause(ctx, interval)
+		}
+		errs[i] = d.sendChats(ctx, sends[i:i+1])[0]
+	}
+	return errs
+}
+
+// returns the jid the message is sent to: full jids as they are, bare jids
+// depending on the resource mode
+func (d *dispatcher) target(recipient jid.JID) jid.JID {
+	if recipient.Resourcepart() != "" || d.resourceMode != resourceHighestPriority {
+		return recipient
+	}
+	// the server decides if none is available
+	if full, ok := d.presence.highestPriority(recipient); ok {
+		return full
+	}
+	return recipient
+}
+
+// returns the body with the timestamp, truncated or split into parts
+func (d *dispatcher) parts(body string, alertTime time.Time) []string {
+	if d.timestampLayout != "" {
+		// use the time of the alert if known, the delivery time otherwise
+		t := alertTime
+		if t.IsZero() {
+			t = time.Now()
+		}
+		if d.timestampAppend {
+			body += "\n" + t.In(d.timezone).Format(d.timestampLayout)
+		} else {
+			body = "[" + t.In(d.timezone).Format(d.timestampLayout) + "] " + body
+		}
+	}
+	if d.lengthPolicy == lengthSplit {
+		return splitMessage(body, d.maxMessageLength)
+	}
+	return []string{truncateMessage(body, d.maxMessageLength)}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+func TestDeliverExpired(t *testing.T) {
+	server := &fakeServer{}
+	address := jid.MustParse("bot@example.net")
+	presence := newPresenceTracker()
+	setup := sessionSetup{presence: presence, address: address, nick: "bot"}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, setup.run, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	conn := server.conn(t, 0)
+
+	d := &dispatcher{client: client, presence: presence, from: address}
+	alice := []jid.JID{jid.MustParse("alice@example.net")}
+	ctx := context.Background()
+	if d.deliver(ctx, alertMessage{id: "stale", source: "ci", body: "disk full", created: time.Now().Add(-time.Hour), ttl: 10 * time.Minute, recipients: alice}) {
+		t.Error("expired message was delivered")
+	}
+	if !d.deliver(ctx, alertMessage{id: "fresh", source: "ci", body: "disk almost full", created: time.Now(), ttl: 10 * time.Minute, recipients: alice}) {
+		t.Error("message wasn't delivered")
+	}
+	waitFor(t, "the fresh message", func() bool { return strings.Contains(conn.received(), "disk almost full") })
+	received := conn.received()
+	if strings.Contains(received, `id="stale"`) {
+		t.Errorf("expired message was sent: %s", received)
+	}
+	if !strings.Contains(received, `<amp xmlns="http://jabber.org/protocol/amp"><rule condition="expire-at" action="drop" value="`) {
+		t.Errorf("no amp rule: %s", received)
+	}
+	if text := metricText(messagesExpired); !strings.Contains(text, `xmpp_messages_expired_total{endpoint="ci"} 1`) {
+		t.Errorf("expired message wasn't counted for its source: %s", text)
+	}
+	if text := metricText(messagesSent); !strings.Contains(text, `xmpp_messages_sent_total{endpoint="ci",severity="unknown"} 1`) {
+		t.Errorf("sent message wasn't counted for its source: %s", text)
+	}
+}
+
+func TestDeliverNick(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	conn := server.conn(t, 0)
+
+	d := &dispatcher{client: client, presence: newPresenceTracker(), from: jid.MustParse("bot@example.net")}
+	m := alertMessage{
+		id:         "m1",
+		body:       "HighErrorRate",
+		nick:       "Grafana",
+		recipients: []jid.JID{jid.MustParse("alice@example.net")},
+		rooms:      []room{{jid: jid.MustParse("ops@conference.example.net")}},
+	}
+	if !d.deliver(context.Background(), m) {
+		t.Fatal("message wasn't delivered")
+	}
+	waitFor(t, "the room message", func() bool { return strings.Contains(conn.received(), `type="groupchat"`) })
+	received := conn.received()
+	if strings.Count(received, `<nick xmlns="http://jabber.org/protocol/nick">Grafana</nick>`) != 1 {
+		t.Errorf("the direct message (only) should carry the nick: %s", received)
+	}
+}
+
+func TestDeliverSpread(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	conn := server.conn(t, 0)
+
+	recipients := []jid.JID{jid.MustParse("alice@example.net"), jid.MustParse("bob@example.net")}
+	rooms := []room{{jid: jid.MustParse("ops@conference.example.net")}}
+	d := &dispatcher{client: client, presence: newPresenceTracker(), from: jid.MustParse("bot@example.net"), spread: 200 * time.Millisecond, spreadMin: 3, stopped: make(chan struct{})}
+	if got := d.spreadInterval(2); got != 0 {
+		t.Errorf("spread below the min. recipients: %s", got)
+	}
+	if got := d.spreadInterval(3); got != 100*time.Millisecond {
+		t.Errorf("interval %s, want 100ms", got)
+	}
+
+	// 2 pauses of at least half the interval
+	start := time.Now()
+	if !d.deliver(context.Background(), alertMessage{id: "m1", body: "disk full", recipients: recipients, rooms: rooms}) {
+		t.Fatal("message wasn't delivered")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("sends weren't spread, took %s", elapsed)
+	}
+	waitFor(t, "all sends", func() bool { return strings.Count(conn.received(), "disk full") == 3 })
+
+	// the pauses end on shutdown
+	d.spread = time.Hour
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		d.stop()
+	}()
+	start = time.Now()
+	if !d.deliver(context.Background(), alertMessage{id: "m2", body: "disk still full", recipients: recipients, rooms: rooms}) {
+		t.Fatal("message wasn't delivered")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sends weren't flushed on shutdown, took %s", elapsed)
+	}
+	waitFor(t, "all sends", func() bool { return strings.Count(conn.received(), "disk still full") == 3 })
+}
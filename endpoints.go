@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+)
+
+// parses the comma-separated list of served endpoints, each given as
+// name=type or just the type: grafana,team-a=alertmanager,ops-grafana=grafana
+// returns the parser type per endpoint, nil if unset (all built-in endpoints)
+func parseEndpoints(s string, templates map[string]*parser.TemplateFile) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	types := make(map[string]string)
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		name, typ := e, e
+		if i := strings.Index(e, "="); i >= 0 {
+			name, typ = e[:i], e[i+1:]
+		}
+		switch {
+		case name == "" || typ == "":
+			return nil, errors.New("endpoint " + e + " must be given as name=type")
+		case strings.Contains(name, "/"):
+			return nil, errors.New("endpoint " + name + " must not contain /")
+		case reservedEndpoints[name]:
+			return nil, errors.New("endpoint " + name + " is reserved")
+		case templates[name] != nil:
+			return nil, errors.New("endpoint " + name + " is already a templated endpoint")
+		case parser.Registry[typ] == nil && !builtinEndpoints[typ]:
+			return nil, errors.New("endpoint " + name + " has the unknown type " + typ)
+		case name != typ && (parser.Registry[name] != nil || builtinEndpoints[name]):
+			// e.g. slack=grafana would be confusing
+			return nil, errors.New("endpoint " + name + " is the name of another type")
+		}
+		if _, ok := types[name]; ok {
+			return nil, errors.New("endpoint " + name + " is listed twice")
+		}
+		types[name] = typ
+	}
+	if len(types) == 0 {
+		return nil, errors.New("no endpoints listed")
+	}
+	return types, nil
+}
+
+// rejects requests without the token of the endpoint, if it has one
+func requireToken(token string) middleware {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isAdmin(r, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="xmpp-webhook"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte("unauthorized"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	templates := map[string]*parser.TemplateFile{"jenkins": {}}
+	tests := []struct {
+		in   string
+		want map[string]string
+		err  bool
+	}{
+		{in: "", want: nil},
+		{in: "grafana, team-a=alertmanager,ops-grafana=grafana", want: map[string]string{"grafana": "grafana", "team-a": "alertmanager", "ops-grafana": "grafana"}},
+		{in: "lines,ci=json", want: map[string]string{"lines": "lines", "ci": "json"}},
+		{in: ",", err: true},
+		{in: "team=unknown", err: true},
+		{in: "slack=grafana", err: true},
+		{in: "metrics=grafana", err: true},
+		{in: "jenkins=slack", err: true},
+		{in: "a/b=grafana", err: true},
+		{in: "=grafana", err: true},
+		{in: "team=alertmanager,team=grafana", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEndpoints(tt.in, templates)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEndpointToken(t *testing.T) {
+	messages := make(chan alertMessage, 10)
+	h := newMessageHandler("team-a", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full"}, nil
+	})
+	h.token = "s3cret"
+	handler := h.withMiddlewares(defaultMiddlewares)
+
+	tests := []struct {
+		name string
+		auth func(r *http.Request)
+		want int
+	}{
+		{name: "missing", auth: func(*http.Request) {}, want: http.StatusUnauthorized},
+		{name: "wrong", auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, want: http.StatusUnauthorized},
+		{name: "bearer", auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, want: http.StatusOK},
+		{name: "basic", auth: func(r *http.Request) { r.SetBasicAuth("grafana", "s3cret") }, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/team-a", strings.NewReader("{}"))
+		tt.auth(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if len(messages) != 2 {
+		t.Errorf("%d messages, want 2", len(messages))
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// checks raw xml elements added to the outgoing messages, e.g.
+// <store xmlns="urn:xmpp:hints"/><x xmlns="urn:example:ops" team="db"/>
+// every top-level element needs its own namespace, so it can't end up in jabber:client
+func parseStanzaExtensions(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	d := xml.NewDecoder(strings.NewReader(s))
+	depth := 0
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.New("malformed xml: " + err.Error())
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth == 0 && !hasNamespace(t) {
+				return "", errors.New("element " + t.Name.Local + " needs an xmlns attribute")
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && strings.TrimSpace(string(t)) != "" {
+				return "", errors.New("text outside of an element")
+			}
+		case xml.ProcInst:
+			return "", errors.New("processing instructions aren't allowed")
+		case xml.Directive:
+			return "", errors.New("directives aren't allowed")
+		}
+	}
+	// RawToken doesn't check that the elements match and are closed
+	d = xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return "", errors.New("malformed xml: " + err.Error())
+		}
+	}
+}
+
+// checks if the element declares its (default or prefixed) namespace
+func hasNamespace(start xml.StartElement) bool {
+	for _, a := range start.Attr {
+		if a.Name.Space == "" && a.Name.Local == "xmlns" && a.Value != "" {
+			return start.Name.Space == ""
+		}
+		if a.Name.Space == "xmlns" && a.Name.Local == start.Name.Space {
+			return true
+		}
+	}
+	return false
+}
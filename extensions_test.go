@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"mellium.im/xmpp/stanza"
+)
+
+func TestParseStanzaExtensions(t *testing.T) {
+	tests := []struct {
+		xml string
+		err bool
+	}{
+		{xml: ``},
+		{xml: `<store xmlns="urn:xmpp:hints"/>`},
+		{xml: ` <store xmlns="urn:xmpp:hints"/> <x xmlns="urn:example:ops" team="db"><y/></x> `},
+		{xml: `<ops:x xmlns:ops="urn:example:ops"/>`},
+		{xml: `<store/>`, err: true},
+		{xml: `<ops:x/>`, err: true},
+		{xml: `<store xmlns="urn:xmpp:hints">`, err: true},
+		{xml: `<a xmlns="urn:example"></b>`, err: true},
+		{xml: `text`, err: true},
+		{xml: `<?xml version="1.0"?><a xmlns="urn:example"/>`, err: true},
+	}
+	for _, tt := range tests {
+		_, err := parseStanzaExtensions(tt.xml)
+		if (err != nil) != tt.err {
+			t.Errorf("parseStanzaExtensions(%q): got error %v, want error %v", tt.xml, err, tt.err)
+		}
+	}
+}
+
+func TestMessageExtensions(t *testing.T) {
+	b, err := xml.Marshal(MessageBody{Message: stanza.Message{Type: stanza.ChatMessage}, Body: "disk full", Extensions: `<x xmlns="urn:example:ops" team="db"/>`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `<body>disk full</body><x xmlns="urn:example:ops" team="db"/></message>`) {
+		t.Errorf("extensions missing: %s", b)
+	}
+}
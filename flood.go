@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+var (
+	floodPaused  = newGauge("xmpp_endpoint_paused", "Whether the endpoint is paused because it flooded (1) or not (0).", "endpoint")
+	floodDropped = newCounter("xmpp_flood_dropped_total", "Messages dropped while their endpoint was paused because it flooded.", "endpoint")
+)
+
+// state of an endpoint's flood protection
+type floodState struct {
+	sent    []time.Time // the messages within the window, oldest first
+	paused  time.Time   // when the endpoint was paused, zero if it isn't
+	dropped int         // messages dropped since then
+}
+
+// pauses endpoints that send more than limit messages within the window for
+// the cooldown, so a runaway alert doesn't flood the recipients; the admins
+// get a notice when an endpoint is paused and when it resumes
+type floodGuard struct {
+	limit    int
+	window   time.Duration
+	cooldown time.Duration
+	now      func() time.Time
+
+	messages   chan<- alertMessage
+	recipients []jid.JID
+	rooms      []room
+
+	mu        sync.Mutex
+	endpoints map[string]*floodState
+	timers    map[string]*time.Timer // resume the paused endpoints
+	done      chan struct{}          // closed by stop
+	notifying sync.WaitGroup         // notices being sent
+}
+
+func newFloodGuard(limit int, window time.Duration, cooldown time.Duration, messages chan<- alertMessage, recipients []jid.JID, rooms []room) *floodGuard {
+	return &floodGuard{
+		limit:      limit,
+		window:     window,
+		cooldown:   cooldown,
+		now:        time.Now,
+		messages:   messages,
+		recipients: recipients,
+		rooms:      rooms,
+		endpoints:  make(map[string]*floodState),
+		timers:     make(map[string]*time.Timer),
+		done:       make(chan struct{}),
+	}
+}
+
+// counts a message of the endpoint and returns whether it may be sent, the
+// message exceeding the limit pauses the endpoint
+func (g *floodGuard) allow(ctx context.Context, endpoint string, source string) bool {
+	if g == nil {
+		return true
+	}
+	now := g.now()
+	g.mu.Lock()
+	s := g.endpoints[endpoint]
+	if s == nil {
+		s = &floodState{}
+		g.endpoints[endpoint] = s
+	}
+	var notices []string
+	if !s.paused.IsZero() {
+		if now.Sub(s.paused) < g.cooldown {
+			s.dropped++
+			g.mu.Unlock()
+			floodDropped.inc(source)
+			return false
+		}
+		// the cooldown is over, but the timer didn't resume the endpoint yet
+		if t := g.timers[endpoint]; t != nil {
+			t.Stop()
+			delete(g.timers, endpoint)
+		}
+		notices = append(notices, g.resumeLocked(endpoint, source, s))
+	}
+	// forget the messages that left the window
+	i := 0
+	for i < len(s.sent) && now.Sub(s.sent[i]) >= g.window {
+		i++
+	}
+	s.sent = append(s.sent[i:], now)
+	allowed := len(s.sent) <= g.limit
+	if !allowed {
+		s.sent, s.paused, s.dropped = nil, now, 1
+		g.resumeAfter(endpoint, source, s.paused)
+		notices = append(notices, fmt.Sprintf("[xmpp-webhook] endpoint /%s paused due to flooding: more than %d messages within %s, its messages are dropped for %s", endpoint, g.limit, g.window, g.cooldown))
+		log.Printf("pausing endpoint /%s for %s, more than %d messages within %s", endpoint, g.cooldown, g.limit, g.window)
+		floodPaused.set(1, source)
+		floodDropped.inc(source)
+	}
+	g.mu.Unlock()
+
+	for _, notice := range notices {
+		g.notify(ctx, endpoint, source, notice)
+	}
+	return allowed
+}
+
+// starts the timer resuming the endpoint after the cooldown, unless the guard
+// was stopped; g.mu must be held
+func (g *floodGuard) resumeAfter(endpoint string, source string, paused time.Time) {
+	select {
+	case <-g.done:
+		return
+	default:
+	}
+	g.timers[endpoint] = time.AfterFunc(g.cooldown, func() { g.resume(endpoint, source, paused) })
+}
+
+// resumes the endpoint after the cooldown of the pause that started at paused,
+// unless it was resumed already
+func (g *floodGuard) resume(endpoint string, source string, paused time.Time) {
+	g.mu.Lock()
+	s := g.endpoints[endpoint]
+	if s == nil || !s.paused.Equal(paused) {
+		g.mu.Unlock()
+		return
+	}
+	delete(g.timers, endpoint)
+	notice := g.resumeLocked(endpoint, source, s)
+	g.mu.Unlock()
+	g.notify(context.Background(), endpoint, source, notice)
+}
+
+// resets the state of the paused endpoint, returns the notice about it
+func (g *floodGuard) resumeLocked(endpoint string, source string, s *floodState) string {
+	log.Printf("endpoint /%s resumed after %s, %d message(s) dropped", endpoint, g.cooldown, s.dropped)
+	notice := fmt.Sprintf("[xmpp-webhook] endpoint /%s resumed, %d message(s) were dropped while it was paused", endpoint, s.dropped)
+	*s = floodState{}
+	floodPaused.set(0, source)
+	return notice
+}
+
+// sends the notice to the admins, if there are any and the guard wasn't
+// stopped
+func (g *floodGuard) notify(ctx context.Context, endpoint string, source string, notice string) {
+	if len(g.recipients) == 0 && len(g.rooms) == 0 {
+		return
+	}
+	g.mu.Lock()
+	select {
+	case <-g.done:
+		g.mu.Unlock()
+		return
+	default:
+	}
+	g.notifying.Add(1)
+	g.mu.Unlock()
+	defer g.notifying.Done()
+	m := alertMessage{
+		id:         newMessageID(),
+		endpoint:   endpoint,
+		source:     source,
+		body:       notice,
+		severity:   parser.SeverityWarning,
+		created:    g.now(),
+		recipients: g.recipients,
+		rooms:      g.rooms,
+	}
+	select {
+	case g.messages <- m:
+	case <-ctx.Done():
+	case <-g.done:
+	}
+}
+
+// stops the timers of the paused endpoints and waits for the notices being
+// sent, they give up; nothing is sent to the messages afterwards, so they can
+// be closed on shutdown
+func (g *floodGuard) stop() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	select {
+	case <-g.done:
+	default:
+		close(g.done)
+	}
+	for endpoint, t := range g.timers {
+		t.Stop()
+		delete(g.timers, endpoint)
+	}
+	g.mu.Unlock()
+	g.notifying.Wait()
+}
+
+// returns the paused endpoints with the time they resume, sorted by name
+func (g *floodGuard) paused() []pausedEndpoint {
+	if g == nil {
+		return nil
+	}
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var paused []pausedEndpoint
+	for endpoint, s := range g.endpoints {
+		if !s.paused.IsZero() && now.Sub(s.paused) < g.cooldown {
+			paused = append(paused, pausedEndpoint{Endpoint: endpoint, Until: s.paused.Add(g.cooldown), Dropped: s.dropped})
+		}
+	}
+	sort.Slice(paused, func(i, j int) bool { return paused[i].Endpoint < paused[j].Endpoint })
+	return paused
+}
+
+// endpoint paused because it flooded, shown on the status page and the health check
+type pausedEndpoint struct {
+	Endpoint string    `json:"endpoint"`
+	Until    time.Time `json:"until"`
+	Dropped  int       `json:"dropped"`
+}
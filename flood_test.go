@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+func TestFloodGuard(t *testing.T) {
+	alice := jid.MustParse("alice@example.net")
+	admin := jid.MustParse("ops@example.net")
+	h, messages := testHandler("noisy")
+	h.source = "noisy"
+	h.flood = newFloodGuard(3, time.Minute, 10*time.Minute, messages, []jid.JID{admin}, nil)
+	now := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+	h.flood.now = func() time.Time { return now }
+	send := func() responseMessage {
+		return h.dispatch(context.Background(), parser.Result{Message: "disk full", Severity: parser.SeverityCritical}, []jid.JID{alice}, nil, false, false, 0, false)
+	}
+	// returns the bodies of the messages sent since the last call
+	received := func() []string {
+		var bodies []string
+		for len(messages) > 0 {
+			bodies = append(bodies, (<-messages).body)
+		}
+		return bodies
+	}
+
+	// messages that left the window don't count
+	send()
+	now = now.Add(time.Minute)
+	send()
+	send()
+	send()
+	if got := received(); len(got) != 4 {
+		t.Fatalf("%d messages below the limit were sent", len(got))
+	}
+
+	// the message exceeding the limit pauses the endpoint
+	if handled := send(); handled.Delivery != "suppressed (flooding)" {
+		t.Errorf("message exceeding the limit was %q", handled.Delivery)
+	}
+	got := received()
+	if len(got) != 1 || !strings.HasPrefix(got[0], "[xmpp-webhook] endpoint /noisy paused due to flooding: more than 3 messages within 1m0s") {
+		t.Fatalf("unexpected notice %q", got)
+	}
+	now = now.Add(5 * time.Minute)
+	send()
+	if got := received(); len(got) != 0 {
+		t.Errorf("messages of the paused endpoint were sent: %q", got)
+	}
+
+	// the paused endpoint is shown by the health check
+	status := &statusHandler{client: &xmppClient{}, flood: h.flood}
+	w := httptest.NewRecorder()
+	status.health(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var health struct {
+		Paused []pausedEndpoint `json:"paused"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if len(health.Paused) != 1 || health.Paused[0].Endpoint != "noisy" || health.Paused[0].Dropped != 2 || !health.Paused[0].Until.Equal(now.Add(5*time.Minute)) {
+		t.Errorf("unexpected paused endpoints %+v", health.Paused)
+	}
+
+	// after the cooldown, the endpoint resumes with a notice
+	now = now.Add(5 * time.Minute)
+	if handled := send(); handled.Delivery == "suppressed (flooding)" {
+		t.Error("message after the cooldown was dropped")
+	}
+	got = received()
+	if len(got) != 2 || got[0] != "[xmpp-webhook] endpoint /noisy resumed, 2 message(s) were dropped while it was paused" || got[1] != "disk full" {
+		t.Errorf("unexpected messages after the cooldown %q", got)
+	}
+	if paused := h.flood.paused(); len(paused) != 0 {
+		t.Errorf("endpoints still paused: %+v", paused)
+	}
+	if n := floodDropped.sum(); n != 2 {
+		t.Errorf("%v messages dropped, want 2", n)
+	}
+}
+
+func TestFloodGuardStop(t *testing.T) {
+	admin := []jid.JID{jid.MustParse("ops@example.net")}
+	// nobody reads the messages, the notice of the pause blocks
+	messages := make(chan alertMessage)
+	g := newFloodGuard(1, time.Minute, 20*time.Millisecond, messages, admin, nil)
+	g.allow(context.Background(), "stopped", "stopped")
+	allowed := make(chan bool)
+	go func() { allowed <- g.allow(context.Background(), "stopped", "stopped") }()
+	time.Sleep(10 * time.Millisecond)
+
+	// stopping unblocks the notice and the pending resume never sends
+	stopped := make(chan struct{})
+	go func() {
+		g.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop didn't return while a notice was pending")
+	}
+	if <-allowed {
+		t.Error("message exceeding the limit was allowed")
+	}
+	close(messages)
+	time.Sleep(50 * time.Millisecond)
+	if len(g.timers) != 0 {
+		t.Errorf("%d resume timers left after stop", len(g.timers))
+	}
+	g.stop()
+}
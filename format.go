@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"mellium.im/xmpp/jid"
+)
+
+// how the bodies of the messages are formatted for a recipient
+const (
+	formatStyling = "styling" // XEP-0393 message styling, as produced by the parsers
+	formatPlain   = "plain"   // the styling is removed, clients are told not to style
+	formatXHTML   = "xhtml"   // the styling is also sent as XHTML-IM (XEP-0071)
+)
+
+// urls turned into links in xhtml bodies
+var formatURL = regexp.MustCompile(`https?://[^\s<>"]+[^\s<>".,;:!?)\]]`)
+
+// rich text of the message (XEP-0071), next to the plain body
+type messageXHTML struct {
+	Body struct {
+		XML string `xml:",innerxml"`
+	} `xml:"http://www.w3.org/1999/xhtml body"`
+}
+
+// format of the messages per recipient, the default for everyone else
+type messageFormats struct {
+	def        string
+	recipients map[string]string // by bare jid
+}
+
+// returns the format of the recipient (or room)
+func (f *messageFormats) of(recipient jid.JID) string {
+	if f == nil {
+		return formatStyling
+	}
+	if format, ok := f.recipients[recipient.Bare().String()]; ok {
+		return format
+	}
+	return f.def
+}
+
+// formats the body (and translations) of the message for the recipient
+func (f *messageFormats) apply(msg *MessageBody, recipient jid.JID) {
+	switch f.of(recipient) {
+	case formatPlain:
+		msg.Body = unstyle(msg.Body)
+		if msg.Translations != nil {
+			translated := make(translatedBodies, len(msg.Translations))
+			for lang, t := range msg.Translations {
+				translated[lang] = unstyle(t)
+			}
+			msg.Translations = translated
+		}
+		msg.Unstyled = &struct{}{}
+	case formatXHTML:
+		msg.HTML = &messageXHTML{}
+		msg.HTML.Body.XML = styleToXHTML(msg.Body)
+	}
+}
+
+// checks the name of a format
+func parseMessageFormat(s string) (string, error) {
+	switch s {
+	case formatStyling, formatPlain, formatXHTML:
+		return s, nil
+	}
+	return "", errors.New("unknown format " + s + ", must be styling, plain or xhtml")
+}
+
+// parses the formats of the recipients: alice@example.com=plain,bob@example.com=xhtml
+func parseRecipientFormats(s string) (map[string]string, error) {
+	formats := make(map[string]string)
+	for _, e := range strings.Split(s, ",") {
+		if e == "" {
+			continue
+		}
+		i := strings.LastIndex(e, "=")
+		if i < 1 || i == len(e)-1 {
+			return nil, errors.New("recipient format " + e + " must be given as jid=format")
+		}
+		j, err := jid.Parse(e[:i])
+		if err != nil {
+			return nil, errors.New("invalid recipient " + e[:i] + ": " + err.Error())
+		}
+		formats[j.Bare().String()], err = parseMessageFormat(e[i+1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return formats, nil
+}
+
+// span of a line in message styling
+type styleSpan struct {
+	marker byte // *, _, ~ or `, 0 for plain text
+	text   string
+}
+
+// splits a line into its styled spans: a span starts with a marker at the
+// beginning of the line or after whitespace, and ends with the same marker
+// on the line that doesn't follow whitespace; spans don't nest
+func styleSpans(line string) []styleSpan {
+	var spans []styleSpan
+	start := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if !strings.ContainsRune("*_~`", rune(c)) || (i > 0 && !unicode.IsSpace(rune(line[i-1]))) || i+1 == len(line) || unicode.IsSpace(rune(line[i+1])) {
+			continue
+		}
+		end := -1
+		for j := i + 2; j < len(line); j++ {
+			if line[j] == c && !unicode.IsSpace(rune(line[j-1])) {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			continue
+		}
+		if i > start {
+			spans = append(spans, styleSpan{text: line[start:i]})
+		}
+		spans = append(spans, styleSpan{marker: c, text: line[i+1 : end]})
+		start = end + 1
+		i = end
+	}
+	if start < len(line) {
+		spans = append(spans, styleSpan{text: line[start:]})
+	}
+	return spans
+}
+
+// removes the styling of the body: the markers of the spans and the fences
+// of the preformatted blocks, quotes stay as they are
+func unstyle(body string) string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "```") {
+			continue
+		}
+		var b strings.Builder
+		for _, s := range styleSpans(line) {
+			b.WriteString(s.text)
+		}
+		lines = append(lines, b.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renders the styling of the body as xhtml-im: strong, em, struck through
+// and code spans, preformatted blocks, quotes and links
+func styleToXHTML(body string) string {
+	var b strings.Builder
+	// the current block, pre, blockquote or empty for text, and its lines
+	var block string
+	var lines []string
+	flush := func() {
+		switch block {
+		case "pre":
+			b.WriteString("<pre>" + strings.Join(lines, "\n") + "</pre>")
+		case "blockquote":
+			b.WriteString("<blockquote>" + strings.Join(lines, "<br/>") + "</blockquote>")
+		default:
+			b.WriteString(strings.Join(lines, "<br/>"))
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(body, "\n") {
+		fence := strings.HasPrefix(line, "```")
+		switch {
+		case block == "pre" && !fence:
+			lines = append(lines, escapeXHTML(line))
+			continue
+		case fence:
+			if block == "pre" {
+				flush()
+				block = ""
+			} else {
+				if len(lines) > 0 {
+					flush()
+				}
+				block = "pre"
+			}
+			continue
+		}
+		kind := ""
+		if strings.HasPrefix(line, ">") {
+			kind, line = "blockquote", strings.TrimSpace(line[1:])
+		}
+		if kind != block {
+			if len(lines) > 0 {
+				flush()
+			}
+			block = kind
+		}
+		lines = append(lines, spansToXHTML(line))
+	}
+	// an unclosed block ends with the body
+	if len(lines) > 0 || block == "pre" {
+		flush()
+	}
+	return b.String()
+}
+
+// renders the spans of a line
+func spansToXHTML(line string) string {
+	var b strings.Builder
+	for _, s := range styleSpans(line) {
+		switch s.marker {
+		case '*':
+			b.WriteString("<strong>" + xhtmlText(s.text) + "</strong>")
+		case '_':
+			b.WriteString("<em>" + xhtmlText(s.text) + "</em>")
+		case '~':
+			b.WriteString(`<span style="text-decoration: line-through">` + xhtmlText(s.text) + "</span>")
+		case '`':
+			b.WriteString("<code>" + escapeXHTML(s.text) + "</code>")
+		default:
+			b.WriteString(xhtmlText(s.text))
+		}
+	}
+	return b.String()
+}
+
+func escapeXHTML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// escapes the text and links its urls
+func xhtmlText(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range formatURL.FindAllStringIndex(s, -1) {
+		u := escapeXHTML(s[m[0]:m[1]])
+		b.WriteString(escapeXHTML(s[last:m[0]]) + `<a href="` + u + `">` + u + "</a>")
+		last = m[1]
+	}
+	b.WriteString(escapeXHTML(s[last:]))
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"mellium.im/xmpp/jid"
+)
+
+func TestUnstyle(t *testing.T) {
+	for body, want := range map[string]string{
+		"*FIRING* disk full":             "FIRING disk full",
+		"_db01_ is ~down~ since `12:00`": "db01 is down since 12:00",
+		"2*3*4 and snake_case_name":      "2*3*4 and snake_case_name",
+		"```\nlog line\n```\n> quoted":   "log line\n> quoted",
+		"*not closed\non the next line*": "*not closed\non the next line*",
+	} {
+		if got := unstyle(body); got != want {
+			t.Errorf("unstyle(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestStyleToXHTML(t *testing.T) {
+	for body, want := range map[string]string{
+		"*FIRING* disk <full>":                 "<strong>FIRING</strong> disk &lt;full&gt;",
+		"_a_ ~b~ `c & d`":                      `<em>a</em> <span style="text-decoration: line-through">b</span> <code>c &amp; d</code>`,
+		"see https://example.com/d/1?a=1&b=2.": `see <a href="https://example.com/d/1?a=1&amp;b=2">https://example.com/d/1?a=1&amp;b=2</a>.`,
+		"first\nsecond":                        "first<br/>second",
+		"log:\n```\n*raw*\n```\n> one\n> two":  "log:<pre>*raw*</pre><blockquote>one<br/>two</blockquote>",
+	} {
+		if got := styleToXHTML(body); got != want {
+			t.Errorf("styleToXHTML(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestMessageFormats(t *testing.T) {
+	formats, err := parseRecipientFormats("alice@example.net/phone=plain,bob@example.net=xhtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &messageFormats{def: formatStyling, recipients: formats}
+
+	format := func(to string) string {
+		msg := MessageBody{Body: "*FIRING* disk full", Translations: translatedBodies{"de": "*FIRING* Platte voll"}}
+		f.apply(&msg, jid.MustParse(to))
+		b, err := xml.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	// the format applies to all resources of the recipient
+	if got := format("alice@example.net/laptop"); !strings.Contains(got, "<body>FIRING disk full</body>") || !strings.Contains(got, ">FIRING Platte voll</body>") ||
+		!strings.Contains(got, `<unstyled xmlns="urn:xmpp:styling:0"></unstyled>`) {
+		t.Errorf("unexpected plain message %s", got)
+	}
+	if got := format("bob@example.net"); !strings.Contains(got, "<body>*FIRING* disk full</body>") ||
+		!strings.Contains(got, `<html xmlns="http://jabber.org/protocol/xhtml-im"><body xmlns="http://www.w3.org/1999/xhtml"><strong>FIRING</strong> disk full</body></html>`) {
+		t.Errorf("unexpected xhtml message %s", got)
+	}
+	if got := format("carol@example.net"); !strings.Contains(got, "<body>*FIRING* disk full</body>") || strings.Contains(got, "unstyled") || strings.Contains(got, "xhtml") {
+		t.Errorf("unexpected styled message %s", got)
+	}
+
+	if _, err := parseRecipientFormats("alice@example.net=markdown"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := parseRecipientFormats("alice@example.net"); err == nil {
+		t.Error("expected an error without a format")
+	}
+}
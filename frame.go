@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// data of the prefix and suffix templates of the messages
+type frameData struct {
+	Endpoint string
+	Source   string
+	Severity string
+	Status   string // firing, resolved or empty
+	Key      string
+	ID       string    // stanza id
+	Time     frameTime // when the alert fired, when the request came in if unknown
+}
+
+// time in the timezone of XMPP_TIMEZONE, shown without seconds unless
+// formatted otherwise, e.g. {{.Time.Format "15:04"}}
+type frameTime struct {
+	time.Time
+}
+
+func (t frameTime) String() string {
+	return t.Format("2006-01-02 15:04 MST")
+}
+
+// templates put before and after the messages of an endpoint, nil ones are
+// left out
+type messageFrame struct {
+	prefix   *template.Template
+	suffix   *template.Template
+	location *time.Location
+}
+
+// parses the prefix or suffix template and renders it once with sample data,
+// so mistakes show up at startup
+func parseFrameTemplate(name string, s string) (*template.Template, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(responseFuncs).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	sample := frameData{Endpoint: "test", Source: "test", Severity: "info", ID: "id", Time: frameTime{time.Now()}}
+	if err := t.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// returns the body with the prefix (separated by a space) and the suffix (on
+// a line of its own), empty renderings are left out
+func (f messageFrame) apply(body string, data frameData) (string, error) {
+	if f.location != nil {
+		data.Time = frameTime{data.Time.In(f.location)}
+	}
+	for _, t := range []*template.Template{f.prefix, f.suffix} {
+		if t == nil {
+			continue
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return body, err
+		}
+		s := strings.TrimSpace(b.String())
+		switch {
+		case s == "":
+		case t == f.prefix:
+			body = s + " " + body
+		default:
+			body += "\n" + s
+		}
+	}
+	return body, nil
+}
+
+// whether the endpoint has a prefix or suffix
+func (f messageFrame) enabled() bool {
+	return f.prefix != nil || f.suffix != nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+func TestMessageFrame(t *testing.T) {
+	if _, err := parseFrameTemplate("prefix", "[{{.Severity}]"); err == nil {
+		t.Error("parsed an invalid template")
+	}
+	if _, err := parseFrameTemplate("prefix", "[{{.Env}}]"); err == nil {
+		t.Error("parsed a template with an unknown field")
+	}
+	prefix, err := parseFrameTemplate("prefix", "[prod][{{.Severity}}]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffix, err := parseFrameTemplate("suffix", `{{if eq .Status "firing"}}— via {{.Endpoint}} at {{.Time}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan alertMessage, 2)
+	alertTime := time.Date(2024, 5, 14, 9, 12, 3, 0, time.UTC)
+	results := []parser.Result{
+		{Message: "disk full", Severity: parser.SeverityCritical, Status: parser.StatusFiring, Time: alertTime, Translations: map[string]string{"de": "Platte voll"}},
+		{Message: "disk ok", Severity: parser.SeverityInfo, Status: parser.StatusResolved},
+	}
+	h := newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+		r := results[0]
+		results = results[1:]
+		return r, nil
+	})
+	h.recipients = []jid.JID{jid.MustParse("alice@example.net")}
+	h.frame = messageFrame{prefix: prefix, suffix: suffix, location: time.FixedZone("CEST", 2*60*60)}
+	for _, want := range []struct{ body, de string }{
+		{"[prod][critical] disk full\n— via grafana at 2024-05-14 11:12 CEST", "[prod][critical] Platte voll\n— via grafana at 2024-05-14 11:12 CEST"},
+		// the suffix renders empty for resolved alerts
+		{"[prod][info] disk ok", ""},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana", strings.NewReader("{}")))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d %s", w.Code, w.Body.String())
+		}
+		m := <-messages
+		if m.body != want.body || m.translations["de"] != want.de {
+			t.Errorf("got %q and %q, want %q", m.body, m.translations["de"], want.body)
+		}
+	}
+}
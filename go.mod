@@ -1,12 +1,13 @@
 module github.com/tmsmr/xmpp-webhook
 
 require (
+	github.com/itchyny/gojq v0.12.7
 	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83 // indirect
-	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110 // indirect
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 	golang.org/x/text v0.3.5 // indirect
 	mellium.im/sasl v0.2.2-0.20190711145101-7aedd692081c
 	mellium.im/xmlstream v0.15.2
 	mellium.im/xmpp v0.18.0
 )
 
-go 1.15
+go 1.16
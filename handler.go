@@ -1,36 +1,809 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
 )
 
-// interface for parser functions
-type parserFunc func(*http.Request) (string, error)
+var resolvedSuppressed = newCounter("xmpp_resolved_suppressed_total", "Resolved notifications that were dropped.", "endpoint")
+
+var requestTimeouts = newCounter("xmpp_webhook_request_timeouts_total", "Requests that weren't parsed and enqueued within the timeout of the endpoint.", "endpoint")
 
 type messageHandler struct {
-	messages   chan<- string // chan to xmpp client
-	parserFunc parserFunc
+	endpoint   string
+	source     string              // label of the endpoint in logs and metrics, the endpoint by default
+	messages   chan<- alertMessage // chan to xmpp client
+	parserFunc parser.ParserFunc
+	onlineOnly bool // only notify recipients that are online
+	// request the recipients' attention for every message or just critical ones
+	attention         bool
+	attentionCritical bool
+	// group the messages of an alert into a thread
+	threads bool
+	// raw xml elements added to the messages, optional
+	extensions string
+	// de-escalates the notifications of acknowledged alerts (downgrade or
+	// suppress), disabled if nil
+	acks              *ackTracker
+	deescalate        string
+	deescalateProfile *DeliveryProfile
+	// convert html in the messages to plain text
+	stripHTML bool
+	// trim trailing whitespace and collapse blank lines in the messages
+	tidyWhitespace bool
+	// renders the response of successful requests, the default response if nil
+	response *template.Template
+	// how the direct messages are sent, nil for the defaults
+	delivery *DeliveryProfile
+	// credentials for fetching the images of the messages, optional
+	imageAuth *imageAuth
+	// accepted content types, every content type is accepted if empty
+	contentTypes []string
+	// accepted http methods
+	methods []string
+
+	// recipients used if the request doesn't specify any
+	recipients []jid.JID
+	rooms      []room
+	// honor the recipients query parameter
+	recipientOverride bool
+	// answer ?recipients= with 403 if the override isn't allowed, instead of ignoring it
+	rejectOverride bool
+	// domains the recipients of the query parameter may belong to, all if nil
+	allowedDomains []string
+	// select the recipients by the parsed fields, first match wins
+	routes []route
+	// treat full jids as their bare jid when removing duplicate recipients
+	dedupeBare bool
+	// max. number of recipients (incl. rooms) per message, 0 is unlimited
+	maxRecipients int
+	// cut down the recipients to the limit instead of rejecting the message
+	truncateRecipients bool
+
+	// jq expression that reshapes the json body before it's parsed, optional
+	transform *transform
+	// severity of messages without one, optional
+	defaultSeverity string
+	// dotted path of the severity in JSON bodies, overrides the one of the parser, optional
+	severityField string
+	// dotted path of the recipients in JSON bodies, overrides the ones of the parser, optional
+	recipientsField string
+
+	// drop resolved notifications
+	suppressResolved bool
+	// refer to the firing alert in resolved notifications, nil if disabled
+	alerts *alertTracker
+	// prefixes of the messages by normalized status
+	statusPrefixes map[string]string
+	// the messages of the parser state the status already, they only get the
+	// prefixes that are set explicitly
+	statusShown    bool
+	customPrefixes map[string]bool
+	// templates before and after the messages, optional
+	frame messageFrame
+
+	// don't notify during these hours (except for critical alerts), nil if disabled
+	quietHours *quietHours
+	// hold back messages during the quiet hours, they are dropped if nil
+	quietQueue *quietQueue
+	// count repeats of the messages instead of sending them, disabled if nil
+	coalesce *coalescer
+	// pauses the endpoint when it floods, disabled if nil
+	flood *floodGuard
+	// holds the messages with deliver_at until their time, disabled if nil
+	scheduler *scheduler
+	// max. time deliver_at may be ahead
+	maxScheduleAhead time.Duration
+
+	// log up to this many bytes of the body if parsing fails, 0 disables it
+	debugBodies int
+
+	// semaphore bounding the concurrent parses of all handlers (see limitConcurrency), unlimited if nil
+	parses chan struct{}
+
+	// buffer for messages while disconnected, rejects requests if full (with the block policy)
+	buffer *messageBuffer
+	// time senders should wait before retrying while disconnected
+	retryAfter time.Duration
+	// responses of requests with an idempotency key, disabled if nil
+	idempotency *idempotencyStore
+	// token the requests have to carry, optional
+	token string
+	// bounds parsing and enqueueing the messages of a request, unlimited if 0
+	timeout time.Duration
+	// messages not sent within this time are dropped, 0 never expires
+	ttl time.Duration
+	// nickname the direct messages are sent with (XEP-0172), optional
+	nick string
+	// tells the operators about requests that can't be parsed, disabled if nil
+	deadLetters *deadLetterNotifier
+	// answer after the messages were delivered, with the outcome per recipient,
+	// instead of after enqueueing them
+	syncDelivery bool
+	// max. time to wait for the delivery (also with the sync query parameter),
+	// answered with 202 afterwards
+	syncTimeout time.Duration
 }
 
-// http request handler
+// delivery of the messages that couldn't be enqueued before the request timed out
+const deliveryTimedOut = "timed out"
+
+// http request handler, the generic checks are done by the middlewares
 func (h *messageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// bound the time until the messages are enqueued, parsers may use the context
+	// too; it ends early if the client goes away or the server shuts down
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// get recipients of the message
+	recipients, rooms := h.recipients, h.rooms
+	override := r.URL.Query().Get("recipients")
+	if override != "" && !h.recipientOverride && h.rejectOverride {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("recipient override is disabled for /" + h.endpoint))
+		return
+	}
+	if override != "" && h.recipientOverride {
+		var ok bool
+		recipients, ok = h.requestedRecipients(w, override)
+		if !ok {
+			return
+		}
+		rooms = nil
+	}
+	var ok bool
+	recipients, rooms, ok = h.limitRecipients(w, recipients, rooms)
+	if !ok {
+		return
+	}
+
+	// the sender may wait for the delivery, up to the timeout of the endpoint
+	wait, waitTimeout := h.syncDelivery, h.syncTimeout
+	if v, ok := r.URL.Query()["sync"]; ok {
+		wait = true
+		if v[0] != "" {
+			d, err := time.ParseDuration(v[0])
+			if err != nil || d <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("invalid sync timeout"))
+				return
+			}
+			if d < waitTimeout {
+				waitTimeout = d
+			}
+		}
+	}
+
+	// the sender may limit how long the messages of the request stay useful
+	ttl := h.ttl
+	if s := r.URL.Query().Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid ttl"))
+			return
+		}
+		ttl = d
+	}
+
+	// the sender may schedule the messages of the request for later
+	var deliverAt time.Time
+	if s := r.URL.Query().Get("deliver_at"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid deliver_at, must be an RFC 3339 timestamp"))
+			return
+		}
+		deliverAt = t
+	}
+
+	// remember the body for debugging
+	var capture *bodyCapture
+	if h.debugBodies > 0 {
+		capture = &bodyCapture{ReadCloser: r.Body, max: h.debugBodies}
+		r.Body = capture
+	}
+	var deadLetterCapture *bodyCapture
+	if h.deadLetters != nil && h.deadLetters.includeBody {
+		deadLetterCapture = &bodyCapture{ReadCloser: r.Body, max: deadLetterBodySize + 1}
+		r.Body = deadLetterCapture
+	}
+
+	// reshape the body, the fields and the parser get the result
+	if h.transform != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("failed to read request body"))
+			return
+		}
+		body, err = h.transform.apply(ctx, body)
+		if err != nil {
+			if ctx.Err() != nil {
+				h.timedOut(ctx, w)
+				return
+			}
+			debugf(h.source, "transform of the request to /%s: %s", h.endpoint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	// get the severity and recipients from the configured fields, the parser gets the body as usual
+	var fieldSeverity, fieldRecipients string
+	if h.severityField != "" || h.recipientsField != "" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("failed to read request body"))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if v, ok := parser.FieldValue(body, h.severityField); ok && h.severityField != "" {
+			fieldSeverity = parser.NormalizeSeverity(v)
+		}
+		if v, ok := parser.FieldValues(body, h.recipientsField); ok && h.recipientsField != "" {
+			fieldRecipients = strings.Join(v, ",")
+		}
+	}
+
 	// parse/generate message from http request
-	m, err := h.parserFunc(r)
+	result, err := h.parserFunc(r)
+	if ctx.Err() != nil {
+		h.timedOut(ctx, w)
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		if capture != nil {
+			logf(h.source, "failed to parse request to /%s: %s\nheaders: %s\nbody: %q", h.endpoint, err, redactedHeaders(r.Header), capture.buf.String())
+		}
+		if h.deadLetters != nil {
+			var body []byte
+			if deadLetterCapture != nil {
+				body = deadLetterCapture.buf.Bytes()
+			}
+			h.deadLetters.failed(ctx, h.endpoint, h.source, err, body)
+		}
+		var badRequest parser.BadRequestError
+		var forbidden parser.ForbiddenError
+		switch {
+		case errors.As(err, &badRequest):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.As(err, &forbidden):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		_, _ = w.Write([]byte(err.Error()))
 	} else {
-		// send message to xmpp client
-		h.messages <- m
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
+		// parsers may produce several messages from one request
+		results := []parser.Result{result}
+		if len(result.Results) > 0 {
+			results = result.Results
+		}
+		_, attention := r.URL.Query()["attention"]
+		routed := override == "" || !h.recipientOverride
+		if fieldRecipients != "" {
+			result.Recipients = fieldRecipients
+		}
+		// recipients requested by the payload, the query parameter takes precedence
+		if result.Recipients != "" && routed && h.recipientOverride {
+			recipients, ok = h.requestedRecipients(w, result.Recipients)
+			if !ok {
+				return
+			}
+			rooms = nil
+			recipients, rooms, ok = h.limitRecipients(w, recipients, rooms)
+			if !ok {
+				return
+			}
+			routed = false
+		}
+		// the query parameter takes precedence over the time of the payload
+		var scheduled int
+		for i := range results {
+			if !deliverAt.IsZero() {
+				results[i].DeliverAt = deliverAt
+			}
+			if reason := h.checkDeliverAt(results[i].DeliverAt); reason != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(reason))
+				return
+			}
+			if !results[i].DeliverAt.IsZero() {
+				scheduled++
+			}
+		}
+		// all scheduled messages of the request fit or none is sent, so a retry
+		// doesn't repeat the others
+		if scheduled > 0 {
+			if err := h.scheduler.reserve(scheduled); err != nil {
+				h.tooManyScheduled(w, err)
+				return
+			}
+			defer h.scheduler.release(scheduled)
+		}
+		response := responseData{Endpoint: h.endpoint, Status: "ok"}
+		for _, res := range results {
+			res.Severity = h.severity(res.Severity, fieldSeverity)
+			if h.stripHTML {
+				res = plainText(res)
+			}
+			if h.tidyWhitespace {
+				res = tidyResult(res)
+			}
+			handled := h.dispatch(ctx, res, recipients, rooms, routed, attention, ttl, wait)
+			if handled.Delivery == deliveryTimedOut {
+				h.timedOut(ctx, w)
+				return
+			}
+			if errors.Is(handled.err, errTooManyScheduled) {
+				h.tooManyScheduled(w, handled.err)
+				return
+			}
+			if len(results) == 1 {
+				response.Status = handled.Delivery
+			}
+			response.Messages = append(response.Messages, handled)
+		}
+		code, t := http.StatusOK, h.response
+		if wait {
+			// waiting doesn't count towards the concurrent parses
+			releaseParse(r)
+			code = h.awaitDelivery(r.Context(), &response, waitTimeout)
+			if code == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", strconv.Itoa(int(h.retryAfter.Seconds())))
+			}
+			if t == nil {
+				t = defaultSyncResponse
+			}
+		}
+		writeResponse(w, t, code, response)
+	}
+}
+
+// parses the recipients requested by the sender, answers the request and
+// returns false if they are invalid or not allowed
+func (h *messageHandler) requestedRecipients(w http.ResponseWriter, list string) ([]jid.JID, bool) {
+	recipients, err := parseRecipients(list)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid recipients"))
+		return nil, false
 	}
+	for _, recipient := range recipients {
+		if !domainAllowed(recipient, h.allowedDomains) {
+			logf(h.source, "rejecting message for %s, domain isn't allowed", recipient)
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("recipient domain not allowed: " + recipient.Domainpart()))
+			return nil, false
+		}
+	}
+	return recipients, true
+}
+
+// applies the max. number of recipients, answers the request and returns
+// false if the message is rejected
+func (h *messageHandler) limitRecipients(w http.ResponseWriter, recipients []jid.JID, rooms []room) ([]jid.JID, []room, bool) {
+	if n := len(recipients) + len(rooms); h.maxRecipients > 0 && n > h.maxRecipients {
+		recipientLimitExceeded.inc(h.source)
+		if !h.truncateRecipients {
+			logf(h.source, "rejecting message for %d recipients (limit is %d)", n, h.maxRecipients)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("too many recipients (limit is %d)", h.maxRecipients)))
+			return nil, nil, false
+		}
+		logf(h.source, "truncating %d recipients to the limit of %d", n, h.maxRecipients)
+		recipients, rooms = truncateRecipients(recipients, rooms, h.maxRecipients)
+	}
+	return recipients, rooms, true
+}
+
+// returns the severity of the configured field, the one of the parser or
+// the default severity, whichever is known first
+func (h *messageHandler) severity(parsed string, field string) string {
+	for _, s := range []string{field, parsed} {
+		if s != "" && s != parser.SeverityUnknown {
+			return s
+		}
+	}
+	if h.defaultSeverity != "" {
+		return h.defaultSeverity
+	}
+	return parsed
+}
+
+// returns the result with the html of its message and translations converted to text
+func plainText(result parser.Result) parser.Result {
+	result.Message = parser.HTMLToText(result.Message, true)
+	if result.Translations != nil {
+		translations := make(map[string]string, len(result.Translations))
+		for lang, message := range result.Translations {
+			translations[lang] = parser.HTMLToText(message, true)
+		}
+		result.Translations = translations
+	}
+	return result
+}
+
+// returns the result with the whitespace of its message and translations tidied
+func tidyResult(result parser.Result) parser.Result {
+	result.Message = tidyWhitespace(result.Message)
+	if result.Translations != nil {
+		translations := make(map[string]string, len(result.Translations))
+		for lang, message := range result.Translations {
+			translations[lang] = tidyWhitespace(message)
+		}
+		result.Translations = translations
+	}
+	return result
+}
+
+// trims the trailing whitespace of every line, collapses runs of blank lines
+// into one and drops the blank lines at the start and end; the blank lines of
+// preformatted blocks are kept
+func tidyWhitespace(message string) string {
+	lines := strings.Split(message, "\n")
+	tidied := make([]string, 0, len(lines))
+	pre := false
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(line, "```"):
+			pre = !pre
+		case !pre && line == "" && (len(tidied) == 0 || tidied[len(tidied)-1] == ""):
+			continue
+		}
+		tidied = append(tidied, line)
+	}
+	for len(tidied) > 0 && tidied[len(tidied)-1] == "" {
+		tidied = tidied[:len(tidied)-1]
+	}
+	return strings.Join(tidied, "\n")
+}
+
+// passes the message of the result to the xmpp client (or holds it back),
+// returns how it was handled for the response
+func (h *messageHandler) dispatch(ctx context.Context, result parser.Result, recipients []jid.JID, rooms []room, routed bool, attention bool, ttl time.Duration, wait bool) responseMessage {
+	handled := responseMessage{Message: result.Message, Severity: result.Severity, Status: result.Status, Key: result.Key}
+	if h.suppressResolved && result.Status == parser.StatusResolved {
+		// the firing alert doesn't need to be remembered anymore
+		if result.Key != "" {
+			if h.alerts != nil {
+				h.alerts.resolve(h.endpoint + "/" + result.Key)
+			}
+			h.acks.resolved(h.endpoint + "/" + result.Key)
+		}
+		resolvedSuppressed.inc(h.source)
+		handled.Delivery = "suppressed (resolved)"
+		return handled
+	}
+
+	// drop the messages of a flooding endpoint until its cooldown is over
+	if !h.flood.allow(ctx, h.endpoint, h.source) {
+		debugf(h.source, "dropping message from /%s, the endpoint is paused due to flooding", h.endpoint)
+		handled.Delivery = "suppressed (flooding)"
+		return handled
+	}
+
+	// route the message unless the request specified its recipients
+	if routed {
+		if rt := matchRoute(h.routes, routeFields(h.endpoint, result)); rt != nil {
+			recipients, rooms = rt.recipients, rt.rooms
+		}
+	}
+	// nobody gets the same message twice
+	recipients, rooms = dedupeRecipients(recipients, rooms, h.dedupeBare)
+
+	m := alertMessage{
+		id:           newMessageID(),
+		endpoint:     h.endpoint,
+		source:       h.source,
+		body:         result.Message,
+		translations: result.Translations,
+		severity:     result.Severity,
+		alertTime:    result.Time,
+		created:      time.Now(),
+		ttl:          ttl,
+		recipients:   recipients,
+		rooms:        rooms,
+		onlineOnly:   h.onlineOnly,
+		delivery:     h.delivery,
+		image:        result.Image,
+		imageAuth:    h.imageAuth,
+		extensions:   h.extensions,
+		nick:         h.nick,
+	}
+	// the same notification gets the same id
+	if result.Key != "" && !result.Time.IsZero() {
+		m.id = stableID(h.endpoint, result.Key, result.Status, result.Time.UTC().Format(time.RFC3339Nano))
+	}
+	if h.threads {
+		thread := result.Thread
+		if thread == "" {
+			thread = result.Key
+		}
+		if thread != "" {
+			m.thread = stableID(h.endpoint, thread)
+		}
+	}
+	m.attention = h.attention || attention || (h.attentionCritical && result.Severity == parser.SeverityCritical)
+
+	if result.Key != "" {
+		m.key = h.endpoint + "/" + result.Key
+	}
+
+	// acknowledged alerts don't need anybody's attention again until they
+	// resolve or the window is over
+	if result.Status == parser.StatusResolved {
+		h.acks.resolved(m.key)
+	} else if by, ok := h.acks.acknowledged(m.key); ok {
+		deescalated.inc(h.source, h.deescalate)
+		if h.deescalate == deescalateSuppress {
+			logf(h.source, "suppressing message from /%s, alert %s was acknowledged by %s", h.endpoint, result.Key, by)
+			handled.Delivery = "suppressed (acknowledged)"
+			return handled
+		}
+		debugf(h.source, "downgrading message %s from /%s, alert %s was acknowledged by %s", m.id, h.endpoint, result.Key, by)
+		result.Severity, m.severity, handled.Severity = parser.SeverityInfo, parser.SeverityInfo, parser.SeverityInfo
+		m.attention = false
+		m.delivery = h.deescalateProfile
+	}
+
+	// correlate firing and resolved notifications
+	var resent bool
+	if h.alerts != nil && m.key != "" {
+		switch result.Status {
+		case parser.StatusFiring:
+			h.alerts.fire(m.key, m.id, m.body, m.translations)
+		case parser.StatusResolved:
+			if firing, ok := h.alerts.resolve(m.key); ok {
+				m.body = firing.body
+				m.translations = firing.translations
+				m.replyTo = firing.id
+				resent = true
+			}
+		}
+	}
+
+	// mark firing and resolved notifications uniformly, the resent firing
+	// message of a resolved alert always needs the prefix
+	prefix := h.statusPrefixes[result.Status]
+	if h.statusShown && !h.customPrefixes[result.Status] && !resent {
+		prefix = ""
+	}
+	if prefix != "" {
+		m.body = prefix + " " + m.body
+		translations := make(map[string]string)
+		for lang, t := range m.translations {
+			translations[lang] = prefix + " " + t
+		}
+		m.translations = translations
+	}
+
+	// frame the message, e.g. [prod][critical] ... — via grafana
+	if h.frame.enabled() {
+		data := frameData{Endpoint: h.endpoint, Source: h.source, Severity: result.Severity, Status: result.Status, Key: result.Key, ID: m.id, Time: frameTime{m.alertTime}}
+		if m.alertTime.IsZero() {
+			data.Time = frameTime{m.created}
+		}
+		if body, err := h.frame.apply(m.body, data); err != nil {
+			logf(h.source, "failed to render the prefix or suffix of message %s from /%s, sending it without: %s", m.id, h.endpoint, err)
+		} else {
+			m.body = body
+			translations := make(map[string]string)
+			for lang, t := range m.translations {
+				framed, err := h.frame.apply(t, data)
+				if err != nil {
+					logf(h.source, "failed to render the prefix or suffix of the %s translation of message %s from /%s, sending it without: %s", lang, m.id, h.endpoint, err)
+					framed = t
+				}
+				translations[lang] = framed
+			}
+			m.translations = translations
+		}
+	}
+
+	// scheduled messages are sent at their time, quiet hours or not
+	if !result.DeliverAt.IsZero() {
+		if err := h.scheduler.schedule(m, result.DeliverAt); err != nil {
+			logf(h.source, "rejecting message from /%s: %s", h.endpoint, err)
+			handled.Delivery, handled.err = err.Error(), err
+			return handled
+		}
+		logf(h.source, "scheduled message %s from /%s for %s", m.id, h.endpoint, result.DeliverAt.Format(time.RFC3339))
+		handled.ID, handled.Message, handled.Delivery = m.id, m.body, deliveryScheduled
+		return handled
+	}
+
+	// hold back / drop non-critical messages during quiet hours
+	if h.quietHours != nil && result.Severity != parser.SeverityCritical && h.quietHours.active(time.Now()) {
+		if h.quietQueue != nil {
+			quietHoursMessages.inc(h.source, "queued")
+			h.quietQueue.hold(m, h.quietHours)
+			handled.ID, handled.Message, handled.Delivery = m.id, m.body, "queued (quiet hours)"
+			return handled
+		}
+		quietHoursMessages.inc(h.source, "suppressed")
+		logf(h.source, "suppressing message from /%s during quiet hours", h.endpoint)
+		handled.Delivery = "suppressed (quiet hours)"
+		return handled
+	}
+
+	// count repeats of a message instead of sending them, they are rolled up
+	if h.coalesce != nil {
+		if n := h.coalesce.seen(m); n > 1 {
+			handled.Message, handled.Delivery = m.body, fmt.Sprintf("coalesced (seen %d times)", n)
+			return handled
+		}
+	}
+
+	// the handler waits for the outcome of the delivery in synchronous mode
+	if wait {
+		result := make(chan deliveryResult, 1)
+		m.result, handled.result = result, result
+	}
+
+	// send message to xmpp client, unless the request times out meanwhile
+	select {
+	case h.messages <- m:
+	case <-ctx.Done():
+		handled.Delivery = deliveryTimedOut
+		handled.result = nil
+		return handled
+	}
+	handled.ID, handled.Message, handled.Delivery = m.id, m.body, "ok"
+	return handled
+}
+
+// returns why the messages can't be scheduled for t, empty if they can (or t is zero)
+func (h *messageHandler) checkDeliverAt(t time.Time) string {
+	switch {
+	case t.IsZero():
+		return ""
+	case h.scheduler == nil:
+		return "scheduled delivery is disabled"
+	case !t.After(time.Now()):
+		return "deliver_at is in the past"
+	case time.Until(t) > h.maxScheduleAhead:
+		return "deliver_at is more than " + h.maxScheduleAhead.String() + " ahead"
+	}
+	return ""
+}
+
+// answers a request whose messages can't be scheduled, there are too many
+func (h *messageHandler) tooManyScheduled(w http.ResponseWriter, err error) {
+	logf(h.source, "rejecting request to /%s: %s", h.endpoint, err)
+	w.Header().Set("Retry-After", strconv.Itoa(int(h.retryAfter.Seconds())))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte(err.Error()))
+}
+
+// answers a request that took longer than the timeout of the endpoint, or
+// whose client went away meanwhile
+func (h *messageHandler) timedOut(ctx context.Context, w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(h.retryAfter.Seconds())))
+	if ctx.Err() == context.Canceled {
+		logf(h.source, "request to /%s was canceled before its messages were enqueued", h.endpoint)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("request canceled"))
+		return
+	}
+	requestTimeouts.inc(h.source)
+	logf(h.source, "request to /%s timed out after %s", h.endpoint, h.timeout)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte("request timed out"))
 }
 
 // returns new handler with a given parser function
-func newMessageHandler(m chan<- string, f parserFunc) *messageHandler {
+func newMessageHandler(endpoint string, m chan<- alertMessage, f parser.ParserFunc) *messageHandler {
 	return &messageHandler{
+		endpoint:   endpoint,
+		source:     endpoint,
 		messages:   m,
 		parserFunc: f,
+		methods:    []string{http.MethodPost},
+	}
+}
+
+// dispatches requests to the handler of the requested webhook type
+type typeHandler struct {
+	handlers map[string]http.Handler
+}
+
+// http request handler
+func (h *typeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// get webhook type from query or header
+	t := r.URL.Query().Get("type")
+	if t == "" {
+		t = r.Header.Get("X-Webhook-Type")
+	}
+	handler, ok := h.handlers[t]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("unknown webhook type"))
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// returns new handler that selects one of the given handlers by webhook type
+func newTypeHandler(handlers map[string]http.Handler) *typeHandler {
+	return &typeHandler{
+		handlers: handlers,
+	}
+}
+
+// returns the endpoint as part of an env var name, e.g. GRAFANA_ONCALL
+func endpointEnvName(endpoint string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(endpoint))
+}
+
+// logs a line about a request or a message, prefixed with the source of the
+// endpoint so the lines of a source can be correlated: [grafana] ...
+func logf(source string, format string, v ...interface{}) {
+	log.Printf("["+source+"] "+format, v...)
+}
+
+// logs a debug line like logf, only if XMPP_DEBUG is set
+func debugf(source string, format string, v ...interface{}) {
+	parser.Debugf("["+source+"] "+format, v...)
+}
+
+// parses a comma-separated list of values per endpoint: grafana=x,slack=y
+func parseEndpointValues(s string, name string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, e := range strings.Split(s, ",") {
+		if e == "" {
+			continue
+		}
+		i := strings.Index(e, "=")
+		if i < 1 || i == len(e)-1 {
+			return nil, errors.New(name + " " + e + " must be given as endpoint=value")
+		}
+		values[e[:i]] = e[i+1:]
+	}
+	return values, nil
+}
+
+// parses a comma-separated list of accepted http methods per endpoint:
+// grafana=POST|PUT,ping=GET
+func parseEndpointMethods(s string) (map[string][]string, error) {
+	methods := make(map[string][]string)
+	for _, e := range strings.Split(s, ",") {
+		if e == "" {
+			continue
+		}
+		i := strings.Index(e, "=")
+		if i < 1 || i == len(e)-1 {
+			return nil, errors.New("methods " + e + " must be given as endpoint=METHOD|METHOD")
+		}
+		for _, m := range strings.Split(e[i+1:], "|") {
+			methods[e[:i]] = append(methods[e[:i]], strings.ToUpper(m))
+		}
 	}
+	return methods, nil
 }
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+// returns a handler that passes the dispatched messages to the returned channel
+func testHandler(endpoint string) (*messageHandler, chan alertMessage) {
+	messages := make(chan alertMessage, 10)
+	return &messageHandler{endpoint: endpoint, messages: messages}, messages
+}
+
+func TestDispatchStatusPrefixes(t *testing.T) {
+	defaults := map[string]string{parser.StatusFiring: "FIRING:", parser.StatusResolved: "RESOLVED:"}
+	tests := []struct {
+		name     string
+		shown    bool
+		custom   map[string]bool
+		prefixes map[string]string
+		result   parser.Result
+		want     string
+	}{
+		{
+			name:     "default prefix",
+			prefixes: defaults,
+			result:   parser.Result{Message: "disk full", Status: parser.StatusFiring},
+			want:     "FIRING: disk full",
+		},
+		{
+			name:     "no status",
+			prefixes: defaults,
+			result:   parser.Result{Message: "hello"},
+			want:     "hello",
+		},
+		{
+			name:     "status shown",
+			shown:    true,
+			prefixes: defaults,
+			result:   parser.Result{Message: "DOWN: example.org", Status: parser.StatusFiring},
+			want:     "DOWN: example.org",
+		},
+		{
+			name:     "status shown, custom prefix",
+			shown:    true,
+			custom:   map[string]bool{parser.StatusFiring: true},
+			prefixes: map[string]string{parser.StatusFiring: "🔥"},
+			result:   parser.Result{Message: "DOWN: example.org", Status: parser.StatusFiring},
+			want:     "🔥 DOWN: example.org",
+		},
+	}
+	for _, tt := range tests {
+		h, messages := testHandler("test")
+		h.statusPrefixes = tt.prefixes
+		h.statusShown = tt.shown
+		h.customPrefixes = tt.custom
+		h.dispatch(context.Background(), tt.result, nil, nil, false, false, 0, false)
+		if m := <-messages; m.body != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, m.body, tt.want)
+		}
+	}
+}
+
+func TestDispatchResentResolved(t *testing.T) {
+	h, messages := testHandler("alertmanager")
+	h.statusPrefixes = map[string]string{parser.StatusFiring: "FIRING:", parser.StatusResolved: "RESOLVED:"}
+	h.statusShown = true
+	h.alerts = newAlertTracker(10)
+
+	h.dispatch(context.Background(), parser.Result{Message: "Firing\nalertname = DiskFull", Status: parser.StatusFiring, Key: "group"}, nil, nil, false, false, 0, false)
+	firing := <-messages
+	if firing.body != "Firing\nalertname = DiskFull" {
+		t.Errorf("firing: got %q", firing.body)
+	}
+	h.dispatch(context.Background(), parser.Result{Message: "Resolved\nalertname = DiskFull", Status: parser.StatusResolved, Key: "group"}, nil, nil, false, false, 0, false)
+	resolved := <-messages
+	if resolved.body != "RESOLVED: Firing\nalertname = DiskFull" {
+		t.Errorf("resolved: got %q", resolved.body)
+	}
+	if resolved.replyTo != firing.id {
+		t.Errorf("resolved: reply to %q, want %q", resolved.replyTo, firing.id)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	translations := map[string]string{"de": "<p>Platte <b>voll</b></p>"}
+	result := plainText(parser.Result{
+		Message:      `<p>disk <b>full</b></p><p>see <a href="https://example.org/disk">details</a></p>`,
+		Translations: translations,
+	})
+	if want := "disk full\nsee details (https://example.org/disk)"; result.Message != want {
+		t.Errorf("message: got %q, want %q", result.Message, want)
+	}
+	if got := result.Translations["de"]; got != "Platte voll" {
+		t.Errorf("translation: got %q", got)
+	}
+	// the translations of the parser are left untouched
+	if translations["de"] != "<p>Platte <b>voll</b></p>" {
+		t.Errorf("parser translations changed: %q", translations["de"])
+	}
+}
+
+func TestTidyWhitespace(t *testing.T) {
+	for message, want := range map[string]string{
+		"disk full": "disk full",
+		"\n\n  \ndisk full  \t\n\n\n\nhost db01 \r\n\n":    "disk full\n\nhost db01",
+		"  indented\nlines":                                "  indented\nlines",
+		"log:\n```\nline 1   \n\n\n\nline 2\n```\n\n\nend": "log:\n```\nline 1\n\n\n\nline 2\n```\n\nend",
+		" \n\t\n": "",
+	} {
+		if got := tidyWhitespace(message); got != want {
+			t.Errorf("tidyWhitespace(%q) = %q, want %q", message, got, want)
+		}
+	}
+
+	// applied to every message of the endpoint, incl. the translations
+	messages := make(chan alertMessage, 1)
+	h := newMessageHandler("alert", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "<p>disk full</p>\n\n\n<p>host db01</p>\n", Translations: map[string]string{"de": "Platte voll \n\n\n"}}, nil
+	})
+	h.tidyWhitespace = true
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/alert", strings.NewReader("{}")))
+	m := <-messages
+	if m.body != "<p>disk full</p>\n\n<p>host db01</p>" || m.translations["de"] != "Platte voll" {
+		t.Errorf("got %q and %q", m.body, m.translations["de"])
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	// nobody reads the messages, enqueueing blocks
+	messages := make(chan alertMessage)
+	h := newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full"}, nil
+	})
+	h.timeout = 50 * time.Millisecond
+	h.retryAfter = 30 * time.Second
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana", strings.NewReader("{}")))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("got %d with Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// a parser that honors the deadline
+	h = newMessageHandler("command", messages, func(r *http.Request) (parser.Result, error) {
+		<-r.Context().Done()
+		return parser.Result{}, r.Context().Err()
+	})
+	h.timeout = 50 * time.Millisecond
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/command", strings.NewReader("{}")))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("slow parser: got %d", w.Code)
+	}
+
+	// without a timeout, the client going away unblocks the enqueueing
+	h = newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full"}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/grafana", strings.NewReader("{}")).WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request of a client that went away still blocks")
+	}
+}
+
+func TestMessageTTL(t *testing.T) {
+	messages := make(chan alertMessage, 10)
+	h := newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full"}, nil
+	})
+	h.ttl = 15 * time.Minute
+	tests := []struct {
+		target string
+		code   int
+		ttl    time.Duration
+	}{
+		{target: "/grafana", code: http.StatusOK, ttl: 15 * time.Minute},
+		{target: "/grafana?ttl=90s", code: http.StatusOK, ttl: 90 * time.Second},
+		{target: "/grafana?ttl=-1m", code: http.StatusBadRequest},
+		{target: "/grafana?ttl=soon", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", tt.target, strings.NewReader("{}")))
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.target, w.Code, tt.code)
+			continue
+		}
+		if tt.code == http.StatusOK {
+			if m := <-messages; m.ttl != tt.ttl {
+				t.Errorf("%s: got ttl %s, want %s", tt.target, m.ttl, tt.ttl)
+			}
+		}
+	}
+
+	created := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+	m := alertMessage{created: created, ttl: 10 * time.Minute}
+	if m.expired(created.Add(9*time.Minute)) || !m.expired(created.Add(10*time.Minute)) {
+		t.Error("message expired at the wrong time")
+	}
+	if rule := m.expiry().Rules[0]; rule.Condition != "expire-at" || rule.Action != "drop" || rule.Value != "2024-05-14T08:10:00Z" {
+		t.Errorf("got amp rule %+v", rule)
+	}
+	if m := (alertMessage{created: created}); m.expired(created.Add(24*time.Hour)) || m.expiry() != nil {
+		t.Error("message without ttl expired")
+	}
+}
+
+// returns the metric in the prometheus text format
+func metricText(m *metric) string {
+	var b strings.Builder
+	m.write(&b)
+	return b.String()
+}
+
+func TestSourceLabel(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	messages := make(chan alertMessage, 10)
+	h := newMessageHandler("grafana-eu", messages, func(r *http.Request) (parser.Result, error) {
+		if r.URL.Query().Get("state") == "resolved" {
+			return parser.Result{Message: "disk full", Status: parser.StatusResolved}, nil
+		}
+		return parser.Result{Message: "disk full"}, nil
+	})
+	if h.source != "grafana-eu" {
+		t.Errorf("default source: got %q", h.source)
+	}
+	h.source = "prod-grafana"
+	h.suppressResolved = true
+	h.maxRecipients = 1
+	h.truncateRecipients = true
+	h.recipients = []jid.JID{jid.MustParse("alice@example.net"), jid.MustParse("bob@example.net")}
+	handler := h.withMiddlewares([]string{"log"})
+
+	for _, target := range []string{"/grafana-eu", "/grafana-eu?state=resolved"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", target, strings.NewReader("{}")))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", target, w.Code)
+		}
+	}
+	if m := <-messages; m.source != "prod-grafana" || m.endpoint != "grafana-eu" {
+		t.Errorf("message of source %q and endpoint %q", m.source, m.endpoint)
+	}
+
+	// every line of the requests carries the source
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 4 {
+		t.Errorf("got %d log lines, want 4: %s", len(lines), logs.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "[prod-grafana] ") {
+			t.Errorf("log line without the source: %s", line)
+		}
+	}
+	for _, m := range []*metric{resolvedSuppressed, recipientLimitExceeded} {
+		if text := metricText(m); !strings.Contains(text, `{endpoint="prod-grafana"} `) {
+			t.Errorf("metric without the source: %s", text)
+		}
+	}
+}
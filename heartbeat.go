@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"text/template"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+var heartbeatsSent = newCounter("xmpp_heartbeats_total", "Heartbeat messages.", "result")
+
+// text of the heartbeats unless another one is configured
+const defaultHeartbeatMessage = "heartbeat {{.Time.Format \"2006-01-02T15:04:05Z07:00\"}} from {{.Hostname}}, up {{.Uptime}}"
+
+// fields available in the heartbeat message
+type heartbeatData struct {
+	Time     time.Time
+	Uptime   time.Duration // rounded to seconds
+	Hostname string
+	Version  string
+}
+
+// sends a message to a recipient or room in an interval, e.g. for a watchdog
+// that alerts if they stop ("dead man's switch")
+type heartbeat struct {
+	client   *xmppClient
+	from     jid.JID
+	to       jid.JID
+	room     bool // send as groupchat message
+	interval time.Duration
+	message  *template.Template
+	started  time.Time
+}
+
+// sends the heartbeats until stop is closed
+func (h *heartbeat) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.beat()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sends a single heartbeat, skipped while disconnected: the missing heartbeat
+// is the signal, a late one would hide the outage
+func (h *heartbeat) beat() {
+	if h.client.current() == nil {
+		heartbeatsSent.inc("skipped")
+		return
+	}
+	hostname, _ := os.Hostname()
+	var body bytes.Buffer
+	err := h.message.Execute(&body, heartbeatData{
+		Time:     time.Now(),
+		Uptime:   time.Since(h.started).Round(time.Second),
+		Hostname: hostname,
+		Version:  version,
+	})
+	if err != nil {
+		heartbeatsSent.inc("error")
+		log.Printf("failed to render heartbeat: %s", err)
+		return
+	}
+	msgType := stanza.ChatMessage
+	if h.room {
+		msgType = stanza.GroupChatMessage
+	}
+	err = h.client.send(context.Background(), MessageBody{
+		Message: stanza.Message{
+			ID:   newMessageID(),
+			To:   h.to,
+			From: h.from,
+			Type: msgType,
+		},
+		Body: body.String(),
+		// don't deliver it later from the offline storage
+		NoStore: &struct{}{},
+	})
+	if err != nil {
+		heartbeatsSent.inc("error")
+		log.Printf("failed to send heartbeat to %s: %s", h.to, err)
+		return
+	}
+	heartbeatsSent.inc("ok")
+}
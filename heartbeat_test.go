@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+func TestHeartbeat(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	conn := server.conn(t, 0)
+
+	h := &heartbeat{
+		client:  client,
+		from:    jid.MustParse("bot@example.net"),
+		to:      jid.MustParse("ops@conference.example.net"),
+		room:    true,
+		message: template.Must(template.New("heartbeat").Parse("alive {{.Version}}, up {{.Uptime}}")),
+		started: time.Now().Add(-time.Minute),
+	}
+	h.beat()
+	waitFor(t, "the heartbeat", func() bool { return strings.Contains(conn.received(), "alive dev, up 1m0s") })
+	received := conn.received()
+	for _, want := range []string{`type="groupchat"`, `to="ops@conference.example.net"`, `<no-store xmlns="urn:xmpp:hints">`} {
+		if !strings.Contains(received, want) {
+			t.Errorf("%s missing: %s", want, received)
+		}
+	}
+
+	// skipped while disconnected
+	_ = conn.conn.Close()
+	waitFor(t, "the session to be lost", func() bool { return client.current() == nil })
+	h.beat()
+	if n := strings.Count(conn.received(), "alive"); n != 1 {
+		t.Errorf("%d heartbeats sent, want 1", n)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const defaultHTTPClientTimeout = 10 * time.Second
+
+// client for all outbound http requests (subscription confirmations, uploads, ...)
+var httpClient = newHTTPClient(defaultHTTPClientTimeout)
+
+// sets the user agent on every request
+type userAgentTransport struct {
+	next http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// round trippers must not modify the original request
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", "xmpp-webhook/"+version)
+	return t.next.RoundTrip(r)
+}
+
+// returns new client that gives up after the timeout, 0 is unlimited
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: userAgentTransport{next: http.DefaultTransport},
+	}
+}
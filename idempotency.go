@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// max. number of remembered idempotency keys, the oldest ones are forgotten first
+const maxIdempotencyKeys = 1000
+
+var idempotentReplays = newCounter("xmpp_webhook_idempotent_replays_total", "Requests answered with the response of an earlier request with the same Idempotency-Key.", "endpoint")
+
+// response to a request with an idempotency key
+type idempotentResponse struct {
+	key     string
+	status  int
+	body    []byte
+	expires time.Time
+	done    bool // false while the first request is handled
+}
+
+// remembers the responses of requests with an idempotency key, so retries
+// of a sender don't send the message again
+type idempotencyStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	order     *list.List // oldest first
+	responses map[string]*list.Element
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:       ttl,
+		now:       time.Now,
+		order:     list.New(),
+		responses: make(map[string]*list.Element),
+	}
+}
+
+// returns the response of an earlier request with the key, or reserves the
+// key for the current request
+func (s *idempotencyStore) start(key string) (idempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.responses[key]; ok {
+		r := e.Value.(*idempotentResponse)
+		if s.now().Before(r.expires) {
+			return *r, true
+		}
+		s.order.Remove(e)
+		delete(s.responses, key)
+	}
+	s.responses[key] = s.order.PushBack(&idempotentResponse{key: key, expires: s.now().Add(s.ttl)})
+	for s.order.Len() > maxIdempotencyKeys {
+		oldest := s.order.Front()
+		s.order.Remove(oldest)
+		delete(s.responses, oldest.Value.(*idempotentResponse).key)
+	}
+	return idempotentResponse{}, false
+}
+
+// remembers the response of successful requests, forgets the key otherwise,
+// so the sender can retry
+func (s *idempotencyStore) finish(key string, status int, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.responses[key]
+	if !ok {
+		return
+	}
+	if status < 200 || status > 299 {
+		s.order.Remove(e)
+		delete(s.responses, key)
+		return
+	}
+	r := e.Value.(*idempotentResponse)
+	r.status, r.body, r.done = status, body, true
+}
+
+// keeps the response for the idempotency store
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// answers retried requests (same Idempotency-Key header) with the original response,
+// retries while the first request is handled are asked to retry after the given time
+func idempotency(endpoint string, source string, store *idempotencyStore, retryAfter time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if store == nil || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = endpoint + "/" + key
+			if earlier, ok := store.start(key); ok {
+				if !earlier.done {
+					w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+					w.WriteHeader(http.StatusConflict)
+					_, _ = w.Write([]byte("a request with this idempotency key is in progress"))
+					return
+				}
+				idempotentReplays.inc(source)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(earlier.status)
+				_, _ = w.Write(earlier.body)
+				return
+			}
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			store.finish(key, rec.status, rec.body.Bytes())
+		})
+	}
+}
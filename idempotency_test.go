@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+	now := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	var handled int
+	release := make(chan struct{})
+	h := idempotency("alert", "alert", store, 30*time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+		if r.URL.Query().Get("wait") != "" {
+			<-release
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = fmt.Fprintf(w, "request %d", handled)
+	}))
+	post := func(key string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader("{}"))
+		r.Header.Set("Idempotency-Key", key)
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// a replayed key gets the stored response
+	post("a", "/alert")
+	w := post("a", "/alert")
+	if w.Code != http.StatusAccepted || w.Body.String() != "request 1" || w.Header().Get("Idempotent-Replayed") != "true" || handled != 1 {
+		t.Errorf("replay answered with %d %q, handled %d times", w.Code, w.Body.String(), handled)
+	}
+
+	// a duplicate while the first request is handled gets a conflict
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("b", "/alert?wait=1") }()
+	for {
+		store.mu.Lock()
+		_, started := store.responses["alert/b"]
+		store.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if w := post("b", "/alert"); w.Code != http.StatusConflict || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("concurrent duplicate answered with %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusAccepted {
+		t.Errorf("first request answered with %d", w.Code)
+	}
+
+	// the key expires after the ttl
+	now = now.Add(time.Hour)
+	if w := post("a", "/alert"); w.Header().Get("Idempotent-Replayed") != "" || w.Body.String() != "request 3" {
+		t.Errorf("expired key answered with %q", w.Body.String())
+	}
+}
+
+func TestIdempotencyEviction(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+	for i := 0; i <= maxIdempotencyKeys; i++ {
+		key := fmt.Sprint(i)
+		store.start(key)
+		store.finish(key, http.StatusOK, nil)
+	}
+	if n := len(store.responses); n != maxIdempotencyKeys {
+		t.Errorf("%d keys remembered, want %d", n, maxIdempotencyKeys)
+	}
+	// the oldest key is forgotten first
+	if _, ok := store.start("0"); ok {
+		t.Error("oldest key wasn't evicted")
+	}
+	if _, ok := store.start("2"); !ok {
+		t.Error("recent key was evicted")
+	}
+}
@@ -2,15 +2,27 @@ package main
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/xml"
+	"flag"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/tmsmr/xmpp-webhook/parser"
+	"golang.org/x/net/proxy"
 	"mellium.im/sasl"
 	"mellium.im/xmlstream"
 	"mellium.im/xmpp"
@@ -28,42 +40,221 @@ func panicOnErr(err error) {
 type MessageBody struct {
 	stanza.Message
 	Body string `xml:"body"`
+	// the body in other languages (RFC 6121, 5.2.3)
+	Translations translatedBodies `xml:"translations,omitempty"`
+	Store        *struct{}        `xml:"urn:xmpp:hints store,omitempty"`
+	NoStore      *struct{}        `xml:"urn:xmpp:hints no-store,omitempty"`
+	Reply        *messageReply    `xml:"urn:xmpp:reply:0 reply,omitempty"`
+	Replace      *messageReplace  `xml:"urn:xmpp:message-correct:0 replace,omitempty"`
+	Delay        *messageDelay    `xml:"urn:xmpp:delay delay,omitempty"`
+	AMP          *messageAMP      `xml:"http://jabber.org/protocol/amp amp,omitempty"`
+	// nickname of the sender (XEP-0172), shown by some clients instead of the jid
+	Nick   string         `xml:"http://jabber.org/protocol/nick nick,omitempty"`
+	Thread *messageThread `xml:"thread,omitempty"`
+	// asks the client to get the user's attention (XEP-0224)
+	Attention *struct{} `xml:"urn:xmpp:attention:0 attention,omitempty"`
+	// link to an uploaded image (XEP-0066)
+	OOB *messageOOB `xml:"jabber:x:oob x,omitempty"`
+	// formatting of the body for recipients that don't want XEP-0393 styling
+	Unstyled *struct{}     `xml:"urn:xmpp:styling:0 unstyled,omitempty"`
+	HTML     *messageXHTML `xml:"http://jabber.org/protocol/xhtml-im html,omitempty"`
+	// delivery receipts (XEP-0184), requested by us and received from the recipients
+	Receipt  *receiptRequest  `xml:"urn:xmpp:receipts request,omitempty"`
+	Received *receiptReceived `xml:"urn:xmpp:receipts received,omitempty"`
+	// reactions of the recipients to our messages (XEP-0444), only received
+	Reactions *messageReactions `xml:"urn:xmpp:reactions:0 reactions,omitempty"`
+	// raw xml elements of XMPP_STANZA_EXTENSIONS, only sent
+	Extensions string `xml:",innerxml"`
 }
 
-func initXMPP(address jid.JID, pass string, skipTLSVerify bool, useXMPPS bool) (*xmpp.Session, error) {
-	tlsConfig := tls.Config{InsecureSkipVerify: skipTLSVerify}
+// conversation thread the message belongs to (RFC 6121, 5.2.5)
+type messageThread struct {
+	ID string `xml:",chardata"`
+}
+
+// reference to the message this one replies to (XEP-0461)
+type messageReply struct {
+	To string `xml:"to,attr,omitempty"`
+	ID string `xml:"id,attr"`
+}
+
+// original time of a delayed message (XEP-0203)
+type messageDelay struct {
+	From  string `xml:"from,attr,omitempty"`
+	Stamp string `xml:"stamp,attr"`
+}
+
+// asks the server to drop the message instead of storing it past the time (XEP-0079)
+type messageAMP struct {
+	Rules []ampRule `xml:"rule"`
+}
+
+type ampRule struct {
+	Condition string `xml:"condition,attr"`
+	Action    string `xml:"action,attr"`
+	Value     string `xml:"value,attr"`
+}
+
+// messages sent later than this after they were created carry a delay stamp
+const delayThreshold = 30 * time.Second
+
+// message passed from the webhooks to the xmpp client
+type alertMessage struct {
+	id           string // stanza id
+	endpoint     string // endpoint the webhook was received at
+	source       string // label of the endpoint in logs and metrics
+	replyTo      string // stanza id of the message this one replies to
+	replaces     string // stanza id of the message this one corrects
+	thread       string // thread id, optional
+	key          string // endpoint/key of the alert, empty if the parser has none
+	body         string
+	severity     string
+	alertTime    time.Time         // when the alert fired, zero if unknown
+	created      time.Time         // when the webhook was received
+	ttl          time.Duration     // dropped if not sent within this time after created, 0 never expires
+	translations map[string]string // body by language tag
+	recipients   []jid.JID
+	rooms        []room
+	onlineOnly   bool             // only deliver to recipients that are currently online
+	attention    bool             // request the recipients' attention
+	extensions   string           // raw xml elements added to the messages
+	nick         string           // nickname of the sender in direct messages (XEP-0172), optional
+	delivery     *DeliveryProfile // how the direct messages are sent, nil for the defaults
+	image        string           // url of the image sent after the message, optional
+	imageAuth    *imageAuth       // credentials for fetching the image, optional
+	// receives the outcome of the delivery if the handler waits for it, optional
+	result chan<- deliveryResult
+}
+
+func initXMPP(address jid.JID, pass string, skipTLSVerify bool, rootCAs *x509.CertPool, tlsServerName string, useXMPPS bool, requireTLS bool, serverAddress string, network string, mechanisms []sasl.Mechanism, proxyDialer proxy.ContextDialer) (*xmpp.Session, error) {
+	tlsConfig := tls.Config{InsecureSkipVerify: skipTLSVerify, RootCAs: rootCAs}
 	var dialer dial.Dialer
 	// only use the tls config for the dialer if necessary
-	if skipTLSVerify {
+	if skipTLSVerify || rootCAs != nil || tlsServerName != "" {
 		dialer = dial.Dialer{NoTLS: !useXMPPS, TLSConfig: &tlsConfig}
 	} else {
 		dialer = dial.Dialer{NoTLS: !useXMPPS}
 	}
-	conn, err := dialer.Dial(context.TODO(), "tcp", address)
+	// we need the domain in the tls config if we want to verify the cert,
+	// the override is sent as sni (and verified) instead
+	if tlsServerName != "" {
+		tlsConfig.ServerName = tlsServerName
+	} else if !skipTLSVerify {
+		tlsConfig.ServerName = address.Domainpart()
+	}
+	var conn net.Conn
+	var err error
+	if proxyDialer != nil {
+		// the tls handshakes run through the tunnel, so they still verify the jid's domain
+		if serverAddress != "" {
+			conn, err = proxyDialer.DialContext(context.TODO(), "tcp", serverAddress)
+		} else {
+			conn, err = dialXMPPProxied(context.TODO(), proxyDialer, address.Domainpart(), useXMPPS)
+		}
+		if err == nil && useXMPPS {
+			conn = tls.Client(conn, &tlsConfig)
+		}
+	} else if serverAddress != "" {
+		// connect to the given server instead of looking up the jid's domain
+		conn, err = dialer.Dialer.DialContext(context.TODO(), network, serverAddress)
+		if err == nil && useXMPPS {
+			conn = tls.Client(conn, &tlsConfig)
+		}
+	} else {
+		conn, err = dialer.Dial(context.TODO(), network, address)
+	}
 	if err != nil {
 		return nil, err
 	}
-	// we need the domain in the tls config if we want to verify the cert
-	if !skipTLSVerify {
-		tlsConfig.ServerName = address.Domainpart()
+	// the wrapped tls connection isn't recognized as encrypted anymore
+	var state xmpp.SessionState
+	if useXMPPS {
+		state = xmpp.Secure
+	}
+	conn = &tailConn{Conn: conn}
+	startTLS := requiredStartTLS(&tlsConfig)
+	auth := xmpp.SASL("", pass, mechanisms...)
+	if !requireTLS {
+		// continue unencrypted if the server refuses starttls
+		startTLS = xmpp.StartTLS(&tlsConfig)
+		auth.Necessary &^= xmpp.Secure
 	}
-	return xmpp.NewSession(
+	startTLS = recordStartTLS(startTLS)
+	session, err := xmpp.NewSession(
 		context.TODO(),
 		address.Domain(),
 		address,
 		conn,
-		0,
+		state,
 		xmpp.NewNegotiator(xmpp.StreamConfig{Features: func(_ *xmpp.Session, f ...xmpp.StreamFeature) []xmpp.StreamFeature {
 			if f != nil {
 				return f
 			}
 			return []xmpp.StreamFeature{
 				xmpp.BindResource(),
-				xmpp.StartTLS(&tlsConfig),
-				xmpp.SASL("", pass, sasl.ScramSha256Plus, sasl.ScramSha256, sasl.ScramSha1Plus, sasl.ScramSha1, sasl.Plain),
+				startTLS,
+				auth,
 			}
 		}}),
 	)
+	if err != nil && strings.Contains(err.Error(), "no matching SASL mechanisms") {
+		return nil, fmt.Errorf("the server supports none of the configured sasl mechanisms (%s): %w", saslMechanismNames(mechanisms), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if requireTLS {
+		if err := checkEncrypted(session); err != nil {
+			closeXMPP(session)
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+var messagesSent = newCounter("xmpp_messages_sent_total", "Messages sent (per recipient).", "endpoint", "severity")
+
+// returns the severity used as metric label
+func (m alertMessage) metricSeverity() string {
+	if m.severity == "" {
+		return parser.SeverityUnknown
+	}
+	return m.severity
+}
+
+// returns the delay stamp if the message is sent noticeably after it was created
+func (m alertMessage) delay(from jid.JID) *messageDelay {
+	if m.created.IsZero() || time.Since(m.created) < delayThreshold {
+		return nil
+	}
+	return &messageDelay{From: from.Domain().String(), Stamp: m.created.UTC().Format(time.RFC3339)}
+}
+
+// checks if the message is too old to be sent
+func (m alertMessage) expired(now time.Time) bool {
+	return m.ttl > 0 && !m.created.IsZero() && now.Sub(m.created) >= m.ttl
+}
+
+// returns the amp rule dropping the message once it expired, nil if it doesn't
+func (m alertMessage) expiry() *messageAMP {
+	if m.ttl <= 0 || m.created.IsZero() {
+		return nil
+	}
+	return &messageAMP{Rules: []ampRule{{Condition: "expire-at", Action: "drop", Value: m.created.Add(m.ttl).UTC().Format(time.RFC3339)}}}
+}
+
+// returns a random stanza id
+func newMessageID() string {
+	b := make([]byte, 12)
+	_, _ = cryptorand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// returns an id derived from the parts, so a notification delivered twice
+// gets the same stanza id and clients can de-duplicate it
+func stableID(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:12])
 }
 
 func closeXMPP(session *xmpp.Session) {
@@ -72,105 +263,772 @@ func closeXMPP(session *xmpp.Session) {
 }
 
 func main() {
-	// get xmpp credentials, message recipients
-	xi := os.Getenv("XMPP_ID")
-	xp := os.Getenv("XMPP_PASS")
-	xr := os.Getenv("XMPP_RECIPIENTS")
+	printVersion := flag.Bool("version", false, "print version and exit")
+	check := flag.Bool("check", false, "connect to the xmpp server, optionally send a test message and exit")
+	checkTo := flag.String("to", "", "recipient of the test message in check mode")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration (secrets redacted) and exit")
+	flag.Parse()
+	if *printVersion {
+		fmt.Println(versionString())
+		return
+	}
+	log.Print(versionString())
+	buildInfo.set(1, version, commit, date)
+
+	// get the configuration in effect
+	cfg := loadConfig(*check)
+	myjid := cfg.XMPP.ID.JID
+	if !cfg.XMPP.RequireTLS {
+		log.Println("XMPP_REQUIRE_TLS=0, the connection to the xmpp server may be unencrypted")
+	}
+	if cfg.XMPP.Proxy.url != nil {
+		log.Printf("connecting to the xmpp server through the proxy %s", redactURL(cfg.XMPP.Proxy.url.String()))
+	}
+	if cfg.XMPP.WebSocketURL != "" {
+		log.Printf("connecting to the xmpp server over websocket at %s", redactURL(string(cfg.XMPP.WebSocketURL)))
+	}
+	// the ca certificates are checked before connecting, a reloaded bundle is
+	// used on the next reconnect like the password
+	var cas *caBundle
+	if cfg.XMPP.CAFile != "" {
+		var n int
+		var err error
+		cas, n, err = loadCABundle(cfg.XMPP.CAFile)
+		if err != nil {
+			log.Fatalf("failed to load XMPP_CA_FILE: %s", err)
+		}
+		log.Printf("verifying the xmpp server with %d certificate(s) of %s", n, cfg.XMPP.CAFile)
+	}
+	// the password is read for every dial, so a reloaded one is used on the next reconnect
+	password := &rotatingSecret{name: "XMPP_PASS", path: cfg.XMPP.PasswordFile, value: string(cfg.XMPP.Password)}
+	dialXMPP := func(address jid.JID, server string) (*xmpp.Session, error) {
+		if cfg.XMPP.WebSocketURL != "" {
+			return initXMPPWebSocket(address, password.get(), string(cfg.XMPP.WebSocketURL), cfg.XMPP.SkipVerify, cas.roots(), cfg.XMPP.TLSServerName, cfg.XMPP.SASLMechanisms)
+		}
+		return initXMPP(address, password.get(), cfg.XMPP.SkipVerify, cas.roots(), cfg.XMPP.TLSServerName, cfg.XMPP.DirectTLS, cfg.XMPP.RequireTLS, server, cfg.XMPP.DialNetwork, cfg.XMPP.SASLMechanisms, cfg.XMPP.Proxy.dialer)
+	}
 
-	// get tls settings from env
-	_, skipTLSVerify := os.LookupEnv("XMPP_SKIP_VERIFY")
-	_, useXMPPS := os.LookupEnv("XMPP_OVER_TLS")
+	// only check the connection instead of starting the server
+	if *check {
+		err := checkConnection(func() (*xmpp.Session, error) {
+			return dialXMPP(myjid, cfg.XMPP.Server)
+		}, myjid, *checkTo, time.Duration(cfg.XMPP.SendTimeout))
+		if err != nil {
+			fmt.Printf("check failed: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("check succeeded")
+		return
+	}
 
-	// get listen address
-	listenAddress := os.Getenv("XMPP_WEBHOOK_LISTEN_ADDRESS")
-	if len(listenAddress) == 0 {
-		listenAddress = ":4321"
+	// only print the configuration instead of starting the server
+	if *printConfig {
+		panicOnErr(cfg.write(os.Stdout))
+		return
 	}
 
-	// check if xmpp credentials and recipient list are supplied
-	if xi == "" || xp == "" || xr == "" {
-		log.Fatal("XMPP_ID, XMPP_PASS or XMPP_RECIPIENTS not set")
+	recipients, rooms := cfg.Recipients.Recipients, cfg.Recipients.Rooms
+	if n := len(recipients) + len(rooms); n > cfg.Recipients.Max {
+		log.Printf("warning: %d recipients configured, messages are limited to %d", n, cfg.Recipients.Max)
 	}
 
-	myjid, err := jid.Parse(xi)
-	panicOnErr(err)
+	// log debug messages
+	if cfg.Messages.Debug {
+		parser.Debugf = log.Printf
+	}
+	httpClient = newHTTPClient(time.Duration(cfg.HTTP.ClientTimeout))
 
-	// connect to xmpp server
-	xmppSession, err := initXMPP(myjid, xp, skipTLSVerify, useXMPPS)
-	panicOnErr(err)
-	defer closeXMPP(xmppSession)
+	// check the alertmanager template against an alertmanager payload
+	var alertmanagerParser parser.ParserFunc
+	if cfg.Endpoints.AlertmanagerTemplate != nil {
+		var err error
+		alertmanagerParser, err = parser.NewAlertmanagerParserFunc(cfg.Endpoints.AlertmanagerTemplate)
+		if err != nil {
+			log.Fatal("XMPP_ALERTMANAGER_TEMPLATE doesn't work with an alertmanager payload: " + err.Error())
+		}
+	}
 
-	// send initial presence
-	panicOnErr(xmppSession.Send(context.TODO(), stanza.Presence{Type: stanza.AvailablePresence}.Wrap(nil)))
+	var buffer *messageBuffer
+	if cfg.Messages.BufferSize > 0 {
+		var err error
+		buffer, err = newMessageBuffer(cfg.Messages.BufferSize, cfg.Messages.BufferOverflow)
+		panicOnErr(err)
+	}
+	var idempotencyKeys *idempotencyStore
+	if cfg.HTTP.IdempotencyTTL > 0 {
+		idempotencyKeys = newIdempotencyStore(time.Duration(cfg.HTTP.IdempotencyTTL))
+	}
+	var alerts *alertTracker
+	if cfg.Messages.TrackResolved {
+		alerts = newAlertTracker(maxTrackedAlerts)
+	}
+	var quiet *quietQueue
+	if cfg.Messages.QuietHoursPolicy == "queue" {
+		quiet = &quietQueue{}
+	}
+	var schedule *scheduler
+	if cfg.Messages.ScheduleMaxAhead > 0 {
+		schedule = newScheduler()
+	}
+	var coalesce *coalescer
+	if len(cfg.Endpoints.Coalesce) > 0 {
+		coalesce = newCoalescer(time.Duration(cfg.Messages.CoalesceWindow), time.Duration(cfg.Messages.CoalesceInterval), cfg.Messages.CoalesceMode == "correct")
+	}
 
-	// listen for messages and echo them
-	go func() {
-		err = xmppSession.Serve(xmpp.HandlerFunc(func(t xmlstream.TokenReadEncoder, start *xml.StartElement) error {
-			d := xml.NewTokenDecoder(t)
-			// ignore elements that aren't messages
-			if start.Name.Local != "message" {
-				return nil
-			}
+	presence := newPresenceTracker()
+	trackPresence := len(cfg.Endpoints.OnlineOnly) > 0 || cfg.XMPP.ResourceMode == resourceHighestPriority
 
-			// parse message into struct
-			msg := MessageBody{}
-			err = d.DecodeElement(&msg, start)
+	// relay incoming chat messages from the recipients to an outbound webhook (disabled if unset)
+	var outbound *relay
+	if cfg.XMPP.RelayURL != "" {
+		outbound = &relay{url: string(cfg.XMPP.RelayURL), token: string(cfg.XMPP.RelayToken), senders: recipients}
+	}
+
+	// collect the acknowledgements of the sent messages, optionally forwarding them (disabled if unset)
+	var acks *ackTracker
+	if cfg.XMPP.Acks {
+		acks = newAckTracker(string(cfg.XMPP.AckWebhookURL), string(cfg.XMPP.AckWebhookToken))
+		acks.deescalateWindow = time.Duration(cfg.XMPP.AckDeescalateWindow)
+	}
+
+	// pause the delivery to recipients whose messages bounce repeatedly (disabled without cooldown)
+	var circuits *circuitBreaker
+	if cfg.Recipients.CircuitCooldown > 0 {
+		circuits = newCircuitBreaker(cfg.Recipients.CircuitFailures, time.Duration(cfg.Recipients.CircuitCooldown))
+	}
+
+	// the configured recipients, incl. the ones of the routes, for the roster check
+	rosterRecipients := append([]jid.JID(nil), recipients...)
+	for _, r := range cfg.Recipients.Routes {
+		rosterRecipients = append(rosterRecipients, r.recipients...)
+	}
+
+	// approves the presence subscription requests
+	approve := newSubscriptionPolicy(cfg.Recipients.SubscriptionApprove, rosterRecipients)
+
+	// prepare every new xmpp session
+	setup := sessionSetup{presence: presence, address: myjid, nick: cfg.Recipients.RoomNick, rooms: rooms}
+	if trackPresence {
+		setup.subscribe = recipients
+	}
+	if cfg.XMPP.InitialPresence == presenceDirected {
+		setup.directed, setup.recipients = true, rosterRecipients
+	}
+
+	// listen for incoming stanzas
+	handler := xmpp.HandlerFunc(func(t xmlstream.TokenReadEncoder, start *xml.StartElement) error {
+		d := xml.NewTokenDecoder(t)
+
+		if start.Name.Local == "presence" {
+			p := presenceWithError{}
+			err := d.DecodeElement(&p, start)
 			if err != nil && err != io.EOF {
 				return nil
 			}
 
-			// ignore empty messages and stanzas that aren't messages
-			if msg.Body == "" || msg.Type != stanza.ChatMessage {
+			// errors while joining a room
+			if p.Type == stanza.ErrorPresence {
+				for _, r := range rooms {
+					if !r.jid.Equal(p.From.Bare()) {
+						continue
+					}
+					if p.Error.Condition == stanza.NotAuthorized {
+						log.Printf("failed to join room %s: wrong or missing password", r.jid)
+					} else {
+						log.Printf("failed to join room %s: %s", r.jid, p.Error.Condition)
+					}
+				}
+			}
+
+			// approve the subscription requests allowed by the policy, and
+			// request theirs in return, so the subscription is mutual
+			if p.Type == stanza.SubscribePresence {
+				if !approve.approves(p.From) {
+					log.Printf("ignoring the subscription request of %s, XMPP_SUBSCRIPTION_APPROVE doesn't allow it", p.From.Bare())
+					return nil
+				}
+				log.Printf("approved the subscription request of %s", p.From.Bare())
+				_ = t.Encode(stanza.Presence{To: p.From.Bare(), Type: stanza.SubscribedPresence})
+				_ = t.Encode(stanza.Presence{To: p.From.Bare(), Type: stanza.SubscribePresence})
 				return nil
 			}
+			// a recipient that revokes the subscription may not get the messages anymore
+			if p.Type == stanza.UnsubscribedPresence && containsBare(rosterRecipients, p.From) {
+				log.Printf("warning: recipient %s revoked the presence subscription, messages may not arrive", p.From.Bare())
+			}
 
-			// create reply with identical contents
-			reply := MessageBody{
-				Message: stanza.Message{
-					To:   msg.From.Bare(),
-					From: myjid,
-					Type: stanza.ChatMessage,
-				},
-				Body: msg.Body,
+			// keep track of the presence of our contacts
+			if trackPresence {
+				presence.update(p.Presence, p.Priority)
 			}
+			return nil
+		}
 
-			// try to send reply, ignore errors
-			_ = t.Encode(reply)
+		// ignore elements that aren't messages
+		if start.Name.Local != "message" {
 			return nil
-		}))
-		panicOnErr(err)
-	}()
+		}
+
+		// parse message into struct
+		msg := MessageBody{}
+		err := d.DecodeElement(&msg, start)
+		if err != nil && err != io.EOF {
+			return nil
+		}
+
+		// collect the acknowledgements of our messages, the reply mode handles unknown ones
+		if acks != nil && msg.Type == stanza.ChatMessage {
+			if id, ok := ackedID(msg); ok && acks.ack(id, msg.From) {
+				return nil
+			}
+		}
+
+		// messages that bounced count against the circuit of the recipient,
+		// everything else it sends proves that it's reachable
+		if msg.Type == stanza.ErrorMessage {
+			circuits.failed(msg.From)
+			return nil
+		}
+		circuits.succeeded(msg.From)
+
+		// count the delivery receipts of our messages
+		if msg.Received != nil {
+			receiptsReceived.inc()
+			return nil
+		}
+
+		// ignore empty messages and stanzas that aren't messages
+		if msg.Body == "" || msg.Type != stanza.ChatMessage {
+			return nil
+		}
+
+		// relay the message to the outbound webhook, without blocking the session
+		if outbound != nil && outbound.allowed(msg.From) {
+			go func(from jid.JID, body string) {
+				err := outbound.forward(from, body)
+				if err != nil {
+					messagesRelayed.inc("error")
+					log.Printf("failed to relay message from %s: %s", from.Bare(), err)
+					return
+				}
+				messagesRelayed.inc("ok")
+			}(msg.From, msg.Body)
+		}
+
+		// create reply depending on the reply mode
+		reply := MessageBody{
+			Message: stanza.Message{
+				To:   msg.From.Bare(),
+				From: myjid,
+				Type: stanza.ChatMessage,
+			},
+		}
+		switch cfg.XMPP.ReplyMode {
+		case replyEcho:
+			reply.Body = msg.Body
+		case replyCommands:
+			reply.Body = runChatCommand(msg.Body)
+		default:
+			return nil
+		}
+		if reply.Body == "" {
+			return nil
+		}
+
+		// try to send reply, ignore errors
+		_ = t.Encode(reply)
+		return nil
+	})
+
+	// connect to xmpp server
+	xmppClient := newXMPPClient(func(t dialTarget) (*xmpp.Session, error) {
+		address, server := myjid, cfg.XMPP.Server
+		if t.resource != "" {
+			// local err, this runs on the reconnecting goroutine
+			a, err := myjid.WithResource(t.resource)
+			if err != nil {
+				return nil, err
+			}
+			address = a
+		}
+		if t.server != "" {
+			server = t.server
+		}
+		return dialXMPP(address, server)
+	}, setup.run, handler)
+	xmppClient.maxReconnectDuration = time.Duration(cfg.XMPP.ReconnectMaxDuration)
+	xmppClient.sendTimeout = time.Duration(cfg.XMPP.SendTimeout)
+	if cfg.XMPP.SendRate > 0 {
+		xmppClient.sendInterval = time.Second / time.Duration(cfg.XMPP.SendRate)
+	}
+	if cfg.XMPP.MaxConcurrentSends > 0 {
+		xmppClient.sends = make(chan struct{}, cfg.XMPP.MaxConcurrentSends)
+	}
+	if len(cfg.XMPP.ConnectionNotify) > 0 {
+		notifier := &connectionNotifier{client: xmppClient, from: myjid, recipients: cfg.XMPP.ConnectionNotify, interval: time.Duration(cfg.XMPP.ConnectionNotifyInterval)}
+		xmppClient.onStateChange = notifier.changed
+	}
+	panicOnErr(xmppClient.connect())
+	defer xmppClient.close()
+
+	// serve the session and reconnect if it gets lost
+	go xmppClient.serve()
+
+	// warn about recipients that aren't in the roster, once at startup
+	if cfg.Recipients.RosterCheck != "" {
+		go func() {
+			missing, err := checkRoster(context.Background(), xmppClient, rosterRecipients, cfg.Recipients.RosterCheck)
+			if err != nil {
+				log.Printf("roster check failed: %s", err)
+				return
+			}
+			log.Printf("roster check: %d of %d recipient(s) not subscribed", len(missing), len(rosterRecipients))
+		}()
+	}
+
+	// send heartbeats for a watchdog if configured
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	if cfg.XMPP.HeartbeatInterval > 0 {
+		to := jid.MustParse(cfg.XMPP.HeartbeatRecipient)
+		r, room := findRoom(rooms, to)
+		if room {
+			to = r.jid
+		}
+		h := &heartbeat{client: xmppClient, from: myjid, to: to, room: room, interval: time.Duration(cfg.XMPP.HeartbeatInterval), message: cfg.XMPP.heartbeatMessage, started: time.Now()}
+		go h.run(stopHeartbeat)
+	}
+
+	// spread the chat messages over more sessions if configured
+	var pool *sessionPool
+	if cfg.XMPP.Sessions > 1 {
+		// with directed presence, the extra sessions stay unavailable
+		extraSetup := extraSessionSetup
+		if cfg.XMPP.InitialPresence == presenceDirected {
+			extraSetup = func(*xmpp.Session) error { return nil }
+		}
+		pool = newSessionPool(xmppClient, cfg.XMPP.Sessions, myjid.Resourcepart(), extraSetup, handler)
+		pool.start()
+		defer pool.close()
+	}
 
 	// create chan for messages (webhooks -> xmpp)
-	messages := make(chan string)
+	messages := make(chan alertMessage)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// wait for messages from the webhooks and send them to all recipients
+	dispatch := &dispatcher{
+		client:           xmppClient,
+		pool:             pool,
+		presence:         presence,
+		from:             myjid,
+		timestampLayout:  cfg.Messages.Timestamp,
+		timestampAppend:  cfg.Messages.TimestampPosition == "append",
+		timezone:         cfg.Messages.Timezone.Location,
+		maxMessageLength: cfg.Messages.MaxLength,
+		lengthPolicy:     cfg.Messages.LengthPolicy,
+		lang:             cfg.XMPP.Lang,
+		buffer:           buffer,
+		resourceMode:     cfg.XMPP.ResourceMode,
+		acks:             acks,
+		circuits:         circuits,
+		spread:           time.Duration(cfg.XMPP.SendSpread),
+		spreadMin:        cfg.XMPP.SendSpreadMin,
+		stopped:          make(chan struct{}),
+	}
+	if cfg.Messages.DebugRecent > 0 {
+		dispatch.recent = newRecentMessages(cfg.Messages.DebugRecent)
+	}
+	if cfg.Messages.Format != formatStyling || len(cfg.Recipients.Formats) > 0 {
+		dispatch.formats = &messageFormats{def: cfg.Messages.Format, recipients: cfg.Recipients.Formats}
+	}
+	if cfg.Messages.AuditLog != "" {
+		var err error
+		dispatch.audit, err = openAuditLog(cfg.Messages.AuditLog, cfg.Messages.AuditLogBody)
+		if err != nil {
+			log.Fatalf("failed to open XMPP_AUDIT_LOG: %s", err)
+		}
+	}
+	if cfg.XMPP.UploadImages {
+		dispatch.uploader = &imageUploader{client: xmppClient, http: httpClient, maxSize: int64(cfg.XMPP.UploadMaxSize) << 20}
+		if cfg.XMPP.UploadService != "" {
+			dispatch.uploader.service = jid.MustParse(cfg.XMPP.UploadService)
+		}
+	}
+
+	// fetch the images of grafana with its token
+	var grafanaImages *imageAuth
+	if t := string(cfg.Endpoints.GrafanaImageToken); t != "" {
+		grafanaImages = &imageAuth{prefix: strings.TrimSuffix(cfg.Endpoints.GrafanaURL, "/") + "/", header: cfg.Endpoints.GrafanaImageHeader, value: t}
+		if http.CanonicalHeaderKey(grafanaImages.header) == "Authorization" && !strings.Contains(t, " ") {
+			grafanaImages.value = "Bearer " + t
+		}
+	}
+	dispatched := make(chan struct{})
 	go func() {
-		for m := range messages {
-			for _, r := range strings.Split(xr, ",") {
-				recipient, err := jid.Parse(r)
-				panicOnErr(err)
-				// try to send message, ignore errors
-				_ = xmppSession.Encode(ctx, MessageBody{
-					Message: stanza.Message{
-						To:   recipient,
-						From: myjid,
-						Type: stanza.ChatMessage,
-					},
-					Body: m,
-				})
+		dispatch.run(ctx, messages)
+		close(dispatched)
+	}()
+
+	// deliver messages held back during quiet hours
+	stopQuiet := make(chan struct{})
+	quietStopped := make(chan struct{})
+	if quiet != nil && len(cfg.Endpoints.QuietHours) > 0 {
+		go func() {
+			quiet.run(messages, stopQuiet)
+			close(quietStopped)
+		}()
+	} else {
+		close(quietStopped)
+	}
+
+	// deliver the scheduled messages at their time
+	stopSchedule := make(chan struct{})
+	scheduleStopped := make(chan struct{})
+	if schedule != nil {
+		go func() {
+			schedule.run(messages, stopSchedule)
+			close(scheduleStopped)
+		}()
+	} else {
+		close(scheduleStopped)
+	}
+
+	// send the rollups of repeated messages
+	stopCoalesce := make(chan struct{})
+	coalesceStopped := make(chan struct{})
+	if coalesce != nil {
+		go func() {
+			coalesce.run(messages, stopCoalesce)
+			close(coalesceStopped)
+		}()
+	} else {
+		close(coalesceStopped)
+	}
+
+	// tell the operators about requests that can't be parsed (disabled if unset)
+	var deadLetters *deadLetterNotifier
+	if list := cfg.Messages.DeadLetterRecipients; len(list) > 0 {
+		var to []jid.JID
+		var toRooms []room
+		for _, j := range list {
+			if r, ok := findRoom(rooms, j); ok {
+				toRooms = append(toRooms, r)
+			} else {
+				to = append(to, j)
 			}
 		}
-	}()
+		deadLetters = newDeadLetterNotifier(messages, to, toRooms, cfg.Messages.DeadLetterBody, time.Duration(cfg.Messages.DeadLetterInterval))
+	}
+
+	// pause the endpoints that flood (disabled if unset)
+	var flood *floodGuard
+	if cfg.Messages.FloodLimit > 0 {
+		var to []jid.JID
+		var toRooms []room
+		for _, j := range cfg.Messages.FloodRecipients {
+			if r, ok := findRoom(rooms, j); ok {
+				toRooms = append(toRooms, r)
+			} else {
+				to = append(to, j)
+			}
+		}
+		flood = newFloodGuard(cfg.Messages.FloodLimit, time.Duration(cfg.Messages.FloodWindow), time.Duration(cfg.Messages.FloodCooldown), messages, to, toRooms)
+	}
 
 	// initialize handlers with associated parser functions
-	http.Handle("/grafana", newMessageHandler(messages, parser.GrafanaParserFunc))
-	http.Handle("/slack", newMessageHandler(messages, parser.SlackParserFunc))
-	http.Handle("/alertmanager", newMessageHandler(messages, parser.AlertmanagerParserFunc))
+	handlers := make(map[string]http.Handler)
+	parses := make(chan struct{}, cfg.HTTP.MaxConcurrentParses)
+	// the endpoint is served with the parser of the type, e.g. team-a with alertmanager
+	addHandler := func(endpoint string, typ string, f parser.ParserFunc) {
+		h := newMessageHandler(endpoint, messages, f)
+		h.onlineOnly = cfg.Endpoints.OnlineOnly[endpoint]
+		h.attention = cfg.Endpoints.Attention[endpoint]
+		h.threads = cfg.Endpoints.Threads[endpoint] || cfg.Endpoints.Threads["*"]
+		h.stripHTML = cfg.Endpoints.StripHTML[endpoint]
+		h.tidyWhitespace = !cfg.Messages.KeepWhitespace
+		h.response = cfg.Endpoints.responses[""]
+		if t, ok := cfg.Endpoints.responses[endpointEnvName(endpoint)]; ok {
+			h.response = t
+		}
+		h.frame = messageFrame{prefix: cfg.Endpoints.prefixes[""], suffix: cfg.Endpoints.suffixes[""], location: cfg.Messages.Timezone.Location}
+		if t, ok := cfg.Endpoints.prefixes[endpointEnvName(endpoint)]; ok {
+			h.frame.prefix = t
+		}
+		if t, ok := cfg.Endpoints.suffixes[endpointEnvName(endpoint)]; ok {
+			h.frame.suffix = t
+		}
+		h.delivery = cfg.Endpoints.Delivery[endpoint]
+		if typ == "grafana" {
+			h.imageAuth = grafanaImages
+		}
+		h.extensions = cfg.Messages.Extensions + cfg.Endpoints.Extensions[endpointEnvName(endpoint)]
+		h.attentionCritical = cfg.Messages.AttentionCritical
+		h.recipients = recipients
+		h.rooms = rooms
+		h.recipientOverride = cfg.Recipients.Override[endpoint] || cfg.Recipients.Override["*"]
+		h.rejectOverride = cfg.Recipients.OverrideReject
+		h.dedupeBare = cfg.Recipients.DedupeBare
+		h.allowedDomains = cfg.Recipients.AllowedDomains
+		h.routes = cfg.Recipients.Routes
+		h.maxRecipients = cfg.Recipients.Max
+		h.truncateRecipients = cfg.Recipients.MaxPolicy == "truncate"
+		h.defaultSeverity = cfg.Endpoints.DefaultSeverity[endpoint]
+		h.transform = cfg.Endpoints.Transforms[endpointEnvName(endpoint)]
+		h.severityField = cfg.Endpoints.SeverityFields[endpoint]
+		h.recipientsField = cfg.Endpoints.RecipientsFields[endpoint]
+		h.suppressResolved = cfg.Endpoints.SuppressResolved[endpointEnvName(endpoint)]
+		h.alerts = alerts
+		h.acks = acks
+		h.deescalate = cfg.XMPP.AckDeescalate
+		h.deescalateProfile = cfg.XMPP.ackDeescalateProfile
+		h.statusPrefixes = cfg.Messages.StatusPrefixes
+		h.statusShown = parser.StatusShown[typ]
+		h.customPrefixes = cfg.Messages.customPrefixes
+		h.quietHours = cfg.Endpoints.QuietHours[endpoint]
+		h.quietQueue = quiet
+		h.scheduler = schedule
+		h.maxScheduleAhead = time.Duration(cfg.Messages.ScheduleMaxAhead)
+		if cfg.Endpoints.Coalesce[endpoint] {
+			h.coalesce = coalesce
+		}
+		h.debugBodies = cfg.Messages.DebugBodies
+		h.parses = parses
+		h.buffer = buffer
+		h.retryAfter = time.Duration(cfg.HTTP.RetryAfter)
+		h.idempotency = idempotencyKeys
+		h.token = string(cfg.Endpoints.Tokens[endpointEnvName(endpoint)])
+		if s, ok := cfg.Endpoints.Sources[endpoint]; ok {
+			h.source = s
+		}
+		h.nick = cfg.Endpoints.Nicks[endpoint]
+		h.deadLetters = deadLetters
+		h.flood = flood
+		h.syncDelivery = cfg.Endpoints.SyncDelivery[endpoint] || cfg.Endpoints.SyncDelivery["*"]
+		h.syncTimeout = time.Duration(cfg.Endpoints.SyncDeliveryTimeout)
+		h.timeout = time.Duration(cfg.HTTP.RequestTimeout)
+		if d, ok := cfg.Endpoints.Timeouts[endpointEnvName(endpoint)]; ok {
+			h.timeout = time.Duration(d)
+		}
+		h.ttl = time.Duration(cfg.Messages.TTL)
+		if d, ok := cfg.Endpoints.TTLs[endpointEnvName(endpoint)]; ok {
+			h.ttl = time.Duration(d)
+		}
+		if cfg.HTTP.EnforceContentType {
+			h.contentTypes = parser.ContentTypes[typ]
+		}
+		if m, ok := cfg.Endpoints.Methods[endpoint]; ok {
+			h.methods = m
+		} else if m, ok := parser.Methods[typ]; ok {
+			h.methods = m
+		}
+		handlers[endpoint] = h.withMiddlewares(cfg.HTTP.Middlewares)
+	}
+
+	// parsers by type, the built-in ones with their settings
+	parsers := make(map[string]parser.ParserFunc)
+	for typ, f := range parser.Registry {
+		parsers[typ] = f
+	}
+	if c := cfg.Endpoints.Command; c != "" {
+		parsers["command"] = parser.NewCommandParserFunc(c, time.Duration(cfg.Endpoints.CommandTimeout), cfg.Endpoints.CommandMaxMemory<<20)
+	}
+	if t := cfg.Endpoints.TwilioAuthToken; t != "" {
+		parsers["twilio"] = parser.NewTwilioParserFunc(string(t))
+	}
+	if s := cfg.Endpoints.TailscaleSecret; s != "" {
+		parsers["tailscale"] = parser.NewTailscaleParserFunc(string(s))
+	}
+	if s, w := cfg.Endpoints.ShopifySecret, cfg.Endpoints.WooCommerceSecret; s != "" || w != "" {
+		parsers["ecommerce"] = parser.NewEcommerceParserFunc(string(s), string(w))
+	}
+	if s := cfg.Endpoints.CloudflareSecret; s != "" {
+		parsers["cloudflare"] = parser.NewCloudflareParserFunc(string(s))
+	}
+	parsers["systemd"] = parser.NewSystemdParserFunc(cfg.Endpoints.SystemdLogLines)
+	parsers["certexpiry"] = parser.NewCertExpiryParserFunc(cfg.Endpoints.CertExpiryThresholds)
+	if alertmanagerParser != nil {
+		parsers["alertmanager"] = alertmanagerParser
+	}
+	parsers["lines"] = parser.NewLineParserFunc(cfg.Endpoints.LinesFields, rune(cfg.Endpoints.LinesDelimiter), cfg.Endpoints.LinesMode == "split")
+	parsers["json"] = parser.NewJSONParserFunc(cfg.Endpoints.JSONMapping)
+
+	// serve the endpoints of XMPP_ENDPOINTS, every type at its own name by default
+	types := cfg.Endpoints.Types
+	if types == nil {
+		types = make(map[string]string)
+		for typ := range parsers {
+			types[typ] = typ
+		}
+	}
+	for endpoint, typ := range types {
+		addHandler(endpoint, typ, parsers[typ])
+	}
+	templates := cfg.Endpoints.Templates
+	for name, t := range templates {
+		endpoint, lang := splitTemplateName(name)
+		if lang != "" {
+			continue
+		}
+		addHandler(endpoint, endpoint, parser.NewTemplateParserFunc(t, templateTranslations(templates, endpoint)))
+	}
+	if t := cfg.Endpoints.AlertmanagerTemplate; t != nil {
+		// reloadable like the other templates
+		templates["alertmanager"] = t
+	}
+
+	// serve every handler at its dedicated path and via the generic endpoint
+	for endpoint, h := range handlers {
+		http.Handle("/"+endpoint, h)
+		if parser.Subpaths[types[endpoint]] {
+			http.Handle("/"+endpoint+"/", h)
+		}
+	}
+	http.Handle("/webhook", newTypeHandler(handlers))
+
+	// expose metrics
+	http.HandleFunc("/metrics", metricsHandler)
+
+	// serve status page and health check
+	var endpoints []string
+	for endpoint := range handlers {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	status := &statusHandler{
+		client:     xmppClient,
+		endpoints:  endpoints,
+		recipients: recipients,
+		rooms:      rooms,
+		flood:      flood,
+		adminToken: string(cfg.HTTP.AdminToken),
+	}
+	http.Handle("/", status)
+	http.HandleFunc("/healthz", status.health)
+
+	// list the recently delivered messages
+	if dispatch.recent != nil {
+		http.Handle("/debug/recent", &recentHandler{recent: dispatch.recent, adminToken: string(cfg.HTTP.AdminToken)})
+	}
+
+	// send a message to the recipients, e.g. a maintenance notice
+	http.Handle("/broadcast", &broadcastHandler{messages: messages, recipients: recipients, rooms: rooms, adminToken: string(cfg.HTTP.AdminToken)})
+
+	// list and reload templates
+	http.Handle("/templates", &templateHandler{templates: templates, adminToken: string(cfg.HTTP.AdminToken)})
 
 	// listen for requests
-	_ = http.ListenAndServe(listenAddress, nil)
+	// use the socket passed by systemd if socket activated, bind the listen address otherwise
+	listener, err := systemdListener()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if listener == nil {
+		listener, err = net.Listen("tcp", cfg.HTTP.ListenAddress)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Printf("using the socket passed by systemd (%s)", listener.Addr())
+	}
+	httpOptions := httpSettings{
+		certFile:             cfg.HTTP.TLSCert,
+		keyFile:              cfg.HTTP.TLSKey,
+		h2c:                  cfg.HTTP.H2C,
+		idleTimeout:          time.Duration(cfg.HTTP.IdleTimeout),
+		disableKeepAlives:    !cfg.HTTP.KeepAlive,
+		maxConcurrentStreams: cfg.HTTP.MaxConcurrentStreams,
+	}
+	server, err := newHTTPServer(http.DefaultServeMux, httpOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		var err error
+		if httpOptions.certFile != "" {
+			err = server.ServeTLS(listener, httpOptions.certFile, httpOptions.keyFile)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// reload the xmpp password and the ca certificates and reopen the audit log
+	// on SIGHUP, shut down in order on SIGINT / SIGTERM, so no accepted message
+	// gets lost
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	sig := <-signals
+	for ; sig == syscall.SIGHUP; sig = <-signals {
+		// the settings the sessions are established with take effect on new
+		// sessions, they replace the current ones without a gap
+		var changed []string
+		if cas != nil {
+			if ok, err := cas.reload(); err == nil && ok {
+				changed = append(changed, "XMPP_CA_FILE")
+			}
+		}
+		if err := dispatch.audit.reopen(); err != nil {
+			log.Printf("failed to reopen XMPP_AUDIT_LOG, writing to the previous file: %s", err)
+		}
+		// without a password file SIGHUP may only be meant for the others
+		if cfg.XMPP.PasswordFile != "" || (cas == nil && dispatch.audit == nil) {
+			if reloadPassword(password) {
+				changed = append(changed, "xmpp password")
+			}
+		}
+		if len(changed) > 0 {
+			migrateSessions(xmppClient, pool, strings.Join(changed, " and ")+" changed")
+		}
+	}
+	log.Printf("received %s, shutting down", sig)
+
+	// stop accepting requests and wait for the in-flight ones
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Duration(cfg.HTTP.ShutdownTimeout))
+	defer cancelShutdown()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		// handlers might still send messages, so the channel can't be closed
+		log.Printf("not all requests finished in time, dropping the pending messages: %s", err)
+		return
+	}
+
+	// stop releasing held and scheduled messages, they are dropped
+	close(stopQuiet)
+	<-quietStopped
+	var held int
+	if quiet != nil {
+		held = quiet.len()
+	}
+	close(stopSchedule)
+	<-scheduleStopped
+	var scheduled int
+	if schedule != nil {
+		scheduled = schedule.len()
+	}
+
+	// send the pending rollups with the remaining messages
+	close(stopCoalesce)
+	<-coalesceStopped
+	if coalesce != nil {
+		for _, m := range coalesce.rollups() {
+			messages <- m
+		}
+	}
+
+	// no more flood notices, then send the remaining messages and close the xmpp session
+	flood.stop()
+	dispatch.stop()
+	close(messages)
+	<-dispatched
+	dispatch.audit.close()
+	log.Printf("drained %d message(s), dropped %d message(s) (%d held back during quiet hours, %d scheduled)", dispatch.drained, dispatch.dropped+held+scheduled, held, scheduled)
+	if pool != nil {
+		pool.close()
+	}
+	xmppClient.close()
 }
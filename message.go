@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// what to do with messages that exceed the max. message length
+const (
+	lengthTruncate = "truncate"
+	lengthSplit    = "split"
+)
+
+// namespace of the xml:lang attribute
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// room of the part number prefix up to 999 parts ("[123/456] "), the max.
+// length of split messages must exceed it
+const partPrefixLength = 10
+
+// cuts the message to at most max characters, 0 is unlimited
+func truncateMessage(body string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(body) <= max {
+		return body
+	}
+	r := []rune(body)
+	return string(r[:max-1]) + "…"
+}
+
+// splits the message into numbered parts of at most max characters (incl. the
+// part number), preferably at line boundaries, 0 is unlimited
+func splitMessage(body string, max int) []string {
+	if max <= 0 || utf8.RuneCountInString(body) <= max {
+		return []string{body}
+	}
+	// the prefix grows with the number of parts, split again with more room
+	// until it fits
+	for digits := 1; ; digits++ {
+		size := max - 2*digits - len("[/] ")
+		if size < 1 {
+			size = 1
+		}
+		parts := splitLines(body, size)
+		if len(strconv.Itoa(len(parts))) > digits && size > 1 {
+			continue
+		}
+		for i, p := range parts {
+			parts[i] = fmt.Sprintf("[%d/%d] %s", i+1, len(parts), strings.Trim(p, "\n"))
+		}
+		return parts
+	}
+}
+
+// splits the text into chunks of at most size characters at line boundaries,
+// lines longer than that are split hard
+func splitLines(text string, size int) []string {
+	var parts []string
+	var current []rune
+	for _, line := range strings.SplitAfter(text, "\n") {
+		l := []rune(line)
+		// start a new part if the line doesn't fit anymore
+		if len(current) > 0 && len(current)+len(l) > size {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		// lines longer than a whole part are split hard
+		for len(l) > size {
+			parts = append(parts, string(l[:size]))
+			l = l[size:]
+		}
+		current = append(current, l...)
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+// alternate bodies keyed by language tag, encoded as additional
+// <body xml:lang="..."/> elements
+type translatedBodies map[string]string
+
+func (b translatedBodies) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	var langs []string
+	for lang := range b {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		err := e.EncodeElement(b[lang], xml.StartElement{
+			Name: xml.Name{Local: "body"},
+			Attr: []xml.Attr{{Name: xml.Name{Space: xmlNamespace, Local: "lang"}, Value: lang}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		body string
+		max  int
+		want []string
+	}{
+		{"unlimited", "disk full\non db01", 0, []string{"disk full\non db01"}},
+		{"fits", "disk full", 9, []string{"disk full"}},
+		{"line boundaries", "disk full\non db01\nsince 12:00", 25, []string{"[1/2] disk full\non db01", "[2/2] since 12:00"}},
+		{"whole lines", "first line\nsecond line\nthird", 18, []string{"[1/3] first line", "[2/3] second line", "[3/3] third"}},
+		{"overlong line", "0123456789abcdefghij\nend", 16, []string{"[1/3] 0123456789", "[2/3] abcdefghij", "[3/3] end"}},
+		{"multibyte runes", "äöüß€😀äöüß€😀", 11, []string{"[1/3] äöüß€", "[2/3] 😀äöüß", "[3/3] €😀"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := splitMessage(test.body, test.max); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("splitMessage(%q, %d) = %q, want %q", test.body, test.max, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessagePrefix(t *testing.T) {
+	// every part fits including its number, also when that takes more digits
+	for _, test := range []struct {
+		body string
+		max  int
+	}{
+		{strings.Repeat("log line\n", 20), 15},
+		{strings.Repeat("x", 300), partPrefixLength + 1},
+		{strings.Repeat("ä", 1000), 20},
+		{strings.Repeat("€", 150) + "\n" + strings.Repeat("ok\n", 30), 12},
+	} {
+		parts := splitMessage(test.body, test.max)
+		if len(parts) < 2 {
+			t.Fatalf("%d runes weren't split at %d", utf8.RuneCountInString(test.body), test.max)
+		}
+		var joined string
+		for _, p := range parts {
+			if n := utf8.RuneCountInString(p); n > test.max {
+				t.Errorf("part %q has %d runes, max. %d", p, n, test.max)
+			}
+			joined += p[strings.Index(p, "] ")+2:]
+		}
+		if want := strings.ReplaceAll(test.body, "\n", ""); strings.ReplaceAll(joined, "\n", "") != want {
+			t.Errorf("parts %q lost characters of %q", parts, test.body)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// all metrics exposed at /metrics
+var metricsRegistry []*metric
+
+// counter or gauge with an optional set of labels
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by the joined label values
+}
+
+func newMetric(kind string, name string, help string, labels ...string) *metric {
+	m := &metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+	metricsRegistry = append(metricsRegistry, m)
+	return m
+}
+
+// returns new counter, registered in the metrics registry
+func newCounter(name string, help string, labels ...string) *metric {
+	return newMetric("counter", name, help, labels...)
+}
+
+// returns new gauge, registered in the metrics registry
+func newGauge(name string, help string, labels ...string) *metric {
+	return newMetric("gauge", name, help, labels...)
+}
+
+// adds v to the metric, label values are given in the order of the labels
+func (m *metric) add(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[strings.Join(labelValues, "\xff")] += v
+}
+
+func (m *metric) inc(labelValues ...string) {
+	m.add(1, labelValues...)
+}
+
+func (m *metric) set(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[strings.Join(labelValues, "\xff")] = v
+}
+
+// returns the sum over all label values
+func (m *metric) sum() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sum float64
+	for _, v := range m.values {
+		sum += v
+	}
+	return sum
+}
+
+// writes the metric in the prometheus text format
+func (m *metric) write(w *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+	// metrics without labels are always exposed
+	if len(m.labels) == 0 {
+		fmt.Fprintf(w, "%s %v\n", m.name, m.values[""])
+		return
+	}
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var pairs []string
+		for i, v := range strings.Split(k, "\xff") {
+			if i < len(m.labels) {
+				pairs = append(pairs, fmt.Sprintf("%s=%q", m.labels[i], v))
+			}
+		}
+		fmt.Fprintf(w, "%s{%s} %v\n", m.name, strings.Join(pairs, ","), m.values[k])
+	}
+}
+
+// http handler exposing all registered metrics
+func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	var b strings.Builder
+	for _, m := range metricsRegistry {
+		m.write(&b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wraps a handler with a cross-cutting concern
+type middleware func(http.Handler) http.Handler
+
+var parsesInFlight = newGauge("xmpp_webhook_parses_in_flight", "Requests that are currently being parsed.")
+
+// middlewares applied to the webhook endpoints by default, outermost first
+var defaultMiddlewares = []string{"methods", "content-type", "idempotency", "buffer", "concurrency"}
+
+// applies the middlewares to the handler, the first one is the outermost
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// parses a comma-separated list of middleware names
+func parseMiddlewares(s string) ([]string, error) {
+	if s == "" {
+		return defaultMiddlewares, nil
+	}
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := (&messageHandler{}).middleware(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	// XMPP_ENDPOINT_METHODS and XMPP_ENFORCE_CONTENT_TYPE apply even if the
+	// list leaves them out, the parsers only get the methods they expect
+	for _, required := range []string{"content-type", "methods"} {
+		if !contains(names, required) {
+			names = append([]string{required}, names...)
+		}
+	}
+	return names, nil
+}
+
+// checks if the list contains the name
+func contains(list []string, name string) bool {
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the named middleware, configured for the endpoint of the handler
+func (h *messageHandler) middleware(name string) (middleware, error) {
+	switch name {
+	case "log":
+		return logRequests(h.endpoint, h.source), nil
+	case "methods":
+		return allowMethods(h.methods), nil
+	case "content-type":
+		return allowContentTypes(h.contentTypes), nil
+	case "idempotency":
+		return idempotency(h.endpoint, h.source, h.idempotency, h.retryAfter), nil
+	case "buffer":
+		return rejectWhenBufferFull(h.buffer, h.retryAfter), nil
+	case "concurrency":
+		return limitConcurrency(h.parses, h.retryAfter), nil
+	}
+	return nil, errors.New("unknown middleware " + name)
+}
+
+// wraps the handler with the named middlewares, the token of the endpoint is
+// always checked first
+func (h *messageHandler) withMiddlewares(names []string) http.Handler {
+	middlewares := []middleware{requireToken(h.token)}
+	for _, name := range names {
+		m, _ := h.middleware(name)
+		middlewares = append(middlewares, m)
+	}
+	return chain(h, middlewares...)
+}
+
+// remembers the status code for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logs every request with its status and duration
+func logRequests(endpoint string, source string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			logf(source, "%s /%s from %s: %d (%s)", r.Method, endpoint, r.RemoteAddr, rec.status, time.Since(start).Round(time.Millisecond))
+		})
+	}
+}
+
+// rejects requests with other http methods
+func allowMethods(methods []string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, m := range methods {
+				if r.Method == m {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_, _ = w.Write([]byte("method not allowed"))
+		})
+	}
+}
+
+// checks the content type against the accepted ones, every content type is accepted if empty
+func acceptsContentType(contentTypes []string, contentType string) bool {
+	if len(contentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range contentTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// rejects requests with other content types
+func allowContentTypes(contentTypes []string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// requests without body have no content type
+			if r.Method != http.MethodGet && !acceptsContentType(contentTypes, r.Header.Get("Content-Type")) {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				_, _ = w.Write([]byte("unsupported content type, expected one of: " + strings.Join(contentTypes, ", ")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rejects requests while disconnected if the buffer is full (with the block policy),
+// senders are asked to retry after the given time
+func rejectWhenBufferFull(buffer *messageBuffer, retryAfter time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if buffer != nil && buffer.blocking() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("not connected, message buffer is full"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// context key of the func releasing the slot of the request early
+type releaseParseKey struct{}
+
+// rejects the request if too many are handled already, unlimited if the semaphore is nil,
+// senders are asked to retry after the given time
+func limitConcurrency(parses chan struct{}, retryAfter time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if parses != nil {
+				select {
+				case parses <- struct{}{}:
+				default:
+					w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+					w.WriteHeader(http.StatusServiceUnavailable)
+					_, _ = w.Write([]byte("too many concurrent requests"))
+					return
+				}
+			}
+			parsesInFlight.add(1)
+			var once sync.Once
+			release := func() {
+				once.Do(func() {
+					parsesInFlight.add(-1)
+					if parses != nil {
+						<-parses
+					}
+				})
+			}
+			defer release()
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), releaseParseKey{}, release)))
+		})
+	}
+}
+
+// frees the slot of the request before it's done, e.g. while it only waits
+// for the delivery
+func releaseParse(r *http.Request) {
+	if release, ok := r.Context().Value(releaseParseKey{}).(func()); ok {
+		release()
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMiddlewares(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: "", want: defaultMiddlewares},
+		{in: "methods, log", want: []string{"content-type", "methods", "log"}},
+		{in: "log,concurrency", want: []string{"methods", "content-type", "log", "concurrency"}},
+		{in: "log,content-type,methods,", want: []string{"log", "content-type", "methods"}},
+		{in: "log,unknown", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMiddlewares(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+const mucNS = "http://jabber.org/protocol/muc"
+
+// multi user chat the messages are sent to
+type room struct {
+	jid      jid.JID
+	password string // never log this
+}
+
+// join presence with the muc extension
+type mucJoin struct {
+	stanza.Presence
+	X struct {
+		Password string `xml:"password,omitempty"`
+		// don't get the room history, we're not reading it anyway
+		History struct {
+			MaxStanzas int `xml:"maxstanzas,attr"`
+		} `xml:"history"`
+	} `xml:"http://jabber.org/protocol/muc x"`
+}
+
+// presence stanza including a possible error
+type presenceWithError struct {
+	stanza.Presence
+	Error    stanza.Error `xml:"error"`
+	Priority int          `xml:"priority"`
+}
+
+// parses a comma-separated list of rooms, optionally with passwords:
+// room@conference.example.org,secret@conference.example.org?password=s3cret
+func parseRooms(s string) ([]room, error) {
+	var rooms []room
+	for _, r := range strings.Split(s, ",") {
+		if r == "" {
+			continue
+		}
+		var password string
+		if i := strings.Index(r, "?password="); i >= 0 {
+			r, password = r[:i], r[i+len("?password="):]
+		}
+		j, err := jid.Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		if j.Resourcepart() != "" {
+			return nil, errors.New("room " + r + " must be a bare jid")
+		}
+		rooms = append(rooms, room{jid: j, password: password})
+	}
+	return rooms, nil
+}
+
+// returns the presence used to join the room with the given nick
+func (r room) join(from jid.JID, nick string) (mucJoin, error) {
+	occupant, err := r.jid.WithResource(nick)
+	if err != nil {
+		return mucJoin{}, err
+	}
+	p := mucJoin{Presence: stanza.Presence{To: occupant, From: from}}
+	p.X.Password = r.password
+	return p, nil
+}
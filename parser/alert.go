@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// canonical alert format, any tool can be adapted to send it to /alert; the
+// vendor parsers fill the same Result fields, but keep their message layout
+type Alert struct {
+	Name     string            `json:"name"`
+	Status   string            `json:"status"`
+	Severity string            `json:"severity"`
+	Summary  string            `json:"summary"`
+	Labels   map[string]string `json:"labels"`
+	URL      string            `json:"url"`
+	// schedules the message for later, optional
+	DeliverAt *time.Time `json:"deliver_at"`
+}
+
+// checks the required fields
+func (a Alert) validate() error {
+	if a.Name == "" {
+		return BadRequestError{Reason: "missing alert name"}
+	}
+	if a.Status != StatusFiring && a.Status != StatusResolved {
+		return BadRequestError{Reason: "alert status must be firing or resolved"}
+	}
+	return nil
+}
+
+// formats the alert, the alert is identified by its name and labels
+func (a Alert) Result() Result {
+	var names []string
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	message := a.Name
+	if a.Summary != "" {
+		message += ": " + a.Summary
+	}
+	key := a.Name
+	for _, name := range names {
+		message += "\n" + name + " = " + a.Labels[name]
+		key += "\xff" + name + "=" + a.Labels[name]
+	}
+	if a.URL != "" {
+		message += "\n" + a.URL
+	}
+
+	result := Result{Message: message, Status: a.Status, Key: key, Severity: NormalizeSeverity(a.Severity), Labels: a.Labels}
+	if a.DeliverAt != nil {
+		result.DeliverAt = *a.DeliverAt
+	}
+	return result
+}
+
+func GenericAlertParserFunc(r *http.Request) (Result, error) {
+	// get alert data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	// parse body into the alert struct
+	var alert Alert
+	err = json.Unmarshal(body, &alert)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	alert.Status = strings.ToLower(alert.Status)
+	err = alert.validate()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return alert.Result(), nil
+}
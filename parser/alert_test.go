@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenericAlertParserFunc(t *testing.T) {
+	testParser(t, GenericAlertParserFunc, []parserTest{
+		{
+			name: "firing",
+			file: "alert-example.json",
+			want: Result{
+				Message:  "DiskAlmostFull: Disk /var on db01 is 92% full\nhost = db01\nmountpoint = /var\nhttps://monitoring.example.com/hosts/db01",
+				Status:   StatusFiring,
+				Severity: SeverityWarning,
+				Key:      "DiskAlmostFull\xffhost=db01\xffmountpoint=/var",
+			},
+		},
+		{
+			name: "resolved",
+			body: `{"name": "DiskAlmostFull", "status": "RESOLVED", "labels": {"mountpoint": "/var", "host": "db01"}}`,
+			want: Result{
+				Message:  "DiskAlmostFull\nhost = db01\nmountpoint = /var",
+				Status:   StatusResolved,
+				Severity: SeverityUnknown,
+				Key:      "DiskAlmostFull\xffhost=db01\xffmountpoint=/var",
+			},
+		},
+		{
+			name: "without labels",
+			body: `{"name": "BackupFailed", "status": "firing", "severity": "page", "summary": "nightly backup failed"}`,
+			want: Result{Message: "BackupFailed: nightly backup failed", Status: StatusFiring, Severity: SeverityCritical, Key: "BackupFailed"},
+		},
+		{
+			name:       "missing name",
+			body:       `{"status": "firing", "summary": "Disk /var on db01 is 92% full"}`,
+			badRequest: true,
+		},
+		{
+			name:       "missing status",
+			body:       `{"name": "DiskAlmostFull"}`,
+			badRequest: true,
+		},
+		{
+			name:       "unknown status",
+			body:       `{"name": "DiskAlmostFull", "status": "pending"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"name": "DiskAlmostFull", `,
+			err:  true,
+		},
+	})
+}
+
+func TestGenericAlertDeliverAt(t *testing.T) {
+	r := httptest.NewRequest("POST", "/alert", strings.NewReader(`{"name": "MaintenanceStarts", "status": "firing", "deliver_at": "2024-05-14T08:00:00Z"}`))
+	result, err := GenericAlertParserFunc(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC); !result.DeliverAt.Equal(want) {
+		t.Errorf("deliver at %v, want %v", result.DeliverAt, want)
+	}
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// single alert of the alertmanager v2 api (POST /api/v2/alerts), as posted by
+// amtool and other clients of the api
+type alertmanagerV2Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+// labels shown in the first line of the message instead of the label list
+var alertmanagerV2TitleLabels = map[string]bool{"alertname": true, "instance": true}
+
+// parses the flat alert list of the alertmanager v2 api:
+// [{"labels": {"alertname": ...}, "annotations": {...}, "startsAt": ..., "endsAt": ...}]
+// unlike the grouped webhook payload of /alertmanager, there's no status, an
+// alert is resolved once its endsAt has passed. every alert is sent as a
+// separate message
+func AlertmanagerV2ParserFunc(r *http.Request) (Result, error) {
+	// get alerts from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	// the webhook payload is an object, point to the right endpoint
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		return Result{}, BadRequestError{Reason: "expected a list of alerts, webhook payloads go to /alertmanager"}
+	}
+	var alerts []alertmanagerV2Alert
+	err = json.Unmarshal(body, &alerts)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	now := time.Now()
+	var results []Result
+	for _, a := range alerts {
+		if len(a.Labels) == 0 {
+			return Result{}, BadRequestError{Reason: "alert without labels"}
+		}
+		results = append(results, alertmanagerV2Result(a, now))
+	}
+	switch len(results) {
+	case 0:
+		return Result{}, BadRequestError{Reason: "no alerts"}
+	case 1:
+		return results[0], nil
+	}
+	return Result{Results: results}, nil
+}
+
+// returns the message of an alert:
+// InstanceDown on server01:9100
+// Instance server01:9100 down
+// description: ...
+// Labels: job=node, severity=critical
+func alertmanagerV2Result(a alertmanagerV2Alert, now time.Time) Result {
+	title := a.Labels["alertname"]
+	if title == "" {
+		title = "Alert"
+	}
+	if instance := a.Labels["instance"]; instance != "" {
+		title += " on " + instance
+	}
+	lines := []string{title}
+	if summary := a.Annotations["summary"]; summary != "" {
+		lines = append(lines, summary)
+	}
+	for _, key := range sortedKeys(a.Annotations) {
+		if key != "summary" && a.Annotations[key] != "" {
+			lines = append(lines, key+": "+a.Annotations[key])
+		}
+	}
+	var labels []string
+	for _, key := range sortedKeys(a.Labels) {
+		if !alertmanagerV2TitleLabels[key] {
+			labels = append(labels, key+"="+a.Labels[key])
+		}
+	}
+	if len(labels) > 0 {
+		lines = append(lines, "Labels: "+strings.Join(labels, ", "))
+	}
+	if a.GeneratorURL != "" {
+		lines = append(lines, a.GeneratorURL)
+	}
+
+	result := Result{
+		Message:  strings.Join(lines, "\n"),
+		Status:   StatusFiring,
+		Key:      alertmanagerV2Key(a.Labels),
+		Severity: NormalizeSeverity(a.Labels["severity"]),
+		Time:     a.StartsAt,
+		Labels:   a.Labels,
+	}
+	// an alert without endsAt fires until it's posted again with one
+	if !a.EndsAt.IsZero() && !a.EndsAt.After(now) {
+		result.Status = StatusResolved
+		result.Time = a.EndsAt
+	}
+	return result
+}
+
+// identifies the alert by its label set, like alertmanager does:
+// {alertname="InstanceDown", instance="server01:9100"}
+func alertmanagerV2Key(labels map[string]string) string {
+	var pairs []string
+	for _, key := range sortedKeys(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, labels[key]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// returns the keys of the map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
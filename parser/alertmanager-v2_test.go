@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAlertmanagerV2ParserFunc(t *testing.T) {
+	testParser(t, AlertmanagerV2ParserFunc, []parserTest{
+		{
+			name: "firing",
+			body: `[{"labels": {"alertname": "HighLoad", "instance": "web01", "severity": "warning"}, "annotations": {"summary": "Load above 10"}, "startsAt": "2024-05-14T08:21:04Z"}]`,
+			want: Result{Message: "HighLoad on web01\nLoad above 10\nLabels: severity=warning", Status: StatusFiring, Severity: SeverityWarning, Key: `{alertname="HighLoad", instance="web01", severity="warning"}`},
+		},
+		{
+			name: "ends in the future",
+			body: `[{"labels": {"alertname": "Maintenance"}, "endsAt": "2999-01-01T00:00:00Z"}]`,
+			want: Result{Message: "Maintenance", Status: StatusFiring, Severity: SeverityUnknown, Key: `{alertname="Maintenance"}`},
+		},
+		{
+			name: "resolved",
+			body: `[{"labels": {"alertname": "HighLoad", "instance": "web01"}, "startsAt": "2024-05-14T08:21:04Z", "endsAt": "2024-05-14T08:30:00Z"}]`,
+			want: Result{Message: "HighLoad on web01", Status: StatusResolved, Severity: SeverityUnknown, Key: `{alertname="HighLoad", instance="web01"}`},
+		},
+		{
+			name:       "webhook payload",
+			file:       "alertmanager-example.json",
+			badRequest: true,
+		},
+		{
+			name:       "without labels",
+			body:       `[{"annotations": {"summary": "test"}}]`,
+			badRequest: true,
+		},
+		{
+			name:       "no alerts",
+			body:       `[]`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[{"labels": []}]`,
+			err:  true,
+		},
+	})
+}
+
+func TestAlertmanagerV2ParserFuncAlerts(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("..", "dev", "alertmanager-v2-example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := AlertmanagerV2ParserFunc(httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{
+		{
+			Message:  "InstanceDown on server01.example.org:9100\nInstance server01.example.org:9100 down\ndescription: server01.example.org:9100 has been down for more than 5 minutes.\nLabels: job=node, severity=critical\nhttp://prometheus.example.org/graph?g0.expr=up+%3D%3D+0",
+			Status:   StatusFiring,
+			Severity: SeverityCritical,
+			Key:      `{alertname="InstanceDown", instance="server01.example.org:9100", job="node", severity="critical"}`,
+			Time:     time.Date(2024, 5, 14, 8, 21, 4, 0, time.UTC),
+		},
+		{
+			Message:  "DiskFull on server02.example.org:9100\nDisk of server02.example.org:9100 almost full\nLabels: severity=warning",
+			Status:   StatusResolved,
+			Severity: SeverityWarning,
+			Key:      `{alertname="DiskFull", instance="server02.example.org:9100", severity="warning"}`,
+			Time:     time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC),
+		},
+	}
+	if len(result.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(result.Results), len(want))
+	}
+	for i, w := range want {
+		got := result.Results[i]
+		if got.Message != w.Message || got.Status != w.Status || got.Severity != w.Severity || got.Key != w.Key || !got.Time.Equal(w.Time) {
+			t.Errorf("alert %d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
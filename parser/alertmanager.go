@@ -1,55 +1,168 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strings"
+	"text/template"
+	"time"
 )
 
-func AlertmanagerParserFunc(r *http.Request) (string, error) {
+// known versions of the webhook payload
+var alertmanagerVersions = map[string]bool{
+	"4": true,
+}
+
+// webhook payload of alertmanager, available in the alertmanager template
+type AlertmanagerPayload struct {
+	Version           string              `json:"version"`
+	Receiver          string              `json:"receiver"`
+	Status            string              `json:"status"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// single alert of the alertmanager payload
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	// screenshot of the panel, only sent by grafana
+	ImageURL string `json:"imageURL"`
+}
+
+// template of the alertmanager messages, used unless another one is configured
+const DefaultAlertmanagerTemplate = `{{range .Alerts}}{{if eq .Status "resolved"}}Resolved{{else}}Firing{{end}}
+Labels
+{{range $key, $value := .Labels}}{{$key}} = {{$value}}
+{{end}}Annotations
+{{range $key, $value := .Annotations}}{{$key}} = {{$value}}
+{{end}}
+{{end}}`
+
+var defaultAlertmanagerTemplate = template.Must(template.New("alertmanager").Parse(DefaultAlertmanagerTemplate))
+
+// payload the alertmanager template is checked against
+var alertmanagerTemplateCheck = AlertmanagerPayload{
+	Version:      "4",
+	Status:       "firing",
+	GroupLabels:  map[string]string{"alertname": "check"},
+	CommonLabels: map[string]string{"alertname": "check"},
+	Alerts: []AlertmanagerAlert{{
+		Status:      "firing",
+		Labels:      map[string]string{"alertname": "check"},
+		Annotations: map[string]string{"summary": "check"},
+		StartsAt:    time.Now(),
+	}},
+}
+
+func AlertmanagerParserFunc(r *http.Request) (Result, error) {
+	return parseAlertmanager(r, func() *template.Template { return defaultAlertmanagerTemplate })
+}
+
+// returns a parser function that renders the alertmanager payload with the
+// template, fails if the template (or a reloaded one) doesn't work with an
+// example payload
+func NewAlertmanagerParserFunc(t *TemplateFile) (ParserFunc, error) {
+	err := t.setValidate(checkAlertmanagerTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request) (Result, error) {
+		return parseAlertmanager(r, t.current)
+	}, nil
+}
+
+// renders the example payload with the template
+func checkAlertmanagerTemplate(tmpl *template.Template) error {
+	return tmpl.Execute(ioutil.Discard, alertmanagerTemplateCheck)
+}
+
+func parseAlertmanager(r *http.Request, tmpl func() *template.Template) (Result, error) {
 	// get alert data from request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return "", errors.New(readErr)
+		return Result{}, errors.New(readErr)
 	}
 
-	payload := &struct {
-		Alerts []struct {
-			Status      string            `json:"status"`
-			Labels      map[string]string `json:"labels"`
-			Annotations map[string]string `json:"annotations"`
-		} `json:"alerts"`
-	}{}
+	// text rendered by a custom template is passed through as it is
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/plain" {
+		message := strings.TrimSpace(string(body))
+		if message == "" {
+			return Result{}, BadRequestError{Reason: "empty alert body"}
+		}
+		return Result{Message: message}, nil
+	}
+
+	payload := &AlertmanagerPayload{}
 
 	// parse body into the alert struct
 	err = json.Unmarshal(body, &payload)
 	if err != nil {
-		return "", errors.New(parseErr)
+		return Result{}, errors.New(parseErr)
+	}
+
+	// other schema versions might not match the struct, so don't guess
+	Debugf("alertmanager payload version %q", payload.Version)
+	if !alertmanagerVersions[payload.Version] {
+		return Result{}, BadRequestError{Reason: fmt.Sprintf("unsupported alertmanager payload version %q", payload.Version)}
 	}
 
 	// construct alert message
-	var message string
+	var message bytes.Buffer
+	err = tmpl().Execute(&message, payload)
+	if err != nil {
+		return Result{}, BadRequestError{Reason: "failed to render alertmanager template: " + err.Error()}
+	}
+	if strings.TrimSpace(message.String()) == "" {
+		return Result{}, BadRequestError{Reason: "alertmanager template rendered an empty message"}
+	}
+
+	status := StatusFiring
+	if payload.Status == "resolved" {
+		status = StatusResolved
+	}
+
+	return Result{Message: strings.TrimSpace(message.String()), Status: status, Key: payload.GroupKey, Severity: alertmanagerSeverity(payload), Time: alertmanagerTime(payload), Labels: payload.CommonLabels}, nil
+}
+
+// returns the highest severity of the alerts in the group
+func alertmanagerSeverity(payload *AlertmanagerPayload) string {
+	severity := NormalizeSeverity(payload.CommonLabels["severity"])
 	for _, alert := range payload.Alerts {
-		if alert.Status == "resolved" {
-			message = "Resolved" + "\n"
-		} else {
-			message = "Firing" + "\n"
+		s := NormalizeSeverity(alert.Labels["severity"])
+		if severityRank[s] > severityRank[severity] {
+			severity = s
 		}
+	}
+	return severity
+}
 
-		message += "Labels" + "\n"
-		for key, label := range alert.Labels {
-			message += fmt.Sprintf("%s = %s\n", key, label)
+// returns the latest change of the alerts in the group
+func alertmanagerTime(payload *AlertmanagerPayload) time.Time {
+	var t time.Time
+	for _, alert := range payload.Alerts {
+		changed := alert.StartsAt
+		if alert.Status == "resolved" && !alert.EndsAt.IsZero() {
+			changed = alert.EndsAt
 		}
-
-		message += "Annotations" + "\n"
-		for key, annotation := range alert.Annotations {
-			message += fmt.Sprintf("%s = %s\n", key, annotation)
+		if changed.After(t) {
+			t = changed
 		}
-
-		message += "\n"
 	}
-
-	return message, nil
+	return t
 }
@@ -0,0 +1,34 @@
+package parser
+
+import "testing"
+
+func TestAlertmanagerParserFunc(t *testing.T) {
+	testParser(t, AlertmanagerParserFunc, []parserTest{
+		{
+			name: "version 4",
+			file: "alertmanager-example.json",
+			want: Result{Message: "Firing\nLabels\nalertname = testalert\ninstance = test.net\nseverity = critical\nAnnotations\nsummary = Simple test", Status: StatusFiring, Severity: SeverityCritical, Key: `{}/{severity="critical"}:{instance="test.net", severity="critical"}`},
+		},
+		{
+			name:       "unknown version",
+			file:       "alertmanager-unknown-version-example.json",
+			badRequest: true,
+		},
+		{
+			name:       "without version",
+			body:       `{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "test"}}]}`,
+			badRequest: true,
+		},
+		{
+			name: "resolved",
+			body: `{"version": "4", "status": "resolved", "groupKey": "g", "alerts": [{"status": "resolved", "labels": {"alertname": "test", "severity": "warning"}}]}`,
+			want: Result{Message: "Resolved\nLabels\nalertname = test\nseverity = warning\nAnnotations", Status: StatusResolved, Severity: SeverityWarning, Key: "g"},
+		},
+		{
+			name:        "rendered text",
+			file:        "alertmanager-text-example.txt",
+			contentType: "text/plain",
+			want:        Result{Message: "[FIRING:1] InstanceDown (node-exporter production)\ninstance: server01.example.org:9100\nsummary: Instance server01.example.org:9100 down\ndescription: server01.example.org:9100 has been down for more than 5 minutes."},
+		},
+	})
+}
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// names of the analytics platforms in the messages, others are shown as "Analytics"
+var analyticsSources = map[string]string{
+	"matomo":    "Matomo",
+	"plausible": "Plausible",
+}
+
+// parses the alert webhooks of analytics platforms (e.g. matomo custom alerts
+// or plausible traffic notifications relayed by a small script), spikes, drops
+// and goal completions:
+// {"source": "matomo", "site": "example.com", "name": "Traffic drop", "metric": "visits", "value": 120, "threshold": 500, ...}
+func AnalyticsAlertParserFunc(r *http.Request) (Result, error) {
+	// get alert data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Source    string      `json:"source"`
+		Site      string      `json:"site"`
+		Name      string      `json:"name"`
+		Metric    string      `json:"metric"`
+		Value     json.Number `json:"value"`
+		Threshold json.Number `json:"threshold"`
+		Previous  json.Number `json:"previous"`
+		Direction string      `json:"direction"`
+		Period    string      `json:"period"`
+		Severity  string      `json:"severity"`
+		URL       string      `json:"url"`
+		Timestamp *time.Time  `json:"timestamp"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.Name == "" && payload.Metric == "" {
+		return Result{}, BadRequestError{Reason: "alert without name and metric"}
+	}
+
+	// construct alert message:
+	// [Matomo] Traffic drop (example.com)
+	// visits 120 ↓ below the threshold of 500 (day, previously 480)
+	source := analyticsSources[strings.ToLower(payload.Source)]
+	if source == "" {
+		source = "Analytics"
+	}
+	name := payload.Name
+	if name == "" {
+		name = payload.Metric
+	}
+	message := "[" + source + "] " + name
+	if payload.Site != "" {
+		message += " (" + payload.Site + ")"
+	}
+	var line []string
+	if payload.Metric != "" {
+		line = append(line, payload.Metric)
+	}
+	if payload.Value != "" {
+		line = append(line, payload.Value.String())
+	}
+	direction := analyticsDirection(payload.Direction, payload.Value, payload.Threshold)
+	switch {
+	case direction == "up" && payload.Threshold != "":
+		line = append(line, "↑ above the threshold of "+payload.Threshold.String())
+	case direction == "down" && payload.Threshold != "":
+		line = append(line, "↓ below the threshold of "+payload.Threshold.String())
+	case direction == "up":
+		line = append(line, "↑")
+	case direction == "down":
+		line = append(line, "↓")
+	}
+	var details []string
+	if payload.Period != "" {
+		details = append(details, payload.Period)
+	}
+	if payload.Previous != "" {
+		details = append(details, "previously "+payload.Previous.String())
+	}
+	if len(details) > 0 {
+		line = append(line, "("+strings.Join(details, ", ")+")")
+	}
+	if len(line) > 0 {
+		message += "\n" + strings.Join(line, " ")
+	}
+	if payload.URL != "" {
+		message += "\n" + payload.URL
+	}
+
+	// drops need a look, spikes and goals are good news unless the sender says otherwise
+	result := Result{Message: message, Severity: SeverityInfo, Key: strings.Trim(strings.ToLower(payload.Source)+"/"+payload.Site+"/"+name, "/")}
+	if direction == "down" {
+		result.Severity = SeverityWarning
+	}
+	if s := NormalizeSeverity(payload.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	if payload.Timestamp != nil {
+		result.Time = *payload.Timestamp
+	}
+	return result, nil
+}
+
+// returns whether the threshold was crossed "up" or "down", as given by the
+// sender (e.g. "spike", "below") or by comparing the value with the threshold;
+// empty if unknown
+func analyticsDirection(direction string, value json.Number, threshold json.Number) string {
+	switch strings.ToLower(direction) {
+	case "up", "above", "increase", "spike", "rise":
+		return "up"
+	case "down", "below", "decrease", "drop", "fall":
+		return "down"
+	}
+	v, err := strconv.ParseFloat(value.String(), 64)
+	if err != nil {
+		return ""
+	}
+	t, err := strconv.ParseFloat(threshold.String(), 64)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case v > t:
+		return "up"
+	case v < t:
+		return "down"
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package parser
+
+import "testing"
+
+func TestAnalyticsAlertParserFunc(t *testing.T) {
+	testParser(t, AnalyticsAlertParserFunc, []parserTest{
+		{
+			name: "traffic drop",
+			file: "analytics-example.json",
+			want: Result{
+				Message:  "[Matomo] Traffic drop (shop.example.com)\nvisits 120 ↓ below the threshold of 500 (day, previously 480)\nhttps://matomo.example.com/index.php?module=CoreHome&action=index&idSite=3&period=day&date=yesterday",
+				Severity: SeverityWarning,
+				Key:      "matomo/shop.example.com/Traffic drop",
+			},
+		},
+		{
+			name: "spike given by the sender",
+			body: `{"source": "Plausible", "site": "blog.example.com", "name": "Traffic spike", "metric": "visitors", "value": 1800, "threshold": 2000, "direction": "spike"}`,
+			want: Result{Message: "[Plausible] Traffic spike (blog.example.com)\nvisitors 1800 ↑ above the threshold of 2000", Severity: SeverityInfo, Key: "plausible/blog.example.com/Traffic spike"},
+		},
+		{
+			name: "goal completion with severity",
+			body: `{"site": "shop.example.com", "metric": "goal: checkout", "value": 1, "severity": "notice"}`,
+			want: Result{Message: "[Analytics] goal: checkout (shop.example.com)\ngoal: checkout 1", Severity: SeverityInfo, Key: "shop.example.com/goal: checkout"},
+		},
+		{
+			name: "value above threshold",
+			body: `{"name": "Bounce rate", "value": "71.5", "threshold": "60"}`,
+			want: Result{Message: "[Analytics] Bounce rate\n71.5 ↑ above the threshold of 60", Severity: SeverityInfo, Key: "Bounce rate"},
+		},
+		{
+			name:       "without name and metric",
+			body:       `{"value": 3}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// risk scores from which on security alerts are critical and warnings, lower
+// ones are info
+const (
+	authAnomalyCriticalRisk = 80
+	authAnomalyWarningRisk  = 50
+)
+
+// canonical security alert of a login or auth anomaly, the event and the
+// user or source_ip are required
+type authAnomalyAlert struct {
+	Event     string          `json:"event"`
+	User      string          `json:"user"`
+	SourceIP  string          `json:"source_ip"`
+	Geo       json.RawMessage `json:"geo"` // a string or {"country": ..., "city": ...}
+	RiskScore *json.Number    `json:"risk_score"`
+	Details   string          `json:"details"`
+	Severity  string          `json:"severity"`
+	Time      string          `json:"time"` // rfc 3339
+}
+
+// parses the security alerts of SIEMs, identity providers and log scanners
+// about suspicious logins and other auth anomalies:
+// {"event": "suspicious_login", "user": "alice", "source_ip": "1.2.3.4", "geo": "RU", "risk_score": 87}
+func AuthAnomalyParserFunc(r *http.Request) (Result, error) {
+	// get alert from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var alert authAnomalyAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	event := strings.ToLower(strings.TrimSpace(alert.Event))
+	if event == "" || (alert.User == "" && alert.SourceIP == "") {
+		return Result{}, BadRequestError{Reason: "event and user or source_ip are required"}
+	}
+	geo, err := authAnomalyGeo(alert.Geo)
+	if err != nil {
+		return Result{}, err
+	}
+	risk := -1
+	if alert.RiskScore != nil {
+		score, err := strconv.ParseFloat(alert.RiskScore.String(), 64)
+		if err != nil || score < 0 || score > 100 {
+			return Result{}, BadRequestError{Reason: "risk_score must be a number from 0 to 100"}
+		}
+		risk = int(math.Round(score))
+	}
+	result := Result{Labels: map[string]string{"event": event}}
+	if alert.Time != "" {
+		result.Time, err = time.Parse(time.RFC3339, alert.Time)
+		if err != nil {
+			return Result{}, BadRequestError{Reason: "time must be an RFC 3339 timestamp"}
+		}
+	}
+
+	// Suspicious login: user alice from 1.2.3.4 (RU, risk 87)
+	name := strings.NewReplacer("_", " ", "-", " ", ".", " ").Replace(event)
+	message := strings.ToUpper(name[:1]) + name[1:] + ":"
+	if alert.User != "" {
+		message += " user " + alert.User
+		result.Labels["user"] = alert.User
+		// the alerts of a user form a conversation
+		result.Thread = alert.User
+	}
+	if alert.SourceIP != "" {
+		message += " from " + alert.SourceIP
+	}
+	var extra []string
+	if geo != "" {
+		extra = append(extra, geo)
+	}
+	if risk >= 0 {
+		extra = append(extra, "risk "+strconv.Itoa(risk))
+	}
+	if len(extra) > 0 {
+		message += " (" + strings.Join(extra, ", ") + ")"
+	}
+	if alert.Details != "" {
+		message += "\n" + alert.Details
+	}
+	result.Message = message
+
+	// the risk score rates the alert, unscored ones are worth a look
+	switch {
+	case risk >= authAnomalyCriticalRisk:
+		result.Severity = SeverityCritical
+	case risk >= authAnomalyWarningRisk || risk < 0:
+		result.Severity = SeverityWarning
+	default:
+		result.Severity = SeverityInfo
+	}
+	if s := NormalizeSeverity(alert.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// returns the location of the source as given or as city, region, country
+func authAnomalyGeo(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var geo string
+	if json.Unmarshal(raw, &geo) == nil {
+		return geo, nil
+	}
+	var location struct {
+		City    string `json:"city"`
+		Region  string `json:"region"`
+		Country string `json:"country"`
+	}
+	if json.Unmarshal(raw, &location) != nil {
+		return "", BadRequestError{Reason: "geo must be a string or an object with city, region and country"}
+	}
+	var parts []string
+	for _, p := range []string{location.City, location.Region, location.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
@@ -0,0 +1,58 @@
+package parser
+
+import "testing"
+
+func TestAuthAnomalyParserFunc(t *testing.T) {
+	testParser(t, AuthAnomalyParserFunc, []parserTest{
+		{
+			name: "suspicious login",
+			file: "security-example.json",
+			want: Result{Message: "Suspicious login: user alice from 1.2.3.4 (RU, risk 87)", Severity: SeverityCritical},
+		},
+		{
+			name: "impossible travel",
+			body: `{"event": "impossible-travel", "user": "bob@example.com", "source_ip": "203.0.113.7", "geo": {"city": "Lagos", "country": "NG"}, "risk_score": 64.6, "details": "last login from Berlin 20 minutes earlier"}`,
+			want: Result{Message: "Impossible travel: user bob@example.com from 203.0.113.7 (Lagos, NG, risk 65)\nlast login from Berlin 20 minutes earlier", Severity: SeverityWarning},
+		},
+		{
+			name: "low risk",
+			body: `{"event": "new_device", "user": "carol", "risk_score": 12}`,
+			want: Result{Message: "New device: user carol (risk 12)", Severity: SeverityInfo},
+		},
+		{
+			name: "unscored",
+			body: `{"event": "password_spray", "source_ip": "198.51.100.23"}`,
+			want: Result{Message: "Password spray: from 198.51.100.23", Severity: SeverityWarning},
+		},
+		{
+			name: "severity override",
+			body: `{"event": "account_lockout", "user": "dave", "risk_score": 40, "severity": "critical"}`,
+			want: Result{Message: "Account lockout: user dave (risk 40)", Severity: SeverityCritical},
+		},
+		{
+			name:       "without user and source",
+			body:       `{"event": "suspicious_login", "risk_score": 90}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid risk score",
+			body:       `{"event": "suspicious_login", "user": "alice", "risk_score": 870}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid geo",
+			body:       `{"event": "suspicious_login", "user": "alice", "geo": 7}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid time",
+			body:       `{"event": "suspicious_login", "user": "alice", "time": "yesterday"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[1]`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// user of the events of unauthenticated requests
+const authentikAnonymous = "AnonymousUser"
+
+// authentik event actions that point to an attack or a compromised account
+var authentikHighRisk = map[string]bool{
+	"login_failed":          true,
+	"suspicious_request":    true,
+	"impersonation_started": true,
+	"policy_exception":      true,
+	"secret_view":           true,
+}
+
+// authentik event actions worth a look, e.g. a new authenticator or a changed password
+var authentikMediumRisk = map[string]bool{
+	"password_set":          true,
+	"authorize_application": true,
+	"model_created":         true,
+	"model_deleted":         true,
+	"configuration_error":   true,
+	"system_exception":      true,
+}
+
+// parses the notifications of the authentik webhook transport, with the
+// event added by a webhook mapping:
+// {"body": "...", "severity": "notice", "event": {"action": "login_failed", "user": {...}, "client_ip": "..."}}
+func AuthentikParserFunc(r *http.Request) (Result, error) {
+	// get event data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Body         string `json:"body"`
+		Severity     string `json:"severity"`
+		UserUsername string `json:"event_user_username"`
+		Event        *struct {
+			Action string `json:"action"`
+			User   struct {
+				Username string `json:"username"`
+				Email    string `json:"email"`
+			} `json:"user"`
+			ClientIP string                 `json:"client_ip"`
+			App      string                 `json:"app"`
+			Context  map[string]interface{} `json:"context"`
+		} `json:"event"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.Event == nil || payload.Event.Action == "" {
+		// the plain notification without a mapping
+		if payload.Body == "" {
+			return Result{}, BadRequestError{Reason: "notification without event and body"}
+		}
+		return Result{Message: "[authentik] " + payload.Body, Severity: NormalizeSeverity(payload.Severity)}, nil
+	}
+
+	// the event type rates the risk, authentik's notification severity is set per rule
+	event := payload.Event
+	action := strings.ToLower(event.Action)
+	result := Result{Severity: NormalizeSeverity(payload.Severity), Labels: map[string]string{"action": action}}
+	prefix := "[authentik]"
+	switch {
+	case authentikHighRisk[action]:
+		result.Severity = SeverityCritical
+		prefix += " HIGH RISK:"
+	case authentikMediumRisk[action]:
+		result.Severity = SeverityWarning
+	}
+
+	// construct event message
+	message := prefix + " " + strings.ReplaceAll(action, "_", " ")
+	user := event.User.Username
+	if user == "" {
+		user = payload.UserUsername
+	}
+	if user != "" && user != authentikAnonymous {
+		message += " by " + user
+		result.Labels["user"] = user
+	} else if u, ok := event.Context["username"].(string); ok && u != "" {
+		// failed logins are anonymous, the context has the username that was tried
+		message += " for " + u
+		result.Labels["user"] = u
+	}
+	if event.ClientIP != "" {
+		message += " from " + event.ClientIP
+	}
+	if payload.Body != "" {
+		message += "\n" + payload.Body
+	}
+	result.Message = message
+	return result, nil
+}
@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestAuthentikParserFunc(t *testing.T) {
+	testParser(t, AuthentikParserFunc, []parserTest{
+		{
+			name: "failed login",
+			file: "authentik-example.json",
+			want: Result{Message: "[authentik] HIGH RISK: login failed for akadmin from 198.51.100.23\nFailed login for akadmin from 198.51.100.23", Severity: SeverityCritical},
+		},
+		{
+			name: "new authenticator",
+			body: `{"body": "", "severity": "notice", "event": {"action": "model_created", "user": {"username": "alice"}, "client_ip": "192.0.2.10"}}`,
+			want: Result{Message: "[authentik] model created by alice from 192.0.2.10", Severity: SeverityWarning},
+		},
+		{
+			name: "login",
+			body: `{"severity": "notice", "event": {"action": "login", "user": {"username": "alice"}}}`,
+			want: Result{Message: "[authentik] login by alice", Severity: SeverityInfo},
+		},
+		{
+			name: "without mapping",
+			body: `{"body": "Test notification", "severity": "alert"}`,
+			want: Result{Message: "[authentik] Test notification", Severity: SeverityCritical},
+		},
+		{
+			name:       "empty",
+			body:       `{"severity": "notice"}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// parses the webhooks of automation platforms (n8n, Node-RED, Zapier, ...),
+// preferably in the canonical shape {"message": ..., "severity": ..., "recipients": ...}
+// with recipients as a comma-separated string or an array; other payloads are
+// sent as their fields, one "key: value" line each
+func AutomationParserFunc(r *http.Request) (Result, error) {
+	// get the payload from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	// zapier and others can send forms too
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+		fields := make(map[string]interface{})
+		for name, values := range form {
+			fields[name] = strings.Join(values, ", ")
+		}
+		if form["recipients"] != nil {
+			fields["recipients"] = form["recipients"]
+		}
+		return automationResult(fields)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var payload interface{}
+	if err := d.Decode(&payload); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if fields, ok := payload.(map[string]interface{}); ok {
+		return automationResult(fields)
+	}
+	// e.g. an array of items or a plain string
+	if s, ok := payload.(string); ok && strings.TrimSpace(s) != "" {
+		return Result{Message: s}, nil
+	}
+	message := automationValue(payload)
+	if message == "" || message == "null" || message == "[]" {
+		return Result{}, BadRequestError{Reason: "empty payload"}
+	}
+	return Result{Message: message}, nil
+}
+
+// returns the result of the canonical shape if there is a message, the
+// stringified fields otherwise
+func automationResult(fields map[string]interface{}) (Result, error) {
+	m, ok := fields["message"]
+	if !ok {
+		if len(fields) == 0 {
+			return Result{}, BadRequestError{Reason: "empty payload"}
+		}
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var lines []string
+		for _, name := range names {
+			lines = append(lines, name+": "+automationValue(fields[name]))
+		}
+		return Result{Message: strings.Join(lines, "\n")}, nil
+	}
+
+	// validate the canonical shape, mistakes shouldn't end up as a stringified payload
+	message, ok := m.(string)
+	if !ok || strings.TrimSpace(message) == "" {
+		return Result{}, BadRequestError{Reason: "message must be a non-empty string"}
+	}
+	result := Result{Message: message, Severity: SeverityUnknown}
+	if s, ok := fields["severity"]; ok && s != nil {
+		severity, ok := s.(string)
+		if !ok {
+			return Result{}, BadRequestError{Reason: "severity must be a string"}
+		}
+		result.Severity = NormalizeSeverity(severity)
+	}
+	switch recipients := fields["recipients"].(type) {
+	case nil:
+	case string:
+		result.Recipients = recipients
+	case []string:
+		result.Recipients = strings.Join(recipients, ",")
+	case []interface{}:
+		var list []string
+		for _, recipient := range recipients {
+			s, ok := recipient.(string)
+			if !ok {
+				return Result{}, BadRequestError{Reason: "recipients must be strings"}
+			}
+			list = append(list, s)
+		}
+		result.Recipients = strings.Join(list, ",")
+	default:
+		return Result{}, BadRequestError{Reason: "recipients must be a string or an array of strings"}
+	}
+	return result, nil
+}
+
+// returns strings as they are and everything else as compact json
+func automationValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
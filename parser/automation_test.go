@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAutomationParserFunc(t *testing.T) {
+	testParser(t, AutomationParserFunc, []parserTest{
+		{
+			name: "canonical shape",
+			file: "automation-example.json",
+			want: Result{Message: "New order #1042 from Jane Doe: 3 items, 129.90 EUR", Severity: SeverityInfo},
+		},
+		{
+			name: "message only",
+			body: `{"message": "workflow done"}`,
+			want: Result{Message: "workflow done", Severity: SeverityUnknown},
+		},
+		{
+			name: "stringified fields",
+			body: `{"workflow": "Sync CRM", "items": 12, "errors": [{"id": 3, "reason": "<missing email>"}], "ok": false}`,
+			want: Result{Message: "errors: [{\"id\":3,\"reason\":\"<missing email>\"}]\nitems: 12\nok: false\nworkflow: Sync CRM"},
+		},
+		{
+			name: "array",
+			body: `[{"id": 1}, {"id": 2}]`,
+			want: Result{Message: `[{"id":1},{"id":2}]`},
+		},
+		{
+			name: "string",
+			body: `"backup done"`,
+			want: Result{Message: "backup done"},
+		},
+		{
+			name:        "form",
+			body:        "message=Zap+ran&severity=warning",
+			contentType: "application/x-www-form-urlencoded",
+			want:        Result{Message: "Zap ran", Severity: SeverityWarning},
+		},
+		{
+			name:        "form without message",
+			body:        "zap=Orders&count=3",
+			contentType: "application/x-www-form-urlencoded",
+			want:        Result{Message: "count: 3\nzap: Orders"},
+		},
+		{name: "message not a string", body: `{"message": 42}`, badRequest: true},
+		{name: "empty message", body: `{"message": " "}`, badRequest: true},
+		{name: "invalid severity", body: `{"message": "x", "severity": 2}`, badRequest: true},
+		{name: "invalid recipients", body: `{"message": "x", "recipients": [1]}`, badRequest: true},
+		{name: "empty object", body: `{}`, badRequest: true},
+		{name: "null", body: `null`, badRequest: true},
+		{name: "invalid json", body: `{"message"`, err: true},
+	})
+}
+
+func TestAutomationParserFuncRecipients(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"message": "x", "recipients": "alice@example.com,bob@example.com"}`:      "alice@example.com,bob@example.com",
+		`{"message": "x", "recipients": ["alice@example.com", "bob@example.com"]}`: "alice@example.com,bob@example.com",
+		`{"message": "x"}`: "",
+	} {
+		result, err := AutomationParserFunc(httptest.NewRequest("POST", "/automation", strings.NewReader(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Recipients != want {
+			t.Errorf("%s: got %q, want %q", body, result.Recipients, want)
+		}
+	}
+	r := httptest.NewRequest("POST", "/automation", strings.NewReader("message=x&recipients=alice@example.com&recipients=bob@example.com"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	result, err := AutomationParserFunc(r)
+	if err != nil || result.Recipients != "alice@example.com,bob@example.com" {
+		t.Errorf("form: got %q (%v)", result.Recipients, err)
+	}
+}
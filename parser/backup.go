@@ -0,0 +1,440 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outcomes of backup jobs
+const (
+	backupOK      = "OK"
+	backupWarning = "WARNING"
+	backupFailed  = "FAILED"
+)
+
+// max. number of error messages listed
+const backupMaxErrors = 5
+
+// statuses of the canonical payload
+var backupStatuses = map[string]string{
+	"ok": backupOK, "success": backupOK, "succeeded": backupOK, "completed": backupOK,
+	"warning": backupWarning, "partial": backupWarning,
+	"failed": backupFailed, "failure": backupFailed, "error": backupFailed, "fatal": backupFailed,
+}
+
+// run of a backup job, as reported by one of the tools
+type backupRun struct {
+	job      string
+	host     string
+	status   string
+	bytes    *float64      // size of the backed up data, nil if unknown
+	duration time.Duration // 0 if unknown
+	errors   int           // -1 if unknown
+	warnings int
+	messages []string // error messages
+	details  []string // lines added after the errors, e.g. the snapshot
+}
+
+// canonical payload for scripts and tools without a format of their own:
+// {"job": "daily", "status": "ok", "bytes": 12300000000, "duration": 240, "errors": 0}
+type backupPayload struct {
+	Job      string          `json:"job"`
+	Host     string          `json:"host"`
+	Status   string          `json:"status"`
+	Bytes    *json.Number    `json:"bytes"`
+	Duration json.RawMessage `json:"duration"` // seconds or a duration like "4m12s"
+	Errors   json.RawMessage `json:"errors"`   // count or list of messages
+	Message  string          `json:"message"`
+}
+
+// line of the json output of restic backup --json, only the summary and
+// errors are used, the progress is ignored
+type resticMessage struct {
+	MessageType         string          `json:"message_type"`
+	TotalBytesProcessed *float64        `json:"total_bytes_processed"`
+	TotalDuration       float64         `json:"total_duration"` // seconds
+	DataAdded           *float64        `json:"data_added"`
+	SnapshotID          string          `json:"snapshot_id"`
+	Error               json.RawMessage `json:"error"`
+	Item                string          `json:"item"`
+	Message             string          `json:"message"` // of exit_error
+}
+
+// result of duplicati in the json format of its http report module
+type duplicatiReport struct {
+	Data struct {
+		ParsedResult        string   `json:"ParsedResult"`
+		Duration            string   `json:"Duration"`
+		SizeOfExaminedFiles *float64 `json:"SizeOfExaminedFiles"`
+		Errors              []string `json:"Errors"`
+		Warnings            []string `json:"Warnings"`
+	} `json:"Data"`
+	Extra map[string]string `json:"Extra"`
+}
+
+// output of borg create --json, only written if the archive was created
+type borgReport struct {
+	Archive struct {
+		Name     string  `json:"name"`
+		Duration float64 `json:"duration"` // seconds
+		Stats    struct {
+			OriginalSize     *float64 `json:"original_size"`
+			DeduplicatedSize *float64 `json:"deduplicated_size"`
+		} `json:"stats"`
+	} `json:"archive"`
+}
+
+// parses the reports of backup jobs: the json output of restic backup --json
+// (the summary and errors, progress lines are ignored), the json result of
+// duplicati, the output of borg create --json or the canonical payload
+// {"job": "daily", "status": "ok", "bytes": 12300000000, "duration": 240, "errors": 0}
+// the query parameters job and host name the job of tools that don't know it
+func BackupParserFunc(r *http.Request) (Result, error) {
+	// get the report from request, duplicati may send it as form
+	var body []byte
+	var err error
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t == "application/x-www-form-urlencoded" {
+		if err = r.ParseForm(); err != nil {
+			return Result{}, errors.New(readErr)
+		}
+		body = []byte(r.PostForm.Get("message"))
+	} else if body, err = ioutil.ReadAll(r.Body); err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&keys); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	var run backupRun
+	switch {
+	case keys["message_type"] != nil:
+		run, err = resticRun(body)
+	case keys["Data"] != nil:
+		run, err = duplicatiRun(body)
+	case keys["archive"] != nil:
+		run, err = borgRun(body)
+	default:
+		run, err = canonicalBackupRun(body)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	query := r.URL.Query()
+	if job := query.Get("job"); job != "" {
+		run.job = job
+	}
+	if host := query.Get("host"); host != "" {
+		run.host = host
+	}
+	if run.job == "" {
+		return Result{}, BadRequestError{Reason: "job is required"}
+	}
+	return backupResult(run), nil
+}
+
+// collects the summary and errors of the lines of restic backup --json,
+// without summary the backup failed
+func resticRun(body []byte) (backupRun, error) {
+	run := backupRun{job: "restic", status: backupFailed}
+	d := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var m resticMessage
+		if err := d.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return backupRun{}, errors.New(parseErr)
+		}
+		switch m.MessageType {
+		case "summary":
+			run.status = backupOK
+			run.bytes = m.TotalBytesProcessed
+			run.duration = time.Duration(m.TotalDuration * float64(time.Second))
+			if m.DataAdded != nil {
+				run.details = append(run.details, "Added: "+formatBytes(*m.DataAdded))
+			}
+			if m.SnapshotID != "" {
+				run.details = append(run.details, "Snapshot: "+m.SnapshotID)
+			}
+		case "error":
+			msg := resticError(m.Error)
+			if m.Item != "" && !strings.Contains(msg, m.Item) {
+				msg = m.Item + ": " + msg
+			}
+			run.messages = append(run.messages, msg)
+		case "exit_error":
+			run.messages = append(run.messages, m.Message)
+		}
+	}
+	if run.status == backupFailed && len(run.messages) == 0 {
+		run.messages = []string{"no summary, the backup didn't complete"}
+	}
+	run.errors = len(run.messages)
+	// restic still creates the snapshot if files couldn't be read
+	if run.status == backupOK && run.errors > 0 {
+		run.status = backupWarning
+	}
+	return run, nil
+}
+
+// returns the message of a restic error, an object with message in newer
+// versions and a string or the fields of the go error in older ones
+func resticError(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var e struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(raw, &e) == nil && e.Message != "" {
+		return e.Message
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, raw) != nil {
+		return "unknown error"
+	}
+	return compact.String()
+}
+
+func duplicatiRun(body []byte) (backupRun, error) {
+	var report duplicatiReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return backupRun{}, errors.New(parseErr)
+	}
+	run := backupRun{
+		job:      report.Extra["backup-name"],
+		host:     report.Extra["machine-name"],
+		bytes:    report.Data.SizeOfExaminedFiles,
+		errors:   len(report.Data.Errors),
+		warnings: len(report.Data.Warnings),
+		messages: report.Data.Errors,
+	}
+	if run.job == "" {
+		run.job = "duplicati"
+	}
+	switch report.Data.ParsedResult {
+	case "Success":
+		run.status = backupOK
+	case "Warning":
+		run.status = backupWarning
+	case "Error", "Fatal":
+		run.status = backupFailed
+	default:
+		return backupRun{}, BadRequestError{Reason: "unknown result " + report.Data.ParsedResult}
+	}
+	if report.Data.Duration != "" {
+		d, err := parseTimeSpan(report.Data.Duration)
+		if err != nil {
+			return backupRun{}, BadRequestError{Reason: "invalid duration " + report.Data.Duration}
+		}
+		run.duration = d
+	}
+	return run, nil
+}
+
+func borgRun(body []byte) (backupRun, error) {
+	var report borgReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return backupRun{}, errors.New(parseErr)
+	}
+	a := report.Archive
+	run := backupRun{
+		job:      "borg",
+		status:   backupOK,
+		bytes:    a.Stats.OriginalSize,
+		duration: time.Duration(a.Duration * float64(time.Second)),
+		errors:   -1,
+	}
+	if a.Stats.DeduplicatedSize != nil {
+		run.details = append(run.details, "Added: "+formatBytes(*a.Stats.DeduplicatedSize))
+	}
+	if a.Name != "" {
+		run.details = append(run.details, "Archive: "+a.Name)
+	}
+	return run, nil
+}
+
+func canonicalBackupRun(body []byte) (backupRun, error) {
+	var p backupPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return backupRun{}, errors.New(parseErr)
+	}
+	status, ok := backupStatuses[strings.ToLower(p.Status)]
+	if !ok {
+		return backupRun{}, BadRequestError{Reason: "unknown status " + p.Status}
+	}
+	run := backupRun{job: p.Job, host: p.Host, status: status, errors: -1}
+	if p.Bytes != nil {
+		b, err := p.Bytes.Float64()
+		if err != nil {
+			return backupRun{}, BadRequestError{Reason: "bytes is not a number"}
+		}
+		run.bytes = &b
+	}
+	if len(p.Duration) > 0 && string(p.Duration) != "null" {
+		d, err := backupDuration(p.Duration)
+		if err != nil {
+			return backupRun{}, BadRequestError{Reason: "invalid duration " + string(p.Duration)}
+		}
+		run.duration = d
+	}
+	if len(p.Errors) > 0 && string(p.Errors) != "null" {
+		if json.Unmarshal(p.Errors, &run.errors) != nil {
+			if json.Unmarshal(p.Errors, &run.messages) != nil {
+				return backupRun{}, BadRequestError{Reason: "errors must be a count or a list of messages"}
+			}
+			run.errors = len(run.messages)
+		}
+	}
+	if p.Message != "" {
+		run.details = append(run.details, p.Message)
+	}
+	return run, nil
+}
+
+// returns the duration given in seconds or as string like "4m12s" or "00:04:12"
+func backupDuration(raw json.RawMessage) (time.Duration, error) {
+	var seconds float64
+	if json.Unmarshal(raw, &seconds) == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	if strings.Contains(s, ":") {
+		return parseTimeSpan(s)
+	}
+	return time.ParseDuration(s)
+}
+
+// parses a .net timespan as used by duplicati: [d.]hh:mm:ss[.fffffff]
+func parseTimeSpan(s string) (time.Duration, error) {
+	var days time.Duration
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.New("invalid timespan")
+	}
+	if i := strings.Index(parts[0], "."); i >= 0 {
+		d, err := strconv.Atoi(parts[0][:i])
+		if err != nil {
+			return 0, err
+		}
+		days, parts[0] = time.Duration(d)*24*time.Hour, parts[0][i+1:]
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	return days + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), nil
+}
+
+// returns the message of the run:
+// backup 'daily' on nas OK: 12.3GB in 4m (0 errors)
+// Snapshot: 3f1a2b3c
+func backupResult(run backupRun) Result {
+	head := "backup '" + run.job + "'"
+	if run.host != "" {
+		head += " on " + run.host
+	}
+	head += " " + run.status
+	var stats []string
+	if run.bytes != nil {
+		stats = append(stats, formatBytes(*run.bytes))
+	}
+	if run.duration > 0 {
+		stats = append(stats, "in "+formatBackupDuration(run.duration))
+	}
+	if len(stats) > 0 {
+		head += ": " + strings.Join(stats, " ")
+	}
+	var counts []string
+	if run.errors >= 0 {
+		counts = append(counts, plural(run.errors, "error"))
+	}
+	if run.warnings > 0 {
+		counts = append(counts, plural(run.warnings, "warning"))
+	}
+	if len(counts) > 0 {
+		head += " (" + strings.Join(counts, ", ") + ")"
+	}
+
+	lines := []string{head}
+	for i, m := range run.messages {
+		if i == backupMaxErrors {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(run.messages)-i))
+			break
+		}
+		lines = append(lines, "Error: "+m)
+	}
+	lines = append(lines, run.details...)
+
+	key := run.job
+	if run.host != "" {
+		key = run.host + "/" + run.job
+	}
+	result := Result{Message: strings.Join(lines, "\n"), Key: key}
+	switch run.status {
+	case backupOK:
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	case backupWarning:
+		result.Status, result.Severity = StatusFiring, SeverityWarning
+	default:
+		result.Status, result.Severity = StatusFiring, SeverityCritical
+	}
+	return result
+}
+
+// formats the size in decimal units, e.g. 12.3GB
+func formatBytes(b float64) string {
+	units := []string{"KB", "MB", "GB", "TB", "PB"}
+	if b < 1000 {
+		return strconv.FormatFloat(b, 'f', 0, 64) + "B"
+	}
+	unit := ""
+	for _, unit = range units {
+		b /= 1000
+		if b < 1000 {
+			break
+		}
+	}
+	return strconv.FormatFloat(b, 'f', 1, 64) + unit
+}
+
+// formats the duration in seconds below a minute and in minutes above, e.g. 4m or 1h5m
+func formatBackupDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%dh%dm", d/time.Hour, d%time.Hour/time.Minute)
+}
+
+// returns the count with the noun, e.g. 1 error or 3 errors
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
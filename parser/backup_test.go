@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestBackupParserFunc(t *testing.T) {
+	testParser(t, BackupParserFunc, []parserTest{
+		{
+			name: "failed",
+			file: "backup-example.json",
+			want: Result{Message: "backup 'daily' on nas FAILED: 4.2GB in 13m (2 errors)\nError: sftp: no space left on device\nError: unable to save snapshot\nRepository: sftp:backup@offsite:/srv/restic",
+				Status: StatusFiring, Severity: SeverityCritical, Key: "nas/daily"},
+		},
+		{
+			name: "ok",
+			body: `{"job": "daily", "status": "success", "bytes": 12300000000, "duration": 240, "errors": 0}`,
+			want: Result{Message: "backup 'daily' OK: 12.3GB in 4m (0 errors)", Status: StatusResolved, Severity: SeverityInfo, Key: "daily"},
+		},
+		{
+			name: "timespan",
+			body: `{"job": "weekly", "status": "warning", "duration": "1.02:30:00", "errors": 1}`,
+			want: Result{Message: "backup 'weekly' WARNING: in 26h30m (1 error)", Status: StatusFiring, Severity: SeverityWarning, Key: "weekly"},
+		},
+		{
+			name:   "restic",
+			file:   "backup-restic-example.json",
+			target: "/backup?job=home&host=laptop",
+			want: Result{Message: "backup 'home' on laptop WARNING: 12.3GB in 4m (1 error)\nError: open /home/alice/.cache/lock: permission denied\nAdded: 212.0MB\nSnapshot: 3f1a2b3c",
+				Status: StatusFiring, Severity: SeverityWarning, Key: "laptop/home"},
+		},
+		{
+			name: "restic without summary",
+			body: `{"message_type":"status","percent_done":0.1}
+{"message_type":"exit_error","code":1,"message":"Fatal: unable to open repository"}`,
+			want: Result{Message: "backup 'restic' FAILED (1 error)\nError: Fatal: unable to open repository", Status: StatusFiring, Severity: SeverityCritical, Key: "restic"},
+		},
+		{
+			name: "duplicati",
+			file: "backup-duplicati-example.json",
+			want: Result{Message: "backup 'daily' on nas OK: 13.2GB in 4m (0 errors)", Status: StatusResolved, Severity: SeverityInfo, Key: "nas/daily"},
+		},
+		{
+			name:        "duplicati form",
+			body:        "message=" + url.QueryEscape(`{"Data": {"ParsedResult": "Error", "Errors": ["Failed to connect: timeout"], "Warnings": ["a", "b"]}, "Extra": {"backup-name": "photos"}}`),
+			contentType: "application/x-www-form-urlencoded",
+			want:        Result{Message: "backup 'photos' FAILED (1 error, 2 warnings)\nError: Failed to connect: timeout", Status: StatusFiring, Severity: SeverityCritical, Key: "photos"},
+		},
+		{
+			name:   "borg",
+			body:   `{"archive": {"name": "nas-2024-05-14", "duration": 31.4, "stats": {"original_size": 812000000, "deduplicated_size": 1200}}, "repository": {"location": "/srv/borg"}}`,
+			target: "/backup?job=nas",
+			want:   Result{Message: "backup 'nas' OK: 812.0MB in 31s\nAdded: 1.2KB\nArchive: nas-2024-05-14", Status: StatusResolved, Severity: SeverityInfo, Key: "nas"},
+		},
+		{
+			name: "many errors",
+			body: `{"job": "db", "status": "error", "errors": ["1", "2", "3", "4", "5", "6", "7"]}`,
+			want: Result{Message: "backup 'db' FAILED (7 errors)\nError: 1\nError: 2\nError: 3\nError: 4\nError: 5\n... and 2 more", Status: StatusFiring, Severity: SeverityCritical, Key: "db"},
+		},
+		{
+			name:       "unknown status",
+			body:       `{"job": "daily", "status": "paused"}`,
+			badRequest: true,
+		},
+		{
+			name:       "without job",
+			body:       `{"status": "ok"}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid errors",
+			body:       `{"job": "daily", "status": "ok", "errors": true}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[1]`,
+			err:  true,
+		},
+	})
+}
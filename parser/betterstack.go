@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parses the incident webhooks of better stack (better uptime), which use the
+// json:api structure {"data": {"id": ..., "type": "incident", "attributes": {...}}}
+func BetterStackParserFunc(r *http.Request) (Result, error) {
+	// get incident data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Data struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Name           string     `json:"name"`
+				URL            string     `json:"url"`
+				Cause          string     `json:"cause"`
+				Status         string     `json:"status"`
+				StartedAt      *time.Time `json:"started_at"`
+				AcknowledgedAt *time.Time `json:"acknowledged_at"`
+				AcknowledgedBy *string    `json:"acknowledged_by"`
+				ResolvedAt     *time.Time `json:"resolved_at"`
+				ResolvedBy     *string    `json:"resolved_by"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	incident := payload.Data.Attributes
+	if incident.Name == "" && incident.URL == "" {
+		return Result{}, BadRequestError{Reason: "incident without name and url"}
+	}
+
+	// the incident id identifies the incident across its notifications
+	result := Result{Key: payload.Data.ID}
+	var event string
+	var by *string
+	switch strings.ToLower(incident.Status) {
+	case "started":
+		event = "started"
+		result.Status = StatusFiring
+		result.Severity = SeverityCritical
+		if incident.StartedAt != nil {
+			result.Time = *incident.StartedAt
+		}
+	case "acknowledged":
+		event = "acknowledged"
+		result.Severity = SeverityWarning
+		by = incident.AcknowledgedBy
+		if incident.AcknowledgedAt != nil {
+			result.Time = *incident.AcknowledgedAt
+		}
+	case "resolved":
+		event = "resolved"
+		result.Status = StatusResolved
+		result.Severity = SeverityInfo
+		by = incident.ResolvedBy
+		if incident.ResolvedAt != nil {
+			result.Time = *incident.ResolvedAt
+		}
+	default:
+		return Result{}, BadRequestError{Reason: "unsupported incident status " + incident.Status}
+	}
+
+	// construct incident message
+	message := "Incident " + event
+	if by != nil && *by != "" {
+		message += " by " + *by
+	}
+	message += ": " + incident.Name
+	if incident.URL != "" && incident.URL != incident.Name {
+		message += " (" + incident.URL + ")"
+	}
+	if incident.Cause != "" {
+		message += "\nCause: " + incident.Cause
+	}
+	result.Message = message
+	return result, nil
+}
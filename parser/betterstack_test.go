@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestBetterStackParserFunc(t *testing.T) {
+	testParser(t, BetterStackParserFunc, []parserTest{
+		{
+			name: "started",
+			file: "betterstack-example.json",
+			want: Result{Message: "Incident started: Homepage (https://example.com)\nCause: Status 502", Status: StatusFiring, Severity: SeverityCritical, Key: "123456789"},
+		},
+		{
+			name: "acknowledged",
+			body: `{"data": {"id": "1", "type": "incident", "attributes": {"name": "API", "url": "https://api.example.com", "status": "Acknowledged", "acknowledged_by": "alice@example.com"}}}`,
+			want: Result{Message: "Incident acknowledged by alice@example.com: API (https://api.example.com)", Severity: SeverityWarning, Key: "1"},
+		},
+		{
+			name: "resolved",
+			body: `{"data": {"id": "1", "type": "incident", "attributes": {"name": "https://api.example.com", "url": "https://api.example.com", "status": "Resolved", "resolved_by": null}}}`,
+			want: Result{Message: "Incident resolved: https://api.example.com", Status: StatusResolved, Severity: SeverityInfo, Key: "1"},
+		},
+		{
+			name:       "unsupported status",
+			body:       `{"data": {"id": "1", "attributes": {"name": "API", "status": "Paused"}}}`,
+			badRequest: true,
+		},
+		{
+			name:       "without name and url",
+			body:       `{"data": {"id": "1", "attributes": {"status": "Started"}}}`,
+			badRequest: true,
+		},
+	})
+}
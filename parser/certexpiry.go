@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// days of remaining validity from which on certificate expiry alerts are
+// critical and warnings, more are info and resolve the alert
+type CertExpiryThresholds struct {
+	Critical int `json:"critical"`
+	Warning  int `json:"warning"`
+}
+
+// thresholds of /certexpiry unless XMPP_CERTEXPIRY_THRESHOLDS is set
+var DefaultCertExpiryThresholds = CertExpiryThresholds{Critical: 7, Warning: 30}
+
+// canonical certificate expiry alert, domain and days_remaining or
+// expires_at are required
+type certExpiryAlert struct {
+	Domain        string       `json:"domain"`
+	DaysRemaining *json.Number `json:"days_remaining"`
+	Issuer        string       `json:"issuer"`
+	ExpiresAt     string       `json:"expires_at"` // rfc 3339 or a date
+}
+
+// parses the alerts of certificate monitors (certbot hooks, tls checkers, ...):
+// {"domain": "example.com", "days_remaining": 7, "issuer": "Let's Encrypt R3", "expires_at": "2024-06-01T12:00:00Z"}
+func CertExpiryParserFunc(r *http.Request) (Result, error) {
+	return parseCertExpiry(r, DefaultCertExpiryThresholds, time.Now())
+}
+
+// returns a certificate expiry parser function with the given thresholds
+func NewCertExpiryParserFunc(thresholds CertExpiryThresholds) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		return parseCertExpiry(r, thresholds, time.Now())
+	}
+}
+
+func parseCertExpiry(r *http.Request, thresholds CertExpiryThresholds, now time.Time) (Result, error) {
+	// get alert from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var alert certExpiryAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if alert.Domain == "" || (alert.DaysRemaining == nil && alert.ExpiresAt == "") {
+		return Result{}, BadRequestError{Reason: "domain and days_remaining or expires_at are required"}
+	}
+	var expires time.Time
+	if alert.ExpiresAt != "" {
+		expires, err = time.Parse(time.RFC3339, alert.ExpiresAt)
+		if err != nil {
+			expires, err = time.Parse("2006-01-02", alert.ExpiresAt)
+		}
+		if err != nil {
+			return Result{}, BadRequestError{Reason: "expires_at must be an RFC 3339 timestamp or a date"}
+		}
+	}
+	// the monitor's count is preferred, it knows when it checked
+	var days int
+	if alert.DaysRemaining != nil {
+		d, err := strconv.ParseFloat(alert.DaysRemaining.String(), 64)
+		if err != nil {
+			return Result{}, BadRequestError{Reason: "days_remaining must be a number"}
+		}
+		days = int(math.Floor(d))
+	} else {
+		days = int(math.Floor(expires.Sub(now).Hours() / 24))
+	}
+
+	// TLS cert for example.com expires in 7 days
+	message := "TLS cert for " + alert.Domain
+	switch {
+	case days < 0:
+		message += " expired " + plural(-days, "day") + " ago"
+	case days == 0:
+		message += " expires today"
+	default:
+		message += " expires in " + plural(days, "day")
+	}
+	if alert.Issuer != "" {
+		message += "\nIssuer: " + alert.Issuer
+	}
+	if !expires.IsZero() {
+		message += "\nExpires: " + expires.UTC().Format("2006-01-02 15:04 MST")
+	}
+
+	result := Result{Message: message, Status: StatusFiring, Key: alert.Domain}
+	switch {
+	case days <= thresholds.Critical:
+		result.Severity = SeverityCritical
+	case days <= thresholds.Warning:
+		result.Severity = SeverityWarning
+	default:
+		// renewed, resolves the alert of the domain
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertExpiryParserFunc(t *testing.T) {
+	testParser(t, CertExpiryParserFunc, []parserTest{
+		{
+			name: "critical",
+			file: "certexpiry-example.json",
+			want: Result{Message: "TLS cert for example.com expires in 7 days\nIssuer: Let's Encrypt R3\nExpires: 2024-06-01 12:00 UTC", Status: StatusFiring, Severity: SeverityCritical, Key: "example.com"},
+		},
+		{
+			name: "warning",
+			body: `{"domain": "mail.example.com", "days_remaining": 21.5}`,
+			want: Result{Message: "TLS cert for mail.example.com expires in 21 days", Status: StatusFiring, Severity: SeverityWarning, Key: "mail.example.com"},
+		},
+		{
+			name: "renewed",
+			body: `{"domain": "example.com", "days_remaining": 89, "expires_at": "2024-08-30"}`,
+			want: Result{Message: "TLS cert for example.com expires in 89 days\nExpires: 2024-08-30 00:00 UTC", Status: StatusResolved, Severity: SeverityInfo, Key: "example.com"},
+		},
+		{
+			name: "today",
+			body: `{"domain": "example.com", "days_remaining": 0}`,
+			want: Result{Message: "TLS cert for example.com expires today", Status: StatusFiring, Severity: SeverityCritical, Key: "example.com"},
+		},
+		{
+			name: "expired",
+			body: `{"domain": "example.com", "days_remaining": -1}`,
+			want: Result{Message: "TLS cert for example.com expired 1 day ago", Status: StatusFiring, Severity: SeverityCritical, Key: "example.com"},
+		},
+		{
+			name:       "without expiry",
+			body:       `{"domain": "example.com", "issuer": "R3"}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid expires_at",
+			body:       `{"domain": "example.com", "expires_at": "June 1st"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[1]`,
+			err:  true,
+		},
+	})
+}
+
+func TestCertExpiryThresholds(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	thresholds := CertExpiryThresholds{Critical: 3, Warning: 14}
+	tests := []struct {
+		expires  string
+		message  string
+		severity string
+	}{
+		{"2024-05-11T18:00:00Z", "expires in 10 days", SeverityWarning},
+		{"2024-05-03T12:00:00Z", "expires in 2 days", SeverityCritical},
+		{"2024-06-01T12:00:00Z", "expires in 31 days", SeverityInfo},
+		{"2024-04-28T12:00:00Z", "expired 3 days ago", SeverityCritical},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/certexpiry", strings.NewReader(`{"domain": "example.com", "expires_at": "`+tt.expires+`"}`))
+		result, err := parseCertExpiry(r, thresholds, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(result.Message, "TLS cert for example.com "+tt.message+"\n") || result.Severity != tt.severity {
+			t.Errorf("%s: got %q (%s)", tt.expires, result.Message, result.Severity)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cloudflare alert types that are attacks or outages
+var cloudflareCritical = map[string]bool{
+	"dos_attack_l4":                 true,
+	"dos_attack_l7":                 true,
+	"advanced_ddos_attack_l4_alert": true,
+	"advanced_ddos_attack_l7_alert": true,
+	"fbm_volumetric_attack":         true,
+	"real_origin_monitoring":        true,
+	"bgp_hijack_notification":       true,
+}
+
+// cloudflare alert types that need somebody to look at them
+var cloudflareWarnings = map[string]bool{
+	"clickhouse_alert_fw_anomaly":                     true,
+	"clickhouse_alert_fw_ent_anomaly":                 true,
+	"http_alert_origin_error":                         true,
+	"http_alert_edge_error":                           true,
+	"tunnel_health_event":                             true,
+	"failing_logpush_job_disabled_alert":              true,
+	"expiring_service_token_alert":                    true,
+	"access_custom_certificate_expiration_type":       true,
+	"hostname_aop_custom_certificate_expiration_type": true,
+	"zone_aop_custom_certificate_expiration_type":     true,
+	"secondary_dns_zone_validation_warning":           true,
+}
+
+// parses cloudflare notification webhooks:
+// {"name": <policy>, "text": ..., "data": {...}, "ts": <unix time>, "account_id": ..., "policy_id": ..., "alert_type": ...}
+// health checks and load balancer pools report their state in the data, they
+// fire while unhealthy and resolve once healthy again
+func CloudflareParserFunc(r *http.Request) (Result, error) {
+	// get alert data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Name string `json:"name"`
+		Text string `json:"text"`
+		Data struct {
+			// health checks
+			HealthCheckID string `json:"health_check_id"`
+			Status        string `json:"status"`
+			Reason        string `json:"reason"`
+			// load balancer pools
+			PoolID    string `json:"pool_id"`
+			NewHealth string `json:"new_health"`
+		} `json:"data"`
+		Timestamp int64  `json:"ts"`
+		PolicyID  string `json:"policy_id"`
+		AlertType string `json:"alert_type"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	text := strings.TrimSpace(payload.Text)
+	if text == "" {
+		return Result{}, BadRequestError{Reason: "missing cloudflare notification text"}
+	}
+
+	// construct alert message, the test notification has neither name nor type
+	title := payload.Name
+	if title == "" {
+		title = payload.AlertType
+	}
+	message := "[Cloudflare] " + text
+	if title != "" {
+		message = "[Cloudflare] " + title + "\n" + text
+	}
+	if payload.Data.Reason != "" && !strings.Contains(text, payload.Data.Reason) {
+		message += "\nReason: " + payload.Data.Reason
+	}
+
+	result := Result{Message: message, Severity: SeverityInfo}
+	switch {
+	case cloudflareCritical[payload.AlertType]:
+		result.Severity = SeverityCritical
+	case cloudflareWarnings[payload.AlertType]:
+		result.Severity = SeverityWarning
+	}
+	// the state of health checks and pools
+	health := payload.Data.Status
+	if health == "" {
+		health = payload.Data.NewHealth
+	}
+	switch strings.ToLower(health) {
+	case "unhealthy":
+		result.Status, result.Severity = StatusFiring, SeverityCritical
+	case "healthy":
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	}
+
+	// an alert of a policy, per health check or pool
+	var key []string
+	for _, k := range []string{payload.PolicyID, payload.AlertType, payload.Data.HealthCheckID, payload.Data.PoolID} {
+		if k != "" {
+			key = append(key, k)
+		}
+	}
+	if payload.AlertType != "" {
+		result.Key = strings.Join(key, "/")
+	}
+	if payload.Timestamp > 0 {
+		result.Time = time.Unix(payload.Timestamp, 0)
+	}
+	return result, nil
+}
+
+// returns a cloudflare parser function that rejects requests without the
+// webhook secret in the cf-webhook-auth header
+func NewCloudflareParserFunc(secret string) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Cf-Webhook-Auth")), []byte(secret)) != 1 {
+			return Result{}, ForbiddenError{Reason: "invalid cloudflare webhook secret"}
+		}
+		return CloudflareParserFunc(r)
+	}
+}
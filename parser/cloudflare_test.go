@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCloudflareParserFunc(t *testing.T) {
+	testParser(t, CloudflareParserFunc, []parserTest{
+		{
+			name: "unhealthy health check",
+			file: "cloudflare-example.json",
+			want: Result{Message: "[Cloudflare] Origin health\nHealth check alert for origin eu-west.example.com: Unhealthy\nReason: TCP connection failed", Status: StatusFiring, Severity: SeverityCritical, Key: "0da2b59e-f118-439e-9d8c-bb4bd5ae8d15/health_check_status_notification/699d98642c564d2e855e9661899b7252"},
+		},
+		{
+			name: "healthy pool",
+			body: `{"name": "Pools", "text": "Pool eu is healthy", "data": {"pool_id": "p1", "new_health": "Healthy"}, "policy_id": "x", "alert_type": "load_balancing_health_alert"}`,
+			want: Result{Message: "[Cloudflare] Pools\nPool eu is healthy", Status: StatusResolved, Severity: SeverityInfo, Key: "x/load_balancing_health_alert/p1"},
+		},
+		{
+			name: "attack",
+			body: `{"name": "DDoS", "text": "Cloudflare is mitigating an HTTP DDoS attack on example.com", "policy_id": "y", "alert_type": "dos_attack_l7"}`,
+			want: Result{Message: "[Cloudflare] DDoS\nCloudflare is mitigating an HTTP DDoS attack on example.com", Severity: SeverityCritical, Key: "y/dos_attack_l7"},
+		},
+		{
+			name: "certificate",
+			body: `{"text": "Certificate for www.example.com expires in 7 days", "alert_type": "access_custom_certificate_expiration_type"}`,
+			want: Result{Message: "[Cloudflare] access_custom_certificate_expiration_type\nCertificate for www.example.com expires in 7 days", Severity: SeverityWarning, Key: "access_custom_certificate_expiration_type"},
+		},
+		{
+			name: "test notification",
+			body: `{"text": "Hello World! This is a test message sent from https://cloudflare.com. If you can see this, your webhook is configured properly."}`,
+			want: Result{Message: "[Cloudflare] Hello World! This is a test message sent from https://cloudflare.com. If you can see this, your webhook is configured properly.", Severity: SeverityInfo},
+		},
+		{
+			name:       "without text",
+			body:       `{"alert_type": "dos_attack_l7"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"ts": "now"}`,
+			err:  true,
+		},
+	})
+}
+
+func TestCloudflareSecret(t *testing.T) {
+	f := NewCloudflareParserFunc("s3cret")
+	for secret, ok := range map[string]bool{"s3cret": true, "guess": false, "": false} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"text": "test"}`))
+		r.Header.Set("cf-webhook-auth", secret)
+		_, err := f(r)
+		if ok && err != nil {
+			t.Errorf("%q: %s", secret, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("%q: expected an error", secret)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// limits for the data passed to / read from the external command
+const commandMaxInput int64 = 1 << 20
+const commandMaxOutput int64 = 64 << 10
+
+// exit code the command uses to reject the payload (answered with 400)
+const commandRejectExitCode int = 1
+
+// writer that fails as soon as more than limit bytes are written
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.Len()+len(p)) > b.limit {
+		return 0, errors.New("output limit exceeded")
+	}
+	return b.Buffer.Write(p)
+}
+
+// returns a parser function that pipes the raw request body to an external
+// command, the stdout of the command becomes the message; the command may use
+// up to maxMemory bytes (0 is unlimited) and as much cpu time as the timeout
+func NewCommandParserFunc(command string, timeout time.Duration, maxMemory int64) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		// get alert data from request
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, commandMaxInput+1))
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+		if int64(len(body)) > commandMaxInput {
+			return Result{}, BadRequestError{Reason: "alert body too large"}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		cmd := limitedCommand(command, timeout, maxMemory)
+		// don't leak our environment (credentials!) to the command
+		cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+		cmd.Stdin = bytes.NewReader(body)
+		stdout := &limitedBuffer{limit: commandMaxOutput}
+		stderr := &limitedBuffer{limit: commandMaxOutput}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		err = cmd.Start()
+		if err != nil {
+			log.Printf("command %s failed to start: %s", command, err)
+			return Result{}, errors.New("command failed")
+		}
+		// kill the command (and everything it spawned) when the timeout is reached
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				killProcessGroup(cmd)
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf("command %s timed out after %s", command, timeout)
+			return Result{}, errors.New("command timed out")
+		}
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == commandRejectExitCode {
+				reason := strings.TrimSpace(stderr.String())
+				if reason == "" {
+					reason = "alert body rejected by command"
+				}
+				return Result{}, BadRequestError{Reason: reason}
+			}
+			log.Printf("command %s failed: %s: %s", command, err, strings.TrimSpace(stderr.String()))
+			return Result{}, errors.New("command failed")
+		}
+
+		return Result{Message: strings.TrimRight(stdout.String(), "\n")}, nil
+	}
+}
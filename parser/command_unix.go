@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package parser
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// returns the command, started by sh which applies the cpu time and memory
+// limits (ulimit) and then replaces itself with the command; it runs in its
+// own process group
+func limitedCommand(command string, cpu time.Duration, maxMemory int64) *exec.Cmd {
+	// cpu time is limited in full seconds, at least one
+	seconds := int64((cpu + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	script := fmt.Sprintf("ulimit -t %d", seconds)
+	if maxMemory > 0 {
+		// virtual memory in KiB
+		script += fmt.Sprintf(" && ulimit -v %d", (maxMemory+1023)/1024)
+	}
+	cmd := exec.Command("/bin/sh", "-c", script+` && exec "$0"`, command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// kill the whole process group of the command
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package parser
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writes the shell script to an executable file in dir
+func writeScript(t *testing.T, dir string, name string, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommandParserFunc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmpp-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		script     string
+		maxMemory  int64
+		want       string
+		badRequest bool
+		err        bool
+	}{
+		{name: "message", script: `tr a-z A-Z`, want: "DISK FULL"},
+		{name: "rejected", script: `echo "unknown payload" >&2; exit 1`, badRequest: true},
+		{name: "failed", script: `exit 2`, err: true},
+		{name: "timeout", script: `sleep 5`, err: true},
+		{name: "limits", script: `echo "$(ulimit -t) $(ulimit -v)"`, maxMemory: 64 << 20, want: "1 65536"},
+		{name: "unlimited memory", script: `ulimit -v`, want: "unlimited"},
+		{name: "environment", script: `echo "${XMPP_PASSWORD:-clean}"`, want: "clean"},
+	}
+	os.Setenv("XMPP_PASSWORD", "secret")
+	defer os.Unsetenv("XMPP_PASSWORD")
+	for _, tt := range tests {
+		command := writeScript(t, dir, strings.ReplaceAll(tt.name, " ", "-"), tt.script)
+		f := NewCommandParserFunc(command, time.Second, tt.maxMemory)
+		result, err := f(httptest.NewRequest("POST", "/", strings.NewReader("disk full")))
+		var badRequest BadRequestError
+		switch {
+		case tt.badRequest:
+			if !errors.As(err, &badRequest) || badRequest.Reason != "unknown payload" {
+				t.Errorf("%s: expected a BadRequestError, got %v", tt.name, err)
+			}
+		case tt.err:
+			if err == nil || errors.As(err, &badRequest) {
+				t.Errorf("%s: expected an error, got %v", tt.name, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %s", tt.name, err)
+		case result.Message != tt.want:
+			t.Errorf("%s: got %q, want %q", tt.name, result.Message, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package parser
+
+import (
+	"os/exec"
+	"time"
+)
+
+// returns the command, windows has no rlimits: only the timeout and the
+// input and output sizes are bounded
+func limitedCommand(command string, cpu time.Duration, maxMemory int64) *exec.Cmd {
+	return exec.Command(command)
+}
+
+// kill the command, processes spawned by it are left alone
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -1,4 +1,147 @@
 package parser
 
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// interface for parser functions
+type ParserFunc func(*http.Request) (Result, error)
+
+// normalized alert states
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// normalized severities
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+	SeverityUnknown  = "unknown"
+)
+
+// maps the severities / priorities used by the sources to the normalized ones
+var severities = map[string]string{
+	"critical":  SeverityCritical,
+	"crit":      SeverityCritical,
+	"fatal":     SeverityCritical,
+	"emergency": SeverityCritical,
+	"alert":     SeverityCritical,
+	"error":     SeverityCritical,
+	"high":      SeverityCritical,
+	"page":      SeverityCritical,
+	"p1":        SeverityCritical,
+	"warning":   SeverityWarning,
+	"warn":      SeverityWarning,
+	"medium":    SeverityWarning,
+	"minor":     SeverityWarning,
+	"p2":        SeverityWarning,
+	"p3":        SeverityWarning,
+	"info":      SeverityInfo,
+	"notice":    SeverityInfo,
+	"low":       SeverityInfo,
+	"ok":        SeverityInfo,
+	"none":      SeverityInfo,
+	"debug":     SeverityInfo,
+	"p4":        SeverityInfo,
+	"p5":        SeverityInfo,
+	// grafana alert states
+	"alerting": SeverityCritical,
+	"no_data":  SeverityWarning,
+}
+
+// order of the normalized severities
+var severityRank = map[string]int{
+	SeverityUnknown:  0,
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityCritical: 3,
+}
+
+// returns the normalized severity, SeverityUnknown if it can't be mapped
+func NormalizeSeverity(s string) string {
+	if severity, ok := severities[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return severity
+	}
+	return SeverityUnknown
+}
+
+// structured result of a parser function
+type Result struct {
+	Message string
+	// StatusFiring, StatusResolved or empty if the source has no notion of it
+	Status string
+	// identifies an alert across its firing and resolved notifications
+	Key string
+	// groups the messages of an alert (updates, resolutions) into a conversation thread, defaults to Key
+	Thread string
+	// one of the normalized severities, empty is treated as SeverityUnknown
+	Severity string
+	// when the alert fired (or resolved), zero if the source doesn't tell
+	Time time.Time
+	// labels of the alert, e.g. used for routing
+	Labels map[string]string
+	// comma-separated recipients requested by the payload, only honored if recipient override is enabled
+	Recipients string
+	// the message in other languages, keyed by language tag (e.g. "de")
+	Translations map[string]string
+	// url of an image of the alert (e.g. a rendered panel), optional
+	Image string
+	// when the message is to be sent, zero sends it right away
+	DeliverAt time.Time
+	// if set, every result is sent as a separate message instead of this one
+	Results []Result
+}
+
+// cuts s to at most max characters
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// headers (and query parameters) containing one of these carry credentials,
+// they are never logged or passed to templates
+var sensitiveHeaders = []string{"authorization", "cookie", "signature", "token", "secret", "key", "hmac", "password"}
+
+// checks if the header or query parameter may carry credentials
+func SensitiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, s := range sensitiveHeaders {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// logs debug messages, does nothing unless enabled by the caller
+var Debugf = func(format string, v ...interface{}) {}
+
 const readErr string = "failed to read alert body"
 const parseErr string = "failed to parse alert body"
+
+// returned by parser functions if the request can't be processed because of
+// its content, handlers answer these with 400 instead of 500
+type BadRequestError struct {
+	Reason string
+}
+
+func (e BadRequestError) Error() string {
+	return e.Reason
+}
+
+// returned by parser functions if the request isn't authentic, handlers
+// answer these with 403
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e ForbiddenError) Error() string {
+	return e.Reason
+}
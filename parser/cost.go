@@ -0,0 +1,313 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// percentages of the budget from which on cost alerts are critical and
+// warnings, a forecast over the budget is a warning too
+const (
+	costCriticalPct = 100
+	costWarningPct  = 90
+)
+
+// names of the providers in the messages
+var costProviders = map[string]string{"aws": "AWS", "gcp": "GCP", "azure": "Azure"}
+
+// canonical cost alert, budget and actual or forecast are required
+type costAlert struct {
+	Provider     string   `json:"provider"` // aws, gcp, azure, ...
+	Account      string   `json:"account"`
+	Budget       string   `json:"budget"` // the name of the budget
+	Actual       *float64 `json:"actual"`
+	Forecast     *float64 `json:"forecast"`
+	Limit        *float64 `json:"limit"`         // the budgeted amount
+	ThresholdPct *float64 `json:"threshold_pct"` // the threshold that was crossed, in percent of the limit
+	Currency     string   `json:"currency"`      // usd by default
+	Severity     string   `json:"severity"`
+	// the forecast of gcp is only a percentage
+	forecastPct *float64
+}
+
+// budget notification of gcp, pushed by pub/sub or relayed as is
+type gcpBudgetNotification struct {
+	BudgetDisplayName         string   `json:"budgetDisplayName"`
+	AlertThresholdExceeded    *float64 `json:"alertThresholdExceeded"`
+	ForecastThresholdExceeded *float64 `json:"forecastThresholdExceeded"`
+	CostAmount                *float64 `json:"costAmount"`
+	BudgetAmount              *float64 `json:"budgetAmount"`
+	CurrencyCode              string   `json:"currencyCode"`
+}
+
+// parses budget and billing alerts of cloud providers: the notifications of
+// aws budgets via sns (with or without raw message delivery), the budget
+// notifications of gcp (pushed by pub/sub or relayed as is) and a canonical
+// format:
+// {"provider": "aws", "account": "123456789012", "budget": "prod", "actual": 9500, "limit": 10000, "threshold_pct": 80}
+func CostAlertParserFunc(r *http.Request) (Result, error) {
+	// get alert from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	// raw sns deliveries of aws budgets are plain text, everything else json;
+	// the envelope is told by its exact field, the message of pub/sub would
+	// match it too otherwise
+	message := bytes.TrimSpace(body)
+	var fields map[string]json.RawMessage
+	if bytes.HasPrefix(message, []byte("{")) && json.Unmarshal(message, &fields) == nil && fields["Type"] != nil {
+		var result *Result
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		message, result, err = readSNS(r)
+		if err != nil {
+			return Result{}, err
+		}
+		if result != nil {
+			return *result, nil
+		}
+		message = bytes.TrimSpace(message)
+	}
+
+	var alert costAlert
+	if bytes.HasPrefix(message, []byte("{")) {
+		alert, err = jsonCostAlert(message)
+	} else {
+		alert, err = awsBudgetAlert(string(message))
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return costResult(alert)
+}
+
+// returns the alert of a json body: a budget notification of gcp, pushed by
+// pub/sub or not, or the canonical format
+func jsonCostAlert(body []byte) (costAlert, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return costAlert{}, errors.New(parseErr)
+	}
+	var account string
+	if fields["message"] != nil && fields["subscription"] != nil {
+		var push struct {
+			Message struct {
+				Attributes map[string]string `json:"attributes"`
+				Data       string            `json:"data"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(body, &push); err != nil {
+			return costAlert{}, errors.New(parseErr)
+		}
+		data, err := base64.StdEncoding.DecodeString(push.Message.Data)
+		if err != nil {
+			return costAlert{}, BadRequestError{Reason: "data of the pub/sub message isn't base64"}
+		}
+		body, account = data, push.Message.Attributes["billingAccountId"]
+		fields = nil
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return costAlert{}, errors.New(parseErr)
+		}
+	}
+
+	if fields["budgetDisplayName"] != nil {
+		var n gcpBudgetNotification
+		if err := json.Unmarshal(body, &n); err != nil {
+			return costAlert{}, errors.New(parseErr)
+		}
+		alert := costAlert{Provider: "gcp", Account: account, Budget: n.BudgetDisplayName, Actual: n.CostAmount, Limit: n.BudgetAmount, Currency: n.CurrencyCode}
+		// the thresholds are fractions of the budget
+		if n.AlertThresholdExceeded != nil {
+			pct := *n.AlertThresholdExceeded * 100
+			alert.ThresholdPct = &pct
+		}
+		if n.ForecastThresholdExceeded != nil {
+			pct := *n.ForecastThresholdExceeded * 100
+			alert.forecastPct = &pct
+		}
+		return alert, nil
+	}
+
+	var alert costAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return costAlert{}, errors.New(parseErr)
+	}
+	return alert, nil
+}
+
+// returns the alert of the text notification of aws budgets:
+// AWS Account 123456789012 ... Budget Name: prod, Budgeted Amount: $10,000.00,
+// Alert Type: ACTUAL, Alert Threshold: > $8,000.00, ACTUAL Amount: $9,500.00
+func awsBudgetAlert(text string) (costAlert, error) {
+	alert := costAlert{Provider: "aws"}
+	var threshold *float64
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "AWS Account ") {
+			alert.Account = strings.TrimSpace(strings.TrimPrefix(line, "AWS Account "))
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch name {
+		case "Budget Name":
+			alert.Budget = value
+		case "Budgeted Amount":
+			alert.Limit = awsBudgetAmount(value, &alert)
+		case "Alert Threshold":
+			threshold = awsBudgetAmount(value, &alert)
+		case "ACTUAL Amount":
+			alert.Actual = awsBudgetAmount(value, &alert)
+		case "FORECASTED Amount":
+			alert.Forecast = awsBudgetAmount(value, &alert)
+		}
+	}
+	if alert.Budget == "" {
+		return costAlert{}, BadRequestError{Reason: "unsupported cost alert, expected an aws budgets notification or json"}
+	}
+	if threshold != nil && alert.Limit != nil && *alert.Limit > 0 {
+		pct := *threshold / *alert.Limit * 100
+		alert.ThresholdPct = &pct
+	}
+	return alert, nil
+}
+
+// parses an amount of aws budgets like $9,500.00 or > $8,000.00, nil if
+// there is none
+func awsBudgetAmount(s string, alert *costAlert) *float64 {
+	if strings.Contains(s, "$") {
+		alert.Currency = "USD"
+	}
+	s = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r == '.' {
+			return r
+		}
+		return -1
+	}, s)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// formats the alert: AWS budget 'prod' at 95% ($9,500/$10,000)
+func costResult(alert costAlert) (Result, error) {
+	budget := strings.TrimSpace(alert.Budget)
+	if budget == "" || (alert.Actual == nil && alert.Forecast == nil && alert.forecastPct == nil) {
+		return Result{}, BadRequestError{Reason: "budget and actual or forecast are required"}
+	}
+	for _, v := range []*float64{alert.Actual, alert.Forecast, alert.Limit, alert.ThresholdPct} {
+		if v != nil && *v < 0 {
+			return Result{}, BadRequestError{Reason: "amounts must not be negative"}
+		}
+	}
+	hasLimit := alert.Limit != nil && *alert.Limit > 0
+	percent := func(v float64) float64 { return v / *alert.Limit * 100 }
+
+	message := "budget '" + budget + "'"
+	provider := strings.ToLower(alert.Provider)
+	if name, ok := costProviders[provider]; ok {
+		message = name + " " + message
+	} else if alert.Provider != "" {
+		message = alert.Provider + " " + message
+	}
+	// how much of the budget is spent, drives the severity
+	pct := -1.0
+	var forecastPct float64
+	switch {
+	case alert.Actual != nil && hasLimit:
+		pct = percent(*alert.Actual)
+		message += " at " + formatPct(pct) + " (" + formatCost(*alert.Actual, alert.Currency) + "/" + formatCost(*alert.Limit, alert.Currency) + ")"
+	case alert.Actual != nil && alert.ThresholdPct != nil:
+		pct = *alert.ThresholdPct
+		message += " over " + formatPct(pct) + " (" + formatCost(*alert.Actual, alert.Currency) + ")"
+	case alert.Actual != nil:
+		message += " at " + formatCost(*alert.Actual, alert.Currency)
+	}
+	forecast := ""
+	switch {
+	case alert.Forecast != nil && hasLimit:
+		forecastPct = percent(*alert.Forecast)
+		forecast = formatPct(forecastPct) + " (" + formatCost(*alert.Forecast, alert.Currency) + ")"
+		if alert.Actual == nil {
+			forecast += " of " + formatCost(*alert.Limit, alert.Currency)
+		}
+	case alert.Forecast != nil:
+		forecast = formatCost(*alert.Forecast, alert.Currency)
+	case alert.forecastPct != nil:
+		forecastPct = *alert.forecastPct
+		forecast = "over " + formatPct(forecastPct)
+	}
+	if forecast != "" {
+		if alert.Actual != nil {
+			message += ", forecast " + forecast
+		} else {
+			message += " forecast at " + forecast
+		}
+	}
+	if alert.ThresholdPct != nil && pct != *alert.ThresholdPct {
+		message += "\nThreshold: " + formatPct(*alert.ThresholdPct)
+	}
+	if alert.Account != "" {
+		message += "\nAccount: " + alert.Account
+	}
+
+	result := Result{Message: message, Severity: SeverityInfo, Labels: map[string]string{"budget": budget}}
+	key := []string{budget}
+	if alert.Account != "" {
+		key = append([]string{alert.Account}, key...)
+		result.Labels["account"] = alert.Account
+	}
+	if provider != "" {
+		key = append([]string{provider}, key...)
+		result.Labels["provider"] = provider
+	}
+	result.Key = strings.Join(key, "/")
+	switch {
+	case pct >= costCriticalPct:
+		result.Severity = SeverityCritical
+	case pct >= costWarningPct || forecastPct >= costCriticalPct:
+		result.Severity = SeverityWarning
+	}
+	if s := NormalizeSeverity(alert.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// formats the percentage without decimals, e.g. 95%
+func formatPct(pct float64) string {
+	return strconv.Itoa(int(math.Round(pct))) + "%"
+}
+
+// formats the amount with thousands separators and the currency (usd by
+// default), whole units from 100 on: $9,500 or $12.34
+func formatCost(v float64, currency string) string {
+	if currency == "" {
+		currency = "USD"
+	}
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	if v >= 100 {
+		s = strconv.FormatFloat(math.Round(v), 'f', 0, 64)
+	}
+	whole, cents := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, cents = s[:i], s[i:]
+	}
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return formatAmount(whole+cents, currency)
+}
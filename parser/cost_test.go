@@ -0,0 +1,77 @@
+package parser
+
+import "testing"
+
+func TestCostAlertParserFunc(t *testing.T) {
+	testParser(t, CostAlertParserFunc, []parserTest{
+		{
+			name: "canonical",
+			file: "cost-example.json",
+			want: Result{Message: "AWS budget 'prod' at 95% ($9,500/$10,000), forecast 112% ($11,200)\nThreshold: 80%\nAccount: 123456789012", Severity: SeverityWarning, Key: "aws/123456789012/prod"},
+		},
+		{
+			name:        "aws budgets via sns",
+			file:        "cost-aws-budgets-example.json",
+			contentType: "text/plain",
+			want:        Result{Message: "AWS budget 'prod' at 95% ($9,500/$10,000)\nThreshold: 80%\nAccount: 123456789012", Severity: SeverityWarning, Key: "aws/123456789012/prod"},
+		},
+		{
+			name:        "aws budgets raw forecast",
+			body:        "AWS Budget Notification May 14, 2024\nAWS Account 123456789012\n\nBudget Name: dev\nBudgeted Amount: $1,000.00\nAlert Type: FORECASTED\nAlert Threshold: > $1,000.00\nFORECASTED Amount: $1,180.00\n",
+			contentType: "text/plain",
+			want:        Result{Message: "AWS budget 'dev' forecast at 118% ($1,180) of $1,000\nThreshold: 100%\nAccount: 123456789012", Severity: SeverityWarning, Key: "aws/123456789012/dev"},
+		},
+		{
+			name: "gcp via pub/sub",
+			file: "cost-gcp-example.json",
+			want: Result{Message: "GCP budget 'analytics' at 105% (€5,230/€5,000)\nThreshold: 100%\nAccount: 01D4EE-079462-DFD6EC", Severity: SeverityCritical, Key: "gcp/01D4EE-079462-DFD6EC/analytics"},
+		},
+		{
+			name: "gcp relayed with forecast",
+			body: `{"budgetDisplayName": "ml", "forecastThresholdExceeded": 1.0, "costAmount": 420.5, "budgetAmount": 1000, "currencyCode": "USD"}`,
+			want: Result{Message: "GCP budget 'ml' at 42% ($421/$1,000), forecast over 100%", Severity: SeverityWarning, Key: "gcp/ml"},
+		},
+		{
+			name: "over the threshold without limit",
+			body: `{"provider": "Hetzner", "budget": "staging", "actual": 1234.5, "threshold_pct": 50, "currency": "CHF"}`,
+			want: Result{Message: "Hetzner budget 'staging' over 50% (1,235 CHF)", Severity: SeverityInfo, Key: "hetzner/staging"},
+		},
+		{
+			name: "small amount",
+			body: `{"budget": "sandbox", "actual": 12.5, "severity": "warning"}`,
+			want: Result{Message: "budget 'sandbox' at $12.50", Severity: SeverityWarning, Key: "sandbox"},
+		},
+		{
+			name:        "sns subscription confirmation",
+			file:        "sns-subscription-example.json",
+			contentType: "text/plain",
+			want:        Result{Message: "SNS subscription to arn:aws:sns:us-west-2:123456789012:ses-notifications needs to be confirmed: https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription&TopicArn=arn:aws:sns:us-west-2:123456789012:ses-notifications&Token=2336412f37"},
+		},
+		{
+			name:       "without budget",
+			body:       `{"actual": 9500, "limit": 10000}`,
+			badRequest: true,
+		},
+		{
+			name:       "without amounts",
+			body:       `{"budget": "prod", "limit": 10000}`,
+			badRequest: true,
+		},
+		{
+			name:       "negative amount",
+			body:       `{"budget": "prod", "actual": -1}`,
+			badRequest: true,
+		},
+		{
+			name:        "unsupported text",
+			body:        "the budget is almost used up",
+			contentType: "text/plain",
+			badRequest:  true,
+		},
+		{
+			name: "invalid json",
+			body: `{"budget": 1}`,
+			err:  true,
+		},
+	})
+}
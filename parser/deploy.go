@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// outcome of a deployment, its severity and status
+type deployOutcome struct {
+	verb     string
+	severity string
+	status   string
+}
+
+var (
+	deploySucceeded  = deployOutcome{"succeeded", SeverityInfo, StatusResolved}
+	deployFailed     = deployOutcome{"failed", SeverityCritical, StatusFiring}
+	deployStarted    = deployOutcome{"started", SeverityInfo, ""}
+	deployCancelled  = deployOutcome{"was cancelled", SeverityWarning, ""}
+	deployRolledBack = deployOutcome{"was rolled back", SeverityWarning, ""}
+)
+
+// statuses of the deploy events, as named by the various ci systems
+var deployStatuses = map[string]deployOutcome{
+	"succeeded": deploySucceeded, "success": deploySucceeded, "successful": deploySucceeded, "deployed": deploySucceeded,
+	"completed": deploySucceeded, "finished": deploySucceeded, "done": deploySucceeded, "ok": deploySucceeded,
+	"failed": deployFailed, "failure": deployFailed, "error": deployFailed, "errored": deployFailed,
+	"started": deployStarted, "running": deployStarted, "in_progress": deployStarted, "pending": deployStarted, "queued": deployStarted,
+	"cancelled": deployCancelled, "canceled": deployCancelled, "aborted": deployCancelled,
+	"rolled_back": deployRolledBack, "rollback": deployRolledBack,
+}
+
+// canonical deploy event, only app and status are required
+type deployEvent struct {
+	App         string `json:"app"`
+	Environment string `json:"environment"`
+	Version     string `json:"version"`
+	Status      string `json:"status"`
+	TriggeredBy string `json:"triggered_by"`
+	URL         string `json:"url"`
+	Message     string `json:"message"`
+}
+
+// parses deploy events of ci/cd pipelines:
+// {"app": "web", "environment": "prod", "version": "v1.4.2", "status": "succeeded", "triggered_by": "alice", "url": "https://ci.example.com/deploys/1234"}
+func DeployParserFunc(r *http.Request) (Result, error) {
+	// get event from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var event deployEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if event.App == "" || event.Status == "" {
+		return Result{}, BadRequestError{Reason: "app and status are required"}
+	}
+	outcome, ok := deployStatuses[strings.ToLower(strings.ReplaceAll(event.Status, "-", "_"))]
+	if !ok {
+		return Result{}, BadRequestError{Reason: "unknown status " + event.Status}
+	}
+
+	// deploy web→prod v1.4.2 succeeded by alice
+	line, key := "deploy "+event.App, event.App
+	if event.Environment != "" {
+		line += "→" + event.Environment
+		key += "/" + event.Environment
+	}
+	if event.Version != "" {
+		line += " " + event.Version
+	}
+	line += " " + outcome.verb
+	if event.TriggeredBy != "" {
+		line += " by " + event.TriggeredBy
+	}
+	lines := []string{line}
+	if event.Message != "" {
+		lines = append(lines, event.Message)
+	}
+	if event.URL != "" {
+		lines = append(lines, event.URL)
+	}
+	return Result{Message: strings.Join(lines, "\n"), Status: outcome.status, Severity: outcome.severity, Key: key}, nil
+}
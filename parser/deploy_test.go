@@ -0,0 +1,43 @@
+package parser
+
+import "testing"
+
+func TestDeployParserFunc(t *testing.T) {
+	testParser(t, DeployParserFunc, []parserTest{
+		{
+			name: "succeeded",
+			file: "deploy-example.json",
+			want: Result{Message: "deploy web→prod v1.4.2 succeeded by alice\nhttps://ci.example.com/deploys/1234", Status: StatusResolved, Severity: SeverityInfo, Key: "web/prod"},
+		},
+		{
+			name: "failed",
+			body: `{"app": "api", "environment": "staging", "version": "3f1a2b3", "status": "Failure", "message": "migration 42 failed"}`,
+			want: Result{Message: "deploy api→staging 3f1a2b3 failed\nmigration 42 failed", Status: StatusFiring, Severity: SeverityCritical, Key: "api/staging"},
+		},
+		{
+			name: "started",
+			body: `{"app": "api", "status": "in-progress", "triggered_by": "ci"}`,
+			want: Result{Message: "deploy api started by ci", Severity: SeverityInfo, Key: "api"},
+		},
+		{
+			name: "rolled back",
+			body: `{"app": "web", "environment": "prod", "version": "v1.4.1", "status": "rolled_back"}`,
+			want: Result{Message: "deploy web→prod v1.4.1 was rolled back", Severity: SeverityWarning, Key: "web/prod"},
+		},
+		{
+			name:       "unknown status",
+			body:       `{"app": "web", "status": "paused"}`,
+			badRequest: true,
+		},
+		{
+			name:       "without app",
+			body:       `{"status": "succeeded"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"app": 1}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// max. size of multipart requests kept in memory, attached files are dropped anyway
+const discordMaxMemory = 1 << 20
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Color       int    `json:"color"`
+	Author      struct {
+		Name string `json:"name"`
+	} `json:"author"`
+	Fields []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"fields"`
+	Footer struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+}
+
+// parses the messages of tools that post to a discord webhook:
+// {"content": ..., "embeds": [{"title": ..., "description": ..., "url": ..., "color": 15158332}]},
+// as json body or as payload_json field of a multipart request (with attached files)
+func DiscordParserFunc(r *http.Request) (Result, error) {
+	var body []byte
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t == "multipart/form-data" {
+		if err := r.ParseMultipartForm(discordMaxMemory); err != nil {
+			return Result{}, errors.New(readErr)
+		}
+		body = []byte(r.FormValue("payload_json"))
+	} else {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+	}
+
+	payload := &struct {
+		Content string         `json:"content"`
+		Embeds  []discordEmbed `json:"embeds"`
+	}{}
+
+	// parse body into the payload struct
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	// construct message: the content, followed by a block per embed;
+	// discord uses markdown, converted to message styling
+	var blocks []string
+	if content := strings.TrimSpace(payload.Content); content != "" {
+		blocks = append(blocks, markdownToStyling(content))
+	}
+	result := Result{}
+	for _, e := range payload.Embeds {
+		var lines []string
+		if e.Author.Name != "" {
+			lines = append(lines, e.Author.Name)
+		}
+		if e.Title != "" {
+			lines = append(lines, "*"+markdownInline(e.Title)+"*")
+		}
+		if e.URL != "" {
+			lines = append(lines, e.URL)
+		}
+		if d := strings.TrimSpace(e.Description); d != "" {
+			lines = append(lines, markdownToStyling(d))
+		}
+		for _, f := range e.Fields {
+			lines = append(lines, markdownInline(f.Name)+": "+markdownInline(f.Value))
+		}
+		if e.Footer.Text != "" {
+			lines = append(lines, e.Footer.Text)
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+		// the first colored embed decides the severity
+		if result.Severity == "" {
+			result.Severity = discordSeverity(e.Color)
+		}
+	}
+	if len(blocks) == 0 {
+		return Result{}, BadRequestError{Reason: "message without content and embeds"}
+	}
+	result.Message = strings.Join(blocks, "\n\n")
+	return result, nil
+}
+
+// maps an embed color to a severity by its hue: red is critical, orange and
+// yellow are warnings, green is info, others (and grey) are unknown
+func discordSeverity(color int) string {
+	r, g, b := color>>16&0xff, color>>8&0xff, color&0xff
+	max, min := r, r
+	for _, c := range []int{g, b} {
+		if c > max {
+			max = c
+		}
+		if c < min {
+			min = c
+		}
+	}
+	// no color, or too little saturation to tell
+	if color == 0 || max-min < max/4 {
+		return ""
+	}
+	var hue int
+	switch max {
+	case r:
+		hue = (60*(g-b)/(max-min) + 360) % 360
+	case g:
+		hue = 60*(b-r)/(max-min) + 120
+	default:
+		hue = 60*(r-g)/(max-min) + 240
+	}
+	switch {
+	case hue < 20 || hue >= 330:
+		return SeverityCritical
+	case hue < 70:
+		return SeverityWarning
+	case hue < 170:
+		return SeverityInfo
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package parser
+
+import "testing"
+
+func TestDiscordParserFunc(t *testing.T) {
+	testParser(t, DiscordParserFunc, []parserTest{
+		{
+			name: "content and embed",
+			file: "discord-example.json",
+			want: Result{
+				Message:  "*Monitor down*: see the status page (https://status.example.org)\n\n*web01 is down*\nhttps://kuma.example.org/dashboard/3\nConnection refused on `https://web01.example.org`\nService: web01\nSince: 2024-05-14 08:21:04\nUptime Kuma",
+				Severity: SeverityCritical,
+			},
+		},
+		{
+			name: "content only",
+			body: `{"content": "backup finished"}`,
+			want: Result{Message: "backup finished"},
+		},
+		{
+			name: "embeds only",
+			body: `{"embeds": [{"title": "Deploy", "description": "v1.2 is live", "color": 3066993}, {"description": "next one", "color": 15158332}]}`,
+			want: Result{Message: "*Deploy*\nv1.2 is live\n\nnext one", Severity: SeverityInfo},
+		},
+		{
+			name: "warning color",
+			body: `{"embeds": [{"title": "Disk at 85%", "color": 15105570}]}`,
+			want: Result{Message: "*Disk at 85%*", Severity: SeverityWarning},
+		},
+		{
+			name: "blue color",
+			body: `{"embeds": [{"title": "News", "color": 3447003}]}`,
+			want: Result{Message: "*News*"},
+		},
+		{
+			name:        "multipart with attachment",
+			contentType: "multipart/form-data; boundary=b",
+			body:        "--b\r\nContent-Disposition: form-data; name=\"payload_json\"\r\n\r\n{\"content\": \"report attached\"}\r\n--b\r\nContent-Disposition: form-data; name=\"files[0]\"; filename=\"report.txt\"\r\n\r\nreport\r\n--b--\r\n",
+			want:        Result{Message: "report attached"},
+		},
+		{
+			name:       "empty",
+			body:       `{"embeds": [{}]}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{`,
+			err:  true,
+		},
+	})
+}
+
+func TestDiscordSeverity(t *testing.T) {
+	tests := map[int]string{
+		0:        "",
+		0xff0000: SeverityCritical,
+		0xed4245: SeverityCritical,
+		0xfee75c: SeverityWarning,
+		0x57f287: SeverityInfo,
+		0x5865f2: "",
+		0x99aab5: "",
+	}
+	for color, want := range tests {
+		if got := discordSeverity(color); got != want {
+			t.Errorf("%06x: got %q, want %q", color, got, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// shops sending order webhooks
+const (
+	shopShopify     = "shopify"
+	shopWooCommerce = "woocommerce"
+)
+
+// max. number of line items listed in a message
+const ecommerceMaxItems = 5
+
+// symbols of the common currencies, others are shown by their code after the amount
+var currencySymbols = map[string]string{
+	"USD": "$", "CAD": "CA$", "AUD": "A$", "EUR": "€", "GBP": "£", "JPY": "¥", "INR": "₹",
+}
+
+// order statuses that need a look: failed payments, cancellations and refunds
+var ecommerceWarnings = map[string]bool{
+	"failed": true, "cancelled": true, "refunded": true, "partially_refunded": true, "voided": true,
+}
+
+type ecommerceCustomer struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// order of shopify or woocommerce, both send the whole order object
+type ecommerceOrder struct {
+	ID       json.Number `json:"id"`
+	Currency string      `json:"currency"`
+	Email    string      `json:"email"`
+	Items    []struct {
+		Name     string `json:"name"`
+		Quantity int    `json:"quantity"`
+	} `json:"line_items"`
+	// shopify
+	Name            string             `json:"name"` // e.g. #1042
+	OrderNumber     json.Number        `json:"order_number"`
+	TotalPrice      string             `json:"total_price"`
+	FinancialStatus string             `json:"financial_status"`
+	CancelledAt     string             `json:"cancelled_at"`
+	Customer        *ecommerceCustomer `json:"customer"`
+	// woocommerce
+	Number  string             `json:"number"`
+	Total   string             `json:"total"`
+	Status  string             `json:"status"`
+	Billing *ecommerceCustomer `json:"billing"`
+}
+
+// parses the order webhooks of shopify and woocommerce (order created, paid,
+// updated or cancelled), the shop is told by the headers or the payload:
+// {"id": 820982911946154500, "name": "#1042", "total_price": "89.00", "currency": "USD", "financial_status": "paid", "customer": {...}, ...}
+func EcommerceParserFunc(r *http.Request) (Result, error) {
+	// get order from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// woocommerce pings the delivery url with a form when the webhook is saved
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+		id, err := strconv.Atoi(r.PostForm.Get("webhook_id"))
+		if err != nil {
+			return Result{}, BadRequestError{Reason: "form without webhook_id"}
+		}
+		return Result{Message: fmt.Sprintf("[WooCommerce] webhook %d is set up", id), Severity: SeverityInfo}, nil
+	}
+
+	var order ecommerceOrder
+	if err := json.Unmarshal(body, &order); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	shop := ecommerceShop(r, body)
+	if shop == "" {
+		return Result{}, BadRequestError{Reason: "neither a shopify nor a woocommerce order"}
+	}
+
+	// New order #1042 — $89.00 from Jane (paid)
+	var number, total, status, topic string
+	customer := order.Customer
+	switch shop {
+	case shopShopify:
+		number, total, status = order.Name, order.TotalPrice, order.FinancialStatus
+		if number == "" {
+			number = "#" + order.OrderNumber.String()
+		}
+		if order.CancelledAt != "" {
+			status = "cancelled"
+		}
+		topic = r.Header.Get("X-Shopify-Topic")
+	case shopWooCommerce:
+		number, total, status, customer = "#"+order.Number, order.Total, order.Status, order.Billing
+		if order.Number == "" {
+			number = "#" + order.ID.String()
+		}
+		topic = r.Header.Get("X-WC-Webhook-Topic")
+	}
+	heading := "Order"
+	switch topic {
+	case "", "orders/create", "order.created":
+		heading = "New order"
+	}
+	message := heading + " " + number + " — " + formatAmount(total, order.Currency)
+	if name := customerName(customer, order.Email); name != "" {
+		message += " from " + name
+	}
+	if status != "" {
+		message += " (" + strings.ReplaceAll(status, "_", " ") + ")"
+	}
+	for i, item := range order.Items {
+		if i == ecommerceMaxItems {
+			message += fmt.Sprintf("\n... and %d more", len(order.Items)-i)
+			break
+		}
+		message += fmt.Sprintf("\n%d× %s", item.Quantity, item.Name)
+	}
+
+	result := Result{Message: message, Severity: SeverityInfo, Key: shop + "/" + strings.TrimPrefix(number, "#")}
+	if ecommerceWarnings[status] {
+		result.Severity = SeverityWarning
+	}
+	return result, nil
+}
+
+// returns the shop that sent the order, by its headers or else the fields
+// only one of them has; empty if unknown
+func ecommerceShop(r *http.Request, body []byte) string {
+	switch {
+	case r.Header.Get("X-Shopify-Topic") != "" || r.Header.Get("X-Shopify-Hmac-Sha256") != "":
+		return shopShopify
+	case r.Header.Get("X-WC-Webhook-Topic") != "" || r.Header.Get("X-WC-Webhook-Signature") != "":
+		return shopWooCommerce
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	switch {
+	case fields["total_price"] != nil || fields["financial_status"] != nil:
+		return shopShopify
+	case fields["total"] != nil && (fields["billing"] != nil || fields["number"] != nil):
+		return shopWooCommerce
+	}
+	return ""
+}
+
+// returns the amount with the symbol of the currency, e.g. $89.00 or 89.00 CHF
+func formatAmount(amount string, currency string) string {
+	if amount == "" {
+		amount = "0.00"
+	}
+	if symbol, ok := currencySymbols[strings.ToUpper(currency)]; ok {
+		return symbol + amount
+	}
+	return strings.TrimSpace(amount + " " + currency)
+}
+
+// returns the first name of the customer, the email if there is none
+func customerName(c *ecommerceCustomer, email string) string {
+	if c != nil && c.FirstName != "" {
+		return c.FirstName
+	}
+	if c != nil && c.Email != "" {
+		return c.Email
+	}
+	return email
+}
+
+// returns an order parser function that verifies the signatures of the shops
+// with a secret (empty if not configured): the base64 hmac-sha256 of the body
+// in X-Shopify-Hmac-Sha256 or X-WC-Webhook-Signature; requests of a shop
+// without a secret are rejected, so an unsigned request can't pose as one
+func NewEcommerceParserFunc(shopifySecret string, wooCommerceSecret string) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		// the ping of woocommerce carries nothing but the id of the webhook
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			return EcommerceParserFunc(r)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+		var secret, signature string
+		switch ecommerceShop(r, body) {
+		case shopShopify:
+			secret, signature = shopifySecret, r.Header.Get("X-Shopify-Hmac-Sha256")
+		case shopWooCommerce:
+			secret, signature = wooCommerceSecret, r.Header.Get("X-WC-Webhook-Signature")
+		}
+		if secret == "" || !ecommerceSignatureValid(secret, signature, body) {
+			return Result{}, ForbiddenError{Reason: "invalid order webhook signature"}
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return EcommerceParserFunc(r)
+	}
+}
+
+// checks the base64 hmac-sha256 of the body
+func ecommerceSignatureValid(secret string, signature string, body []byte) bool {
+	s, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hmac.Equal(s, mac.Sum(nil))
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEcommerceParserFunc(t *testing.T) {
+	testParser(t, EcommerceParserFunc, []parserTest{
+		{
+			name: "shopify",
+			file: "ecommerce-shopify-example.json",
+			want: Result{Message: "New order #1042 — $89.00 from Jane (paid)\n2× Organic Cotton T-Shirt - M\n1× Canvas Tote Bag", Severity: SeverityInfo, Key: "shopify/1042"},
+		},
+		{
+			name: "woocommerce",
+			file: "ecommerce-woocommerce-example.json",
+			want: Result{Message: "New order #727 — €42.50 from Max (processing)\n1× Espresso Beans 1kg", Severity: SeverityInfo, Key: "woocommerce/727"},
+		},
+		{
+			name: "shopify cancelled",
+			body: `{"order_number": 1043, "total_price": "12.00", "currency": "CHF", "financial_status": "refunded", "cancelled_at": "2024-05-14T11:00:00-04:00", "email": "bob@example.com", "customer": null}`,
+			want: Result{Message: "New order #1043 — 12.00 CHF from bob@example.com (cancelled)", Severity: SeverityWarning, Key: "shopify/1043"},
+		},
+		{
+			name: "woocommerce failed",
+			body: `{"id": 728, "total": "9.99", "currency": "USD", "status": "failed", "billing": {"email": "eve@example.com"}}`,
+			want: Result{Message: "New order #728 — $9.99 from eve@example.com (failed)", Severity: SeverityWarning, Key: "woocommerce/728"},
+		},
+		{
+			name: "many items",
+			body: `{"name": "#7", "total_price": "7.00", "currency": "USD", "line_items": [{"name": "a", "quantity": 1}, {"name": "b", "quantity": 1}, {"name": "c", "quantity": 1}, {"name": "d", "quantity": 1}, {"name": "e", "quantity": 1}, {"name": "f", "quantity": 1}, {"name": "g", "quantity": 1}]}`,
+			want: Result{Message: "New order #7 — $7.00\n1× a\n1× b\n1× c\n1× d\n1× e\n... and 2 more", Severity: SeverityInfo, Key: "shopify/7"},
+		},
+		{
+			name:        "woocommerce ping",
+			body:        "webhook_id=5",
+			contentType: "application/x-www-form-urlencoded",
+			want:        Result{Message: "[WooCommerce] webhook 5 is set up", Severity: SeverityInfo},
+		},
+		{
+			name:       "unknown shop",
+			body:       `{"id": 1, "amount": "5.00"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"total_price": 89}`,
+			err:  true,
+		},
+	})
+}
+
+func TestEcommerceTopic(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(`{"id": 727, "number": "727", "total": "42.50", "currency": "EUR", "status": "completed"}`)))
+	r.Header.Set("X-WC-Webhook-Topic", "order.updated")
+	result, err := EcommerceParserFunc(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "Order #727 — €42.50 (completed)" {
+		t.Errorf("got %q", result.Message)
+	}
+}
+
+func TestNewEcommerceParserFunc(t *testing.T) {
+	f := NewEcommerceParserFunc("shop-secret", "")
+	body := []byte(`{"name": "#1042", "total_price": "89.00", "currency": "USD", "financial_status": "paid"}`)
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		valid   bool
+	}{
+		{name: "valid", headers: map[string]string{"X-Shopify-Hmac-Sha256": sign("shop-secret")}, valid: true},
+		{name: "wrong secret", headers: map[string]string{"X-Shopify-Hmac-Sha256": sign("other")}},
+		{name: "missing", headers: map[string]string{"X-Shopify-Topic": "orders/create"}},
+		{name: "unsigned", headers: map[string]string{}},
+		// woocommerce has no secret, its requests can't be verified
+		{name: "woocommerce", headers: map[string]string{"X-WC-Webhook-Signature": sign("shop-secret")}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		result, err := f(r)
+		var forbidden ForbiddenError
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.valid && result.Message != "New order #1042 — $89.00 (paid)":
+			t.Errorf("%s: got %q", tt.name, result.Message)
+		case !tt.valid && !errors.As(err, &forbidden):
+			t.Errorf("%s: expected a ForbiddenError, got %v", tt.name, err)
+		}
+	}
+}
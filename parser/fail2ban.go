@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// parses the payload posted by the fail2ban action:
+// {"action": "ban", "ip": "<ip>", "jail": "<name>", "failures": <failures>}
+func Fail2banParserFunc(r *http.Request) (Result, error) {
+	// get event data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Action   string `json:"action"`
+		IP       string `json:"ip"`
+		Jail     string `json:"jail"`
+		Failures int    `json:"failures"`
+		Host     string `json:"host"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.IP == "" {
+		return Result{}, BadRequestError{Reason: "event without ip"}
+	}
+
+	var result Result
+	var message string
+	switch strings.ToLower(payload.Action) {
+	case "ban":
+		result.Severity = SeverityWarning
+		message = "banned " + payload.IP
+	case "unban":
+		result.Severity = SeverityInfo
+		message = "unbanned " + payload.IP
+	default:
+		return Result{}, BadRequestError{Reason: "action must be ban or unban"}
+	}
+
+	// construct event message
+	if payload.Jail != "" {
+		message += " in " + payload.Jail
+	}
+	if payload.Host != "" {
+		message += " on " + payload.Host
+	}
+	if payload.Failures > 0 && result.Severity == SeverityWarning {
+		message += fmt.Sprintf(" (%d failures)", payload.Failures)
+	}
+	result.Message = "[fail2ban] " + message
+	return result, nil
+}
@@ -0,0 +1,28 @@
+package parser
+
+import "testing"
+
+func TestFail2banParserFunc(t *testing.T) {
+	testParser(t, Fail2banParserFunc, []parserTest{
+		{
+			name: "ban",
+			file: "fail2ban-example.json",
+			want: Result{Message: "[fail2ban] banned 203.0.113.42 in sshd (5 failures)", Severity: SeverityWarning},
+		},
+		{
+			name: "unban",
+			body: `{"action": "unban", "ip": "203.0.113.42", "jail": "sshd", "failures": 5, "host": "web01"}`,
+			want: Result{Message: "[fail2ban] unbanned 203.0.113.42 in sshd on web01", Severity: SeverityInfo},
+		},
+		{
+			name:       "unknown action",
+			body:       `{"action": "start", "ip": "203.0.113.42"}`,
+			badRequest: true,
+		},
+		{
+			name:       "without ip",
+			body:       `{"action": "ban", "jail": "sshd"}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// max. length of the item summary included in the notification
+const feedMaxSummary = 300
+
+func FeedItemParserFunc(r *http.Request) (Result, error) {
+	// get feed item from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	item := &struct {
+		Title     string `json:"title"`
+		Link      string `json:"link"`
+		Summary   string `json:"summary"`
+		Published string `json:"published"`
+	}{}
+
+	// parse body into the item struct
+	err = json.Unmarshal(body, &item)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	title := strings.Join(strings.Fields(HTMLToText(item.Title, false)), " ")
+	if title == "" && item.Link == "" {
+		return Result{}, BadRequestError{Reason: "feed item without title and link"}
+	}
+
+	// construct message: New item: title — link
+	message := "New item: "
+	switch {
+	case title == "":
+		message += item.Link
+	case item.Link == "":
+		message += title
+	default:
+		message += title + " — " + item.Link
+	}
+	if item.Published != "" {
+		message += "\nPublished: " + item.Published
+	}
+	if summary := HTMLToText(item.Summary, true); summary != "" {
+		message += "\n" + truncate(summary, feedMaxSummary)
+	}
+
+	return Result{Message: message}, nil
+}
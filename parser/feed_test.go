@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFeedItemParserFunc(t *testing.T) {
+	testParser(t, FeedItemParserFunc, []parserTest{
+		{
+			name: "item",
+			file: "feed-example.json",
+			want: Result{Message: "New item: Go 1.21 is released! — https://go.dev/blog/go1.21\nPublished: 2023-08-08T00:00:00Z\nToday the Go team is thrilled to release Go 1.21, which you can get by visiting the download page (https://go.dev/dl/).\nGo 1.21 comes with many new features & improvements."},
+		},
+		{
+			name: "html summary",
+			body: `{"title": "Release <b>1.0</b>", "link": "https://example.org/1.0", "summary": "<p>First&nbsp;stable<br/>release</p><ul><li>fast</li></ul>"}`,
+			want: Result{Message: "New item: Release 1.0 — https://example.org/1.0\nFirst stable\nrelease\n• fast"},
+		},
+		{
+			name: "long summary",
+			body: `{"title": "Long", "summary": "` + strings.Repeat("x", 400) + `"}`,
+			want: Result{Message: "New item: Long\n" + strings.Repeat("x", feedMaxSummary-1) + "…"},
+		},
+		{
+			name: "link only",
+			body: `{"link": "https://example.org/post"}`,
+			want: Result{Message: "New item: https://example.org/post"},
+		},
+		{
+			name:       "without title and link",
+			body:       `{"summary": "nothing to link to"}`,
+			badRequest: true,
+		},
+	})
+}
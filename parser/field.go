@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// returns the value at the dotted path in the JSON body, e.g.
+// "alerts.0.labels.severity" (array elements are addressed by index)
+func FieldValue(body []byte, path string) (string, bool) {
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return "", false
+	}
+	return scalarValue(fieldNode(v, path))
+}
+
+// returns the scalar or the elements of the array of scalars at the dotted
+// path in the JSON body, e.g. a list of recipients
+func FieldValues(body []byte, path string) ([]string, bool) {
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return nil, false
+	}
+	return scalarValues(fieldNode(v, path))
+}
+
+// walks the dotted path down the decoded JSON value, nil if it doesn't exist
+func fieldNode(v interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// formats a decoded JSON scalar, false for null, objects and arrays
+func scalarValue(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return "", false
+	case string:
+		return value, true
+	default:
+		return fmt.Sprint(value), true
+	}
+}
+
+// formats a decoded JSON scalar or the elements of an array of scalars
+func scalarValues(v interface{}) ([]string, bool) {
+	elements, ok := v.([]interface{})
+	if !ok {
+		value, ok := scalarValue(v)
+		if !ok {
+			return nil, false
+		}
+		return []string{value}, true
+	}
+	var values []string
+	for _, e := range elements {
+		value, ok := scalarValue(e)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, len(values) > 0
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// human readable names of the oncall event types
+var onCallEvents = map[string]string{
+	"firing":        "Firing",
+	"escalation":    "Escalated",
+	"acknowledge":   "Acknowledged",
+	"unacknowledge": "Unacknowledged",
+	"resolve":       "Resolved",
+	"unresolve":     "Unresolved",
+	"silence":       "Silenced",
+	"unsilence":     "Unsilenced",
+}
+
+func GrafanaOnCallParserFunc(r *http.Request) (Result, error) {
+	// get alert data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Event struct {
+			Type string    `json:"type"`
+			Time time.Time `json:"time"`
+		} `json:"event"`
+		User *struct {
+			Username string `json:"username"`
+		} `json:"user"`
+		AlertGroup struct {
+			ID         string            `json:"id"`
+			Title      string            `json:"title"`
+			State      string            `json:"state"`
+			Permalinks map[string]string `json:"permalinks"`
+		} `json:"alert_group"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	// construct alert message
+	event, ok := onCallEvents[payload.Event.Type]
+	if !ok {
+		event = payload.Event.Type
+	}
+	message := event
+	if payload.User != nil && payload.User.Username != "" {
+		message += " by " + payload.User.Username
+	}
+	message += ": " + payload.AlertGroup.Title + "\n"
+	message += "State: " + payload.AlertGroup.State
+	if link := payload.AlertGroup.Permalinks["web"]; link != "" {
+		message += "\n" + link
+	}
+
+	// all events of an alert group share a thread, the group is the alert
+	result := Result{Message: message, Time: payload.Event.Time, Thread: payload.AlertGroup.ID, Key: payload.AlertGroup.ID}
+	switch payload.Event.Type {
+	case "firing", "unresolve":
+		result.Status = StatusFiring
+	case "resolve":
+		result.Status = StatusResolved
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package parser
+
+import "testing"
+
+func TestGrafanaOnCallParserFunc(t *testing.T) {
+	testParser(t, GrafanaOnCallParserFunc, []parserTest{
+		{
+			name: "acknowledge",
+			file: "grafana-oncall-example.json",
+			want: Result{Message: "Acknowledged by alice: [firing:3] HighCPUUsage (web01)\nState: acknowledged\nhttps://oncall.example.com/a/grafana-oncall-app/alert-groups/IRFN6ZD31N31B", Key: "IRFN6ZD31N31B"},
+		},
+		{
+			name: "firing",
+			body: `{"event": {"type": "firing"}, "alert_group": {"id": "G1", "title": "HighCPUUsage", "state": "firing"}}`,
+			want: Result{Message: "Firing: HighCPUUsage\nState: firing", Status: StatusFiring, Key: "G1"},
+		},
+		{
+			name: "escalation",
+			body: `{"event": {"type": "escalation"}, "user": null, "alert_group": {"id": "G1", "title": "HighCPUUsage", "state": "firing"}}`,
+			want: Result{Message: "Escalated: HighCPUUsage\nState: firing", Key: "G1"},
+		},
+		{
+			name: "resolve",
+			body: `{"event": {"type": "resolve"}, "user": {"username": "bob"}, "alert_group": {"id": "G1", "title": "HighCPUUsage", "state": "resolved", "permalinks": {"web": "https://oncall.example.com/g/G1"}}}`,
+			want: Result{Message: "Resolved by bob: HighCPUUsage\nState: resolved\nhttps://oncall.example.com/g/G1", Status: StatusResolved, Key: "G1"},
+		},
+		{
+			name: "unresolve",
+			body: `{"event": {"type": "unresolve"}, "alert_group": {"id": "G1", "title": "HighCPUUsage", "state": "firing"}}`,
+			want: Result{Message: "Unresolved: HighCPUUsage\nState: firing", Status: StatusFiring, Key: "G1"},
+		},
+		{
+			name: "unknown event",
+			body: `{"event": {"type": "custom"}, "alert_group": {"id": "G1", "title": "HighCPUUsage", "state": "silenced"}}`,
+			want: Result{Message: "custom: HighCPUUsage\nState: silenced", Key: "G1"},
+		},
+	})
+}
@@ -5,38 +5,132 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-func GrafanaParserFunc(r *http.Request) (string, error) {
+// labels naming the datasource of unified alerts, the first one set is used;
+// grafana doesn't add them by itself, the alert rules have to
+var grafanaDatasourceLabels = []string{"datasource", "datasource_type", "datasource_uid"}
+
+// label with the folder of the alert rule, added by grafana
+const grafanaFolderLabel = "grafana_folder"
+
+// parses the webhooks of legacy and unified (grafana 8 and newer) alerting
+func GrafanaParserFunc(r *http.Request) (Result, error) {
 	// get alert data from request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return "", errors.New(readErr)
+		return Result{}, errors.New(readErr)
 	}
 
 	alert := &struct {
+		RuleID  int    `json:"ruleId"`
 		Title   string `json:"title"`
 		RuleURL string `json:"ruleUrl"`
 		State   string `json:"state"`
 		Message string `json:"message"`
+		// rendered panel, if grafana is set up to take screenshots
+		ImageURL string `json:"imageUrl"`
+		// unified alerting, alertmanager-like
+		AlertmanagerPayload
 	}{}
 
 	// parse body into the alert struct
 	err = json.Unmarshal(body, &alert)
 	if err != nil {
-		return "", errors.New(parseErr)
+		return Result{}, errors.New(parseErr)
+	}
+	if len(alert.Alerts) > 0 {
+		return grafanaUnified(&alert.AlertmanagerPayload), nil
 	}
 
 	// construct alert message
 	var message string
 	switch alert.State {
 	case "ok":
-		message = ":) " + alert.Title
+		message = alert.Title
 	default:
-		message = ":( " + alert.Title + "\n\n"
-		message += alert.Message + "\n\n"
+		message = alert.Title + "\n\n"
+		message += HTMLToText(alert.Message, true) + "\n\n"
 		message += alert.RuleURL
 	}
 
-	return message, nil
+	result := Result{Message: message, Image: alert.ImageURL}
+	switch alert.State {
+	case "ok":
+		result.Status = StatusResolved
+		result.Severity = SeverityInfo
+	case "alerting":
+		result.Status = StatusFiring
+		result.Severity = SeverityCritical
+	case "no_data":
+		result.Status = StatusFiring
+		result.Severity = SeverityWarning
+	}
+	if alert.RuleID != 0 {
+		result.Key = strconv.Itoa(alert.RuleID)
+	}
+	return result, nil
+}
+
+// summarizes every alert of the unified alerting payload with its datasource and folder
+func grafanaUnified(payload *AlertmanagerPayload) Result {
+	var blocks []string
+	for _, alert := range payload.Alerts {
+		// the status of the group is told by the prefix, only resolved alerts of a firing group are marked
+		block := alert.Labels["alertname"]
+		if alert.Status == "resolved" && payload.Status != "resolved" {
+			block = "Resolved: " + block
+		}
+		var context []string
+		for _, l := range grafanaDatasourceLabels {
+			if ds := alert.Labels[l]; ds != "" {
+				context = append(context, "datasource "+ds)
+				break
+			}
+		}
+		if folder := alert.Labels[grafanaFolderLabel]; folder != "" {
+			context = append(context, "folder "+folder)
+		}
+		if len(context) > 0 {
+			block += " (" + strings.Join(context, ", ") + ")"
+		}
+		if summary := alert.Annotations["summary"]; summary != "" {
+			block += "\n" + HTMLToText(summary, true)
+		} else if description := alert.Annotations["description"]; description != "" {
+			block += "\n" + HTMLToText(description, true)
+		}
+		if alert.GeneratorURL != "" {
+			block += "\n" + alert.GeneratorURL
+		}
+		blocks = append(blocks, block)
+	}
+
+	result := Result{
+		Message:  strings.Join(blocks, "\n\n"),
+		Status:   StatusFiring,
+		Key:      payload.GroupKey,
+		Severity: alertmanagerSeverity(payload),
+		Time:     alertmanagerTime(payload),
+		Labels:   payload.CommonLabels,
+	}
+	if payload.Status == "resolved" {
+		result.Status = StatusResolved
+	}
+	// the first screenshot stands for the group
+	for _, alert := range payload.Alerts {
+		if alert.ImageURL != "" {
+			result.Image = alert.ImageURL
+			break
+		}
+	}
+	// like legacy alerts, if the rules don't label a severity
+	if result.Severity == SeverityUnknown {
+		result.Severity = SeverityCritical
+		if result.Status == StatusResolved {
+			result.Severity = SeverityInfo
+		}
+	}
+	return result
 }
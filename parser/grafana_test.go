@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrafanaParserFunc(t *testing.T) {
+	testParser(t, GrafanaParserFunc, []parserTest{
+		{
+			name: "legacy alerting",
+			file: "grafana-webhook-alert-example.json",
+			want: Result{Message: "My alert\n\nLoad is peaking. Make sure the traffic is real and spin up more webfronts\n\nhttp://url.to.grafana/db/dashboard/my_dashboard?panelId=2", Status: StatusFiring, Severity: SeverityCritical, Key: "1"},
+		},
+		{
+			name: "legacy ok",
+			body: `{"title": "My alert", "ruleId": 1, "state": "ok"}`,
+			want: Result{Message: "My alert", Status: StatusResolved, Severity: SeverityInfo, Key: "1"},
+		},
+		{
+			name: "unified with datasources",
+			file: "grafana-unified-alert-example.json",
+			want: Result{
+				Message:  "HighErrorRate (datasource loki, folder Production)\ncheckout logs 42 errors per minute\nhttps://grafana.example.com/alerting/grafana/a1b2c3/view\n\nSlowTraces (datasource tempo, folder Production)\np99 latency of checkout is 3.2s\nhttps://grafana.example.com/alerting/grafana/d4e5f6/view",
+				Status:   StatusFiring,
+				Severity: SeverityCritical,
+				Key:      `{}/{}:{grafana_folder="Production", service="checkout"}`,
+			},
+		},
+		{
+			name: "unified resolved with datasource uid, without severity",
+			body: `{"status": "resolved", "groupKey": "g", "version": "1", "alerts": [{"status": "resolved", "labels": {"alertname": "DiskFull", "datasource_uid": "P1809F7CD0C75ACF3"}}]}`,
+			want: Result{Message: "DiskFull (datasource P1809F7CD0C75ACF3)", Status: StatusResolved, Severity: SeverityInfo, Key: "g"},
+		},
+		{
+			name: "unified partly resolved",
+			body: `{"status": "firing", "groupKey": "g", "version": "1", "alerts": [{"status": "firing", "labels": {"alertname": "A", "severity": "warning"}}, {"status": "resolved", "labels": {"alertname": "B"}}]}`,
+			want: Result{Message: "A\n\nResolved: B", Status: StatusFiring, Severity: SeverityWarning, Key: "g"},
+		},
+		{
+			name: "malformed",
+			body: `{"alerts": "x"}`,
+			err:  true,
+		},
+	})
+}
+
+func TestGrafanaParserFuncImage(t *testing.T) {
+	tests := map[string]string{
+		"grafana-webhook-alert-example.json": "http://s3.image.url",
+		"grafana-unified-alert-example.json": "https://grafana.example.com/public/img/attachments/pV3d9kGtZK2wXq.png",
+	}
+	for file, want := range tests {
+		body, err := ioutil.ReadFile(filepath.Join("..", "dev", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := GrafanaParserFunc(httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Image != want {
+			t.Errorf("%s: got image %q, want %q", file, result.Image, want)
+		}
+	}
+}
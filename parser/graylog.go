@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// max. number of backlog messages included as samples, and their max. length
+const (
+	graylogMaxSamples = 3
+	graylogMaxSample  = 200
+)
+
+// parses the http notifications of graylog event definitions (graylog 3 and newer):
+// {"event_definition_id": ..., "event_definition_title": ..., "event": {"message": ..., "priority": 2, ...}, "backlog": [...]}
+func GraylogParserFunc(r *http.Request) (Result, error) {
+	// get event data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		DefinitionID    string `json:"event_definition_id"`
+		DefinitionTitle string `json:"event_definition_title"`
+		Event           struct {
+			Message   string     `json:"message"`
+			Source    string     `json:"source"`
+			Key       string     `json:"key"`
+			Priority  int        `json:"priority"`
+			Timestamp *time.Time `json:"timestamp"`
+		} `json:"event"`
+		Backlog []struct {
+			Message string `json:"message"`
+			Source  string `json:"source"`
+		} `json:"backlog"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.DefinitionTitle == "" && payload.Event.Message == "" {
+		return Result{}, BadRequestError{Reason: "event without title and message"}
+	}
+
+	// events are stateless, the definition (and the key of aggregated events) groups them
+	result := Result{Key: payload.DefinitionID}
+	if payload.Event.Key != "" {
+		result.Key += "/" + payload.Event.Key
+	}
+	if payload.Event.Timestamp != nil {
+		result.Time = *payload.Event.Timestamp
+	}
+
+	// graylog priorities: 1 low, 2 normal, 3 high (4 critical in newer versions)
+	switch {
+	case payload.Event.Priority >= 3:
+		result.Severity = SeverityCritical
+	case payload.Event.Priority == 2:
+		result.Severity = SeverityWarning
+	case payload.Event.Priority == 1:
+		result.Severity = SeverityInfo
+	}
+
+	// construct event message
+	message := "[Graylog] " + payload.DefinitionTitle
+	if m := payload.Event.Message; m != "" && m != payload.DefinitionTitle {
+		if payload.DefinitionTitle != "" {
+			message += ": "
+		}
+		message += m
+	}
+	if payload.Event.Source != "" {
+		message += " (" + payload.Event.Source + ")"
+	}
+	if n := len(payload.Backlog); n > 0 {
+		message += fmt.Sprintf("\n%d backlog message(s)", n)
+		for i, b := range payload.Backlog {
+			if i == graylogMaxSamples {
+				message += fmt.Sprintf("\n… %d more", n-graylogMaxSamples)
+				break
+			}
+			sample := strings.TrimSpace(b.Message)
+			if b.Source != "" {
+				sample = b.Source + ": " + sample
+			}
+			message += "\n- " + truncate(sample, graylogMaxSample)
+		}
+	}
+	result.Message = message
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraylogParserFunc(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	testParser(t, GraylogParserFunc, []parserTest{
+		{
+			name: "aggregation event",
+			file: "graylog-example.json",
+			want: Result{
+				Message:  "[Graylog] SSH brute force: SSH brute force: count()=14.0 (graylog01)\n2 backlog message(s)\n- web01: Failed password for invalid user admin from 203.0.113.42 port 51234 ssh2\n- web01: Failed password for root from 203.0.113.42 port 51240 ssh2",
+				Severity: SeverityCritical,
+				Key:      "5d8a1bb2c8311d0b0c8f6f43/web01",
+			},
+		},
+		{
+			name: "normal priority without backlog",
+			body: `{"event_definition_id": "1", "event_definition_title": "Disk full", "event": {"message": "Disk full", "priority": 2}, "backlog": []}`,
+			want: Result{Message: "[Graylog] Disk full", Severity: SeverityWarning, Key: "1"},
+		},
+		{
+			name: "low priority, long and many samples",
+			body: `{"event_definition_id": "1", "event_definition_title": "Errors", "event": {"priority": 1}, "backlog": [{"message": "` + long + `"}, {"message": "b"}, {"message": "c"}, {"message": "d"}, {"message": "e"}]}`,
+			want: Result{Message: "[Graylog] Errors\n5 backlog message(s)\n- " + strings.Repeat("x", 199) + "…\n- b\n- c\n… 2 more", Severity: SeverityInfo, Key: "1"},
+		},
+		{
+			name:       "without title and message",
+			body:       `{"event_definition_id": "1", "event": {"priority": 2}}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// parses the notifications of the rest notify platform of home assistant:
+// {"message": ..., "title": ..., "target": ..., "data": {...}} with POST_JSON,
+// or the same parameters in the query (GET) or form (POST); the data is listed
+// below the message, data.tag identifies the notification and data.severity
+// (or data.priority) sets the severity
+func HomeAssistantParserFunc(r *http.Request) (Result, error) {
+	payload := &struct {
+		Message string                 `json:"message"`
+		Title   string                 `json:"title"`
+		Target  interface{}            `json:"target"`
+		Data    map[string]interface{} `json:"data"`
+	}{}
+
+	// the rest platform sends parameters unless the method is POST_JSON
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method == http.MethodGet || contentType == "application/x-www-form-urlencoded" {
+		err := r.ParseForm()
+		if err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+		payload.Message, payload.Title = r.Form.Get("message"), r.Form.Get("title")
+		if t := r.Form["target"]; len(t) > 0 {
+			payload.Target = strings.Join(t, ",")
+		}
+	} else {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(payload); err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+	}
+	message := strings.TrimSpace(payload.Message)
+	if message == "" {
+		return Result{}, BadRequestError{Reason: "missing message"}
+	}
+
+	// construct notification message:
+	// [Home Assistant] Washing machine
+	// The laundry is done.
+	// room: basement
+	result := Result{Message: "[Home Assistant] " + message}
+	if title := strings.TrimSpace(payload.Title); title != "" {
+		result.Message = "[Home Assistant] " + title + "\n" + message
+	}
+	var names []string
+	for name := range payload.Data {
+		switch name {
+		case "tag", "severity", "priority":
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.Message += "\n" + name + ": " + automationValue(payload.Data[name])
+	}
+
+	if tag, ok := payload.Data["tag"].(string); ok {
+		result.Key = tag
+	}
+	for _, name := range []string{"severity", "priority"} {
+		if s, ok := payload.Data[name].(string); ok && NormalizeSeverity(s) != SeverityUnknown {
+			result.Severity = NormalizeSeverity(s)
+			break
+		}
+	}
+	switch target := payload.Target.(type) {
+	case string:
+		result.Recipients = target
+	case []interface{}:
+		var list []string
+		for _, t := range target {
+			if s, ok := t.(string); ok {
+				list = append(list, s)
+			}
+		}
+		result.Recipients = strings.Join(list, ",")
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHomeAssistantParserFunc(t *testing.T) {
+	testParser(t, HomeAssistantParserFunc, []parserTest{
+		{
+			name: "notification with data",
+			file: "homeassistant-example.json",
+			want: Result{
+				Message:  "[Home Assistant] Water leak\nWater detected under the washing machine.\nroom: basement\nsensor: binary_sensor.washing_machine_leak",
+				Severity: SeverityCritical,
+				Key:      "leak-basement",
+			},
+		},
+		{
+			name: "message only",
+			body: `{"message": "The laundry is done."}`,
+			want: Result{Message: "[Home Assistant] The laundry is done."},
+		},
+		{
+			name: "nested data",
+			body: `{"message": "Low battery", "data": {"sensors": ["door", "window"], "level": 7, "severity": "warning"}}`,
+			want: Result{Message: "[Home Assistant] Low battery\nlevel: 7\nsensors: [\"door\",\"window\"]", Severity: SeverityWarning},
+		},
+		{
+			name:   "query",
+			method: "GET",
+			target: "/?title=Door&message=Front%20door%20opened",
+			want:   Result{Message: "[Home Assistant] Door\nFront door opened"},
+		},
+		{
+			name:        "form",
+			body:        "message=Garage+open",
+			contentType: "application/x-www-form-urlencoded",
+			want:        Result{Message: "[Home Assistant] Garage open"},
+		},
+		{name: "without message", body: `{"title": "Door"}`, badRequest: true},
+		{name: "invalid json", body: `{"message"`, err: true},
+	})
+}
+
+func TestHomeAssistantParserFuncTarget(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"message": "x", "target": "alice@example.com"}`:                      "alice@example.com",
+		`{"message": "x", "target": ["alice@example.com", "bob@example.com"]}`: "alice@example.com,bob@example.com",
+	} {
+		result, err := HomeAssistantParserFunc(httptest.NewRequest("POST", "/homeassistant", strings.NewReader(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Recipients != want {
+			t.Errorf("%s: got %q, want %q", body, result.Recipients, want)
+		}
+	}
+}
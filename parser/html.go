@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// elements that start a new line
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "ul": true, "ol": true, "li": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"tr": true, "table": true, "blockquote": true, "pre": true, "hr": true,
+}
+
+// returns the text of an html snippet: tags are stripped, entities decoded
+// and whitespace collapsed, block elements start a new line and list items get
+// a bullet; links become "text (url)" if links is set and the url is absolute
+func HTMLToText(s string, links bool) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	var b strings.Builder
+	var href string
+	var linkStart int
+	skip := 0 // inside script or style
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return collapseWhitespace(b.String())
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			switch {
+			case tag == "script" || tag == "style":
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case tag == "li" && tt != html.EndTagToken:
+				b.WriteString("\n• ")
+			case htmlBlocks[tag]:
+				b.WriteString("\n")
+			case tag == "td" || tag == "th":
+				b.WriteString(" ")
+			case tag == "a" && tt == html.StartTagToken:
+				href = ""
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = z.TagAttr()
+					if string(key) == "href" {
+						href = string(value)
+					}
+				}
+				linkStart = b.Len()
+			case tag == "a" && tt == html.EndTagToken:
+				text := strings.TrimSpace(b.String()[linkStart:])
+				if u, err := url.Parse(href); links && err == nil && u.IsAbs() && text != href {
+					if text == "" {
+						b.WriteString(href)
+					} else {
+						b.WriteString(" (" + href + ")")
+					}
+				}
+				href = ""
+			}
+		}
+	}
+}
+
+// collapses the whitespace of every line and drops the empty ones
+func collapseWhitespace(s string) string {
+	var lines []string
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name  string
+		html  string
+		links bool
+		want  string
+	}{
+		{name: "plain text", html: "disk full", want: "disk full"},
+		{name: "entities and whitespace", html: "a&nbsp;&amp;  b\t\tc &lt;x&gt;", want: "a & b c <x>"},
+		{name: "inline tags", html: "<b>Go</b> <em>1.21</em>", want: "Go 1.21"},
+		{name: "paragraphs and breaks", html: "<p>first</p><p>second<br>third</p>", want: "first\nsecond\nthird"},
+		{name: "lists", html: "changes:<ul><li>fast</li><li>safe</li></ul>done", want: "changes:\n• fast\n• safe\ndone"},
+		{name: "table cells", html: "<table><tr><td>a</td><td>b</td></tr></table>", want: "a b"},
+		{name: "script and style", html: "<style>p {}</style>text<script>alert(1)</script>", want: "text"},
+		{name: "links dropped", html: `see <a href="https://example.org/dl">download</a>`, want: "see download"},
+		{name: "links kept", html: `see <a href="https://example.org/dl">download</a>.`, links: true, want: "see download (https://example.org/dl)."},
+		{name: "link showing its url", html: `<a href="https://example.org">https://example.org</a>`, links: true, want: "https://example.org"},
+		{name: "link without text", html: `<a href="https://example.org"><img src="x.png"></a>`, links: true, want: "https://example.org"},
+		{name: "relative link", html: `<a href="/dl">download</a>`, links: true, want: "download"},
+		{name: "unclosed tags", html: "<p>broken <b>markup", want: "broken markup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html, tt.links); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// max. length of the error and number of lines and length of the stack trace
+// shown, the rest is cut off
+const (
+	jobMaxError      = 300
+	jobMaxTraceLines = 10
+	jobMaxTrace      = 1000
+)
+
+// canonical failure of a background job, job and error are required
+type jobFailure struct {
+	Queue       string          `json:"queue"`
+	Job         string          `json:"job"` // the task, worker or job class
+	ID          json.RawMessage `json:"id"`  // a string or a number
+	Error       string          `json:"error"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Stacktrace  json.RawMessage `json:"stacktrace"` // a string or a list of lines
+	Severity    string          `json:"severity"`
+}
+
+// parses the failures of the jobs of task runners and queues (Celery,
+// Sidekiq, BullMQ, ...), e.g. posted by their error hooks:
+// {"queue": "mailers", "job": "SendEmail", "id": "abc123", "error": "SMTP timeout", "attempts": 3}
+func JobFailureParserFunc(r *http.Request) (Result, error) {
+	// get failure from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var job jobFailure
+	if err := json.Unmarshal(body, &job); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if job.Job == "" || job.Error == "" {
+		return Result{}, BadRequestError{Reason: "job and error are required"}
+	}
+	if job.Attempts < 0 || job.MaxAttempts < 0 {
+		return Result{}, BadRequestError{Reason: "attempts and max_attempts must not be negative"}
+	}
+	trace, err := jobStacktrace(job.Stacktrace)
+	if err != nil {
+		return Result{}, err
+	}
+	id := strings.Trim(string(job.ID), `"`)
+	if id == "null" {
+		id = ""
+	}
+
+	// job SendEmail #abc123 failed after 3 attempts: SMTP timeout
+	message := "job " + job.Job
+	if id != "" {
+		message += " #" + id
+	}
+	// failures with attempts left are retried, the others are final
+	retrying := job.Attempts > 0 && job.Attempts < job.MaxAttempts
+	switch {
+	case retrying:
+		message += " failed on attempt " + strconv.Itoa(job.Attempts) + " of " + strconv.Itoa(job.MaxAttempts) + ", retrying"
+	case job.Attempts > 0:
+		message += " failed after " + plural(job.Attempts, "attempt")
+	default:
+		message += " failed"
+	}
+	message += ": " + truncate(strings.TrimSpace(job.Error), jobMaxError)
+	if job.Queue != "" {
+		message += "\nQueue: " + job.Queue
+	}
+	if trace != "" {
+		message += "\n```\n" + trace + "\n```"
+	}
+
+	result := Result{Message: message, Severity: SeverityCritical, Labels: map[string]string{"job": job.Job}}
+	if retrying {
+		result.Severity = SeverityWarning
+	}
+	if job.Queue != "" {
+		result.Labels["queue"] = job.Queue
+	}
+	if s := NormalizeSeverity(job.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// returns the first lines of the stack trace, given as a string or a list of
+// lines (e.g. the backtrace of Sidekiq)
+func jobStacktrace(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var lines []string
+	var trace string
+	if json.Unmarshal(raw, &trace) == nil {
+		lines = strings.Split(strings.Trim(trace, "\r\n"), "\n")
+	} else if json.Unmarshal(raw, &lines) != nil {
+		return "", BadRequestError{Reason: "stacktrace must be a string or a list of strings"}
+	}
+	if len(lines) > jobMaxTraceLines {
+		lines = append(lines[:jobMaxTraceLines], "…")
+	}
+	return truncate(strings.Join(lines, "\n"), jobMaxTrace), nil
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJobFailureParserFunc(t *testing.T) {
+	longTrace, _ := json.Marshal(strings.Repeat("  File \"tasks.py\", line 1, in run\n", 12))
+	testParser(t, JobFailureParserFunc, []parserTest{
+		{
+			name: "sidekiq",
+			file: "jobs-example.json",
+			want: Result{Message: "job SendEmail #abc123 failed after 3 attempts: SMTP timeout\nQueue: mailers\n```\napp/jobs/send_email.rb:12:in `perform'\nlib/mailer.rb:40:in `deliver'\n```", Severity: SeverityCritical},
+		},
+		{
+			name: "retrying",
+			body: `{"queue": "default", "job": "tasks.resize_image", "id": 42, "error": "OSError: disk full", "attempts": 1, "max_attempts": 5}`,
+			want: Result{Message: "job tasks.resize_image #42 failed on attempt 1 of 5, retrying: OSError: disk full\nQueue: default", Severity: SeverityWarning},
+		},
+		{
+			name: "celery traceback",
+			body: `{"job": "tasks.sync", "error": "KeyError: 'id'", "attempts": 1, "stacktrace": ` + string(longTrace) + `}`,
+			want: Result{Message: "job tasks.sync failed after 1 attempt: KeyError: 'id'\n```\n" + strings.Repeat("  File \"tasks.py\", line 1, in run\n", 10) + "…\n```", Severity: SeverityCritical},
+		},
+		{
+			name: "long error",
+			body: `{"job": "Import", "error": "` + strings.Repeat("x", 400) + `", "severity": "warning"}`,
+			want: Result{Message: "job Import failed: " + strings.Repeat("x", 299) + "…", Severity: SeverityWarning},
+		},
+		{
+			name:       "without error",
+			body:       `{"job": "SendEmail", "attempts": 3}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid stacktrace",
+			body:       `{"job": "SendEmail", "error": "SMTP timeout", "stacktrace": {"line": 1}}`,
+			badRequest: true,
+		},
+		{
+			name:       "negative attempts",
+			body:       `{"job": "SendEmail", "error": "SMTP timeout", "attempts": -1}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"job": "SendEmail", "attempts": "3"}`,
+			err:  true,
+		},
+	})
+}
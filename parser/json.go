@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// dotted paths of the fields a generic JSON payload is mapped from
+type FieldMapping struct {
+	MessagePath    string `json:"message_path"`
+	RecipientsPath string `json:"recipients_path"` // optional
+	SeverityPath   string `json:"severity_path"`   // optional
+}
+
+// parses a comma-separated mapping, e.g.
+// message_path=alert.text,recipients_path=notify,severity_path=alert.level
+func ParseFieldMapping(s string) (FieldMapping, error) {
+	mapping := FieldMapping{MessagePath: "message"}
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		i := strings.Index(m, "=")
+		if i < 1 || i == len(m)-1 {
+			return FieldMapping{}, errors.New("field mapping " + m + " must be given as key=path")
+		}
+		switch path := strings.TrimSpace(m[i+1:]); strings.TrimSpace(m[:i]) {
+		case "message_path":
+			mapping.MessagePath = path
+		case "recipients_path":
+			mapping.RecipientsPath = path
+		case "severity_path":
+			mapping.SeverityPath = path
+		default:
+			return FieldMapping{}, fmt.Errorf("unknown field mapping key %q", m[:i])
+		}
+	}
+	return mapping, nil
+}
+
+// returns a parser function that plucks the message (and optionally the
+// recipients and severity) out of any JSON body by their dotted paths
+func NewJSONParserFunc(mapping FieldMapping) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		// get alert data from request
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+
+		var payload interface{}
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+
+		// the message is required, objects and arrays aren't messages
+		message, ok := scalarValue(fieldNode(payload, mapping.MessagePath))
+		if !ok || strings.TrimSpace(message) == "" {
+			return Result{}, BadRequestError{Reason: "no message at " + mapping.MessagePath}
+		}
+		result := Result{Message: strings.TrimSpace(message)}
+		if mapping.SeverityPath != "" {
+			if severity, ok := scalarValue(fieldNode(payload, mapping.SeverityPath)); ok {
+				result.Severity = NormalizeSeverity(severity)
+			}
+		}
+		if mapping.RecipientsPath != "" {
+			// a list or a comma-separated string
+			if recipients, ok := scalarValues(fieldNode(payload, mapping.RecipientsPath)); ok {
+				result.Recipients = strings.Join(recipients, ",")
+			}
+		}
+
+		return result, nil
+	}
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewJSONParserFunc(t *testing.T) {
+	testParser(t, NewJSONParserFunc(FieldMapping{MessagePath: "message"}), []parserTest{
+		{
+			name: "default mapping",
+			body: `{"message": "  disk full  ", "severity": "critical"}`,
+			want: Result{Message: "disk full"},
+		},
+		{
+			name:       "missing message",
+			body:       `{"text": "disk full"}`,
+			badRequest: true,
+		},
+		{
+			name:       "blank message",
+			body:       `{"message": " "}`,
+			badRequest: true,
+		},
+		{
+			name:       "object isn't a message",
+			body:       `{"message": {"text": "disk full"}}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"message": `,
+			err:  true,
+		},
+	})
+
+	mapping, err := ParseFieldMapping("message_path=alert.text, severity_path=alert.labels.level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testParser(t, NewJSONParserFunc(mapping), []parserTest{
+		{
+			name: "nested paths",
+			body: `{"alert": {"text": "disk full", "labels": {"level": "P1"}}}`,
+			want: Result{Message: "disk full", Severity: SeverityCritical},
+		},
+		{
+			name: "warning",
+			body: `{"alert": {"text": "disk at 91%", "labels": {"level": "warn"}}}`,
+			want: Result{Message: "disk at 91%", Severity: SeverityWarning},
+		},
+		{
+			name: "unknown severity",
+			body: `{"alert": {"text": "disk full", "labels": {"level": "loud"}}}`,
+			want: Result{Message: "disk full", Severity: SeverityUnknown},
+		},
+		{
+			name: "missing severity",
+			body: `{"alert": {"text": "disk full"}}`,
+			want: Result{Message: "disk full"},
+		},
+		{
+			name: "number as message",
+			body: `{"alert": {"text": 42}}`,
+			want: Result{Message: "42"},
+		},
+		{
+			name:       "missing parent",
+			body:       `{"text": "disk full"}`,
+			badRequest: true,
+		},
+	})
+
+	mapping, err = ParseFieldMapping("message_path=events.1.summary,severity_path=events.1.severity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testParser(t, NewJSONParserFunc(mapping), []parserTest{
+		{
+			name: "array index",
+			body: `{"events": [{"summary": "first"}, {"summary": "second", "severity": "info"}]}`,
+			want: Result{Message: "second", Severity: SeverityInfo},
+		},
+		{
+			name:       "index out of range",
+			body:       `{"events": [{"summary": "first"}]}`,
+			badRequest: true,
+		},
+	})
+}
+
+func TestNewJSONParserFuncRecipients(t *testing.T) {
+	f := NewJSONParserFunc(FieldMapping{MessagePath: "message", RecipientsPath: "notify.to"})
+	for body, want := range map[string]string{
+		`{"message": "disk full", "notify": {"to": ["alice@example.net", "bob@example.net"]}}`: "alice@example.net,bob@example.net",
+		`{"message": "disk full", "notify": {"to": "alice@example.net,bob@example.net"}}`:      "alice@example.net,bob@example.net",
+		`{"message": "disk full", "notify": {"to": [{"jid": "alice@example.net"}]}}`:           "",
+		`{"message": "disk full"}`: "",
+	} {
+		result, err := f(httptest.NewRequest("POST", "/json", strings.NewReader(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Recipients != want {
+			t.Errorf("recipients of %s: got %q, want %q", body, result.Recipients, want)
+		}
+	}
+}
+
+func TestParseFieldMapping(t *testing.T) {
+	mapping, err := ParseFieldMapping("")
+	if err != nil || mapping != (FieldMapping{MessagePath: "message"}) {
+		t.Errorf("default mapping %+v, %v", mapping, err)
+	}
+	for _, s := range []string{"message_path", "message_path=", "=alert.text", "title_path=alert.title"} {
+		if _, err := ParseFieldMapping(s); err == nil {
+			t.Errorf("mapping %q was accepted", s)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// returns a parser function for newline-delimited / csv payloads, every line
+// is split by delimiter into the given fields (quoting as in csv):
+// - "message" is the text of the line, surplus columns are added to it
+// - "severity" is normalized
+// - all other fields prefix the line, e.g. [web01] disk full
+// with perLine every line is sent as a separate message, otherwise all lines
+// are combined into one
+func NewLineParserFunc(fields []string, delimiter rune, perLine bool) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		reader := csv.NewReader(r.Body)
+		reader.Comma = delimiter
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		reader.TrimLeadingSpace = true
+
+		var lines []Result
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var parseError *csv.ParseError
+				if errors.As(err, &parseError) {
+					return Result{}, BadRequestError{Reason: parseError.Error()}
+				}
+				return Result{}, errors.New(readErr)
+			}
+			lines = append(lines, parseLine(fields, delimiter, record))
+		}
+		if len(lines) == 0 {
+			return Result{}, BadRequestError{Reason: "no lines"}
+		}
+
+		if perLine {
+			return Result{Results: lines}, nil
+		}
+		combined := Result{Severity: SeverityUnknown}
+		var messages []string
+		for _, l := range lines {
+			messages = append(messages, l.Message)
+			if severityRank[l.Severity] > severityRank[combined.Severity] {
+				combined.Severity = l.Severity
+			}
+		}
+		combined.Message = strings.Join(messages, "\n")
+		return combined, nil
+	}
+}
+
+// maps the columns of a line to the fields
+func parseLine(fields []string, delimiter rune, record []string) Result {
+	var prefix, message string
+	severity := SeverityUnknown
+	for i, value := range record {
+		if i >= len(fields) {
+			// surplus columns belong to the message
+			message += string(delimiter) + value
+			continue
+		}
+		switch fields[i] {
+		case "message":
+			message = value
+		case "severity":
+			severity = NormalizeSeverity(value)
+		default:
+			if value != "" {
+				prefix += "[" + value + "] "
+			}
+		}
+	}
+	return Result{Message: prefix + message, Severity: severity}
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewLineParserFunc(t *testing.T) {
+	fields := []string{"host", "severity", "message"}
+	testParser(t, NewLineParserFunc(fields, ',', false), []parserTest{
+		{
+			name:        "joined lines",
+			body:        "web01,warning,disk at 91%\ndb01,critical,replication stopped\n",
+			contentType: "text/plain",
+			want:        Result{Message: "[web01] disk at 91%\n[db01] replication stopped", Severity: SeverityCritical},
+		},
+		{
+			name:        "quoted fields",
+			body:        `web01, info, "disk full, 2 GB left"` + "\n" + `"db01", warning, "said ""no"""`,
+			contentType: "text/csv",
+			want:        Result{Message: "[web01] disk full, 2 GB left\n[db01] said \"no\"", Severity: SeverityWarning},
+		},
+		{
+			name:        "surplus columns",
+			body:        "web01,error,disk full,2 GB left",
+			contentType: "text/plain",
+			want:        Result{Message: "[web01] disk full,2 GB left", Severity: SeverityCritical},
+		},
+		{
+			name:        "missing columns",
+			body:        ",,backup done\nweb01",
+			contentType: "text/plain",
+			want:        Result{Message: "backup done\n[web01] ", Severity: SeverityUnknown},
+		},
+		{
+			name:        "no lines",
+			contentType: "text/plain",
+			badRequest:  true,
+		},
+	})
+	testParser(t, NewLineParserFunc([]string{"host", "message"}, ';', false), []parserTest{
+		{
+			name:        "custom delimiter",
+			body:        "web01;disk full, 2 GB left\ndb01;\"up; again\"",
+			contentType: "text/plain",
+			want:        Result{Message: "[web01] disk full, 2 GB left\n[db01] up; again", Severity: SeverityUnknown},
+		},
+	})
+	testParser(t, NewLineParserFunc([]string{"message"}, '\t', false), []parserTest{
+		{
+			name:        "tab delimiter",
+			body:        "disk full\tweb01",
+			contentType: "text/tab-separated-values",
+			want:        Result{Message: "disk full\tweb01", Severity: SeverityUnknown},
+		},
+	})
+}
+
+func TestNewLineParserFuncPerLine(t *testing.T) {
+	f := NewLineParserFunc([]string{"host", "severity", "message"}, ',', true)
+	r := httptest.NewRequest("POST", "/lines", strings.NewReader("web01,warning,disk at 91%\n\"db01\",critical,\"replication stopped, lag 5m\"\n"))
+	result, err := f(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "" || len(result.Results) != 2 {
+		t.Fatalf("%d results, want 2 instead of one message %q", len(result.Results), result.Message)
+	}
+	if got := result.Results[0]; got.Message != "[web01] disk at 91%" || got.Severity != SeverityWarning {
+		t.Errorf("first result %+v", got)
+	}
+	if got := result.Results[1]; got.Message != "[db01] replication stopped, lag 5m" || got.Severity != SeverityCritical {
+		t.Errorf("second result %+v", got)
+	}
+}
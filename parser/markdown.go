@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownHeading  = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	markdownBullet   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	markdownRule     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	markdownImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	markdownAutolink = regexp.MustCompile(`<((?:https?|mailto|xmpp):[^<>\s]+)>`)
+	markdownBold     = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	markdownItalic   = regexp.MustCompile(`\*([^*\s][^*\n]*)\*`)
+	markdownStrike   = regexp.MustCompile(`~~([^~\n]+)~~`)
+	markdownEscape   = regexp.MustCompile(`\\([\\*_~\[\]()#>` + "`" + `-])`)
+)
+
+// placeholder for the bold markers while converting italic
+const markdownBoldMarker = "\x00"
+
+// start of the placeholders for escaped characters
+const markdownEscaped = 0xe000
+
+// parses a markdown body, either raw (text/markdown, text/plain) or as the
+// "text" (or "markdown", "message") field of a json object, and converts it
+// to XEP-0393 message styling
+func MarkdownParserFunc(r *http.Request) (Result, error) {
+	// get message from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	text := string(body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		payload := &struct {
+			Text     string `json:"text"`
+			Markdown string `json:"markdown"`
+			Message  string `json:"message"`
+		}{}
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+		text = payload.Text
+		for _, t := range []string{payload.Markdown, payload.Message} {
+			if text == "" {
+				text = t
+			}
+		}
+	}
+	message := strings.TrimSpace(markdownToStyling(text))
+	if message == "" {
+		return Result{}, BadRequestError{Reason: "empty message"}
+	}
+	return Result{Message: message}, nil
+}
+
+// converts markdown to XEP-0393 message styling, which clients without
+// styling support show as readable plain text
+func markdownToStyling(s string) string {
+	var lines []string
+	var code bool
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		// fenced code blocks are preformatted in styling too, the language is dropped
+		if strings.HasPrefix(strings.TrimSpace(line), "```") || strings.HasPrefix(strings.TrimSpace(line), "~~~") {
+			code = !code
+			lines = append(lines, "```")
+			continue
+		}
+		if code {
+			lines = append(lines, line)
+			continue
+		}
+		switch {
+		case markdownRule.MatchString(line):
+			line = "───"
+		case markdownHeading.MatchString(line):
+			// styling has no headings, make them bold
+			line = "*" + markdownInline(markdownHeading.FindStringSubmatch(line)[1]) + "*"
+		case markdownBullet.MatchString(line):
+			m := markdownBullet.FindStringSubmatch(line)
+			line = m[1] + "• " + markdownInline(m[2])
+		default:
+			// blockquotes (>) and numbered lists are the same in styling
+			line = markdownInline(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// converts the inline markup of a line, except in code spans
+func markdownInline(line string) string {
+	parts := strings.Split(line, "`")
+	for i := 0; i < len(parts); i += 2 {
+		// escaped characters are hidden from the conversion, in the private use area
+		p := markdownEscape.ReplaceAllStringFunc(parts[i], func(m string) string {
+			return string(rune(markdownEscaped + int(m[1])))
+		})
+		p = markdownImage.ReplaceAllString(p, "$1 ($2)")
+		p = markdownLink.ReplaceAllStringFunc(p, func(m string) string {
+			l := markdownLink.FindStringSubmatch(m)
+			if l[1] == l[2] {
+				return l[2]
+			}
+			return l[1] + " (" + l[2] + ")"
+		})
+		p = markdownAutolink.ReplaceAllString(p, "$1")
+		// bold is marked with a placeholder first, so it isn't taken for italic
+		p = markdownBold.ReplaceAllString(p, markdownBoldMarker+"$1$2"+markdownBoldMarker)
+		p = markdownItalic.ReplaceAllString(p, "_${1}_")
+		p = strings.ReplaceAll(p, markdownBoldMarker, "*")
+		p = markdownStrike.ReplaceAllString(p, "~$1~")
+		parts[i] = strings.Map(func(c rune) rune {
+			if c >= markdownEscaped && c < markdownEscaped+128 {
+				return c - markdownEscaped
+			}
+			return c
+		}, p)
+	}
+	return strings.Join(parts, "`")
+}
@@ -0,0 +1,85 @@
+package parser
+
+import "testing"
+
+func TestMarkdownParserFunc(t *testing.T) {
+	testParser(t, MarkdownParserFunc, []parserTest{
+		{
+			name:        "markdown",
+			body:        "## Deploy failed\n\n**web01** is down, see [the logs](https://ci.example.com/runs/42)\n",
+			contentType: "text/markdown; charset=utf-8",
+			want:        Result{Message: "*Deploy failed*\n\n*web01* is down, see the logs (https://ci.example.com/runs/42)"},
+		},
+		{
+			name:        "plain text",
+			body:        "- disk full\n- _replication_ stopped",
+			contentType: "text/plain",
+			want:        Result{Message: "• disk full\n• _replication_ stopped"},
+		},
+		{
+			name: "json text",
+			body: `{"text": "**disk full**", "markdown": "ignored"}`,
+			want: Result{Message: "*disk full*"},
+		},
+		{
+			name: "json markdown",
+			body: `{"markdown": "~~resolved~~ firing"}`,
+			want: Result{Message: "~resolved~ firing"},
+		},
+		{
+			name: "json message",
+			body: `{"message": "# disk full #"}`,
+			want: Result{Message: "*disk full*"},
+		},
+		{
+			name:        "json isn't parsed as text/plain",
+			body:        `{"text": "**disk full**"}`,
+			contentType: "text/plain",
+			want:        Result{Message: `{"text": "*disk full*"}`},
+		},
+		{
+			name:       "empty json",
+			body:       `{"title": "disk full"}`,
+			badRequest: true,
+		},
+		{
+			name:        "empty markdown",
+			body:        " \n\n",
+			contentType: "text/markdown",
+			badRequest:  true,
+		},
+		{
+			name: "invalid json",
+			body: `{"text": `,
+			err:  true,
+		},
+	})
+}
+
+func TestMarkdownToStyling(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"headings", "# Title\n###### Small ###", "*Title*\n*Small*"},
+		{"bold and italic", "**bold**, __bold__, *italic* and ***both***", "*bold*, *bold*, _italic_ and _*both*_"},
+		{"strike", "~~gone~~", "~gone~"},
+		{"nested bullets", "* one\n  + two\n- **three**", "• one\n  • two\n• *three*"},
+		{"rule", "above\n---\n* * *\nbelow", "above\n───\n───\nbelow"},
+		{"links", "[docs](https://example.com/docs \"title\") and [https://example.com](https://example.com)", "docs (https://example.com/docs) and https://example.com"},
+		{"image", "![graph](https://example.com/g.png)", "graph (https://example.com/g.png)"},
+		{"autolink", "<https://example.com/d/1>", "https://example.com/d/1"},
+		{"code span", "run `**not bold**` now", "run `**not bold**` now"},
+		{"fenced code", "```go\n**raw**\n# raw\n```\n**bold**", "```\n**raw**\n# raw\n```\n*bold*"},
+		{"escapes", `\*not italic\* and 2\*3`, "*not italic* and 2*3"},
+		{"quotes and numbers", "> quoted\n1. first", "> quoted\n1. first"},
+		{"crlf", "**a**\r\n**b**", "*a*\n*b*"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := markdownToStyling(test.markdown); got != test.want {
+				t.Errorf("markdownToStyling(%q) =\n%q, want\n%q", test.markdown, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// max. length of the activity message included in the notification
+const nextcloudMaxMessage = 500
+
+// human readable names of the common activity types
+var nextcloudActivities = map[string]string{
+	"file_created":      "File created",
+	"file_changed":      "File changed",
+	"file_deleted":      "File deleted",
+	"file_restored":     "File restored",
+	"shared":            "Shared",
+	"remote_share":      "Remote share",
+	"public_links":      "Public link",
+	"comments":          "New comment",
+	"calendar_event":    "Calendar event",
+	"calendar_todo":     "Task",
+	"contacts":          "Contacts",
+	"security":          "Security",
+	"personal_settings": "Settings changed",
+}
+
+func NextcloudParserFunc(r *http.Request) (Result, error) {
+	// get activity data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Type       string `json:"type"`
+		User       string `json:"user"`
+		Subject    string `json:"subject"`
+		Message    string `json:"message"`
+		ObjectType string `json:"object_type"`
+		ObjectName string `json:"object_name"`
+		Link       string `json:"link"`
+		Timestamp  int64  `json:"timestamp"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.Subject == "" {
+		return Result{}, BadRequestError{Reason: "activity without subject"}
+	}
+
+	// construct message, unknown activity types only get the subject
+	message := payload.Subject
+	if activity, ok := nextcloudActivities[payload.Type]; ok {
+		message = activity + ": " + payload.Subject
+		if payload.ObjectName != "" && !strings.Contains(payload.Subject, payload.ObjectName) {
+			message += " (" + payload.ObjectName + ")"
+		}
+	}
+	if m := strings.TrimSpace(payload.Message); m != "" {
+		message += "\n" + truncate(m, nextcloudMaxMessage)
+	}
+	if payload.Link != "" {
+		message += "\n" + payload.Link
+	}
+
+	result := Result{Message: message}
+	if payload.Timestamp > 0 {
+		result.Time = time.Unix(payload.Timestamp, 0)
+	}
+	return result, nil
+}
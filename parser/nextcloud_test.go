@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNextcloudParserFunc(t *testing.T) {
+	testParser(t, NextcloudParserFunc, []parserTest{
+		{
+			name: "comment",
+			file: "nextcloud-example.json",
+			want: Result{Message: "New comment: alice commented on quarterly-report.odt (/Documents/quarterly-report.odt)\nCan you double check the numbers in section 3 before we send this out?\nhttps://cloud.example.com/index.php/f/1337"},
+		},
+		{
+			name: "share",
+			body: `{"type": "shared", "subject": "bob shared report.pdf with you", "object_name": "/report.pdf"}`,
+			want: Result{Message: "Shared: bob shared report.pdf with you (/report.pdf)"},
+		},
+		{
+			name: "unknown type",
+			body: `{"type": "deck", "subject": "alice assigned you a card", "object_name": "card 7"}`,
+			want: Result{Message: "alice assigned you a card"},
+		},
+		{
+			name: "long message",
+			body: `{"type": "comments", "subject": "alice commented", "message": "` + strings.Repeat("a", 600) + `"}`,
+			want: Result{Message: "New comment: alice commented\n" + strings.Repeat("a", nextcloudMaxMessage-1) + "…"},
+		},
+		{
+			name:       "without subject",
+			body:       `{"type": "comments", "message": "hello"}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// max. size of the message of an ntfy publish, like the limit of ntfy
+const ntfyMaxSize = 4096
+
+// names of the ntfy priorities, 1 (min) to 5 (max)
+var ntfyPriorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "max": 5, "urgent": 5}
+
+// json publish of ntfy, sent to the root instead of a topic
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Message  string   `json:"message"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	Priority int      `json:"priority"`
+	Click    string   `json:"click"`
+	Attach   string   `json:"attach"`
+}
+
+// returns the first of the headers or query parameters that is set, ntfy
+// accepts several aliases of every parameter
+func ntfyParam(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	query := r.URL.Query()
+	for _, name := range names {
+		if v := query.Get(strings.ToLower(strings.TrimPrefix(name, "X-"))); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parses publish requests of the ntfy api: the message as body of a request
+// to /ntfy/<topic>, with the title, priority, tags and click url as headers
+// (X-Title, X-Priority, X-Tags, X-Click) or query parameters, or as json
+// {"topic": ..., "message": ..., "title": ..., "priority": 4, "tags": [...]}
+// sent to /ntfy itself
+func NtfyParserFunc(r *http.Request) (Result, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	// the topic is the last part of the path, like the url of an ntfy server
+	var msg ntfyMessage
+	if dir, topic := path.Split(strings.TrimSuffix(r.URL.Path, "/")); strings.Count(dir, "/") > 1 {
+		msg.Topic = topic
+	}
+	if b := bytes.TrimSpace(body); msg.Topic == "" && len(b) > 0 && b[0] == '{' {
+		// json is only accepted at the root, like ntfy does
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+	} else {
+		msg.Message = string(body)
+		if strings.TrimSpace(msg.Message) == "" {
+			msg.Message = ntfyParam(r, "X-Message", "Message", "m")
+		}
+		msg.Title = ntfyParam(r, "X-Title", "Title", "ti", "t")
+		if tags := ntfyParam(r, "X-Tags", "Tags", "tag", "ta"); tags != "" {
+			for _, t := range strings.Split(tags, ",") {
+				msg.Tags = append(msg.Tags, strings.TrimSpace(t))
+			}
+		}
+		msg.Click = ntfyParam(r, "X-Click", "Click")
+		msg.Attach = ntfyParam(r, "X-Attach", "Attach", "a")
+		if p := ntfyParam(r, "X-Priority", "Priority", "prio", "p"); p != "" {
+			var ok bool
+			if msg.Priority, ok = ntfyPriorities[strings.ToLower(p)]; !ok {
+				if msg.Priority, err = strconv.Atoi(p); err != nil {
+					return Result{}, BadRequestError{Reason: "invalid priority " + p}
+				}
+			}
+		}
+	}
+	message := strings.TrimSpace(msg.Message)
+	if message == "" {
+		// ntfy sends "triggered" for empty messages
+		message = "triggered"
+	}
+	if len(message) > ntfyMaxSize {
+		return Result{}, BadRequestError{Reason: "message exceeds 4096 bytes"}
+	}
+
+	// construct notification message:
+	// [backups] Backup failed
+	// The disk is full.
+	// Tags: warning, nas
+	// https://nas.example.com/backups
+	var lines []string
+	title := strings.TrimSpace(msg.Title)
+	switch {
+	case msg.Topic != "" && title != "":
+		lines = append(lines, "["+msg.Topic+"] "+title, message)
+	case msg.Topic != "":
+		lines = append(lines, "["+msg.Topic+"] "+message)
+	case title != "":
+		lines = append(lines, title, message)
+	default:
+		lines = append(lines, message)
+	}
+	var tags []string
+	for _, t := range msg.Tags {
+		if t != "" {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) > 0 {
+		lines = append(lines, "Tags: "+strings.Join(tags, ", "))
+	}
+	if msg.Click != "" {
+		lines = append(lines, msg.Click)
+	}
+	if msg.Attach != "" {
+		lines = append(lines, "Attachment: "+msg.Attach)
+	}
+
+	// max (and urgent) priority is critical, high a warning, the rest info
+	result := Result{Message: strings.Join(lines, "\n"), Severity: SeverityInfo}
+	switch {
+	case msg.Priority < 0 || msg.Priority > 5:
+		return Result{}, BadRequestError{Reason: "invalid priority " + strconv.Itoa(msg.Priority)}
+	case msg.Priority == 5:
+		result.Severity = SeverityCritical
+	case msg.Priority == 4:
+		result.Severity = SeverityWarning
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNtfyParserFunc(t *testing.T) {
+	testParser(t, NtfyParserFunc, []parserTest{
+		{
+			name: "json",
+			file: "ntfy-example.json",
+			want: Result{Message: "[backups] Backup failed\nThe nightly backup of nas failed: no space left on device.\nTags: warning, nas\nhttps://nas.example.com/backups", Severity: SeverityWarning},
+		},
+		{
+			name:        "topic and query",
+			target:      "/ntfy/deploys?title=Deployed&p=max&tags=rocket",
+			body:        "v1.4.2 is live",
+			contentType: "text/plain",
+			want:        Result{Message: "[deploys] Deployed\nv1.4.2 is live\nTags: rocket", Severity: SeverityCritical},
+		},
+		{
+			name:        "empty message",
+			target:      "/ntfy/cron",
+			contentType: "text/plain",
+			want:        Result{Message: "[cron] triggered", Severity: SeverityInfo},
+		},
+		{
+			name:        "json body at a topic is the message",
+			target:      "/ntfy/raw",
+			body:        `{"a": 1}`,
+			contentType: "application/json",
+			want:        Result{Message: `[raw] {"a": 1}`, Severity: SeverityInfo},
+		},
+		{
+			name:        "invalid priority",
+			target:      "/ntfy/cron?priority=6",
+			body:        "done",
+			contentType: "text/plain",
+			badRequest:  true,
+		},
+		{
+			name:       "invalid json priority",
+			body:       `{"topic": "cron", "message": "done", "priority": 9}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"topic": 1}`,
+			err:  true,
+		},
+	})
+}
+
+func TestNtfyParserFuncHeaders(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/ntfy/backups", strings.NewReader("Disk is full\n"))
+	r.Header.Set("X-Title", "Backup failed")
+	r.Header.Set("Priority", "urgent")
+	r.Header.Set("Tags", "warning, nas")
+	r.Header.Set("X-Click", "https://nas.example.com")
+	r.Header.Set("X-Attach", "https://nas.example.com/log.txt")
+	result, err := NtfyParserFunc(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[backups] Backup failed\nDisk is full\nTags: warning, nas\nhttps://nas.example.com\nAttachment: https://nas.example.com/log.txt"; result.Message != want {
+		t.Errorf("got %q, want %q", result.Message, want)
+	}
+	if result.Severity != SeverityCritical {
+		t.Errorf("severity %s, want critical", result.Severity)
+	}
+
+	// the message may be a header too
+	r = httptest.NewRequest("POST", "/ntfy/cron", nil)
+	r.Header.Set("X-Message", "Job done")
+	result, err = NtfyParserFunc(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "[cron] Job done" || result.Severity != SeverityInfo {
+		t.Errorf("got %q (%s)", result.Message, result.Severity)
+	}
+}
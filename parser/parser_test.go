@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// request to a parser function and the expected result, the body is one of
+// the samples in dev/ or given inline
+type parserTest struct {
+	name        string
+	file        string
+	body        string
+	method      string // defaults to POST
+	target      string // request uri, defaults to /
+	contentType string // defaults to application/json
+	headers     map[string]string
+	want        Result // compared by message, status, severity and key
+	err         bool   // expect an error instead
+	badRequest  bool   // expect a BadRequestError instead
+	forbidden   bool   // expect a ForbiddenError instead
+}
+
+// runs the parser function for every test
+func testParser(t *testing.T, f ParserFunc, tests []parserTest) {
+	t.Helper()
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(tt.body)
+			if tt.file != "" {
+				var err error
+				body, err = ioutil.ReadFile(filepath.Join("..", "dev", tt.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			method, target, contentType := tt.method, tt.target, tt.contentType
+			if method == "" {
+				method = http.MethodPost
+			}
+			if target == "" {
+				target = "/"
+			}
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			r := httptest.NewRequest(method, target, bytes.NewReader(body))
+			r.Header.Set("Content-Type", contentType)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			got, err := f(r)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got.Message)
+				}
+				return
+			}
+			if tt.badRequest {
+				var badRequest BadRequestError
+				if !errors.As(err, &badRequest) {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				return
+			}
+			if tt.forbidden {
+				var forbidden ForbiddenError
+				if !errors.As(err, &forbidden) {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Message != tt.want.Message {
+				t.Errorf("message:\ngot  %q\nwant %q", got.Message, tt.want.Message)
+			}
+			if got.Status != tt.want.Status {
+				t.Errorf("status: got %q, want %q", got.Status, tt.want.Status)
+			}
+			if got.Severity != tt.want.Severity {
+				t.Errorf("severity: got %q, want %q", got.Severity, tt.want.Severity)
+			}
+			if got.Key != tt.want.Key {
+				t.Errorf("key: got %q, want %q", got.Key, tt.want.Key)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parses pingdom state change webhooks: the current json body
+// {"check_id": ..., "check_name": ..., "check_type": ..., "current_state": "DOWN", "description": ...}
+// and the legacy format, a json document in the message query parameter
+// {"check": ..., "checkname": ..., "host": ..., "action": "assign", "description": ...}
+func PingdomParserFunc(r *http.Request) (Result, error) {
+	// legacy webhooks pass the payload in the url
+	if m := r.URL.Query().Get("message"); m != "" {
+		return parseLegacyPingdom(m)
+	}
+
+	// get check data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		CheckID     int64  `json:"check_id"`
+		CheckName   string `json:"check_name"`
+		CheckType   string `json:"check_type"`
+		CheckParams struct {
+			Hostname string `json:"hostname"`
+			FullURL  string `json:"full_url"`
+		} `json:"check_params"`
+		CurrentState          string `json:"current_state"`
+		Description           string `json:"description"`
+		LongDescription       string `json:"long_description"`
+		StateChangedTimestamp int64  `json:"state_changed_timestamp"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	target := payload.CheckParams.FullURL
+	if target == "" {
+		target = payload.CheckParams.Hostname
+	}
+	result, err := pingdomResult(payload.CurrentState, payload.CheckName, payload.CheckType, target, payload.Description)
+	if err != nil {
+		return Result{}, err
+	}
+	if payload.CheckID != 0 {
+		result.Key = fmt.Sprint(payload.CheckID)
+	}
+	if payload.StateChangedTimestamp > 0 {
+		result.Time = time.Unix(payload.StateChangedTimestamp, 0)
+	}
+	return result, nil
+}
+
+// parses the payload of legacy pingdom webhooks
+func parseLegacyPingdom(message string) (Result, error) {
+	payload := &struct {
+		Check       string `json:"check"`
+		CheckName   string `json:"checkname"`
+		Host        string `json:"host"`
+		Action      string `json:"action"`
+		Description string `json:"description"`
+	}{}
+	err := json.Unmarshal([]byte(message), &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	// an incident is assigned when the check goes down and closed when it's up again
+	var state string
+	switch payload.Action {
+	case "assign":
+		state = "DOWN"
+	case "notify_of_close":
+		state = "UP"
+	default:
+		return Result{}, BadRequestError{Reason: "unsupported pingdom action " + payload.Action}
+	}
+	result, err := pingdomResult(state, payload.CheckName, "", payload.Host, payload.Description)
+	if err != nil {
+		return Result{}, err
+	}
+	result.Key = payload.Check
+	return result, nil
+}
+
+// constructs the message of a pingdom state change
+func pingdomResult(state string, name string, checkType string, target string, description string) (Result, error) {
+	var result Result
+	switch strings.ToUpper(state) {
+	case "DOWN":
+		result.Status = StatusFiring
+		result.Severity = SeverityCritical
+	case "UP":
+		result.Status = StatusResolved
+		result.Severity = SeverityInfo
+	default:
+		return Result{}, BadRequestError{Reason: "unsupported pingdom state " + state}
+	}
+
+	message := strings.ToUpper(state) + ": " + name
+	if checkType != "" {
+		message += " (" + checkType + ")"
+	}
+	if target != "" && target != name {
+		message += "\n" + target
+	}
+	if description != "" {
+		message += "\n" + description
+	}
+	result.Message = message
+	return result, nil
+}
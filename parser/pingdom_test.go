@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPingdomParserFunc(t *testing.T) {
+	legacy := func(action string) string {
+		return "/?message=" + url.QueryEscape(`{"check": "1234", "checkname": "Homepage", "host": "www.example.com", "action": "`+action+`", "description": "timeout"}`)
+	}
+	testParser(t, PingdomParserFunc, []parserTest{
+		{
+			name: "down",
+			file: "pingdom-example.json",
+			want: Result{Message: "DOWN: Homepage (HTTP)\nhttps://www.example.com/\n503 Service Unavailable", Status: StatusFiring, Severity: SeverityCritical, Key: "12345"},
+		},
+		{
+			name: "up",
+			body: `{"check_id": 12345, "check_name": "Homepage", "check_type": "HTTP", "check_params": {"hostname": "Homepage"}, "current_state": "UP", "description": "OK"}`,
+			want: Result{Message: "UP: Homepage (HTTP)\nOK", Status: StatusResolved, Severity: SeverityInfo, Key: "12345"},
+		},
+		{
+			name:   "legacy down",
+			method: "GET",
+			target: legacy("assign"),
+			want:   Result{Message: "DOWN: Homepage\nwww.example.com\ntimeout", Status: StatusFiring, Severity: SeverityCritical, Key: "1234"},
+		},
+		{
+			name:   "legacy up",
+			method: "GET",
+			target: legacy("notify_of_close"),
+			want:   Result{Message: "UP: Homepage\nwww.example.com\ntimeout", Status: StatusResolved, Severity: SeverityInfo, Key: "1234"},
+		},
+		{
+			name:       "legacy unknown action",
+			method:     "GET",
+			target:     legacy("reassign"),
+			badRequest: true,
+		},
+		{
+			name:       "unknown state",
+			body:       `{"check_id": 1, "check_name": "Homepage", "current_state": "PAUSED"}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canonical result of a probe, target and success are required
+type probeResult struct {
+	Target        string          `json:"target"`
+	Module        string          `json:"module"`
+	Success       json.RawMessage `json:"success"`  // true or false, or 1 or 0 like probe_success
+	Duration      json.RawMessage `json:"duration"` // seconds or a duration like "340ms"
+	FailureReason string          `json:"failure_reason"`
+	Severity      string          `json:"severity"`
+}
+
+// parses the results of connectivity probes, e.g. forwarded from the
+// blackbox_exporter or posted by a script checking tls handshakes:
+// {"target": "https://example.com", "module": "http_2xx", "success": false, "duration": 1.2, "failure_reason": "503"}
+func ProbeParserFunc(r *http.Request) (Result, error) {
+	// get probe result from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var probe probeResult
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if probe.Target == "" || len(probe.Success) == 0 || string(probe.Success) == "null" {
+		return Result{}, BadRequestError{Reason: "target and success are required"}
+	}
+	var success bool
+	switch strings.Trim(string(probe.Success), `"`) {
+	case "true", "1":
+		success = true
+	case "false", "0":
+	default:
+		return Result{}, BadRequestError{Reason: "success must be true or false (or 1 or 0)"}
+	}
+	var duration time.Duration
+	if len(probe.Duration) > 0 && string(probe.Duration) != "null" {
+		duration, err = backupDuration(probe.Duration)
+		if err != nil || duration < 0 {
+			return Result{}, BadRequestError{Reason: "invalid duration " + string(probe.Duration)}
+		}
+	}
+
+	// probe https://example.com (http_2xx) FAILED: 503 in 1.2s
+	message := "probe " + probe.Target
+	key := probe.Target
+	if probe.Module != "" {
+		message += " (" + probe.Module + ")"
+		key = probe.Module + ":" + probe.Target
+	}
+	result := Result{Status: StatusFiring, Severity: SeverityCritical, Key: key, Labels: map[string]string{"target": probe.Target}}
+	if probe.Module != "" {
+		result.Labels["module"] = probe.Module
+	}
+	if success {
+		message += " OK"
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	} else {
+		message += " FAILED"
+		if reason := strings.TrimSpace(probe.FailureReason); reason != "" {
+			message += ": " + reason
+		}
+	}
+	if duration > 0 {
+		message += " in " + formatProbeDuration(duration)
+	}
+	result.Message = message
+	if s := NormalizeSeverity(probe.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// formats the duration in milliseconds below a second and in seconds with at
+// most one decimal above, e.g. 340ms or 1.2s
+func formatProbeDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return strconv.FormatFloat(d.Round(100*time.Millisecond).Seconds(), 'f', -1, 64) + "s"
+}
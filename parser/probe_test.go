@@ -0,0 +1,48 @@
+package parser
+
+import "testing"
+
+func TestProbeParserFunc(t *testing.T) {
+	testParser(t, ProbeParserFunc, []parserTest{
+		{
+			name: "failed",
+			file: "probe-example.json",
+			want: Result{Message: "probe https://example.com (http_2xx) FAILED: 503 in 1.2s", Status: StatusFiring, Severity: SeverityCritical, Key: "http_2xx:https://example.com"},
+		},
+		{
+			name: "tls handshake",
+			body: `{"target": "mail.example.com:993", "module": "tls_connect", "success": 0, "duration": "5s", "failure_reason": "x509: certificate has expired"}`,
+			want: Result{Message: "probe mail.example.com:993 (tls_connect) FAILED: x509: certificate has expired in 5s", Status: StatusFiring, Severity: SeverityCritical, Key: "tls_connect:mail.example.com:993"},
+		},
+		{
+			name: "succeeded",
+			body: `{"target": "https://example.com", "module": "http_2xx", "success": true, "duration": 0.3412}`,
+			want: Result{Message: "probe https://example.com (http_2xx) OK in 341ms", Status: StatusResolved, Severity: SeverityInfo, Key: "http_2xx:https://example.com"},
+		},
+		{
+			name: "without module and duration",
+			body: `{"target": "10.0.0.1", "success": "false", "severity": "warning"}`,
+			want: Result{Message: "probe 10.0.0.1 FAILED", Status: StatusFiring, Severity: SeverityWarning, Key: "10.0.0.1"},
+		},
+		{
+			name:       "without success",
+			body:       `{"target": "https://example.com", "module": "http_2xx"}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid success",
+			body:       `{"target": "https://example.com", "success": "maybe"}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid duration",
+			body:       `{"target": "https://example.com", "success": false, "duration": "soon"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[1]`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parses the payload of the recommended proxmox ve webhook body:
+// {"title": "{{ escape title }}", "message": "{{ escape message }}", "severity": "{{ severity }}", "timestamp": {{ timestamp }}}
+func ProxmoxParserFunc(r *http.Request) (Result, error) {
+	// get notification data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Title     string `json:"title"`
+		Message   string `json:"message"`
+		Severity  string `json:"severity"`
+		Timestamp int64  `json:"timestamp"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.Title == "" && payload.Message == "" {
+		return Result{}, BadRequestError{Reason: "notification without title and message"}
+	}
+
+	// construct notification message, prefixed with the normalized severity
+	severity := NormalizeSeverity(payload.Severity)
+	message := "[" + strings.ToUpper(severity) + "] " + strings.TrimSpace(payload.Title)
+	if m := strings.TrimSpace(payload.Message); m != "" {
+		message += "\n" + m
+	}
+
+	result := Result{Message: message, Severity: severity}
+	if payload.Timestamp > 0 {
+		result.Time = time.Unix(payload.Timestamp, 0)
+	}
+	return result, nil
+}
@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestProxmoxParserFunc(t *testing.T) {
+	testParser(t, ProxmoxParserFunc, []parserTest{
+		{
+			name: "failed backup",
+			file: "proxmox-example.json",
+			want: Result{Message: "[CRITICAL] vzdump backup status (pve01.example.com): backup failed\nDetails\n=======\nVMID  Name   Status  Time  Size  Filename\n101   web01  err     3s    0 B   null\n\nTotal running time: 3s\n\nLogs\n====\nvzdump 101 --storage backup --mode snapshot\n\n101: 2023-11-08 02:00:01 INFO: Starting Backup of VM 101 (qemu)\n101: 2023-11-08 02:00:04 ERROR: Backup of VM 101 failed - storage 'backup' is not online", Severity: SeverityCritical},
+		},
+		{
+			name: "notice",
+			body: `{"title": "Package updates available", "severity": "notice"}`,
+			want: Result{Message: "[INFO] Package updates available", Severity: SeverityInfo},
+		},
+		{
+			name: "warning",
+			body: `{"title": "Replication delayed", "message": "job 101-0 is 10m behind", "severity": "warning"}`,
+			want: Result{Message: "[WARNING] Replication delayed\njob 101-0 is 10m behind", Severity: SeverityWarning},
+		},
+		{
+			name: "unknown severity",
+			body: `{"title": "Test", "severity": "custom"}`,
+			want: Result{Message: "[UNKNOWN] Test", Severity: SeverityUnknown},
+		},
+		{
+			name:       "empty",
+			body:       `{"severity": "info"}`,
+			badRequest: true,
+		},
+	})
+}
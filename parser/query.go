@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// takes the message from the message parameter of the query or the form
+// encoded body, for senders that can only request an url:
+// /ping?message=backup%20done&severity=info
+func QueryParserFunc(r *http.Request) (Result, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	message := strings.TrimSpace(r.Form.Get("message"))
+	if message == "" {
+		return Result{}, BadRequestError{Reason: "missing message"}
+	}
+
+	result := Result{Message: message}
+	if s := r.Form.Get("severity"); s != "" {
+		result.Severity = NormalizeSeverity(s)
+	}
+	return result, nil
+}
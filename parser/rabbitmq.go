@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// states of queue alerts that fire, and the ones that resolve them
+var queueFiring = map[string]bool{"alerting": true, "exceeded": true, "firing": true, "critical": true, "warning": true}
+var queueResolved = map[string]bool{"ok": true, "recovered": true, "resolved": true, "normal": true}
+
+// alert about the depth of a queue, as sent by queue monitoring scripts and
+// exporters, only queue and depth are required
+type queueAlert struct {
+	Queue     string       `json:"queue"`
+	VHost     string       `json:"vhost"`
+	Depth     *json.Number `json:"depth"`
+	Threshold *json.Number `json:"threshold"`
+	State     string       `json:"state"`
+	Severity  string       `json:"severity"`
+	Consumers *json.Number `json:"consumers"`
+	Node      string       `json:"node"`
+	Source    string       `json:"source"`
+}
+
+// parses queue depth alerts of rabbitmq (or other brokers): a single alert
+// {"queue": "orders", "vhost": "/", "depth": 10234, "threshold": 5000, "state": "alerting", "consumers": 0}
+// or a json array of them, every alert is sent as a separate message
+// without state, the alert fires if the depth exceeds the threshold
+func RabbitMQParserFunc(r *http.Request) (Result, error) {
+	// get alerts from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var alerts []queueAlert
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		var alert queueAlert
+		err = json.Unmarshal(body, &alert)
+		alerts = []queueAlert{alert}
+	} else {
+		err = json.Unmarshal(body, &alerts)
+	}
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	var results []Result
+	for _, a := range alerts {
+		result, err := queueResult(a)
+		if err != nil {
+			return Result{}, err
+		}
+		results = append(results, result)
+	}
+	switch len(results) {
+	case 0:
+		return Result{}, BadRequestError{Reason: "no queue alerts"}
+	case 1:
+		return results[0], nil
+	}
+	return Result{Results: results}, nil
+}
+
+// returns the message of a queue alert:
+// [RabbitMQ] queue orders depth 10234 exceeds 5000
+// Consumers: 0
+func queueResult(a queueAlert) (Result, error) {
+	if a.Queue == "" || a.Depth == nil {
+		return Result{}, BadRequestError{Reason: "queue and depth are required"}
+	}
+	depth, err := a.Depth.Float64()
+	if err != nil {
+		return Result{}, BadRequestError{Reason: "depth is not a number"}
+	}
+	var threshold float64
+	if a.Threshold != nil {
+		if threshold, err = a.Threshold.Float64(); err != nil {
+			return Result{}, BadRequestError{Reason: "threshold is not a number"}
+		}
+	}
+
+	// the state wins over the numbers, the sender may use a hysteresis
+	state := strings.ToLower(a.State)
+	firing := a.Threshold != nil && depth > threshold
+	switch {
+	case queueFiring[state]:
+		firing = true
+	case queueResolved[state]:
+		firing = false
+	case state != "":
+		return Result{}, BadRequestError{Reason: "unknown state " + a.State}
+	case a.Threshold == nil:
+		return Result{}, BadRequestError{Reason: "state or threshold is required"}
+	}
+
+	source := a.Source
+	if source == "" {
+		source = "RabbitMQ"
+	}
+	queue, key := "queue "+a.Queue, a.Queue
+	if a.VHost != "" && a.VHost != "/" {
+		queue += " (vhost " + a.VHost + ")"
+		key = a.VHost + "/" + a.Queue
+	}
+	result := Result{Status: StatusFiring, Severity: SeverityWarning, Key: key}
+	var line string
+	switch {
+	case firing && a.Threshold != nil:
+		line = queue + " depth " + a.Depth.String() + " exceeds " + a.Threshold.String()
+	case firing:
+		line = queue + " depth " + a.Depth.String()
+	case a.Threshold != nil:
+		line = queue + " depth " + a.Depth.String() + " is back below " + a.Threshold.String()
+	default:
+		line = queue + " depth " + a.Depth.String() + " is back to normal"
+	}
+	if firing {
+		if state == "critical" {
+			result.Severity = SeverityCritical
+		}
+		if s := NormalizeSeverity(a.Severity); a.Severity != "" && s != SeverityUnknown {
+			result.Severity = s
+		}
+	} else {
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	}
+	lines := []string{"[" + source + "] " + line}
+	if a.Consumers != nil {
+		lines = append(lines, "Consumers: "+a.Consumers.String())
+	}
+	if a.Node != "" {
+		lines = append(lines, "Node: "+a.Node)
+	}
+	result.Message = strings.Join(lines, "\n")
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRabbitMQParserFunc(t *testing.T) {
+	testParser(t, RabbitMQParserFunc, []parserTest{
+		{
+			name: "exceeded",
+			file: "rabbitmq-example.json",
+			want: Result{Message: "[RabbitMQ] queue orders depth 10234 exceeds 5000\nConsumers: 0\nNode: rabbit@mq-1", Status: StatusFiring, Severity: SeverityWarning, Key: "orders"},
+		},
+		{
+			name: "recovered",
+			body: `{"queue": "orders", "vhost": "shop", "depth": 120, "threshold": 5000, "state": "ok"}`,
+			want: Result{Message: "[RabbitMQ] queue orders (vhost shop) depth 120 is back below 5000", Status: StatusResolved, Severity: SeverityInfo, Key: "shop/orders"},
+		},
+		{
+			name: "without state",
+			body: `{"queue": "mails", "depth": "812", "threshold": 500, "severity": "critical", "source": "Kafka lag"}`,
+			want: Result{Message: "[Kafka lag] queue mails depth 812 exceeds 500", Status: StatusFiring, Severity: SeverityCritical, Key: "mails"},
+		},
+		{
+			name: "critical state without threshold",
+			body: `{"queue": "orders", "depth": 10234, "state": "critical"}`,
+			want: Result{Message: "[RabbitMQ] queue orders depth 10234", Status: StatusFiring, Severity: SeverityCritical, Key: "orders"},
+		},
+		{
+			name:       "unknown state",
+			body:       `{"queue": "orders", "depth": 1, "state": "paused"}`,
+			badRequest: true,
+		},
+		{
+			name:       "neither state nor threshold",
+			body:       `{"queue": "orders", "depth": 1}`,
+			badRequest: true,
+		},
+		{
+			name:       "without depth",
+			body:       `{"queue": "orders", "threshold": 5000}`,
+			badRequest: true,
+		},
+		{
+			name:       "no alerts",
+			body:       `[]`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"queue": 1}`,
+			err:  true,
+		},
+	})
+}
+
+func TestRabbitMQParserFuncAlerts(t *testing.T) {
+	r := httptest.NewRequest("POST", "/rabbitmq", strings.NewReader(`[{"queue": "orders", "depth": 10234, "threshold": 5000}, {"queue": "mails", "depth": 3, "threshold": 500, "state": "recovered"}]`))
+	result, err := RabbitMQParserFunc(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 2 {
+		t.Fatalf("%d results, want 2", len(result.Results))
+	}
+	if got := result.Results[0]; got.Status != StatusFiring || got.Key != "orders" {
+		t.Errorf("first result %+v", got)
+	}
+	if got := result.Results[1]; got.Status != StatusResolved || got.Message != "[RabbitMQ] queue mails depth 3 is back below 500" {
+		t.Errorf("second result %+v", got)
+	}
+}
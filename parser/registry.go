@@ -0,0 +1,137 @@
+package parser
+
+// built-in parser functions, keyed by the endpoint / webhook type they're served at
+var Registry = map[string]ParserFunc{
+	"grafana":         GrafanaParserFunc,
+	"slack":           SlackParserFunc,
+	"alertmanager":    AlertmanagerParserFunc,
+	"alertmanager-v2": AlertmanagerV2ParserFunc,
+	"twilio":          TwilioParserFunc,
+	"grafana-oncall":  GrafanaOnCallParserFunc,
+	"nextcloud":       NextcloudParserFunc,
+	"synology":        SynologyParserFunc,
+	"proxmox":         ProxmoxParserFunc,
+	"ping":            QueryParserFunc,
+	"alert":           GenericAlertParserFunc,
+	"feed":            FeedItemParserFunc,
+	"watchtower":      WatchtowerParserFunc,
+	"ses":             SESParserFunc,
+	"betterstack":     BetterStackParserFunc,
+	"fail2ban":        Fail2banParserFunc,
+	"pingdom":         PingdomParserFunc,
+	"authentik":       AuthentikParserFunc,
+	"markdown":        MarkdownParserFunc,
+	"graylog":         GraylogParserFunc,
+	"discord":         DiscordParserFunc,
+	"tailscale":       TailscaleParserFunc,
+	"analytics":       AnalyticsAlertParserFunc,
+	"automation":      AutomationParserFunc,
+	"homeassistant":   HomeAssistantParserFunc,
+	"cloudflare":      CloudflareParserFunc,
+	"vaultwarden":     VaultwardenParserFunc,
+	"statuspage":      StatuspageParserFunc,
+	"rabbitmq":        RabbitMQParserFunc,
+	"systemd":         SystemdParserFunc,
+	"ntfy":            NtfyParserFunc,
+	"backup":          BackupParserFunc,
+	"deploy":          DeployParserFunc,
+	"sensor":          SensorParserFunc,
+	"ecommerce":       EcommerceParserFunc,
+	"usage":           UsageAlertParserFunc,
+	"certexpiry":      CertExpiryParserFunc,
+	"storage":         StorageParserFunc,
+	"security":        AuthAnomalyParserFunc,
+	"jobs":            JobFailureParserFunc,
+	"probe":           ProbeParserFunc,
+	"tests":           TestFailureParserFunc,
+	"cost":            CostAlertParserFunc,
+}
+
+// content types accepted by the built-in parser functions, only checked if enforcement is enabled
+var ContentTypes = map[string][]string{
+	"grafana":         {"application/json"},
+	"slack":           {"application/json"},
+	"alertmanager":    {"application/json", "text/plain"},
+	"alertmanager-v2": {"application/json"},
+	"twilio":          {"application/x-www-form-urlencoded"},
+	"grafana-oncall":  {"application/json"},
+	"nextcloud":       {"application/json"},
+	"synology":        {"application/json"},
+	"proxmox":         {"application/json"},
+	"alert":           {"application/json"},
+	"feed":            {"application/json"},
+	"watchtower":      {"application/json"},
+	"betterstack":     {"application/json"},
+	"fail2ban":        {"application/json"},
+	"pingdom":         {"application/json"},
+	"json":            {"application/json"},
+	"authentik":       {"application/json"},
+	"markdown":        {"text/markdown", "text/plain", "application/json"},
+	"graylog":         {"application/json"},
+	"tailscale":       {"application/json"},
+	"analytics":       {"application/json"},
+	"cloudflare":      {"application/json"},
+	"vaultwarden":     {"application/json"},
+	"statuspage":      {"application/json"},
+	"rabbitmq":        {"application/json"},
+	"systemd":         {"application/json"},
+	"deploy":          {"application/json"},
+	"sensor":          {"application/json"},
+	"usage":           {"application/json"},
+	"certexpiry":      {"application/json"},
+	"storage":         {"application/json"},
+	"security":        {"application/json"},
+	"jobs":            {"application/json"},
+	"probe":           {"application/json"},
+	"tests":           {"application/json"},
+	// woocommerce pings the webhook with a form
+	"ecommerce": {"application/json", "application/x-www-form-urlencoded"},
+	// restic writes json lines, duplicati sends forms unless told otherwise
+	"backup": {"application/json", "application/x-ndjson", "application/x-www-form-urlencoded"},
+	// zapier can send forms
+	"automation": {"application/json", "application/x-www-form-urlencoded"},
+	// the rest notify platform of home assistant sends forms unless the method is POST_JSON
+	"homeassistant": {"application/json", "application/x-www-form-urlencoded"},
+	// discord webhooks accept files in multipart requests
+	"discord": {"application/json", "multipart/form-data"},
+	// sns sends json as text/plain
+	"ses": {"application/json", "text/plain"},
+	// sns sends json as text/plain, raw deliveries of aws budgets are text
+	"cost": {"application/json", "text/plain"},
+}
+
+// http methods accepted by the built-in parser functions, POST if not listed
+var Methods = map[string][]string{
+	"ping": {"GET", "POST"},
+	// legacy pingdom webhooks use GET
+	"pingdom": {"GET", "POST"},
+	// the default method of the rest notify platform of home assistant
+	"homeassistant": {"GET", "POST"},
+	// ntfy clients publish with PUT too (curl -T)
+	"ntfy": {"POST", "PUT"},
+}
+
+// parsers that are also served below their endpoint, e.g. /ntfy/<topic>
+var Subpaths = map[string]bool{
+	"ntfy": true,
+}
+
+// parsers whose messages state the status (e.g. "DOWN: ..."), the default
+// firing and resolved prefixes are left out for them
+var StatusShown = map[string]bool{
+	"alertmanager":   true,
+	"betterstack":    true,
+	"grafana-oncall": true,
+	"pingdom":        true,
+	"statuspage":     true,
+	"rabbitmq":       true,
+	"systemd":        true,
+	"backup":         true,
+	"deploy":         true,
+	"sensor":         true,
+	"usage":          true,
+	"certexpiry":     true,
+	"storage":        true,
+	"probe":          true,
+	"tests":          true,
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// states of the sensor alerts, true for a breach of the threshold, false for the recovery
+var sensorStates = map[string]bool{
+	"alert": true, "alarm": true, "breach": true, "breached": true, "triggered": true, "firing": true, "problem": true,
+	"ok": false, "normal": false, "recovered": false, "recovery": false, "resolved": false, "cleared": false,
+}
+
+// canonical sensor threshold alert, sensor, value and state are required
+type sensorAlert struct {
+	Sensor    string      `json:"sensor"`
+	Metric    string      `json:"metric"`
+	Value     json.Number `json:"value"`
+	Unit      string      `json:"unit"`
+	Threshold json.Number `json:"threshold"`
+	State     string      `json:"state"`
+	Severity  string      `json:"severity"`
+}
+
+// parses the threshold alerts of weather stations and iot sensors (e.g. sent
+// by node-red, home automation or the sensor gateway):
+// {"sensor": "freezer", "metric": "temp", "value": 5.2, "unit": "°C", "threshold": -15, "state": "alert"}
+func SensorParserFunc(r *http.Request) (Result, error) {
+	// get alert from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var alert sensorAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if alert.Sensor == "" || alert.Value == "" || alert.State == "" {
+		return Result{}, BadRequestError{Reason: "sensor, value and state are required"}
+	}
+	breach, ok := sensorStates[strings.ToLower(alert.State)]
+	if !ok {
+		return Result{}, BadRequestError{Reason: "unknown state " + alert.State}
+	}
+
+	// sensor freezer temp 5.2°C exceeds -15°C
+	// sensor freezer temp -18°C back below -15°C
+	message, key := "sensor "+alert.Sensor, alert.Sensor
+	if alert.Metric != "" {
+		message += " " + alert.Metric
+		key += "/" + alert.Metric
+	}
+	message += " " + withUnit(alert.Value.String(), alert.Unit)
+	direction := analyticsDirection("", alert.Value, alert.Threshold)
+	threshold := withUnit(alert.Threshold.String(), alert.Unit)
+	switch {
+	case breach && direction == "up":
+		message += " exceeds " + threshold
+	case breach && direction == "down":
+		message += " is below " + threshold
+	case breach && alert.Threshold != "":
+		message += " reached " + threshold
+	case breach:
+		message += " in alert"
+	case direction == "up":
+		message += " back above " + threshold
+	case direction == "down":
+		message += " back below " + threshold
+	default:
+		message += " back to normal"
+	}
+
+	result := Result{Message: message, Status: StatusFiring, Severity: SeverityWarning, Key: key}
+	if !breach {
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	}
+	if s := NormalizeSeverity(alert.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// appends the unit to the value, degrees and percent without a space
+func withUnit(value string, unit string) string {
+	switch {
+	case unit == "":
+		return value
+	case strings.HasPrefix(unit, "°") || unit == "%":
+		return value + unit
+	default:
+		return value + " " + unit
+	}
+}
@@ -0,0 +1,48 @@
+package parser
+
+import "testing"
+
+func TestSensorParserFunc(t *testing.T) {
+	testParser(t, SensorParserFunc, []parserTest{
+		{
+			name: "breach",
+			file: "sensor-example.json",
+			want: Result{Message: "sensor freezer temp 5.2°C exceeds -15°C", Status: StatusFiring, Severity: SeverityWarning, Key: "freezer/temp"},
+		},
+		{
+			name: "recovery",
+			body: `{"sensor": "freezer", "metric": "temp", "value": -18.5, "unit": "°C", "threshold": -15, "state": "OK"}`,
+			want: Result{Message: "sensor freezer temp -18.5°C back below -15°C", Status: StatusResolved, Severity: SeverityInfo, Key: "freezer/temp"},
+		},
+		{
+			name: "below",
+			body: `{"sensor": "barometer", "metric": "pressure", "value": 980, "unit": "hPa", "threshold": 990, "state": "alarm", "severity": "critical"}`,
+			want: Result{Message: "sensor barometer pressure 980 hPa is below 990 hPa", Status: StatusFiring, Severity: SeverityCritical, Key: "barometer/pressure"},
+		},
+		{
+			name: "without threshold",
+			body: `{"sensor": "cellar", "value": 81, "unit": "%", "state": "triggered"}`,
+			want: Result{Message: "sensor cellar 81% in alert", Status: StatusFiring, Severity: SeverityWarning, Key: "cellar"},
+		},
+		{
+			name: "recovery without threshold",
+			body: `{"sensor": "cellar", "value": 60, "unit": "%", "state": "cleared"}`,
+			want: Result{Message: "sensor cellar 60% back to normal", Status: StatusResolved, Severity: SeverityInfo, Key: "cellar"},
+		},
+		{
+			name:       "unknown state",
+			body:       `{"sensor": "freezer", "value": 1, "state": "paused"}`,
+			badRequest: true,
+		},
+		{
+			name:       "without value",
+			body:       `{"sensor": "freezer", "state": "alert"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"sensor": "freezer", "value": "warm"}`,
+			err:  true,
+		},
+	})
+}
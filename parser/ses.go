@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parses amazon ses bounce, complaint and delivery notifications, delivered
+// via sns (with or without raw message delivery)
+func SESParserFunc(r *http.Request) (Result, error) {
+	message, result, err := readSNS(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if result != nil {
+		return *result, nil
+	}
+
+	payload := &struct {
+		// notifications use notificationType, event publishing uses eventType
+		NotificationType string `json:"notificationType"`
+		EventType        string `json:"eventType"`
+		Mail             struct {
+			Timestamp     time.Time `json:"timestamp"`
+			Source        string    `json:"source"`
+			CommonHeaders struct {
+				Subject string `json:"subject"`
+			} `json:"commonHeaders"`
+		} `json:"mail"`
+		Bounce struct {
+			BounceType        string `json:"bounceType"`
+			BounceSubType     string `json:"bounceSubType"`
+			BouncedRecipients []struct {
+				EmailAddress   string `json:"emailAddress"`
+				DiagnosticCode string `json:"diagnosticCode"`
+			} `json:"bouncedRecipients"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"complainedRecipients"`
+			ComplaintFeedbackType string    `json:"complaintFeedbackType"`
+			Timestamp             time.Time `json:"timestamp"`
+		} `json:"complaint"`
+		Delivery struct {
+			Recipients []string  `json:"recipients"`
+			Timestamp  time.Time `json:"timestamp"`
+		} `json:"delivery"`
+	}{}
+
+	// parse the inner message into the payload struct
+	err = json.Unmarshal(message, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	kind := payload.NotificationType
+	if kind == "" {
+		kind = payload.EventType
+	}
+
+	var lines []string
+	var res Result
+	switch kind {
+	case "Bounce":
+		// permanent bounces won't go away by retrying
+		res.Severity = SeverityWarning
+		if payload.Bounce.BounceType == "Transient" {
+			res.Severity = SeverityInfo
+		}
+		for _, rcpt := range payload.Bounce.BouncedRecipients {
+			line := "Bounce: " + rcpt.EmailAddress + " (" + strings.ToLower(payload.Bounce.BounceType) + ")"
+			if rcpt.DiagnosticCode != "" {
+				line += " - " + rcpt.DiagnosticCode
+			}
+			lines = append(lines, line)
+		}
+		res.Time = payload.Bounce.Timestamp
+	case "Complaint":
+		res.Severity = SeverityWarning
+		for _, rcpt := range payload.Complaint.ComplainedRecipients {
+			line := "Complaint: " + rcpt.EmailAddress
+			if payload.Complaint.ComplaintFeedbackType != "" {
+				line += " (" + payload.Complaint.ComplaintFeedbackType + ")"
+			}
+			lines = append(lines, line)
+		}
+		res.Time = payload.Complaint.Timestamp
+	case "Delivery":
+		res.Severity = SeverityInfo
+		for _, rcpt := range payload.Delivery.Recipients {
+			lines = append(lines, "Delivery: "+rcpt)
+		}
+		res.Time = payload.Delivery.Timestamp
+	default:
+		return Result{}, BadRequestError{Reason: "unsupported ses notification type " + kind}
+	}
+	if len(lines) == 0 {
+		return Result{}, BadRequestError{Reason: "ses notification without recipients"}
+	}
+
+	// add the original mail for context
+	if s := payload.Mail.CommonHeaders.Subject; s != "" {
+		lines = append(lines, "Mail from "+payload.Mail.Source+": "+s)
+	} else if payload.Mail.Source != "" {
+		lines = append(lines, "Mail from "+payload.Mail.Source)
+	}
+	if res.Time.IsZero() {
+		res.Time = payload.Mail.Timestamp
+	}
+	res.Message = strings.Join(lines, "\n")
+	return res, nil
+}
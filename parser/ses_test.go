@@ -0,0 +1,44 @@
+package parser
+
+import "testing"
+
+func TestSESParserFunc(t *testing.T) {
+	testParser(t, SESParserFunc, []parserTest{
+		{
+			name: "bounce",
+			file: "ses-bounce-example.json",
+			want: Result{Message: "Bounce: jane@example.com (permanent) - smtp; 550 5.1.1 user unknown\nMail from alerts@example.org: Your weekly report", Severity: SeverityWarning},
+		},
+		{
+			name: "complaint",
+			file: "ses-complaint-example.json",
+			want: Result{Message: "Complaint: richard@example.com (abuse)\nMail from alerts@example.org: Your weekly report", Severity: SeverityWarning},
+		},
+		{
+			name:        "subscription confirmation",
+			file:        "sns-subscription-example.json",
+			contentType: "text/plain",
+			want:        Result{Message: "SNS subscription to arn:aws:sns:us-west-2:123456789012:ses-notifications needs to be confirmed: https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription&TopicArn=arn:aws:sns:us-west-2:123456789012:ses-notifications&Token=2336412f37"},
+		},
+		{
+			name: "raw transient bounce",
+			body: `{"notificationType": "Bounce", "bounce": {"bounceType": "Transient", "bouncedRecipients": [{"emailAddress": "bob@example.com"}]}, "mail": {"source": "alerts@example.org"}}`,
+			want: Result{Message: "Bounce: bob@example.com (transient)\nMail from alerts@example.org", Severity: SeverityInfo},
+		},
+		{
+			name: "raw delivery event",
+			body: `{"eventType": "Delivery", "delivery": {"recipients": ["a@example.com", "b@example.com"]}}`,
+			want: Result{Message: "Delivery: a@example.com\nDelivery: b@example.com", Severity: SeverityInfo},
+		},
+		{
+			name:       "unsupported type",
+			body:       `{"notificationType": "Open"}`,
+			badRequest: true,
+		},
+		{
+			name:       "without recipients",
+			body:       `{"notificationType": "Complaint", "complaint": {}}`,
+			badRequest: true,
+		},
+	})
+}
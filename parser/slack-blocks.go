@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// text object of a block kit block
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// block kit layout block (only the commonly used parts)
+type slackBlock struct {
+	Type     string            `json:"type"`
+	Text     *slackText        `json:"text"`
+	Fields   []slackText       `json:"fields"`
+	Elements []json.RawMessage `json:"elements"`
+}
+
+// links (<url|text>, <url>) and special mentions (<!here>) in mrkdwn
+var slackLinkRegex = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]+))?>`)
+
+// converts mrkdwn to XEP-0393 message styling, which already uses the same
+// markers for bold, italic, strike and code, so only links need to be rewritten
+func mrkdwnToStyling(s string) string {
+	s = slackLinkRegex.ReplaceAllStringFunc(s, func(m string) string {
+		parts := slackLinkRegex.FindStringSubmatch(m)
+		target, label := parts[1], parts[2]
+		switch {
+		case strings.HasPrefix(target, "!"):
+			// <!here>, <!channel>, <!subteam^ID|@team>
+			if label != "" {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!")
+		case strings.HasPrefix(target, "@") || strings.HasPrefix(target, "#"):
+			// user and channel mentions
+			if label != "" {
+				return label
+			}
+			return target
+		case label != "":
+			return label + " (" + target + ")"
+		default:
+			return target
+		}
+	})
+	// entities slack escapes in text
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(s)
+}
+
+// returns the text of a text object
+func (t slackText) String() string {
+	if t.Type == "mrkdwn" {
+		return mrkdwnToStyling(t.Text)
+	}
+	return t.Text
+}
+
+// flattens a list of blocks into plain text, unknown block types are
+// included if they have a text, otherwise they're skipped
+func flattenSlackBlocks(blocks []slackBlock) string {
+	var parts []string
+	for _, block := range blocks {
+		var part string
+		switch block.Type {
+		case "header":
+			if block.Text != nil {
+				part = "*" + block.Text.Text + "*"
+			}
+		case "divider":
+			part = "---"
+		case "context":
+			var texts []string
+			for _, raw := range block.Elements {
+				// only text objects, images etc. are skipped
+				var element slackText
+				if json.Unmarshal(raw, &element) == nil && element.Text != "" {
+					texts = append(texts, element.String())
+				}
+			}
+			part = strings.Join(texts, " ")
+		default:
+			var lines []string
+			if block.Text != nil {
+				lines = append(lines, block.Text.String())
+			}
+			for _, field := range block.Fields {
+				lines = append(lines, field.String())
+			}
+			part = strings.Join(lines, "\n")
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
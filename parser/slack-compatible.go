@@ -7,38 +7,47 @@ import (
 	"net/http"
 )
 
-func SlackParserFunc(r *http.Request) (string, error) {
+func SlackParserFunc(r *http.Request) (Result, error) {
 	// get alert data from request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return "", errors.New(readErr)
+		return Result{}, errors.New(readErr)
 	}
 
 	alert := struct {
-		Text        string `json:"text"`
+		Text        string       `json:"text"`
+		Blocks      []slackBlock `json:"blocks"`
 		Attachments []struct {
-			Title     string `json:"title"`
-			TitleLink string `json:"title_link"`
-			Text      string `json:"text"`
+			Title     string       `json:"title"`
+			TitleLink string       `json:"title_link"`
+			Text      string       `json:"text"`
+			Blocks    []slackBlock `json:"blocks"`
 		} `json:"attachments"`
 	}{}
 
 	// parse body into the alert struct
 	err = json.Unmarshal(body, &alert)
 	if err != nil {
-		return "", errors.New(parseErr)
+		return Result{}, errors.New(parseErr)
 	}
 
-	// construct alert message
+	// construct alert message, text is only a fallback if there are blocks
 	message := alert.Text
+	if len(alert.Blocks) > 0 {
+		message = flattenSlackBlocks(alert.Blocks)
+	}
 	for _, attachment := range alert.Attachments {
 		if len(message) > 0 {
 			message = message + "\n"
 		}
+		if len(attachment.Blocks) > 0 {
+			message += flattenSlackBlocks(attachment.Blocks)
+			continue
+		}
 		message += attachment.Title + "\n"
 		message += attachment.TitleLink + "\n\n"
 		message += attachment.Text
 	}
 
-	return message, nil
+	return Result{Message: message}, nil
 }
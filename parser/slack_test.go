@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestSlackParserFunc(t *testing.T) {
+	testParser(t, SlackParserFunc, []parserTest{
+		{
+			name: "block kit",
+			file: "slack-blocks-example.json",
+			want: Result{Message: "*Deployment finished*\n\n*shop* was deployed to _production_ by @U024BE7LH, see build #1234 (https://ci.example.com/builds/1234)\n*Version:*\n`v1.4.2`\n*Duration:*\n4m 12s\n\n---\n\nSent by @here & the CI"},
+		},
+		{
+			name: "legacy attachments",
+			file: "slack-compatible-notification-example.json",
+			want: Result{Message: "Applied flux changes to cluster\nhttps://GITURL/USERNAME/kubernetes/commit/COMMITSHA\n\nEvent: Sync: 0f34755, jabber:deployment/test\nCommits:\n\n* <https://GITURL/USERNAME/kubernetes/commit/COMMITSHA>: change test to test webhook\n\nResources updated:\n\n* jabber:deployment/test"},
+		},
+		{
+			name: "unknown block types",
+			body: `{"text": "fallback", "blocks": [{"type": "image", "image_url": "https://example.org/a.png"}, {"type": "rich_text_preview", "text": {"type": "plain_text", "text": "still shown"}}]}`,
+			want: Result{Message: "still shown"},
+		},
+		{
+			name: "text only",
+			body: `{"text": "hello *world*"}`,
+			want: Result{Message: "hello *world*"},
+		},
+		{
+			name: "invalid json",
+			body: `{"text": `,
+			err:  true,
+		},
+	})
+}
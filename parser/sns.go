@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// envelope of amazon sns http(s) deliveries
+type snsEnvelope struct {
+	Type         string `json:"Type"`
+	TopicArn     string `json:"TopicArn"`
+	Subject      string `json:"Subject"`
+	Message      string `json:"Message"`
+	Timestamp    string `json:"Timestamp"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+// reads the body of an sns delivery, returns the inner message of
+// notifications and raw message deliveries (which have no envelope), and a
+// result for subscription (un)confirmations, which have no inner message
+func readSNS(r *http.Request) ([]byte, *Result, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, errors.New(readErr)
+	}
+
+	envelope := &snsEnvelope{}
+	err = json.Unmarshal(body, &envelope)
+	if err != nil {
+		return nil, nil, errors.New(parseErr)
+	}
+
+	switch envelope.Type {
+	case "":
+		// raw message delivery
+		return body, nil, nil
+	case "Notification":
+		return []byte(envelope.Message), nil, nil
+	case "SubscriptionConfirmation":
+		// not confirmed automatically, the url is only trusted by a human
+		result := Result{Message: "SNS subscription to " + envelope.TopicArn + " needs to be confirmed: " + envelope.SubscribeURL}
+		if t, err := time.Parse(time.RFC3339, envelope.Timestamp); err == nil {
+			result.Time = t
+		}
+		return nil, &result, nil
+	case "UnsubscribeConfirmation":
+		result := Result{Message: "SNS subscription to " + envelope.TopicArn + " was removed"}
+		return nil, &result, nil
+	}
+	return nil, nil, BadRequestError{Reason: "unsupported sns message type " + envelope.Type}
+}
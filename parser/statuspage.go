@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// severity of the impact of statuspage incidents
+var statuspageImpact = map[string]string{
+	"critical":    SeverityCritical,
+	"major":       SeverityCritical,
+	"minor":       SeverityWarning,
+	"none":        SeverityInfo,
+	"maintenance": SeverityInfo,
+}
+
+// severity of the status of statuspage components, operational resolves
+var statuspageComponents = map[string]string{
+	"major_outage":         SeverityCritical,
+	"partial_outage":       SeverityWarning,
+	"degraded_performance": SeverityWarning,
+	"under_maintenance":    SeverityInfo,
+	"operational":          SeverityInfo,
+}
+
+type statuspageUpdate struct {
+	Body      string     `json:"body"`
+	Status    string     `json:"status"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// parses the webhooks of atlassian statuspage subscriptions, incident updates
+// {"page": {...}, "incident": {"id": ..., "name": ..., "status": "identified", "impact": "major", "shortlink": ..., "incident_updates": [...]}}
+// and component updates {"page": {...}, "component_update": {...}, "component": {"id": ..., "name": ..., "status": "major_outage"}}
+// incidents fire until they're resolved (or get a postmortem)
+func StatuspageParserFunc(r *http.Request) (Result, error) {
+	// get incident data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Page struct {
+			StatusDescription string `json:"status_description"`
+		} `json:"page"`
+		Incident *struct {
+			ID              string             `json:"id"`
+			Name            string             `json:"name"`
+			Status          string             `json:"status"`
+			Impact          string             `json:"impact"`
+			Shortlink       string             `json:"shortlink"`
+			UpdatedAt       *time.Time         `json:"updated_at"`
+			IncidentUpdates []statuspageUpdate `json:"incident_updates"`
+		} `json:"incident"`
+		Component *struct {
+			ID     string `json:"id"`
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"component"`
+		ComponentUpdate struct {
+			CreatedAt *time.Time `json:"created_at"`
+		} `json:"component_update"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	switch {
+	case payload.Incident != nil && payload.Incident.Name != "":
+		incident := payload.Incident
+		result := Result{Key: incident.ID, Status: StatusFiring, Severity: statuspageImpact[incident.Impact]}
+		if result.Severity == "" {
+			result.Severity = SeverityWarning
+		}
+		// the impact comes first, it tells how bad it is
+		title := "[Statuspage] " + incident.Name
+		if impact := strings.ToLower(incident.Impact); impact != "" && impact != "none" {
+			title = "[Statuspage] " + strings.ToUpper(impact[:1]) + impact[1:] + " impact: " + incident.Name
+		}
+		lines := []string{title}
+		status := statuspageStatus(incident.Status)
+		if u := latestStatuspageUpdate(incident.IncidentUpdates); u != nil && u.Body != "" {
+			lines = append(lines, status+": "+strings.TrimSpace(u.Body))
+		} else {
+			lines = append(lines, "Status: "+status)
+		}
+		if incident.Shortlink != "" {
+			lines = append(lines, incident.Shortlink)
+		}
+		switch strings.ToLower(incident.Status) {
+		case "resolved", "postmortem", "completed":
+			result.Status, result.Severity = StatusResolved, SeverityInfo
+		}
+		result.Message = strings.Join(lines, "\n")
+		if incident.UpdatedAt != nil {
+			result.Time = *incident.UpdatedAt
+		}
+		return result, nil
+	case payload.Component != nil && payload.Component.Name != "":
+		component := payload.Component
+		result := Result{Key: component.ID, Status: StatusFiring, Severity: statuspageComponents[component.Status]}
+		if result.Severity == "" {
+			result.Severity = SeverityWarning
+		}
+		if component.Status == "operational" {
+			result.Status = StatusResolved
+		}
+		message := "[Statuspage] Component " + component.Name + ": " + statuspageStatus(component.Status)
+		if d := payload.Page.StatusDescription; d != "" {
+			message += "\nPage: " + d
+		}
+		result.Message = message
+		if payload.ComponentUpdate.CreatedAt != nil {
+			result.Time = *payload.ComponentUpdate.CreatedAt
+		}
+		return result, nil
+	}
+	return Result{}, BadRequestError{Reason: "neither an incident nor a component update"}
+}
+
+// returns the status readable: major_outage -> Major outage
+func statuspageStatus(status string) string {
+	if status == "" {
+		return "Unknown"
+	}
+	status = strings.ReplaceAll(status, "_", " ")
+	return strings.ToUpper(status[:1]) + status[1:]
+}
+
+// returns the latest update of the incident, nil if there is none
+func latestStatuspageUpdate(updates []statuspageUpdate) *statuspageUpdate {
+	var latest *statuspageUpdate
+	for i, u := range updates {
+		if latest == nil || (u.CreatedAt != nil && (latest.CreatedAt == nil || u.CreatedAt.After(*latest.CreatedAt))) {
+			latest = &updates[i]
+		}
+	}
+	return latest
+}
@@ -0,0 +1,48 @@
+package parser
+
+import "testing"
+
+func TestStatuspageParserFunc(t *testing.T) {
+	testParser(t, StatuspageParserFunc, []parserTest{
+		{
+			name: "identified",
+			file: "statuspage-example.json",
+			want: Result{Message: "[Statuspage] Major impact: Login failures on the dashboard\nIdentified: The login failures were caused by an expired certificate of the identity provider, a new one is being rolled out.\nhttp://stspg.io/x3Klm9", Status: StatusFiring, Severity: SeverityCritical, Key: "lbkhbwn21v5q"},
+		},
+		{
+			name: "monitoring without updates",
+			body: `{"incident": {"id": "i1", "name": "Slow API", "status": "monitoring", "impact": "minor"}}`,
+			want: Result{Message: "[Statuspage] Minor impact: Slow API\nStatus: Monitoring", Status: StatusFiring, Severity: SeverityWarning, Key: "i1"},
+		},
+		{
+			name: "resolved",
+			body: `{"incident": {"id": "i1", "name": "Slow API", "status": "resolved", "impact": "minor", "incident_updates": [{"body": "Fixed.", "created_at": "2024-05-14T09:00:00Z"}, {"body": "Watching.", "created_at": "2024-05-14T08:00:00Z"}]}}`,
+			want: Result{Message: "[Statuspage] Minor impact: Slow API\nResolved: Fixed.", Status: StatusResolved, Severity: SeverityInfo, Key: "i1"},
+		},
+		{
+			name: "no impact",
+			body: `{"incident": {"id": "i2", "name": "Maintenance", "status": "investigating", "impact": "none"}}`,
+			want: Result{Message: "[Statuspage] Maintenance\nStatus: Investigating", Status: StatusFiring, Severity: SeverityInfo, Key: "i2"},
+		},
+		{
+			name: "component outage",
+			body: `{"page": {"status_description": "Partial System Outage"}, "component_update": {"old_status": "operational", "new_status": "major_outage"}, "component": {"id": "c1", "name": "API", "status": "major_outage"}}`,
+			want: Result{Message: "[Statuspage] Component API: Major outage\nPage: Partial System Outage", Status: StatusFiring, Severity: SeverityCritical, Key: "c1"},
+		},
+		{
+			name: "component operational",
+			body: `{"component": {"id": "c1", "name": "API", "status": "operational"}}`,
+			want: Result{Message: "[Statuspage] Component API: Operational", Status: StatusResolved, Severity: SeverityInfo, Key: "c1"},
+		},
+		{
+			name:       "neither incident nor component",
+			body:       `{"page": {"id": "p1"}}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"incident": []}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// usage from which on storage alerts without a threshold fire
+const storageDefaultThreshold = 90
+
+// canonical storage alert, the mount (or volume) and used_pct are required
+type storageAlert struct {
+	Host      string          `json:"host"`
+	Mount     string          `json:"mount"`
+	Volume    string          `json:"volume"`
+	UsedPct   json.Number     `json:"used_pct"`
+	Free      json.RawMessage `json:"free"` // bytes, or as given if a string
+	Threshold json.Number     `json:"threshold"`
+	Severity  string          `json:"severity"`
+}
+
+// parses the alerts of disks, volumes and quotas running full (e.g. sent by
+// a cron job, a nas or a monitoring agent):
+// {"host": "db01", "mount": "/var", "used_pct": 92, "free": 8200000000, "threshold": 90}
+func StorageParserFunc(r *http.Request) (Result, error) {
+	// get alert from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var alert storageAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	mount := alert.Mount
+	if mount == "" {
+		mount = alert.Volume
+	}
+	if mount == "" || alert.UsedPct == "" {
+		return Result{}, BadRequestError{Reason: "mount (or volume) and used_pct are required"}
+	}
+	used, err := strconv.ParseFloat(alert.UsedPct.String(), 64)
+	if err != nil {
+		return Result{}, BadRequestError{Reason: "used_pct must be a number"}
+	}
+	threshold := float64(storageDefaultThreshold)
+	if alert.Threshold != "" {
+		threshold, err = strconv.ParseFloat(alert.Threshold.String(), 64)
+		if err != nil || threshold <= 0 || threshold > 100 {
+			return Result{}, BadRequestError{Reason: "threshold must be a percentage"}
+		}
+	}
+	var free string
+	if len(alert.Free) > 0 && string(alert.Free) != "null" {
+		var n float64
+		if json.Unmarshal(alert.Free, &n) == nil {
+			free = formatBytes(n)
+		} else if json.Unmarshal(alert.Free, &free) != nil {
+			return Result{}, BadRequestError{Reason: "free must be a number of bytes or a string"}
+		}
+	}
+
+	// host db01: /var 92% full (threshold 90%)
+	message := mount + " " + formatPercent(used) + " full"
+	key := mount
+	if alert.Host != "" {
+		message = "host " + alert.Host + ": " + message
+		key = alert.Host + ":" + mount
+	}
+	if free != "" {
+		message += ", " + free + " free"
+	}
+	if alert.Threshold != "" {
+		message += " (threshold " + formatPercent(threshold) + ")"
+	}
+
+	// critical from halfway between the threshold and full on, e.g. 95% for 90%
+	result := Result{Message: message, Status: StatusFiring, Key: key}
+	switch {
+	case used >= threshold+(100-threshold)/2:
+		result.Severity = SeverityCritical
+	case used >= threshold:
+		result.Severity = SeverityWarning
+	default:
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	}
+	if s := NormalizeSeverity(alert.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// formats the percentage with at most one decimal, e.g. 92% or 92.5%
+func formatPercent(p float64) string {
+	return strconv.FormatFloat(math.Round(p*10)/10, 'f', -1, 64) + "%"
+}
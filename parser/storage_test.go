@@ -0,0 +1,53 @@
+package parser
+
+import "testing"
+
+func TestStorageParserFunc(t *testing.T) {
+	testParser(t, StorageParserFunc, []parserTest{
+		{
+			name: "warning",
+			file: "storage-example.json",
+			want: Result{Message: "host db01: /var 92% full, 8.2GB free (threshold 90%)", Status: StatusFiring, Severity: SeverityWarning, Key: "db01:/var"},
+		},
+		{
+			name: "critical",
+			body: `{"host": "nas", "volume": "tank/photos", "used_pct": 96.04, "free": "1.2 TiB", "threshold": 90}`,
+			want: Result{Message: "host nas: tank/photos 96% full, 1.2 TiB free (threshold 90%)", Status: StatusFiring, Severity: SeverityCritical, Key: "nas:tank/photos"},
+		},
+		{
+			name: "lower threshold",
+			body: `{"mount": "/home", "used_pct": 85.5, "threshold": 70}`,
+			want: Result{Message: "/home 85.5% full (threshold 70%)", Status: StatusFiring, Severity: SeverityCritical, Key: "/home"},
+		},
+		{
+			name: "resolved",
+			body: `{"host": "db01", "mount": "/var", "used_pct": 71, "threshold": 90}`,
+			want: Result{Message: "host db01: /var 71% full (threshold 90%)", Status: StatusResolved, Severity: SeverityInfo, Key: "db01:/var"},
+		},
+		{
+			name: "default threshold",
+			body: `{"host": "web1", "mount": "/", "used_pct": 90, "severity": "critical"}`,
+			want: Result{Message: "host web1: / 90% full", Status: StatusFiring, Severity: SeverityCritical, Key: "web1:/"},
+		},
+		{
+			name:       "without usage",
+			body:       `{"host": "db01", "mount": "/var"}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid threshold",
+			body:       `{"mount": "/var", "used_pct": 92, "threshold": 900}`,
+			badRequest: true,
+		},
+		{
+			name:       "invalid free",
+			body:       `{"mount": "/var", "used_pct": 92, "free": true}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[1]`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// parses the payload of the recommended DSM webhook template:
+// {"hostname": "nas01", "title": "@@PREFIX@@", "message": "@@TEXT@@", "severity": "warning"}
+// DSM's default template only contains "text", which is used as message then
+func SynologyParserFunc(r *http.Request) (Result, error) {
+	// get notification data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Hostname string `json:"hostname"`
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Text     string `json:"text"`
+		Severity string `json:"severity"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	text := strings.TrimSpace(payload.Message)
+	if text == "" {
+		text = strings.TrimSpace(payload.Text)
+	}
+	if text == "" {
+		return Result{}, BadRequestError{Reason: "notification without message"}
+	}
+
+	// construct notification message
+	var message string
+	title := strings.TrimSpace(payload.Title)
+	// the dsm subject prefix usually contains the hostname already
+	if prefix := "[" + payload.Hostname + "]"; payload.Hostname != "" && !strings.HasPrefix(title, prefix) {
+		message = prefix + " "
+	}
+	if title != "" {
+		message += title + "\n"
+	}
+	message += text
+
+	result := Result{Message: message}
+	if payload.Severity != "" {
+		result.Severity = NormalizeSeverity(payload.Severity)
+	}
+	return result, nil
+}
@@ -0,0 +1,33 @@
+package parser
+
+import "testing"
+
+func TestSynologyParserFunc(t *testing.T) {
+	testParser(t, SynologyParserFunc, []parserTest{
+		{
+			name: "recommended template",
+			file: "synology-example.json",
+			want: Result{Message: "[nas01] Storage Pool 1 degraded\nStorage Pool 1 on nas01 has degraded (total number of drives: 4; number of active drives: 3). Please repair it as soon as possible.", Severity: SeverityWarning},
+		},
+		{
+			name: "default template",
+			body: `{"text": "Test message from Synology DSM"}`,
+			want: Result{Message: "Test message from Synology DSM"},
+		},
+		{
+			name: "hostname in the title",
+			body: `{"hostname": "nas01", "title": "[nas01] Backup succeeded", "message": "Hyper Backup task finished", "severity": "info"}`,
+			want: Result{Message: "[nas01] Backup succeeded\nHyper Backup task finished", Severity: SeverityInfo},
+		},
+		{
+			name: "unknown severity",
+			body: `{"hostname": "nas01", "message": "Disk 2 failed", "severity": "urgent"}`,
+			want: Result{Message: "[nas01] Disk 2 failed", Severity: SeverityUnknown},
+		},
+		{
+			name:       "without message",
+			body:       `{"hostname": "nas01", "title": "Empty"}`,
+			badRequest: true,
+		},
+	})
+}
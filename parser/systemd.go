@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// default number of log lines shown
+const systemdLogLines = 10
+
+// what the results of systemd units mean ($MONITOR_SERVICE_RESULT), exit-code
+// is told by the exit status
+var systemdResults = map[string]string{
+	"timeout":         "timed out",
+	"signal":          "killed by a signal",
+	"core-dump":       "dumped core",
+	"watchdog":        "watchdog timeout",
+	"start-limit-hit": "start limit hit",
+	"oom-kill":        "killed by the OOM killer",
+	"resources":       "out of resources",
+	"protocol":        "protocol violation",
+	"exit-code":       "non-zero exit status",
+}
+
+// details of a failed unit, posted by an OnFailure= unit from the variables
+// systemd passes to it ($MONITOR_UNIT, $MONITOR_SERVICE_RESULT, ...)
+type systemdPayload struct {
+	Unit         string          `json:"unit"`
+	Host         string          `json:"host"`
+	Result       string          `json:"result"`
+	ExitCode     json.RawMessage `json:"exit_code"`   // the exit status, or the code of systemd (exited, killed, dumped)
+	ExitStatus   string          `json:"exit_status"` // the exit status or signal if exit_code is the code of systemd
+	InvocationID string          `json:"invocation_id"`
+	Log          json.RawMessage `json:"log"` // string or array of lines
+	Severity     string          `json:"severity"`
+}
+
+// parses the failed units posted by a systemd OnFailure= (or OnSuccess=) unit:
+// {"unit": "backup.service", "host": "nas", "result": "exit-code", "exit_code": 1, "log": "..."}
+// with the last lines of the log of the unit, failures fire until the unit succeeds
+func SystemdParserFunc(r *http.Request) (Result, error) {
+	return parseSystemd(r, systemdLogLines)
+}
+
+// returns a systemd parser function that shows up to logLines lines of the log
+func NewSystemdParserFunc(logLines int) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		return parseSystemd(r, logLines)
+	}
+}
+
+func parseSystemd(r *http.Request, logLines int) (Result, error) {
+	// get unit data from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var payload systemdPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if payload.Unit == "" {
+		return Result{}, BadRequestError{Reason: "missing unit"}
+	}
+	logs, err := systemdLog(payload.Log)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	exitCode := strings.Trim(string(payload.ExitCode), `"`)
+	if exitCode == "null" {
+		exitCode = ""
+	}
+
+	unit := "unit " + payload.Unit
+	if payload.Host != "" {
+		unit += " on " + payload.Host
+	}
+	result := Result{Status: StatusFiring, Severity: SeverityWarning, Key: payload.Unit}
+	if payload.Host != "" {
+		result.Key = payload.Host + "/" + payload.Unit
+	}
+	var lines []string
+	if payload.Result == "success" || (payload.Result == "" && exitCode == "0") {
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+		lines = append(lines, "[systemd] "+unit+" succeeded")
+	} else {
+		if s := NormalizeSeverity(payload.Severity); payload.Severity != "" && s != SeverityUnknown {
+			result.Severity = s
+		}
+		lines = append(lines, "[systemd] "+unit+" failed"+systemdReason(payload.Result, exitCode, payload.ExitStatus))
+	}
+	if payload.InvocationID != "" {
+		lines = append(lines, "Invocation: "+payload.InvocationID)
+	}
+
+	// only the end of the log, it tells why it failed
+	if len(logs) > logLines {
+		lines = append(lines, fmt.Sprintf("Log (last %d of %d lines):", logLines, len(logs)))
+		logs = logs[len(logs)-logLines:]
+	} else if len(logs) > 0 {
+		lines = append(lines, "Log:")
+	}
+	lines = append(lines, logs...)
+	result.Message = strings.Join(lines, "\n")
+	return result, nil
+}
+
+// returns why the unit failed: " (exit 1)", " (timed out)" or " (killed by SIGTERM)"
+func systemdReason(result string, exitCode string, exitStatus string) string {
+	switch exitCode {
+	case "":
+	case "exited":
+		if exitStatus != "" {
+			return " (exit " + exitStatus + ")"
+		}
+	case "killed", "dumped":
+		if exitStatus != "" {
+			signal := exitStatus
+			if !strings.HasPrefix(signal, "SIG") {
+				signal = "SIG" + signal
+			}
+			if exitCode == "dumped" {
+				return " (dumped core on " + signal + ")"
+			}
+			return " (killed by " + signal + ")"
+		}
+	default:
+		if _, err := strconv.Atoi(exitCode); err == nil {
+			return " (exit " + exitCode + ")"
+		}
+	}
+	if reason, ok := systemdResults[result]; ok {
+		return " (" + reason + ")"
+	}
+	if result != "" {
+		return " (" + result + ")"
+	}
+	return ""
+}
+
+// returns the non-empty lines of the log, given as string or array of lines
+func systemdLog(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var entries []string
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		entries = strings.Split(s, "\n")
+	} else if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, e := range entries {
+		for _, l := range strings.Split(e, "\n") {
+			if l = strings.TrimRight(l, " \r\t"); l != "" {
+				lines = append(lines, l)
+			}
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSystemdParserFunc(t *testing.T) {
+	testParser(t, SystemdParserFunc, []parserTest{
+		{
+			name: "exited",
+			file: "systemd-example.json",
+			want: Result{Message: "[systemd] unit backup.service on nas failed (exit 1)\nInvocation: 5c3f9ad3e2b54e6d8f0d2c7f1b8a4e91\nLog:\n" +
+				"May 14 03:00:01 nas systemd[1]: Starting Nightly backup...\n" +
+				"May 14 03:00:02 nas restic[4711]: repository 3f1a2b3c opened successfully\n" +
+				"May 14 03:12:40 nas restic[4711]: Fatal: unable to save snapshot: sftp: no space left on device\n" +
+				"May 14 03:12:40 nas systemd[1]: backup.service: Main process exited, code=exited, status=1/FAILURE\n" +
+				"May 14 03:12:40 nas systemd[1]: backup.service: Failed with result 'exit-code'.\n" +
+				"May 14 03:12:40 nas systemd[1]: Failed to start Nightly backup.",
+				Status: StatusFiring, Severity: SeverityWarning, Key: "nas/backup.service"},
+		},
+		{
+			name: "numeric exit code",
+			body: `{"unit": "backup.service", "exit_code": 2, "severity": "critical", "log": ["one", "", "two"]}`,
+			want: Result{Message: "[systemd] unit backup.service failed (exit 2)\nLog:\none\ntwo", Status: StatusFiring, Severity: SeverityCritical, Key: "backup.service"},
+		},
+		{
+			name: "killed",
+			body: `{"unit": "worker.service", "result": "signal", "exit_code": "killed", "exit_status": "TERM"}`,
+			want: Result{Message: "[systemd] unit worker.service failed (killed by SIGTERM)", Status: StatusFiring, Severity: SeverityWarning, Key: "worker.service"},
+		},
+		{
+			name: "timeout",
+			body: `{"unit": "sync.timer", "result": "timeout"}`,
+			want: Result{Message: "[systemd] unit sync.timer failed (timed out)", Status: StatusFiring, Severity: SeverityWarning, Key: "sync.timer"},
+		},
+		{
+			name: "success",
+			body: `{"unit": "backup.service", "host": "nas", "result": "success", "exit_code": "exited", "exit_status": "0"}`,
+			want: Result{Message: "[systemd] unit backup.service on nas succeeded", Status: StatusResolved, Severity: SeverityInfo, Key: "nas/backup.service"},
+		},
+		{
+			name:       "without unit",
+			body:       `{"result": "exit-code"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid log",
+			body: `{"unit": "backup.service", "log": 1}`,
+			err:  true,
+		},
+	})
+}
+
+func TestNewSystemdParserFunc(t *testing.T) {
+	r := httptest.NewRequest("POST", "/systemd", strings.NewReader(`{"unit": "backup.service", "exit_code": 1, "log": "one\ntwo\nthree\nfour"}`))
+	result, err := NewSystemdParserFunc(2)(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[systemd] unit backup.service failed (exit 1)\nLog (last 2 of 4 lines):\nthree\nfour"; result.Message != want {
+		t.Errorf("got %q, want %q", result.Message, want)
+	}
+}
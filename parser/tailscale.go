@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// max. age of a signed tailscale request, older ones might be replayed
+const tailscaleMaxAge = 5 * time.Minute
+
+// tailscale events that need an admin to act
+var tailscaleWarnings = map[string]bool{
+	"nodeNeedsApproval":              true,
+	"userNeedsApproval":              true,
+	"nodeKeyExpiringInOneDay":        true,
+	"nodeKeyExpired":                 true,
+	"exitNodeIPForwardingNotEnabled": true,
+	"subnetIPForwardingNotEnabled":   true,
+}
+
+type tailscaleEvent struct {
+	Timestamp *time.Time `json:"timestamp"`
+	Type      string     `json:"type"`
+	Tailnet   string     `json:"tailnet"`
+	Message   string     `json:"message"`
+	Data      struct {
+		NodeID     string `json:"nodeID"`
+		DeviceName string `json:"deviceName"`
+		User       string `json:"user"`
+		Actor      string `json:"actor"`
+		URL        string `json:"url"`
+	} `json:"data"`
+}
+
+// parses the webhook events of tailscale, a json array of events (or an object with an
+// events array): [{"type": "nodeNeedsApproval", "tailnet": ..., "message": ..., "data": {...}}],
+// every event is sent as a separate message
+func TailscaleParserFunc(r *http.Request) (Result, error) {
+	// get events from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var events []tailscaleEvent
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		payload := &struct {
+			Events []tailscaleEvent `json:"events"`
+		}{}
+		err = json.Unmarshal(body, &payload)
+		events = payload.Events
+	} else {
+		err = json.Unmarshal(body, &events)
+	}
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	var results []Result
+	for _, e := range events {
+		if e.Type == "" && e.Message == "" {
+			continue
+		}
+		results = append(results, tailscaleResult(e))
+	}
+	switch len(results) {
+	case 0:
+		return Result{}, BadRequestError{Reason: "no tailscale events"}
+	case 1:
+		return results[0], nil
+	}
+	return Result{Results: results}, nil
+}
+
+// returns the message of a tailscale event:
+// [Tailscale] Node gp-laptop needs approval (example.com)
+func tailscaleResult(e tailscaleEvent) Result {
+	message := e.Message
+	if message == "" {
+		message = e.Type
+	}
+	message = "[Tailscale] " + message
+	if e.Tailnet != "" {
+		message += " (" + e.Tailnet + ")"
+	}
+	var details []string
+	if e.Data.DeviceName != "" {
+		details = append(details, "Device: "+e.Data.DeviceName)
+	}
+	if e.Data.User != "" {
+		details = append(details, "User: "+e.Data.User)
+	}
+	if e.Data.Actor != "" {
+		details = append(details, "By: "+e.Data.Actor)
+	}
+	if e.Data.URL != "" {
+		details = append(details, e.Data.URL)
+	}
+	if len(details) > 0 {
+		message += "\n" + strings.Join(details, "\n")
+	}
+
+	result := Result{Message: message, Severity: SeverityInfo, Key: e.Type}
+	if e.Data.NodeID != "" {
+		result.Key += "/" + e.Data.NodeID
+	}
+	if tailscaleWarnings[e.Type] {
+		result.Severity = SeverityWarning
+	}
+	if e.Timestamp != nil {
+		result.Time = *e.Timestamp
+	}
+	return result
+}
+
+// returns a tailscale parser function that rejects requests without a valid
+// Tailscale-Webhook-Signature for the given secret
+func NewTailscaleParserFunc(secret string) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+		if !tailscaleSignatureValid(secret, r.Header.Get("Tailscale-Webhook-Signature"), body, time.Now()) {
+			return Result{}, ForbiddenError{Reason: "invalid tailscale signature"}
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return TailscaleParserFunc(r)
+	}
+}
+
+// checks the signature header "t=<unix time>,v1=<hex hmac-sha256 of "<time>.<body>">",
+// which must not be older than tailscaleMaxAge
+func tailscaleSignatureValid(secret string, header string, body []byte, now time.Time) bool {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			if s, err := hex.DecodeString(kv[1]); err == nil {
+				signatures = append(signatures, s)
+			}
+		}
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(t, 0)); age > tailscaleMaxAge || age < -tailscaleMaxAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(timestamp + "."))
+	_, _ = mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, s := range signatures {
+		if hmac.Equal(s, expected) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTailscaleParserFunc(t *testing.T) {
+	testParser(t, TailscaleParserFunc, []parserTest{
+		{
+			name: "single event",
+			body: `[{"type": "nodeKeyExpired", "tailnet": "example.com", "message": "Node key of web01 expired", "data": {"nodeID": "n1", "deviceName": "web01"}}]`,
+			want: Result{Message: "[Tailscale] Node key of web01 expired (example.com)\nDevice: web01", Severity: SeverityWarning, Key: "nodeKeyExpired/n1"},
+		},
+		{
+			name: "events object",
+			body: `{"events": [{"type": "test", "message": "This is a test event"}]}`,
+			want: Result{Message: "[Tailscale] This is a test event", Severity: SeverityInfo, Key: "test"},
+		},
+		{
+			name: "without message",
+			body: `[{"type": "policyUpdate", "data": {"actor": "alice@example.com"}}]`,
+			want: Result{Message: "[Tailscale] policyUpdate\nBy: alice@example.com", Severity: SeverityInfo, Key: "policyUpdate"},
+		},
+		{
+			name:       "no events",
+			body:       `[]`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `[{"type": 1}]`,
+			err:  true,
+		},
+	})
+}
+
+func TestTailscaleParserFuncEvents(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("..", "dev", "tailscale-example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := TailscaleParserFunc(httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{
+		{
+			Message:  "[Tailscale] Node gp-laptop needs approval (example.com)\nDevice: gp-laptop.example.com\nBy: alice@example.com\nhttps://login.tailscale.com/admin/machines/100.101.102.103",
+			Severity: SeverityWarning,
+			Key:      "nodeNeedsApproval/nJpnrT4CNTRL",
+		},
+		{
+			Message:  "[Tailscale] User bob@example.com approved (example.com)\nUser: bob@example.com\nBy: alice@example.com\nhttps://login.tailscale.com/admin/users",
+			Severity: SeverityInfo,
+			Key:      "userApproved",
+		},
+	}
+	if len(result.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(result.Results), len(want))
+	}
+	for i, w := range want {
+		got := result.Results[i]
+		if got.Message != w.Message || got.Severity != w.Severity || got.Key != w.Key {
+			t.Errorf("event %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if !result.Results[0].Time.Equal(time.Date(2024, 5, 14, 8, 21, 4, 117000000, time.UTC)) {
+		t.Errorf("time: got %s", result.Results[0].Time)
+	}
+}
+
+// returns the tailscale signature header of the body
+func tailscaleSign(secret string, at time.Time, body string) string {
+	ts := fmt.Sprint(at.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + body))
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewTailscaleParserFunc(t *testing.T) {
+	f := NewTailscaleParserFunc("s3cret")
+	body := `[{"type": "test", "message": "This is a test event"}]`
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{name: "valid", signature: tailscaleSign("s3cret", time.Now(), body), valid: true},
+		{name: "wrong secret", signature: tailscaleSign("other", time.Now(), body)},
+		{name: "too old", signature: tailscaleSign("s3cret", time.Now().Add(-10*time.Minute), body)},
+		{name: "malformed", signature: "v1=abc"},
+		{name: "missing"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+		if tt.signature != "" {
+			r.Header.Set("Tailscale-Webhook-Signature", tt.signature)
+		}
+		result, err := f(r)
+		var forbidden ForbiddenError
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.valid && result.Message != "[Tailscale] This is a test event":
+			t.Errorf("%s: got %q", tt.name, result.Message)
+		case !tt.valid && !errors.As(err, &forbidden):
+			t.Errorf("%s: expected a ForbiddenError, got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// template read from a file, can be reloaded at runtime
+type TemplateFile struct {
+	Path string
+
+	mu       sync.RWMutex
+	tmpl     *template.Template
+	loadedAt time.Time
+	// checks a new template before it replaces the active one, optional
+	validate func(*template.Template) error
+}
+
+// reads and compiles the template file
+func LoadTemplateFile(path string) (*TemplateFile, error) {
+	t := &TemplateFile{Path: path}
+	err := t.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// re-reads the template file, the current template stays active if the new
+// one doesn't compile or fails validation
+func (t *TemplateFile) Reload() error {
+	source, err := ioutil.ReadFile(t.Path)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(t.Path)).Parse(string(source))
+	if err != nil {
+		return err
+	}
+	t.mu.RLock()
+	validate := t.validate
+	t.mu.RUnlock()
+	if validate != nil {
+		err = validate(tmpl)
+		if err != nil {
+			return err
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tmpl = tmpl
+	t.loadedAt = time.Now()
+	return nil
+}
+
+// makes reloads check new templates with validate, the active template is checked right away
+func (t *TemplateFile) setValidate(validate func(*template.Template) error) error {
+	err := validate(t.current())
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.validate = validate
+	return nil
+}
+
+// returns the time the active template was loaded
+func (t *TemplateFile) LoadedAt() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.loadedAt
+}
+
+// the template is printed as its path
+func (t *TemplateFile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Path)
+}
+
+func (t *TemplateFile) current() *template.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tmpl
+}
+
+// renders the payload, fails if the message is empty
+func (t *TemplateFile) render(payload interface{}) (string, error) {
+	var message bytes.Buffer
+	err := t.current().Execute(&message, payload)
+	if err != nil {
+		return "", BadRequestError{Reason: "failed to render template " + filepath.Base(t.Path) + ": " + err.Error()}
+	}
+	if strings.TrimSpace(message.String()) == "" {
+		return "", BadRequestError{Reason: "template " + filepath.Base(t.Path) + " rendered an empty message"}
+	}
+	return strings.TrimSpace(message.String()), nil
+}
+
+// returns the data the templates are rendered with: the fields of the body
+// (if it's an object, as before), the body as .Body and the request headers
+// and query parameters as .Headers and .Query, both by name with the values
+// joined by commas; the ones with credentials are left out
+func templateData(r *http.Request, body interface{}) interface{} {
+	fields, ok := body.(map[string]interface{})
+	if !ok {
+		// arrays and other values are passed on as they are
+		return body
+	}
+	headers := make(map[string]string)
+	for name, values := range r.Header {
+		if !SensitiveName(name) {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+	query := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		if !SensitiveName(name) {
+			query[name] = strings.Join(values, ", ")
+		}
+	}
+	data := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		data[k] = v
+	}
+	data["Body"] = body
+	data["Headers"] = headers
+	data["Query"] = query
+	return data
+}
+
+// returns a parser function that renders the JSON body with the template, and
+// with the translated templates (keyed by language tag) if any
+func NewTemplateParserFunc(t *TemplateFile, translations map[string]*TemplateFile) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		// get alert data from request
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return Result{}, errors.New(readErr)
+		}
+
+		// parse body into a generic value, so the template can access any field
+		var payload interface{}
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+		payload = templateData(r, payload)
+
+		// render the message
+		message, err := t.render(payload)
+		if err != nil {
+			return Result{}, err
+		}
+		result := Result{Message: message}
+		for lang, translation := range translations {
+			message, err := translation.render(payload)
+			if err != nil {
+				return Result{}, err
+			}
+			if result.Translations == nil {
+				result.Translations = make(map[string]string)
+			}
+			result.Translations[lang] = message
+		}
+
+		return result, nil
+	}
+}
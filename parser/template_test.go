@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writes the template source to the file
+func writeTemplate(t *testing.T, path string, source string) {
+	t.Helper()
+	err := ioutil.WriteFile(path, []byte(source), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAlertmanagerTemplateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmpp-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alertmanager.tmpl")
+	writeTemplate(t, path, "{{.Status}}: {{.CommonLabels.alertname}}")
+
+	tmpl, err := LoadTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewAlertmanagerParserFunc(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a template referencing a missing field compiles, but fails the check
+	writeTemplate(t, path, "{{.Status}}: {{.Missing}}")
+	if err := tmpl.Reload(); err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+	body := `{"version": "4", "status": "firing", "commonLabels": {"alertname": "DiskFull"}, "alerts": []}`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	result, err := f(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "firing: DiskFull" {
+		t.Errorf("the previous template isn't active anymore: got %q", result.Message)
+	}
+
+	// valid templates replace it
+	writeTemplate(t, path, "{{.CommonLabels.alertname}} is {{.Status}}")
+	if err := tmpl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	result, err = f(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "DiskFull is firing" {
+		t.Errorf("got %q", result.Message)
+	}
+
+	// and invalid ones are rejected at startup
+	writeTemplate(t, path, "{{.Missing}}")
+	invalid, err := LoadTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAlertmanagerParserFunc(invalid); err == nil {
+		t.Error("expected the invalid template to be rejected")
+	}
+}
+
+func TestTemplateParserFuncRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmpp-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.tmpl")
+	writeTemplate(t, path, `[{{index .Headers "X-Environment"}}] {{.host}} {{.Body.state}} via {{.Query.via}}{{index .Headers "Authorization"}}{{index .Headers "X-Hub-Signature"}}{{index .Query "token"}}`)
+	tmpl, err := LoadTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/backup?via=cron&token=s3cret", strings.NewReader(`{"host": "nas", "state": "failed"}`))
+	r.Header.Set("X-Environment", "prod")
+	r.Header.Set("Authorization", "Bearer s3cret")
+	r.Header.Set("X-Hub-Signature", "sha256=abc")
+	result, err := NewTemplateParserFunc(tmpl, nil)(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[prod] nas failed via cron"; result.Message != want {
+		t.Errorf("got %q, want %q", result.Message, want)
+	}
+
+	// other bodies are passed on as they are
+	writeTemplate(t, path, `{{range .}}{{.}} {{end}}`)
+	if err := tmpl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("POST", "/backup", strings.NewReader(`["a", "b"]`))
+	result, err = NewTemplateParserFunc(tmpl, nil)(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "a b" {
+		t.Errorf("got %q", result.Message)
+	}
+}
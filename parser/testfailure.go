@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// number and max. length of the failing tests listed, the rest is summarized
+const (
+	testFailureMaxNames = 5
+	testFailureMaxName  = 100
+)
+
+// canonical result of a test suite run in ci, suite is required
+type testFailure struct {
+	Suite        string   `json:"suite"`
+	Total        int      `json:"total"`
+	Failed       *int     `json:"failed"` // defaults to the number of failing_tests
+	FailingTests []string `json:"failing_tests"`
+	URL          string   `json:"url"`
+	Severity     string   `json:"severity"`
+}
+
+// parses the test results of ci runs, e.g. posted by a step summarizing the
+// junit report:
+// {"suite": "integration", "total": 250, "failed": 3, "failing_tests": ["TestLogin", "TestCheckout"], "url": "https://ci.example.com/runs/42"}
+func TestFailureParserFunc(r *http.Request) (Result, error) {
+	// get test results from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var run testFailure
+	if err := json.Unmarshal(body, &run); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	suite := strings.TrimSpace(run.Suite)
+	if suite == "" {
+		return Result{}, BadRequestError{Reason: "suite is required"}
+	}
+	var tests []string
+	for _, name := range run.FailingTests {
+		if name = strings.TrimSpace(name); name != "" {
+			tests = append(tests, truncate(name, testFailureMaxName))
+		}
+	}
+	failed := len(tests)
+	if run.Failed != nil {
+		failed = *run.Failed
+	}
+	if run.Total < 0 || failed < 0 {
+		return Result{}, BadRequestError{Reason: "total and failed must not be negative"}
+	}
+	if run.Total > 0 && failed > run.Total {
+		return Result{}, BadRequestError{Reason: "failed must not exceed total"}
+	}
+
+	// suite integration: 3/250 failed — TestLogin, TestCheckout and 1 more (https://ci.example.com/runs/42)
+	message := "suite " + suite + ": "
+	result := Result{Status: StatusFiring, Severity: SeverityCritical, Key: suite, Labels: map[string]string{"suite": suite}}
+	if failed == 0 {
+		if run.Total > 0 {
+			message += "all " + plural(run.Total, "test") + " passed"
+		} else {
+			message += "all tests passed"
+		}
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	} else {
+		if run.Total > 0 {
+			message += strconv.Itoa(failed) + "/" + strconv.Itoa(run.Total) + " failed"
+		} else {
+			message += strconv.Itoa(failed) + " failed"
+		}
+		if names := testFailureNames(tests, failed); names != "" {
+			message += " — " + names
+		}
+	}
+	if run.URL != "" {
+		message += " (" + run.URL + ")"
+	}
+	result.Message = message
+	if s := NormalizeSeverity(run.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// lists the first failing tests and counts the others, reports often name
+// fewer than failed
+func testFailureNames(names []string, failed int) string {
+	if len(names) == 0 {
+		return ""
+	}
+	more := failed - len(names)
+	if len(names) > testFailureMaxNames {
+		more = failed - testFailureMaxNames
+		names = names[:testFailureMaxNames]
+	}
+	if more <= 0 {
+		return strings.Join(names, ", ")
+	}
+	return strings.Join(names, ", ") + " and " + strconv.Itoa(more) + " more"
+}
@@ -0,0 +1,48 @@
+package parser
+
+import "testing"
+
+func TestTestFailureParserFunc(t *testing.T) {
+	testParser(t, TestFailureParserFunc, []parserTest{
+		{
+			name: "failed",
+			file: "tests-example.json",
+			want: Result{Message: "suite integration: 3/250 failed — TestLogin, TestCheckout, TestRefund (https://ci.example.com/runs/42)", Status: StatusFiring, Severity: SeverityCritical, Key: "integration"},
+		},
+		{
+			name: "more failures than listed",
+			body: `{"suite": "unit", "total": 1200, "failed": 9, "failing_tests": ["TestA", "TestB", "TestC", "TestD", "TestE", "TestF", "TestG"]}`,
+			want: Result{Message: "suite unit: 9/1200 failed — TestA, TestB, TestC, TestD, TestE and 4 more", Status: StatusFiring, Severity: SeverityCritical, Key: "unit"},
+		},
+		{
+			name: "failed without count and total",
+			body: `{"suite": "e2e", "failing_tests": ["checkout flow", " "], "severity": "warning"}`,
+			want: Result{Message: "suite e2e: 1 failed — checkout flow", Status: StatusFiring, Severity: SeverityWarning, Key: "e2e"},
+		},
+		{
+			name: "failed without names",
+			body: `{"suite": "e2e", "total": 40, "failed": 2}`,
+			want: Result{Message: "suite e2e: 2/40 failed", Status: StatusFiring, Severity: SeverityCritical, Key: "e2e"},
+		},
+		{
+			name: "passed",
+			body: `{"suite": "integration", "total": 250, "failed": 0, "url": "https://ci.example.com/runs/43"}`,
+			want: Result{Message: "suite integration: all 250 tests passed (https://ci.example.com/runs/43)", Status: StatusResolved, Severity: SeverityInfo, Key: "integration"},
+		},
+		{
+			name:       "without suite",
+			body:       `{"total": 250, "failed": 3}`,
+			badRequest: true,
+		},
+		{
+			name:       "more failed than total",
+			body:       `{"suite": "unit", "total": 2, "failed": 3}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"suite": "unit", "failing_tests": "TestA"}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+func TwilioParserFunc(r *http.Request) (Result, error) {
+	// get sms data from the form encoded request
+	err := r.ParseForm()
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	from := r.PostForm.Get("From")
+	body := r.PostForm.Get("Body")
+	if from == "" {
+		return Result{}, BadRequestError{Reason: "missing sender"}
+	}
+
+	// construct sms message
+	return Result{Message: "SMS from " + from + ": " + body}, nil
+}
+
+// returns a twilio parser function that rejects requests without a valid
+// X-Twilio-Signature for the given auth token
+func NewTwilioParserFunc(authToken string) ParserFunc {
+	return func(r *http.Request) (Result, error) {
+		err := r.ParseForm()
+		if err != nil {
+			return Result{}, errors.New(parseErr)
+		}
+		signature, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Twilio-Signature"))
+		if err != nil || !hmac.Equal(signature, twilioSignature(authToken, twilioURL(r), r.PostForm)) {
+			return Result{}, ForbiddenError{Reason: "invalid twilio signature"}
+		}
+		return TwilioParserFunc(r)
+	}
+}
+
+// returns the url twilio requested, which might be behind a reverse proxy;
+// X-Forwarded-Proto is trusted from any client, at worst it lets a request
+// be signed for the http instead of the https url (or the other way round),
+// the host, path, query and parameters are still covered by the signature
+func twilioURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// hmac-sha1 of the url followed by all post parameters (sorted by name, name directly followed by value)
+func twilioSignature(authToken string, u string, params url.Values) []byte {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	_, _ = mac.Write([]byte(u))
+	for _, k := range keys {
+		for _, v := range params[k] {
+			_, _ = mac.Write([]byte(k + v))
+		}
+	}
+	return mac.Sum(nil)
+}
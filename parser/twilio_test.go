@@ -0,0 +1,95 @@
+package parser
+
+import "testing"
+
+func TestTwilioParserFunc(t *testing.T) {
+	testParser(t, TwilioParserFunc, []parserTest{
+		{
+			name:        "sms",
+			file:        "twilio-sms-example.txt",
+			contentType: "application/x-www-form-urlencoded",
+			want:        Result{Message: "SMS from +15551234567: Server room temperature is too high!"},
+		},
+		{
+			name:        "without sender",
+			body:        "Body=hello",
+			contentType: "application/x-www-form-urlencoded",
+			badRequest:  true,
+		},
+	})
+}
+
+func TestNewTwilioParserFunc(t *testing.T) {
+	// the example of https://www.twilio.com/docs/usage/security#validating-requests
+	const (
+		target    = "https://mycompany.com/myapp.php?foo=1&bar=2"
+		params    = "CallSid=CA1234567890ABCDE&Caller=%2B12349013030&Digits=1234&From=%2B12349013030&To=%2B18005551212"
+		signature = "0/KCTR6DLpKmkAf8muzZqo1nDgQ="
+		form      = "application/x-www-form-urlencoded"
+	)
+	testParser(t, NewTwilioParserFunc("12345"), []parserTest{
+		{
+			name:        "documented example",
+			target:      target,
+			body:        params,
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": signature},
+			want:        Result{Message: "SMS from +12349013030: "},
+		},
+		{
+			name:        "tampered param",
+			target:      target,
+			body:        "CallSid=CA1234567890ABCDE&Caller=%2B12349013030&Digits=1234&From=%2B10000000000&To=%2B18005551212",
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": signature},
+			forbidden:   true,
+		},
+		{
+			name:        "added param",
+			target:      target,
+			body:        params + "&Body=hello",
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": signature},
+			forbidden:   true,
+		},
+		{
+			name:        "tampered url",
+			target:      "https://mycompany.com/myapp.php?foo=1&bar=3",
+			body:        params,
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": signature},
+			forbidden:   true,
+		},
+		{
+			name:        "missing signature",
+			target:      target,
+			body:        params,
+			contentType: form,
+			forbidden:   true,
+		},
+		{
+			name:        "garbage signature",
+			target:      target,
+			body:        params,
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": "not base64!"},
+			forbidden:   true,
+		},
+		{
+			name:        "https behind a proxy",
+			target:      "http://mycompany.com/myapp.php?foo=1&bar=2",
+			body:        params,
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": signature, "X-Forwarded-Proto": "https"},
+			want:        Result{Message: "SMS from +12349013030: "},
+		},
+		{
+			name:        "https url without the proxy header",
+			target:      "http://mycompany.com/myapp.php?foo=1&bar=2",
+			body:        params,
+			contentType: form,
+			headers:     map[string]string{"X-Twilio-Signature": signature},
+			forbidden:   true,
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// canonical usage alert of llm services, service, metric and value are required
+type usageAlert struct {
+	Service   string      `json:"service"`
+	Metric    string      `json:"metric"`
+	Value     json.Number `json:"value"`
+	Threshold json.Number `json:"threshold"`
+	Window    string      `json:"window"`
+	Currency  string      `json:"currency"`
+	State     string      `json:"state"`
+	Severity  string      `json:"severity"`
+}
+
+// parses the token usage and cost alerts of llm services (e.g. sent by a
+// gateway, a cost exporter or a cron job polling the billing api):
+// {"service": "LLM", "metric": "cost", "value": 142, "threshold": 100, "window": "24h", "state": "alert"}
+func UsageAlertParserFunc(r *http.Request) (Result, error) {
+	// get alert from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var alert usageAlert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+	if alert.Service == "" || alert.Metric == "" || alert.Value == "" {
+		return Result{}, BadRequestError{Reason: "service, metric and value are required"}
+	}
+	// without a state the value tells, reaching the threshold is a breach
+	direction := analyticsDirection("", alert.Value, alert.Threshold)
+	breach := direction == "up" || (direction == "" && alert.Threshold != "" && alert.Value.String() == alert.Threshold.String())
+	if alert.State != "" {
+		var ok bool
+		breach, ok = sensorStates[strings.ToLower(alert.State)]
+		if !ok {
+			return Result{}, BadRequestError{Reason: "unknown state " + alert.State}
+		}
+	} else if alert.Threshold == "" {
+		return Result{}, BadRequestError{Reason: "state or threshold is required"}
+	}
+
+	// LLM cost $142 exceeds $100 (24h window)
+	// LLM tokens 850k back below 1M (1h window)
+	value := formatUsage(alert.Metric, alert.Value, alert.Currency)
+	message := alert.Service + " " + alert.Metric + " " + value
+	threshold := formatUsage(alert.Metric, alert.Threshold, alert.Currency)
+	switch {
+	case breach && direction == "down":
+		message += " is below " + threshold
+	case breach && alert.Threshold != "" && direction == "":
+		message += " reached " + threshold
+	case breach && alert.Threshold != "":
+		message += " exceeds " + threshold
+	case breach:
+		message += " in alert"
+	case direction == "up":
+		message += " back above " + threshold
+	case direction == "down":
+		message += " back below " + threshold
+	default:
+		message += " back to normal"
+	}
+	if alert.Window != "" {
+		message += " (" + alert.Window + " window)"
+	}
+
+	result := Result{Message: message, Status: StatusFiring, Severity: SeverityWarning, Key: alert.Service + "/" + alert.Metric}
+	if alert.Window != "" {
+		result.Key += "/" + alert.Window
+	}
+	if !breach {
+		result.Status, result.Severity = StatusResolved, SeverityInfo
+	}
+	if s := NormalizeSeverity(alert.Severity); s != SeverityUnknown {
+		result.Severity = s
+	}
+	return result, nil
+}
+
+// returns the value of the metric: costs with the currency (usd by default),
+// token and request counts abbreviated (e.g. 1.25M), others as given
+func formatUsage(metric string, value json.Number, currency string) string {
+	switch strings.ToLower(metric) {
+	case "cost", "costs", "spend", "spending":
+		if currency == "" {
+			currency = "USD"
+		}
+		return formatAmount(value.String(), currency)
+	case "tokens", "input_tokens", "output_tokens", "requests":
+		return formatCount(value)
+	}
+	return value.String()
+}
+
+// abbreviates large counts: 850k, 1.25M, 3B
+func formatCount(value json.Number) string {
+	n, err := strconv.ParseFloat(value.String(), 64)
+	if err != nil {
+		return value.String()
+	}
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{{"B", 1e9}, {"M", 1e6}, {"k", 1e3}} {
+		if n >= unit.size || n <= -unit.size {
+			s := strconv.FormatFloat(n/unit.size, 'f', 2, 64)
+			return strings.TrimSuffix(strings.TrimRight(s, "0"), ".") + unit.suffix
+		}
+	}
+	return value.String()
+}
@@ -0,0 +1,53 @@
+package parser
+
+import "testing"
+
+func TestUsageAlertParserFunc(t *testing.T) {
+	testParser(t, UsageAlertParserFunc, []parserTest{
+		{
+			name: "cost breach",
+			file: "usage-example.json",
+			want: Result{Message: "LLM cost $142 exceeds $100 (24h window)", Status: StatusFiring, Severity: SeverityWarning, Key: "LLM/cost/24h"},
+		},
+		{
+			name: "tokens recovery",
+			body: `{"service": "chat-api", "metric": "tokens", "value": 850000, "threshold": 1250000, "window": "1h", "state": "ok"}`,
+			want: Result{Message: "chat-api tokens 850k back below 1.25M (1h window)", Status: StatusResolved, Severity: SeverityInfo, Key: "chat-api/tokens/1h"},
+		},
+		{
+			name: "state from the value",
+			body: `{"service": "openai", "metric": "cost", "value": 99.5, "threshold": 100, "currency": "EUR", "window": "30d"}`,
+			want: Result{Message: "openai cost €99.5 back below €100 (30d window)", Status: StatusResolved, Severity: SeverityInfo, Key: "openai/cost/30d"},
+		},
+		{
+			name: "reached",
+			body: `{"service": "openai", "metric": "requests", "value": 10000, "threshold": 10000, "severity": "critical"}`,
+			want: Result{Message: "openai requests 10k reached 10k", Status: StatusFiring, Severity: SeverityCritical, Key: "openai/requests"},
+		},
+		{
+			name: "other metric",
+			body: `{"service": "LLM", "metric": "latency_p95", "value": 4.2, "state": "firing"}`,
+			want: Result{Message: "LLM latency_p95 4.2 in alert", Status: StatusFiring, Severity: SeverityWarning, Key: "LLM/latency_p95"},
+		},
+		{
+			name:       "without state and threshold",
+			body:       `{"service": "LLM", "metric": "cost", "value": 142}`,
+			badRequest: true,
+		},
+		{
+			name:       "unknown state",
+			body:       `{"service": "LLM", "metric": "cost", "value": 142, "state": "meh"}`,
+			badRequest: true,
+		},
+		{
+			name:       "without metric",
+			body:       `{"service": "LLM", "value": 142, "state": "alert"}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"service": "LLM", "value": "a lot"}`,
+			err:  true,
+		},
+	})
+}
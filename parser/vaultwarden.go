@@ -0,0 +1,239 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// descriptions of the bitwarden event types, which vaultwarden uses too
+var vaultwardenEvents = map[int]string{
+	1000: "User logged in",
+	1001: "User changed the master password",
+	1002: "User updated two-step login",
+	1003: "User disabled two-step login",
+	1004: "User recovered the account from two-step login",
+	1005: "Failed login attempt",
+	1006: "Failed login attempt with wrong two-step login",
+	1007: "User exported the vault",
+	1008: "User updated a temporary password",
+	1100: "Item created",
+	1101: "Item updated",
+	1102: "Item permanently deleted",
+	1103: "Attachment created",
+	1104: "Attachment deleted",
+	1105: "Item shared",
+	1106: "Item collections updated",
+	1107: "Item viewed",
+	1111: "Item password copied",
+	1114: "Item autofilled",
+	1115: "Item moved to trash",
+	1116: "Item restored",
+	1300: "Collection created",
+	1301: "Collection updated",
+	1302: "Collection deleted",
+	1400: "Group created",
+	1401: "Group updated",
+	1402: "Group deleted",
+	1500: "Member invited",
+	1501: "Member confirmed",
+	1502: "Member updated",
+	1503: "Member removed",
+	1504: "Member groups updated",
+	1506: "Member enrolled in account recovery",
+	1507: "Member withdrew from account recovery",
+	1508: "Member master password reset by an admin",
+	1511: "Member revoked",
+	1512: "Member restored",
+	1600: "Organization settings updated",
+	1601: "Organization vault purged",
+	1602: "Organization vault exported",
+	1700: "Policy updated",
+}
+
+// events that might be an attack or the takeover of an account
+var vaultwardenCritical = map[int]bool{
+	1003: true, // 2fa disabled
+	1007: true, // vault exported
+	1508: true, // admin reset the master password
+	1601: true, // organization vault purged
+	1602: true, // organization vault exported
+}
+
+var vaultwardenWarnings = map[int]bool{
+	1001: true, // master password changed
+	1004: true, // 2fa recovered
+	1005: true, // failed login
+	1006: true, // failed 2fa
+	1102: true, // item deleted
+	1503: true, // member removed
+	1511: true, // member revoked
+	1700: true, // policy updated
+}
+
+// names of the bitwarden device types
+var vaultwardenDevices = map[int]string{
+	0:  "Android",
+	1:  "iOS",
+	2:  "Chrome extension",
+	3:  "Firefox extension",
+	4:  "Opera extension",
+	5:  "Edge extension",
+	6:  "Windows desktop",
+	7:  "macOS desktop",
+	8:  "Linux desktop",
+	9:  "Chrome",
+	10: "Firefox",
+	11: "Opera",
+	12: "Edge",
+	13: "Internet Explorer",
+	14: "Unknown browser",
+	15: "Android (Amazon)",
+	16: "Windows (UWP)",
+	17: "Safari",
+	18: "Vivaldi",
+	19: "Vivaldi extension",
+	20: "Safari extension",
+	21: "SDK",
+	22: "Server",
+	23: "Windows CLI",
+	24: "macOS CLI",
+	25: "Linux CLI",
+}
+
+// event of the bitwarden event log, as returned by the organization events api
+// of vaultwarden (deviceType, organizationUserId) or the bitwarden public api
+// (device, memberId), the email of the acting user may be added by the relay
+type vaultwardenEvent struct {
+	Type               int        `json:"type"`
+	ItemID             string     `json:"itemId"`
+	CollectionID       string     `json:"collectionId"`
+	GroupID            string     `json:"groupId"`
+	PolicyID           string     `json:"policyId"`
+	MemberID           string     `json:"memberId"`
+	OrganizationUserID string     `json:"organizationUserId"`
+	ActingUserID       string     `json:"actingUserId"`
+	ActingUserEmail    string     `json:"actingUserEmail"`
+	Date               *time.Time `json:"date"`
+	Device             *int       `json:"device"`
+	DeviceType         *int       `json:"deviceType"`
+	IPAddress          string     `json:"ipAddress"`
+}
+
+// parses vaultwarden (bitwarden) events relayed from the event log: a single
+// event {"type": 1005, "actingUserId": ..., "date": ..., "deviceType": 10, "ipAddress": ...},
+// a json array of events or a list response of the api {"data": [...]}, every event
+// is sent as a separate message
+func VaultwardenParserFunc(r *http.Request) (Result, error) {
+	// get events from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	var events []vaultwardenEvent
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		payload := &struct {
+			Data *[]vaultwardenEvent `json:"data"`
+			vaultwardenEvent
+		}{}
+		err = json.Unmarshal(body, &payload)
+		if payload.Data != nil {
+			events = *payload.Data
+		} else {
+			events = []vaultwardenEvent{payload.vaultwardenEvent}
+		}
+	} else {
+		err = json.Unmarshal(body, &events)
+	}
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	var results []Result
+	for _, e := range events {
+		if e.Type == 0 {
+			continue
+		}
+		results = append(results, vaultwardenResult(e))
+	}
+	switch len(results) {
+	case 0:
+		return Result{}, BadRequestError{Reason: "no vaultwarden events"}
+	case 1:
+		return results[0], nil
+	}
+	return Result{Results: results}, nil
+}
+
+// returns the message of a vaultwarden event, suspicious ones are marked:
+// [Vaultwarden] Suspicious: Failed login attempt
+// User: alice@example.com
+// Device: Firefox
+// IP: 192.0.2.10
+func vaultwardenResult(e vaultwardenEvent) Result {
+	event, ok := vaultwardenEvents[e.Type]
+	if !ok {
+		event = fmt.Sprintf("Event %d", e.Type)
+	}
+	result := Result{Severity: SeverityInfo, Key: fmt.Sprint(e.Type)}
+	switch {
+	case vaultwardenCritical[e.Type]:
+		result.Severity = SeverityCritical
+	case vaultwardenWarnings[e.Type]:
+		result.Severity = SeverityWarning
+	}
+	lines := []string{"[Vaultwarden] " + event}
+	if result.Severity != SeverityInfo {
+		lines[0] = "[Vaultwarden] Suspicious: " + event
+	}
+
+	user := e.ActingUserEmail
+	if user == "" {
+		user = e.ActingUserID
+	}
+	if user != "" {
+		lines = append(lines, "User: "+user)
+		result.Key += "/" + user
+	}
+	member := e.MemberID
+	if member == "" {
+		member = e.OrganizationUserID
+	}
+	for _, target := range []struct{ name, id string }{
+		{"Item", e.ItemID},
+		{"Collection", e.CollectionID},
+		{"Group", e.GroupID},
+		{"Policy", e.PolicyID},
+		{"Member", member},
+	} {
+		if target.id != "" {
+			lines = append(lines, target.name+": "+target.id)
+		}
+	}
+	device := e.DeviceType
+	if device == nil {
+		device = e.Device
+	}
+	if device != nil {
+		name, ok := vaultwardenDevices[*device]
+		if !ok {
+			name = fmt.Sprintf("device type %d", *device)
+		}
+		lines = append(lines, "Device: "+name)
+	}
+	if e.IPAddress != "" {
+		lines = append(lines, "IP: "+e.IPAddress)
+	}
+
+	result.Message = strings.Join(lines, "\n")
+	if e.Date != nil {
+		result.Time = *e.Date
+	}
+	return result
+}
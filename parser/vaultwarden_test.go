@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVaultwardenParserFunc(t *testing.T) {
+	testParser(t, VaultwardenParserFunc, []parserTest{
+		{
+			name: "single event",
+			body: `{"type": 1007, "actingUserId": "u1", "deviceType": 8, "ipAddress": "192.0.2.10"}`,
+			want: Result{Message: "[Vaultwarden] Suspicious: User exported the vault\nUser: u1\nDevice: Linux desktop\nIP: 192.0.2.10", Severity: SeverityCritical, Key: "1007/u1"},
+		},
+		{
+			name: "public api",
+			body: `[{"type": 1503, "memberId": "m1", "actingUserId": "u1", "device": 9}]`,
+			want: Result{Message: "[Vaultwarden] Suspicious: Member removed\nUser: u1\nMember: m1\nDevice: Chrome", Severity: SeverityWarning, Key: "1503/u1"},
+		},
+		{
+			name: "info",
+			body: `{"type": 1100, "itemId": "i1", "actingUserEmail": "bob@example.com"}`,
+			want: Result{Message: "[Vaultwarden] Item created\nUser: bob@example.com\nItem: i1", Severity: SeverityInfo, Key: "1100/bob@example.com"},
+		},
+		{
+			name: "unknown type",
+			body: `{"type": 1900, "deviceType": 99}`,
+			want: Result{Message: "[Vaultwarden] Event 1900\nDevice: device type 99", Severity: SeverityInfo, Key: "1900"},
+		},
+		{
+			name:       "no events",
+			body:       `{"data": []}`,
+			badRequest: true,
+		},
+		{
+			name: "invalid json",
+			body: `{"type": "login"}`,
+			err:  true,
+		},
+	})
+}
+
+func TestVaultwardenParserFuncEvents(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("..", "dev", "vaultwarden-example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := VaultwardenParserFunc(httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{
+		{
+			Message:  "[Vaultwarden] Suspicious: Failed login attempt\nUser: alice@example.com\nDevice: Firefox\nIP: 192.0.2.10",
+			Severity: SeverityWarning,
+			Key:      "1005/alice@example.com",
+		},
+		{
+			Message:  "[Vaultwarden] Member invited\nUser: 8a7b6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d\nMember: 0c1d2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f\nDevice: Chrome\nIP: 198.51.100.7",
+			Severity: SeverityInfo,
+			Key:      "1500/8a7b6c5d-4e3f-4a2b-9c1d-0e9f8a7b6c5d",
+		},
+	}
+	if len(result.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(result.Results), len(want))
+	}
+	for i, w := range want {
+		got := result.Results[i]
+		if got.Message != w.Message || got.Severity != w.Severity || got.Key != w.Key {
+			t.Errorf("event %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if !result.Results[0].Time.Equal(time.Date(2024, 5, 14, 8, 21, 4, 117000000, time.UTC)) {
+		t.Errorf("time: got %s", result.Results[0].Time)
+	}
+}
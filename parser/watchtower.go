@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// container in the watchtower report
+type watchtowerContainer struct {
+	Name           string `json:"name"`
+	ImageName      string `json:"imageName"`
+	CurrentImageID string `json:"currentImageId"`
+	LatestImageID  string `json:"latestImageId"`
+	Error          string `json:"error"`
+}
+
+// returns the short form of an image id (sha256:0123456789ab...)
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// parses the json notification of watchtower (shoutrrr generic service with
+// the json template), the report is only included with WATCHTOWER_NOTIFICATION_REPORT
+func WatchtowerParserFunc(r *http.Request) (Result, error) {
+	// get report from request
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Result{}, errors.New(readErr)
+	}
+
+	payload := &struct {
+		Host   string `json:"host"`
+		Report *struct {
+			Updated []watchtowerContainer `json:"updated"`
+			Failed  []watchtowerContainer `json:"failed"`
+			Fresh   []watchtowerContainer `json:"fresh"`
+			Skipped []watchtowerContainer `json:"skipped"`
+		} `json:"report"`
+		Entries []struct {
+			Message string `json:"message"`
+		} `json:"entries"`
+	}{}
+
+	// parse body into the payload struct
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return Result{}, errors.New(parseErr)
+	}
+
+	var message string
+	if payload.Host != "" {
+		message = "[" + payload.Host + "] "
+	}
+
+	// notifications without report only carry the log entries
+	if payload.Report == nil {
+		var lines []string
+		for _, e := range payload.Entries {
+			lines = append(lines, e.Message)
+		}
+		if len(lines) == 0 {
+			return Result{}, BadRequestError{Reason: "notification without report and entries"}
+		}
+		return Result{Message: message + strings.Join(lines, "\n")}, nil
+	}
+
+	// construct summary, e.g.: Updated 2 containers: web (nginx:latest 0123456789ab→ba9876543210), db unchanged
+	var parts []string
+	for _, c := range payload.Report.Updated {
+		parts = append(parts, fmt.Sprintf("%s (%s %s→%s)", c.Name, c.ImageName, shortImageID(c.CurrentImageID), shortImageID(c.LatestImageID)))
+	}
+	for _, c := range payload.Report.Fresh {
+		parts = append(parts, c.Name+" unchanged")
+	}
+	for _, c := range payload.Report.Skipped {
+		parts = append(parts, c.Name+" skipped")
+	}
+	for _, c := range payload.Report.Failed {
+		parts = append(parts, fmt.Sprintf("%s failed (%s)", c.Name, c.Error))
+	}
+	noun := "containers"
+	if len(payload.Report.Updated) == 1 {
+		noun = "container"
+	}
+	message += fmt.Sprintf("Updated %d %s", len(payload.Report.Updated), noun)
+	if len(parts) > 0 {
+		message += ": " + strings.Join(parts, ", ")
+	}
+
+	result := Result{Message: message, Severity: SeverityInfo}
+	if len(payload.Report.Failed) > 0 {
+		result.Severity = SeverityWarning
+	}
+	return result, nil
+}
@@ -0,0 +1,28 @@
+package parser
+
+import "testing"
+
+func TestWatchtowerParserFunc(t *testing.T) {
+	testParser(t, WatchtowerParserFunc, []parserTest{
+		{
+			name: "report",
+			file: "watchtower-example.json",
+			want: Result{Message: "[docker01] Updated 1 container: web (nginx:latest b6b69a1b0a7f→3f57d9401f8d), db unchanged", Severity: SeverityInfo},
+		},
+		{
+			name: "failed update",
+			body: `{"report": {"updated": [{"name": "web", "imageName": "nginx:1.25", "currentImageId": "sha256:aaaaaaaaaaaaaaaa", "latestImageId": "sha256:bbbbbbbbbbbbbbbb"}, {"name": "api", "imageName": "api:2", "currentImageId": "c1", "latestImageId": "c2"}], "failed": [{"name": "db", "error": "pull access denied"}]}}`,
+			want: Result{Message: "Updated 2 containers: web (nginx:1.25 aaaaaaaaaaaa→bbbbbbbbbbbb), api (api:2 c1→c2), db failed (pull access denied)", Severity: SeverityWarning},
+		},
+		{
+			name: "entries without report",
+			body: `{"host": "docker01", "entries": [{"message": "Watchtower 1.7.1"}, {"message": "Scheduling first run"}]}`,
+			want: Result{Message: "[docker01] Watchtower 1.7.1\nScheduling first run"},
+		},
+		{
+			name:       "empty",
+			body:       `{"host": "docker01"}`,
+			badRequest: true,
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// max. number of sessions of the pool
+const maxSessions = 16
+
+// sessions the chat messages are spread over for high volumes, the first one
+// is the main client (rooms, presence, health); the messages to one recipient
+// always use the same session, so they stay in order
+type sessionPool struct {
+	clients []*xmppClient
+}
+
+// returns a pool of the main client and n-1 extra sessions, connected in the
+// background; dial establishes the session of the extra resource, setup
+// prepares it (extraSessionSetup or, with directed presence, nothing)
+func newSessionPool(main *xmppClient, n int, resource string, setup func(*xmpp.Session) error, handler xmpp.Handler) *sessionPool {
+	p := &sessionPool{clients: []*xmppClient{main}}
+	for i := 1; i < n; i++ {
+		c := newXMPPClient(main.dial, setup, handler)
+		c.sendTimeout = main.sendTimeout
+		c.sendInterval = main.sendInterval
+		c.sends = main.sends
+		// two sessions can't bind the same resource, the server assigns one if none is configured
+		if resource != "" {
+			c.target.resource = fmt.Sprintf("%s-%d", resource, i+1)
+		}
+		p.clients = append(p.clients, c)
+	}
+	return p
+}
+
+// connects the extra sessions and keeps them connected, only the main client
+// gives up after the max. reconnect duration
+func (p *sessionPool) start() {
+	for _, c := range p.clients[1:] {
+		go func(c *xmppClient) {
+			if err := c.connect(); err != nil {
+				log.Printf("failed to connect extra session: %s", err)
+				if c.reconnect(false) == 0 {
+					return
+				}
+			}
+			c.serve()
+		}(c)
+	}
+}
+
+// closes the extra sessions
+func (p *sessionPool) close() {
+	for _, c := range p.clients[1:] {
+		c.close()
+	}
+}
+
+// returns the client for the messages to the recipient, the main client while
+// the session of the recipient is down
+func (p *sessionPool) client(recipient jid.JID) *xmppClient {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(recipient.Bare().String()))
+	c := p.clients[h.Sum32()%uint32(len(p.clients))]
+	if c.current() == nil {
+		return p.clients[0]
+	}
+	return c
+}
+
+// chat message to send and the recipient it is for
+type chatSend struct {
+	recipient jid.JID
+	message   MessageBody
+}
+
+// sends the messages, the sessions in parallel; returns the errors in the
+// order of the messages
+func (p *sessionPool) send(ctx context.Context, sends []chatSend) []error {
+	errs := make([]error, len(sends))
+	bySession := make(map[*xmppClient][]int)
+	for i, s := range sends {
+		c := p.client(s.recipient)
+		bySession[c] = append(bySession[c], i)
+	}
+	var wg sync.WaitGroup
+	for c, indexes := range bySession {
+		wg.Add(1)
+		go func(c *xmppClient, indexes []int) {
+			defer wg.Done()
+			for _, i := range indexes {
+				errs[i] = c.send(ctx, sends[i].message)
+			}
+		}(c, indexes)
+	}
+	wg.Wait()
+	return errs
+}
+
+// presence with a priority
+type priorityPresence struct {
+	stanza.Presence
+	Priority int `xml:"priority"`
+}
+
+// makes the extra session available with a negative priority, so messages to
+// the bare jid (e.g. the replies of the recipients) still go to the main session
+func extraSessionSetup(s *xmpp.Session) error {
+	return s.Encode(context.TODO(), priorityPresence{
+		Presence: stanza.Presence{Type: stanza.AvailablePresence},
+		Priority: -1,
+	})
+}
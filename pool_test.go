@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+// returns a dispatcher sending over a pool of n in-memory sessions
+func testPool(t testing.TB, server *fakeServer, n int) (*dispatcher, []*fakeConn) {
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	pool := newSessionPool(client, n, "webhook", extraSessionSetup, handler)
+	pool.start()
+	t.Cleanup(func() {
+		pool.close()
+		client.close()
+	})
+	for _, c := range pool.clients {
+		for deadline := time.Now().Add(10 * time.Second); c.current() == nil; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the pool to connect")
+			}
+		}
+	}
+	var conns []*fakeConn
+	server.mu.Lock()
+	conns = append(conns, server.conns...)
+	server.mu.Unlock()
+	d := &dispatcher{client: client, pool: pool, presence: newPresenceTracker(), from: jid.MustParse("bot@example.net")}
+	return d, conns
+}
+
+// returns n recipients
+func testRecipients(n int) []jid.JID {
+	var recipients []jid.JID
+	for i := 0; i < n; i++ {
+		recipients = append(recipients, jid.MustParse(fmt.Sprintf("user%d@example.net", i)))
+	}
+	return recipients
+}
+
+func TestSessionPool(t *testing.T) {
+	server := &fakeServer{}
+	d, conns := testPool(t, server, 4)
+	if len(conns) != 4 {
+		t.Fatalf("%d sessions connected, want 4", len(conns))
+	}
+	waitFor(t, "the presence of the extra sessions", func() bool {
+		for _, c := range conns[1:] {
+			if !strings.Contains(c.received(), "<priority>-1</priority>") {
+				return false
+			}
+		}
+		return true
+	})
+
+	recipients := testRecipients(16)
+	for i := 0; i < 2; i++ {
+		if !d.deliver(context.Background(), alertMessage{id: fmt.Sprintf("m%d", i), body: "disk full", recipients: recipients}) {
+			t.Fatal("delivery failed")
+		}
+	}
+	waitFor(t, "the messages", func() bool {
+		var n int
+		for _, c := range conns {
+			n += strings.Count(c.received(), "disk full")
+		}
+		return n == 32
+	})
+
+	// every recipient gets both messages on the same session, and the load is spread
+	used := 0
+	for _, c := range conns {
+		if strings.Contains(c.received(), "disk full") {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("messages sent on %d session(s), want them spread", used)
+	}
+	for _, r := range recipients {
+		sessions := 0
+		for _, c := range conns {
+			if n := strings.Count(c.received(), `to="`+r.String()+`"`); n > 0 {
+				sessions++
+				if n != 2 {
+					t.Errorf("%s got %d message(s) on one session, want 2", r, n)
+				}
+			}
+		}
+		if sessions != 1 {
+			t.Errorf("%s got messages on %d sessions, want 1", r, sessions)
+		}
+	}
+}
+
+func TestSessionPoolFallback(t *testing.T) {
+	server := &fakeServer{}
+	d, _ := testPool(t, server, 2)
+	extra := d.pool.clients[1]
+	var r jid.JID
+	for _, candidate := range testRecipients(16) {
+		if d.pool.client(candidate) == extra {
+			r = candidate
+			break
+		}
+	}
+	extra.close()
+	if c := d.pool.client(r); c != d.client {
+		t.Error("messages of a disconnected session don't go to the main session")
+	}
+}
+
+// sends a message to 16 recipients through a server that takes 1ms per read
+func benchmarkSessions(b *testing.B, n int) {
+	server := &fakeServer{readDelay: time.Millisecond}
+	d, _ := testPool(b, server, n)
+	recipients := testRecipients(16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.deliver(context.Background(), alertMessage{id: fmt.Sprintf("m%d", i), body: "disk full", recipients: recipients})
+	}
+}
+
+func BenchmarkSessions1(b *testing.B) { benchmarkSessions(b, 1) }
+func BenchmarkSessions4(b *testing.B) { benchmarkSessions(b, 4) }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// keeps track of the available resources of our contacts
+type presenceTracker struct {
+	mu        sync.Mutex
+	resources map[string]map[string]int // bare jid -> priorities of the available full jids
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{
+		resources: make(map[string]map[string]int),
+	}
+}
+
+// update the tracked state from an incoming presence stanza
+func (t *presenceTracker) update(p stanza.Presence, priority int) {
+	bare := p.From.Bare().String()
+	full := p.From.String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch p.Type {
+	case stanza.AvailablePresence:
+		if t.resources[bare] == nil {
+			t.resources[bare] = make(map[string]int)
+		}
+		t.resources[bare][full] = priority
+	case stanza.UnavailablePresence:
+		delete(t.resources[bare], full)
+		if len(t.resources[bare]) == 0 {
+			delete(t.resources, bare)
+		}
+	}
+}
+
+// checks if at least one resource of the jid is available
+func (t *presenceTracker) online(j jid.JID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.resources[j.Bare().String()]) > 0
+}
+
+// returns the available resource of the jid with the highest priority, false
+// if none is available (resources with a negative priority don't count)
+func (t *presenceTracker) highestPriority(j jid.JID) (jid.JID, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	best, bestPriority := "", -1
+	for full, priority := range t.resources[j.Bare().String()] {
+		// the lower jid wins a tie, so the choice is stable
+		if priority > bestPriority || (priority == bestPriority && full < best) {
+			best, bestPriority = full, priority
+		}
+	}
+	if best == "" {
+		return jid.JID{}, false
+	}
+	target, err := jid.Parse(best)
+	return target, err == nil
+}
+
+// forget all tracked presence
+func (t *presenceTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resources = make(map[string]map[string]int)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// returns the dialer of the proxy the xmpp connection goes through, from
+// XMPP_PROXY or ALL_PROXY; nil connects directly
+func xmppProxy() (proxy.ContextDialer, *url.URL, error) {
+	u := os.Getenv("XMPP_PROXY")
+	if u == "" {
+		u = os.Getenv("ALL_PROXY")
+	}
+	if u == "" {
+		u = os.Getenv("all_proxy")
+	}
+	if u == "" {
+		return nil, nil, nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return nil, nil, fmt.Errorf("invalid proxy url %q", u)
+	}
+	switch parsed.Scheme {
+	case "socks5", "socks5h":
+		d, err := proxy.FromURL(parsed, &net.Dialer{})
+		if err != nil {
+			return nil, nil, err
+		}
+		// the socks5 dialer of x/net supports contexts
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, nil, errors.New("socks5 dialer without context support")
+		}
+		return cd, parsed, nil
+	case "http":
+		return &connectDialer{proxy: parsed}, parsed, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported proxy scheme %q, use socks5, socks5h or http", parsed.Scheme)
+	}
+}
+
+// tunnels connections through an http proxy with CONNECT
+type connectDialer struct {
+	proxy *url.URL
+}
+
+func (d *connectDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := d.proxy.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+	err = req.Write(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the tunneled data that was read along with the response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// connection whose first bytes were read into the buffer already
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// connects to the xmpp server of the domain through the proxy, the srv
+// records are looked up locally, the domain itself is tried last
+func dialXMPPProxied(ctx context.Context, d proxy.ContextDialer, domain string, useXMPPS bool) (net.Conn, error) {
+	service, port := "xmpp-client", 5222
+	if useXMPPS {
+		service, port = "xmpps-client", 5223
+	}
+	var addrs []string
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, service, "tcp", domain)
+	if err == nil {
+		for _, r := range records {
+			// a single "." target means the service isn't available
+			if r.Target == "." {
+				return nil, fmt.Errorf("%s has no %s service", domain, service)
+			}
+			addrs = append(addrs, net.JoinHostPort(r.Target, strconv.Itoa(int(r.Port))))
+		}
+	}
+	addrs = append(addrs, net.JoinHostPort(domain, strconv.Itoa(port)))
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// max. number of messages held back during quiet hours, the oldest ones are dropped first
+const maxHeldMessages = 1000
+
+var quietHoursMessages = newCounter("xmpp_quiet_hours_messages_total", "Messages that arrived during quiet hours.", "endpoint", "action")
+
+// daily time range during which an endpoint doesn't notify
+type quietHours struct {
+	start    int // minutes since midnight
+	end      int
+	location *time.Location
+}
+
+// parses a comma-separated list of quiet hours per endpoint:
+// grafana=22:00-07:00,nextcloud=20:00-08:00
+func parseQuietHours(s string, location *time.Location) (map[string]*quietHours, error) {
+	hours := make(map[string]*quietHours)
+	for _, q := range strings.Split(s, ",") {
+		if q == "" {
+			continue
+		}
+		i := strings.Index(q, "=")
+		// the endpoint name may contain hyphens too
+		j := -1
+		if i >= 0 {
+			j = strings.Index(q[i+1:], "-")
+		}
+		if i < 1 || j < 0 {
+			return nil, errors.New("quiet hours " + q + " must be given as endpoint=hh:mm-hh:mm")
+		}
+		j += i + 1
+		start, err := parseTimeOfDay(q[i+1 : j])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(q[j+1:])
+		if err != nil {
+			return nil, err
+		}
+		hours[q[:i]] = &quietHours{start: start, end: end, location: location}
+	}
+	return hours, nil
+}
+
+// parses hh:mm into minutes since midnight
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// checks if t is within the quiet hours, ranges may span midnight
+func (q *quietHours) active(t time.Time) bool {
+	t = t.In(q.location)
+	minute := t.Hour()*60 + t.Minute()
+	if q.start <= q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// message held back until its quiet hours are over
+type heldMessage struct {
+	message alertMessage
+	hours   *quietHours
+}
+
+// holds back messages during quiet hours and releases them afterwards
+type quietQueue struct {
+	mu   sync.Mutex
+	held []heldMessage // oldest first
+}
+
+// holds back the message until the quiet hours are over
+func (q *quietQueue) hold(m alertMessage, hours *quietHours) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.held) >= maxHeldMessages {
+		logf(q.held[0].message.source, "dropping message %s held back during quiet hours, too many messages", q.held[0].message.id)
+		q.held = q.held[1:]
+	}
+	q.held = append(q.held, heldMessage{message: m, hours: hours})
+}
+
+// returns (and forgets) the messages whose quiet hours are over at t, in their original order
+func (q *quietQueue) release(t time.Time) []alertMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var released []alertMessage
+	var held []heldMessage
+	for _, h := range q.held {
+		if h.hours.active(t) {
+			held = append(held, h)
+		} else {
+			released = append(released, h.message)
+		}
+	}
+	q.held = held
+	return released
+}
+
+// returns the number of held back messages
+func (q *quietQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.held)
+}
+
+// periodically passes the released messages to the xmpp client until stop is closed
+func (q *quietQueue) run(messages chan<- alertMessage, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case t := <-ticker.C:
+			for _, m := range q.release(t) {
+				messages <- m
+			}
+		}
+	}
+}
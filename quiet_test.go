@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in       string
+		endpoint string
+		start    int
+		end      int
+		err      bool
+	}{
+		{in: "nextcloud=22:00-07:00", endpoint: "nextcloud", start: 22 * 60, end: 7 * 60},
+		{in: "grafana-oncall=22:00-07:30", endpoint: "grafana-oncall", start: 22 * 60, end: 7*60 + 30},
+		{in: "grafana-oncall", err: true},
+		{in: "a-b=22:00", err: true},
+		{in: "=22:00-07:00", err: true},
+		{in: "grafana=25:00-07:00", err: true},
+	}
+	for _, tt := range tests {
+		hours, err := parseQuietHours(tt.in, time.UTC)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+		q, ok := hours[tt.endpoint]
+		if !ok {
+			t.Errorf("%q: no quiet hours for %s", tt.in, tt.endpoint)
+			continue
+		}
+		if q.start != tt.start || q.end != tt.end {
+			t.Errorf("%q: got %d-%d, want %d-%d", tt.in, q.start, q.end, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// max. length of the message excerpts kept for troubleshooting
+const recentExcerptLength = 80
+
+// a message as delivered, for troubleshooting
+type recentMessage struct {
+	Time       time.Time `json:"time"`
+	ID         string    `json:"id"`
+	Endpoint   string    `json:"endpoint"`
+	Severity   string    `json:"severity,omitempty"`
+	Recipients []string  `json:"recipients"` // incl. rooms
+	Excerpt    string    `json:"excerpt"`    // first line, truncated
+	Result     string    `json:"result"`     // sent or failed
+	Failed     []string  `json:"failed,omitempty"`
+	Skipped    []string  `json:"skipped,omitempty"` // with the reason
+}
+
+// keeps the last delivered messages in memory, never on disk
+type recentMessages struct {
+	mu       sync.Mutex
+	messages []recentMessage // ring buffer, next is the oldest once full
+	next     int
+	full     bool
+}
+
+func newRecentMessages(n int) *recentMessages {
+	return &recentMessages{messages: make([]recentMessage, n)}
+}
+
+// remembers the delivery of the message, failed lists the recipients that
+// didn't get it and skipped the ones it wasn't sent to
+func (r *recentMessages) add(m alertMessage, failed []string, skipped []string) {
+	if r == nil {
+		return
+	}
+	recent := recentMessage{
+		Time:     time.Now(),
+		ID:       m.id,
+		Endpoint: m.endpoint,
+		Severity: m.severity,
+		Excerpt:  truncateMessage(strings.SplitN(m.body, "\n", 2)[0], recentExcerptLength),
+		Result:   "sent",
+		Failed:   failed,
+		Skipped:  skipped,
+	}
+	for _, recipient := range m.recipients {
+		recent.Recipients = append(recent.Recipients, recipient.String())
+	}
+	for _, room := range m.rooms {
+		recent.Recipients = append(recent.Recipients, room.jid.String())
+	}
+	if len(failed) > 0 {
+		recent.Result = "failed"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[r.next] = recent
+	r.next = (r.next + 1) % len(r.messages)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// returns the remembered messages, newest first
+func (r *recentMessages) list() []recentMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.messages)
+	}
+	list := make([]recentMessage, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, r.messages[(r.next-i+len(r.messages))%len(r.messages)])
+	}
+	return list
+}
+
+// admin api listing the recently delivered messages
+type recentHandler struct {
+	recent     *recentMessages
+	adminToken string
+}
+
+func (h *recentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r, h.adminToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("unauthorized"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := marshal(h.recent.list())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mellium.im/xmpp/jid"
+)
+
+func TestRecentMessages(t *testing.T) {
+	r := newRecentMessages(3)
+	if got := r.list(); len(got) != 0 {
+		t.Fatalf("got %d messages before the first delivery", len(got))
+	}
+	for i := 1; i <= 5; i++ {
+		r.add(alertMessage{id: fmt.Sprint(i), endpoint: "grafana", body: fmt.Sprintf("message %d\nsecond line", i)}, nil, nil)
+	}
+	got := r.list()
+	if len(got) != 3 {
+		t.Fatalf("got %d messages, want 3", len(got))
+	}
+	for i, want := range []string{"5", "4", "3"} {
+		if got[i].ID != want {
+			t.Errorf("message %d: got id %s, want %s", i, got[i].ID, want)
+		}
+	}
+	if got[0].Excerpt != "message 5" || got[0].Result != "sent" {
+		t.Errorf("got %+v", got[0])
+	}
+
+	r.add(alertMessage{
+		id:         "6",
+		body:       strings.Repeat("x", 200),
+		recipients: []jid.JID{jid.MustParse("alice@example.net"), jid.MustParse("bob@example.net")},
+		rooms:      []room{{jid: jid.MustParse("ops@conference.example.net")}},
+	}, []string{"bob@example.net"}, []string{"carol@example.net (offline)"})
+	latest := r.list()[0]
+	if len([]rune(latest.Excerpt)) != recentExcerptLength {
+		t.Errorf("excerpt of %d characters", len([]rune(latest.Excerpt)))
+	}
+	if latest.Result != "failed" || strings.Join(latest.Recipients, ",") != "alice@example.net,bob@example.net,ops@conference.example.net" {
+		t.Errorf("got %+v", latest)
+	}
+}
+
+func TestRecentHandler(t *testing.T) {
+	r := newRecentMessages(5)
+	r.add(alertMessage{id: "1", endpoint: "alert", body: "disk full"}, nil, nil)
+	h := &recentHandler{recent: r, adminToken: "s3cret"}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/debug/recent", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/debug/recent", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	var list []recentMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Excerpt != "disk full" || list[0].Endpoint != "alert" {
+		t.Errorf("got %s", w.Body)
+	}
+}
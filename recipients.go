@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+
+	"mellium.im/xmpp/jid"
+)
+
+var recipientLimitExceeded = newCounter("xmpp_recipient_limit_exceeded_total", "Messages that exceeded the max. number of recipients.", "endpoint")
+
+// parses a comma-separated list of jids
+func parseRecipients(s string) ([]jid.JID, error) {
+	var recipients []jid.JID
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		recipient, err := jid.Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// checks if the jid belongs to one of the domains, all domains are allowed if nil
+func domainAllowed(j jid.JID, domains []string) bool {
+	if domains == nil {
+		return true
+	}
+	for _, d := range domains {
+		if strings.EqualFold(j.Domainpart(), d) {
+			return true
+		}
+	}
+	return false
+}
+
+// cuts the recipients (rooms last) down to max entries
+func truncateRecipients(recipients []jid.JID, rooms []room, max int) ([]jid.JID, []room) {
+	if len(recipients) > max {
+		return recipients[:max], nil
+	}
+	if len(recipients)+len(rooms) > max {
+		return recipients, rooms[:max-len(recipients)]
+	}
+	return recipients, rooms
+}
+
+// drops repeated recipients and rooms, keeping the first occurrence; with
+// bare, full jids count as their bare jid, so a bare and a full jid of the same
+// account (or two of its resources) get the message once
+func dedupeRecipients(recipients []jid.JID, rooms []room, bare bool) ([]jid.JID, []room) {
+	seen := make(map[string]bool)
+	var unique []jid.JID
+	for _, r := range recipients {
+		key := r.String()
+		if bare {
+			key = r.Bare().String()
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, r)
+	}
+	var uniqueRooms []room
+	for _, r := range rooms {
+		key := "room:" + r.jid.Bare().String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		uniqueRooms = append(uniqueRooms, r)
+	}
+	return unique, uniqueRooms
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+// returns the jids as comma-separated string
+func joinJIDs(jids []jid.JID) string {
+	var s string
+	for i, j := range jids {
+		if i > 0 {
+			s += ","
+		}
+		s += j.String()
+	}
+	return s
+}
+
+func TestDedupeRecipients(t *testing.T) {
+	tests := []struct {
+		recipients string
+		bare       bool
+		want       string
+	}{
+		{recipients: "a@example.com,b@example.com,a@example.com", want: "a@example.com,b@example.com"},
+		{recipients: "a@example.com,a@example.com/phone", want: "a@example.com,a@example.com/phone"},
+		{recipients: "a@example.com/phone,a@example.com,a@example.com/laptop", bare: true, want: "a@example.com/phone"},
+		{recipients: "a@example.com/phone,b@example.com,a@example.com/phone", want: "a@example.com/phone,b@example.com"},
+	}
+	for _, tt := range tests {
+		recipients, err := parseRecipients(tt.recipients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := dedupeRecipients(recipients, nil, tt.bare)
+		if joinJIDs(got) != tt.want {
+			t.Errorf("%q (bare %v): got %q, want %q", tt.recipients, tt.bare, joinJIDs(got), tt.want)
+		}
+	}
+}
+
+func TestDedupeRooms(t *testing.T) {
+	ops := room{jid: jid.MustParse("ops@conference.example.com")}
+	dba := room{jid: jid.MustParse("dba@conference.example.com")}
+	_, rooms := dedupeRecipients(nil, []room{ops, dba, ops}, false)
+	if len(rooms) != 2 || !rooms[0].jid.Equal(ops.jid) || !rooms[1].jid.Equal(dba.jid) {
+		t.Errorf("got %v", rooms)
+	}
+}
+
+// overlapping default recipients and route recipients get the message once
+func TestDispatchSingleDelivery(t *testing.T) {
+	ops := room{jid: jid.MustParse("ops@conference.example.com")}
+	defaults, err := parseRecipients("alice@example.com,bob@example.com,alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, err := parseRoutes("severity=critical -> alice@example.com,ops@conference.example.com,alice@example.com/phone,ops@conference.example.com,bob@example.com", []room{ops})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		severity string
+		bare     bool
+		want     string
+	}{
+		{name: "defaults", severity: parser.SeverityInfo, want: "alice@example.com,bob@example.com"},
+		{name: "route", severity: parser.SeverityCritical, want: "alice@example.com,alice@example.com/phone,bob@example.com"},
+		{name: "route by bare jid", severity: parser.SeverityCritical, bare: true, want: "alice@example.com,bob@example.com"},
+	}
+	for _, tt := range tests {
+		h, messages := testHandler("alert")
+		h.routes = routes
+		h.dedupeBare = tt.bare
+		h.dispatch(context.Background(), parser.Result{Message: "disk full", Severity: tt.severity}, defaults, []room{ops, ops}, true, false, 0, false)
+		m := <-messages
+		if joinJIDs(m.recipients) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, joinJIDs(m.recipients), tt.want)
+		}
+		if len(m.rooms) != 1 {
+			t.Errorf("%s: got %d rooms", tt.name, len(m.rooms))
+		}
+	}
+}
+
+func TestRecipientsField(t *testing.T) {
+	messages := make(chan alertMessage, 10)
+	h := newMessageHandler("alert", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full", Recipients: "carol@example.com"}, nil
+	})
+	h.recipients = []jid.JID{jid.MustParse("ops@example.com")}
+	h.recipientOverride = true
+	h.allowedDomains = []string{"example.com"}
+	h.recipientsField = "notify.to"
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		code   int
+		want   string
+	}{
+		{name: "list", body: `{"notify": {"to": ["alice@example.com", "bob@example.com"]}}`, code: http.StatusOK, want: "alice@example.com,bob@example.com"},
+		{name: "string", body: `{"notify": {"to": "alice@example.com,bob@example.com"}}`, code: http.StatusOK, want: "alice@example.com,bob@example.com"},
+		{name: "missing field", body: `{}`, code: http.StatusOK, want: "carol@example.com"},
+		{name: "query precedence", target: "?recipients=dave@example.com", body: `{"notify": {"to": ["alice@example.com"]}}`, code: http.StatusOK, want: "dave@example.com"},
+		{name: "domain not allowed", body: `{"notify": {"to": ["mallory@example.org"]}}`, code: http.StatusForbidden},
+		{name: "invalid", body: `{"notify": {"to": ["@"]}}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/alert"+tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if m := <-messages; joinJIDs(m.recipients) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, joinJIDs(m.recipients), tt.want)
+		}
+	}
+}
+
+func TestRejectOverride(t *testing.T) {
+	messages := make(chan alertMessage, 10)
+	h := newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full"}, nil
+	})
+	h.recipients = []jid.JID{jid.MustParse("ops@example.com")}
+
+	// ignored by default
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana?recipients=mallory@example.com", strings.NewReader("{}")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	if m := <-messages; joinJIDs(m.recipients) != "ops@example.com" {
+		t.Errorf("got recipients %s", joinJIDs(m.recipients))
+	}
+
+	h.rejectOverride = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana?recipients=mallory@example.com", strings.NewReader("{}")))
+	if w.Code != http.StatusForbidden || len(messages) != 0 {
+		t.Errorf("got %d, %d message(s)", w.Code, len(messages))
+	}
+	// the endpoints with the override still honor it
+	h.recipientOverride = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana?recipients=alice@example.com", strings.NewReader("{}")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	if m := <-messages; joinJIDs(m.recipients) != "alice@example.com" {
+		t.Errorf("got recipients %s", joinJIDs(m.recipients))
+	}
+}
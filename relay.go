@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mellium.im/xmpp/jid"
+)
+
+var messagesRelayed = newCounter("xmpp_messages_relayed_total", "Incoming chat messages relayed to the outbound webhook.", "result")
+
+// posts incoming chat messages to an outbound webhook
+type relay struct {
+	url   string
+	token string // sent as bearer token, optional
+	// jids allowed to send messages that are relayed
+	senders []jid.JID
+}
+
+// payload posted to the outbound webhook
+type relayedMessage struct {
+	From string    `json:"from"`
+	Body string    `json:"body"`
+	Time time.Time `json:"time"`
+}
+
+// checks if messages from the jid are relayed
+func (r *relay) allowed(from jid.JID) bool {
+	for _, s := range r.senders {
+		if s.Bare().Equal(from.Bare()) {
+			return true
+		}
+	}
+	return false
+}
+
+// posts the message to the outbound webhook
+func (r *relay) forward(from jid.JID, body string) error {
+	return postJSON(r.url, r.token, relayedMessage{From: from.Bare().String(), Body: body, Time: time.Now()})
+}
+
+// posts v as json to the outbound webhook, with the bearer token if set
+func postJSON(url string, token string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("outbound webhook answered with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// max. number of firing alerts remembered, the oldest ones are forgotten first
+const maxTrackedAlerts = 1000
+
+// message that was sent for a firing alert
+type trackedAlert struct {
+	key  string
+	id   string // stanza id of the message
+	body string
+	// translated bodies by language tag
+	translations map[string]string
+}
+
+// remembers the messages sent for firing alerts, so the resolved
+// notifications can refer to them
+type alertTracker struct {
+	mu     sync.Mutex
+	max    int
+	order  *list.List // oldest first
+	alerts map[string]*list.Element
+}
+
+func newAlertTracker(max int) *alertTracker {
+	return &alertTracker{
+		max:    max,
+		order:  list.New(),
+		alerts: make(map[string]*list.Element),
+	}
+}
+
+// remembers the message sent for a firing alert, replaces an older message for the same key
+func (t *alertTracker) fire(key string, id string, body string, translations map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.alerts[key]; ok {
+		t.order.Remove(e)
+	}
+	t.alerts[key] = t.order.PushBack(trackedAlert{key: key, id: id, body: body, translations: translations})
+	for t.order.Len() > t.max {
+		oldest := t.order.Front()
+		t.order.Remove(oldest)
+		delete(t.alerts, oldest.Value.(trackedAlert).key)
+	}
+}
+
+// returns and forgets the message sent for the alert
+func (t *alertTracker) resolve(key string) (trackedAlert, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.alerts[key]
+	if !ok {
+		return trackedAlert{}, false
+	}
+	t.order.Remove(e)
+	delete(t.alerts, key)
+	return e.Value.(trackedAlert), true
+}
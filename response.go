@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"text/template"
+)
+
+// response of the webhooks unless XMPP_RESPONSE_TEMPLATE is set
+const defaultResponseTemplate = `{"status":{{json .Status}}}`
+
+var defaultResponse = template.Must(parseResponseTemplate("response", defaultResponseTemplate))
+
+// data of the response templates
+type responseData struct {
+	Endpoint string
+	// "ok", or how the message was handled if the request had a single one,
+	// e.g. "queued (quiet hours)"
+	Status   string
+	Messages []responseMessage
+	// delivery per recipient of all messages, with synchronous delivery only
+	Recipients []recipientResult
+}
+
+// a message of the request and how it was handled
+type responseMessage struct {
+	ID       string // stanza id, empty if the message wasn't sent
+	Message  string
+	Severity string
+	Status   string // firing, resolved or empty
+	Key      string
+	Delivery string // e.g. "ok" or "suppressed (resolved)"
+	// delivery per recipient, with synchronous delivery only
+	Recipients []recipientResult
+
+	// receives the outcome of the delivery with synchronous delivery, nil otherwise
+	result <-chan deliveryResult
+	// why the message was rejected, nil otherwise
+	err error
+}
+
+var responseFuncs = template.FuncMap{
+	// encodes the value as json, e.g. to return the message in a json string
+	"json": func(v interface{}) (string, error) {
+		b, err := marshal(v)
+		return string(b), err
+	},
+}
+
+// parses the response template and renders it once with sample data, so
+// mistakes show up at startup
+func parseResponseTemplate(name string, s string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(responseFuncs).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	sample := responseData{Endpoint: "test", Status: "ok", Messages: []responseMessage{{ID: "id", Message: "test", Delivery: "ok"}}}
+	if err := t.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// writes the rendered response with the status code, as json if it is valid
+// json and as plain text otherwise
+func writeResponse(w http.ResponseWriter, t *template.Template, code int, data responseData) {
+	if t == nil {
+		t = defaultResponse
+	}
+	var body bytes.Buffer
+	if err := t.Execute(&body, data); err != nil {
+		log.Printf("failed to render the response of /%s: %s", data.Endpoint, err)
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(data.Status))
+		return
+	}
+	if json.Valid(body.Bytes()) {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write(body.Bytes())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+)
+
+func TestResponseTemplates(t *testing.T) {
+	results := parser.Result{Results: []parser.Result{
+		{Message: "disk full", Severity: parser.SeverityCritical, Status: parser.StatusFiring},
+		{Message: "cpu <high>", Status: parser.StatusResolved},
+	}}
+	tests := []struct {
+		name        string
+		template    string
+		result      parser.Result
+		suppress    bool
+		want        string
+		contentType string
+	}{
+		{
+			name:        "default",
+			result:      parser.Result{Message: "disk full"},
+			want:        `{"status":"ok"}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "default, suppressed",
+			result:      parser.Result{Message: "disk ok", Status: parser.StatusResolved},
+			suppress:    true,
+			want:        `{"status":"suppressed (resolved)"}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "rendered messages",
+			template:    `{"messages":[{{range $i, $m := .Messages}}{{if $i}},{{end}}{"text":{{json $m.Message}},"status":{{json $m.Delivery}}}{{end}}]}`,
+			result:      results,
+			suppress:    true,
+			want:        `{"messages":[{"text":"disk full","status":"ok"},{"text":"cpu <high>","status":"suppressed (resolved)"}]}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "plain text",
+			template:    `{{.Status}}: {{len .Messages}} message(s) via /{{.Endpoint}}`,
+			result:      results,
+			want:        "ok: 2 message(s) via /test",
+			contentType: "text/plain; charset=utf-8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			messages := make(chan alertMessage, 10)
+			h := newMessageHandler("test", messages, func(*http.Request) (parser.Result, error) { return result, nil })
+			h.suppressResolved = tt.suppress
+			if tt.template != "" {
+				tmpl, err := parseResponseTemplate("test", tt.template)
+				if err != nil {
+					t.Fatal(err)
+				}
+				h.response = tmpl
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("POST", "/test", strings.NewReader("{}")))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("content type: got %q, want %q", got, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestParseResponseTemplate(t *testing.T) {
+	for _, s := range []string{`{{.Status`, `{{.Unknown}}`, `{{json}}`} {
+		if _, err := parseResponseTemplate("test", s); err == nil {
+			t.Errorf("%s: no error", s)
+		}
+	}
+}
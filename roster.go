@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// namespace of the roster (RFC 6121, 2)
+const rosterNamespace = "jabber:iq:roster"
+
+// what the roster check does with recipients that aren't subscribed
+const (
+	rosterWarn      = "warn"
+	rosterSubscribe = "subscribe"
+)
+
+// entry of XMPP_SUBSCRIPTION_APPROVE standing for the configured recipients
+const approveRecipients = "recipients"
+
+type rosterItem struct {
+	JID          string `xml:"jid,attr"`
+	Subscription string `xml:"subscription,attr"` // none, to, from or both
+	Ask          string `xml:"ask,attr"`          // subscribe while a request is pending
+}
+
+type rosterResponse struct {
+	Query struct {
+		Items []rosterItem `xml:"item"`
+	} `xml:"jabber:iq:roster query"`
+}
+
+// fetches the roster of the account, by bare jid
+func fetchRoster(ctx context.Context, c *xmppClient) (map[string]rosterItem, error) {
+	var resp rosterResponse
+	err := c.iq(ctx, stanza.IQ{Type: stanza.GetIQ}, discoQuery{XMLName: xml.Name{Space: rosterNamespace, Local: "query"}}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the roster: %w", err)
+	}
+	roster := make(map[string]rosterItem)
+	for _, item := range resp.Query.Items {
+		if j, err := jid.Parse(item.JID); err == nil {
+			roster[j.Bare().String()] = item
+		}
+	}
+	return roster, nil
+}
+
+// checks the recipients against the roster and warns about the ones without
+// a subscription, some servers drop messages from strangers silently; with
+// subscribe, their subscription is requested too
+// returns the recipients that aren't subscribed
+func checkRoster(ctx context.Context, c *xmppClient, recipients []jid.JID, mode string) ([]jid.JID, error) {
+	roster, err := fetchRoster(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	var missing []jid.JID
+	seen := make(map[string]bool)
+	for _, r := range recipients {
+		bare := r.Bare()
+		if seen[bare.String()] {
+			continue
+		}
+		seen[bare.String()] = true
+		item, ok := roster[bare.String()]
+		switch {
+		case !ok:
+			log.Printf("warning: recipient %s is not in the roster, messages may not arrive", bare)
+		case item.Subscription == "" || item.Subscription == "none":
+			if item.Ask == "subscribe" {
+				log.Printf("warning: recipient %s hasn't approved the subscription yet, messages may not arrive", bare)
+			} else {
+				log.Printf("warning: recipient %s is in the roster without a subscription, messages may not arrive", bare)
+			}
+		default:
+			continue
+		}
+		missing = append(missing, bare)
+		// a pending request doesn't need to be repeated
+		if mode != rosterSubscribe || item.Ask == "subscribe" {
+			continue
+		}
+		err := c.send(ctx, stanza.Presence{To: bare, Type: stanza.SubscribePresence})
+		if err != nil {
+			return missing, err
+		}
+		log.Printf("requested the subscription of %s", bare)
+	}
+	return missing, nil
+}
+
+// checks if the bare jid of j is among the list
+func containsBare(list []jid.JID, j jid.JID) bool {
+	for _, l := range list {
+		if l.Bare().Equal(j.Bare()) {
+			return true
+		}
+	}
+	return false
+}
+
+// decides whose subscription requests are approved: everybody, the configured
+// recipients, or listed jids and domains
+type subscriptionPolicy struct {
+	all        bool
+	recipients []jid.JID
+	jids       []jid.JID
+	domains    []string
+}
+
+// parses the comma-separated entries of XMPP_SUBSCRIPTION_APPROVE: recipients,
+// bare jids, domains or * for everybody
+func parseSubscriptionApprove(s string) ([]string, error) {
+	var entries []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "":
+			continue
+		case e == "*" || e == approveRecipients:
+		case strings.Contains(e, "@"):
+			j, err := jid.Parse(e)
+			if err != nil || j.Resourcepart() != "" {
+				return nil, errors.New("invalid jid " + e + " in XMPP_SUBSCRIPTION_APPROVE, bare jids only")
+			}
+		default:
+			if _, err := jid.New("", e, ""); err != nil || strings.ContainsAny(e, "/ ") {
+				return nil, errors.New("invalid domain " + e + " in XMPP_SUBSCRIPTION_APPROVE")
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// returns the policy of the entries, recipients stands for the given ones
+func newSubscriptionPolicy(entries []string, recipients []jid.JID) subscriptionPolicy {
+	var p subscriptionPolicy
+	for _, e := range entries {
+		switch {
+		case e == "*":
+			p.all = true
+		case e == approveRecipients:
+			p.recipients = recipients
+		case strings.Contains(e, "@"):
+			p.jids = append(p.jids, jid.MustParse(e))
+		default:
+			p.domains = append(p.domains, e)
+		}
+	}
+	return p
+}
+
+// checks if the subscription request of j is approved
+func (p subscriptionPolicy) approves(j jid.JID) bool {
+	if p.all || containsBare(p.recipients, j) || containsBare(p.jids, j) {
+		return true
+	}
+	return p.domains != nil && domainAllowed(j, p.domains)
+}
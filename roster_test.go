@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+func TestCheckRoster(t *testing.T) {
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	defer client.close()
+	answerIQs(t, server.conn(t, 0), func(request string) string {
+		if !strings.Contains(request, rosterNamespace) {
+			return ""
+		}
+		return `<query xmlns="jabber:iq:roster">` +
+			`<item jid="alice@example.net" subscription="both"/>` +
+			`<item jid="bob@example.net" subscription="to"/>` +
+			`<item jid="carol@example.net" subscription="none"/>` +
+			`<item jid="dave@example.net" subscription="none" ask="subscribe"/>` +
+			`</query>`
+	})
+
+	recipients := []jid.JID{
+		jid.MustParse("alice@example.net/phone"),
+		jid.MustParse("bob@example.net"),
+		jid.MustParse("carol@example.net"),
+		jid.MustParse("dave@example.net"),
+		jid.MustParse("erin@example.net"),
+		jid.MustParse("erin@example.net/laptop"),
+	}
+	missing, err := checkRoster(context.Background(), client, recipients, rosterSubscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinJIDs(missing); got != "carol@example.net,dave@example.net,erin@example.net" {
+		t.Errorf("missing %s", got)
+	}
+	waitFor(t, "the subscription requests", func() bool {
+		return strings.Contains(server.conn(t, 0).received(), `to="erin@example.net"`)
+	})
+	received := server.conn(t, 0).received()
+	if !strings.Contains(received, `to="carol@example.net"`) {
+		t.Errorf("no subscription request for carol: %s", received)
+	}
+	// dave's request is still pending
+	if strings.Contains(received, `to="dave@example.net"`) || strings.Contains(received, `to="alice@example.net"`) {
+		t.Errorf("unexpected subscription request: %s", received)
+	}
+	if strings.Count(received, `type="subscribe"`) != 2 {
+		t.Errorf("subscription requests: %s", received)
+	}
+}
+
+func TestSubscriptionPolicy(t *testing.T) {
+	if _, err := parseSubscriptionApprove("alice@example.net/phone"); err == nil {
+		t.Error("full jid was accepted")
+	}
+	if _, err := parseSubscriptionApprove("exa mple.net"); err == nil {
+		t.Error("invalid domain was accepted")
+	}
+	entries, err := parseSubscriptionApprove("recipients, carol@example.org,example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newSubscriptionPolicy(entries, []jid.JID{jid.MustParse("alice@example.net")})
+	for j, want := range map[string]bool{
+		"alice@example.net/phone": true,
+		"bob@example.net":         false,
+		"carol@example.org":       true,
+		"dave@example.com":        true,
+		"eve@sub.example.com":     false,
+	} {
+		if got := p.approves(jid.MustParse(j)); got != want {
+			t.Errorf("%s: got %t, want %t", j, got, want)
+		}
+	}
+	if !newSubscriptionPolicy([]string{"*"}, nil).approves(jid.MustParse("eve@example.org")) {
+		t.Error("* didn't approve")
+	}
+	if newSubscriptionPolicy(nil, nil).approves(jid.MustParse("alice@example.net")) {
+		t.Error("empty policy approved")
+	}
+}
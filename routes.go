@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+// condition on a field of the parsed message
+type routeCondition struct {
+	field string
+	value string
+	re    *regexp.Regexp // used instead of value if set
+}
+
+// recipients of the messages matching all conditions
+type route struct {
+	conditions []routeCondition
+	recipients []jid.JID
+	rooms      []room
+}
+
+// parses the routing rules, separated by semicolons:
+// labels.team=db -> dba@conference.example.org; endpoint=grafana,severity~^(critical|warning)$ -> alice@example.org
+// targets that are configured rooms are sent to the room
+func parseRoutes(s string, rooms []room) ([]route, error) {
+	var routes []route
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		i := strings.Index(rule, "->")
+		if i < 0 {
+			return nil, errors.New("route " + rule + " must be given as conditions -> recipients")
+		}
+		var r route
+		for _, c := range strings.Split(rule[:i], ",") {
+			c = strings.TrimSpace(c)
+			if j := strings.IndexAny(c, "=~"); j > 0 {
+				condition := routeCondition{field: c[:j], value: c[j+1:]}
+				if c[j] == '~' {
+					re, err := regexp.Compile(condition.value)
+					if err != nil {
+						return nil, errors.New("invalid regex in route " + rule + ": " + err.Error())
+					}
+					condition.re = re
+				}
+				r.conditions = append(r.conditions, condition)
+				continue
+			}
+			return nil, errors.New("condition " + c + " must be given as field=value or field~regex")
+		}
+		recipients, err := parseRecipients(rule[i+2:])
+		if err != nil {
+			return nil, err
+		}
+		for _, recipient := range recipients {
+			if rm, ok := findRoom(rooms, recipient); ok {
+				r.rooms = append(r.rooms, rm)
+			} else {
+				r.recipients = append(r.recipients, recipient)
+			}
+		}
+		if len(r.recipients)+len(r.rooms) == 0 {
+			return nil, errors.New("route " + rule + " has no recipients")
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// returns the configured room with the jid
+func findRoom(rooms []room, j jid.JID) (room, bool) {
+	for _, r := range rooms {
+		if r.jid.Equal(j.Bare()) {
+			return r, true
+		}
+	}
+	return room{}, false
+}
+
+// returns the fields conditions can refer to
+func routeFields(endpoint string, result parser.Result) map[string]string {
+	severity := result.Severity
+	if severity == "" {
+		severity = parser.SeverityUnknown
+	}
+	fields := map[string]string{
+		"endpoint": endpoint,
+		"severity": severity,
+		"status":   result.Status,
+	}
+	for name, value := range result.Labels {
+		fields["labels."+name] = value
+	}
+	return fields
+}
+
+// returns the first route matching the fields, nil if none matches
+func matchRoute(routes []route, fields map[string]string) *route {
+	for i, r := range routes {
+		matches := true
+		for _, c := range r.conditions {
+			value := fields[c.field]
+			if (c.re != nil && !c.re.MatchString(value)) || (c.re == nil && value != c.value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return &routes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"mellium.im/sasl"
+)
+
+// PLAIN isn't included, it has to be enabled explicitly
+const defaultSASLMechanisms = "SCRAM-SHA-256-PLUS,SCRAM-SHA-256,SCRAM-SHA-1-PLUS,SCRAM-SHA-1"
+
+// supported sasl mechanisms by name
+var saslMechanisms = map[string]sasl.Mechanism{
+	sasl.ScramSha256Plus.Name: sasl.ScramSha256Plus,
+	sasl.ScramSha256.Name:     sasl.ScramSha256,
+	sasl.ScramSha1Plus.Name:   sasl.ScramSha1Plus,
+	sasl.ScramSha1.Name:       sasl.ScramSha1,
+	sasl.Plain.Name:           sasl.Plain,
+}
+
+// parses a comma-separated list of sasl mechanisms, in order of preference
+func parseSASLMechanisms(s string) ([]sasl.Mechanism, error) {
+	var mechanisms []sasl.Mechanism
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		m, ok := saslMechanisms[name]
+		if !ok {
+			return nil, errors.New("unsupported sasl mechanism " + name)
+		}
+		mechanisms = append(mechanisms, m)
+	}
+	if len(mechanisms) == 0 {
+		return nil, errors.New("no sasl mechanisms configured")
+	}
+	return mechanisms, nil
+}
+
+// returns the names of the mechanisms
+func saslMechanismNames(mechanisms []sasl.Mechanism) string {
+	var names []string
+	for _, m := range mechanisms {
+		names = append(names, m.Name)
+	}
+	return strings.Join(names, ", ")
+}
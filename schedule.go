@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// max. number of messages scheduled for later delivery
+const maxScheduledMessages = 1000
+
+// delivery of the messages scheduled for later
+const deliveryScheduled = "scheduled"
+
+var errTooManyScheduled = errors.New("too many scheduled messages")
+
+var scheduledMessages = newGauge("xmpp_scheduled_messages", "Messages scheduled for later delivery.")
+
+// message to be sent at the given time
+type scheduledMessage struct {
+	message alertMessage
+	at      time.Time
+}
+
+// holds the messages scheduled for later delivery (deliver_at), in memory only
+type scheduler struct {
+	mu        sync.Mutex
+	scheduled []scheduledMessage // by time, in their original order for the same time
+	// slots reserved by the requests being handled, see reserve
+	reserved int
+	// wakes up run when an earlier message was scheduled
+	wake chan struct{}
+}
+
+// returns new, empty scheduler
+func newScheduler() *scheduler {
+	return &scheduler{wake: make(chan struct{}, 1)}
+}
+
+// reserves n slots for the messages of a request, so either all of them can be
+// scheduled or the request is rejected before any is; the slots count until
+// they're released, also the ones being used meanwhile
+func (s *scheduler) reserve(n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.scheduled)+s.reserved+n > maxScheduledMessages {
+		return errTooManyScheduled
+	}
+	s.reserved += n
+	return nil
+}
+
+// releases the slots reserved for a request
+func (s *scheduler) release(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserved -= n
+}
+
+// schedules the message for the given time, fails if too many are scheduled
+func (s *scheduler) schedule(m alertMessage, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.scheduled) >= maxScheduledMessages {
+		return errTooManyScheduled
+	}
+	i := sort.Search(len(s.scheduled), func(i int) bool { return s.scheduled[i].at.After(at) })
+	s.scheduled = append(s.scheduled, scheduledMessage{})
+	copy(s.scheduled[i+1:], s.scheduled[i:])
+	s.scheduled[i] = scheduledMessage{message: m, at: at}
+	scheduledMessages.set(float64(len(s.scheduled)))
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// returns (and forgets) the messages that are due at t; they count as
+// created at their time, so they expire from then on and aren't stamped as delayed
+func (s *scheduler) due(t time.Time) []alertMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []alertMessage
+	for len(s.scheduled) > 0 && !s.scheduled[0].at.After(t) {
+		m := s.scheduled[0].message
+		m.created = s.scheduled[0].at
+		due = append(due, m)
+		s.scheduled = s.scheduled[1:]
+	}
+	scheduledMessages.set(float64(len(s.scheduled)))
+	return due
+}
+
+// returns the time of the next message, zero if none is scheduled
+func (s *scheduler) next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.scheduled) == 0 {
+		return time.Time{}
+	}
+	return s.scheduled[0].at
+}
+
+// returns the number of scheduled messages
+func (s *scheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.scheduled)
+}
+
+// passes the messages to the xmpp client when they are due, until stop is closed
+func (s *scheduler) run(messages chan<- alertMessage, stop <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		// sleep until the next message, or until one is scheduled
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next := s.next(); !next.IsZero() {
+			timer.Reset(time.Until(next))
+		} else {
+			timer.Reset(time.Hour)
+		}
+		select {
+		case <-stop:
+			return
+		case <-s.wake:
+		case <-timer.C:
+			for _, m := range s.due(time.Now()) {
+				logf(m.source, "sending message %s scheduled for %s", m.id, m.created.Format(time.RFC3339))
+				messages <- m
+			}
+		}
+	}
+}
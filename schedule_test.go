@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler()
+	now := time.Now()
+	for _, m := range []struct {
+		id string
+		at time.Duration
+	}{{"c", 3 * time.Hour}, {"a", time.Hour}, {"b", 2 * time.Hour}, {"b2", 2 * time.Hour}} {
+		if err := s.schedule(alertMessage{id: m.id}, now.Add(m.at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if due := s.due(now); len(due) != 0 {
+		t.Errorf("%d message(s) due too early", len(due))
+	}
+	due := s.due(now.Add(2 * time.Hour))
+	if len(due) != 3 || due[0].id != "a" || due[1].id != "b" || due[2].id != "b2" {
+		t.Fatalf("unexpected due messages %+v", due)
+	}
+	if !due[1].created.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("message created at %s, want its scheduled time", due[1].created)
+	}
+	if s.len() != 1 || !s.next().Equal(now.Add(3*time.Hour)) {
+		t.Errorf("%d message(s) left, next at %s", s.len(), s.next())
+	}
+
+	// run wakes up for a message scheduled before the next one
+	messages := make(chan alertMessage, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.run(messages, stop)
+	if err := s.schedule(alertMessage{id: "soon"}, time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-messages:
+		if m.id != "soon" {
+			t.Errorf("got message %s", m.id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled message wasn't sent")
+	}
+}
+
+func TestDeliverAt(t *testing.T) {
+	messages := make(chan alertMessage, 1)
+	h := newMessageHandler("alert", messages, parser.GenericAlertParserFunc)
+	h.recipients = []jid.JID{jid.MustParse("alice@example.net")}
+	body := `{"name": "maintenance", "status": "firing", "summary": "db upgrade tonight"}`
+	post := func(query string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/alert"+query, strings.NewReader(body)))
+		return w
+	}
+
+	at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if w := post("?deliver_at="+at, body); w.Code != http.StatusBadRequest || w.Body.String() != "scheduled delivery is disabled" {
+		t.Errorf("disabled: got %d %s", w.Code, w.Body.String())
+	}
+
+	h.scheduler = newScheduler()
+	h.maxScheduleAhead = 24 * time.Hour
+	if w := post("?deliver_at="+at, body); w.Code != http.StatusOK || w.Body.String() != `{"status":"scheduled"}` {
+		t.Errorf("scheduled: got %d %s", w.Code, w.Body.String())
+	}
+	if len(messages) != 0 || h.scheduler.len() != 1 {
+		t.Errorf("message wasn't scheduled: %d sent, %d scheduled", len(messages), h.scheduler.len())
+	}
+	// the time of the payload
+	inBody := `{"name": "maintenance", "status": "firing", "deliver_at": "` + at + `"}`
+	if w := post("", inBody); w.Code != http.StatusOK || h.scheduler.len() != 2 {
+		t.Errorf("deliver_at in the body: got %d, %d scheduled", w.Code, h.scheduler.len())
+	}
+
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	far := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	for query, want := range map[string]string{
+		"?deliver_at=" + past:    "deliver_at is in the past",
+		"?deliver_at=" + far:     "deliver_at is more than 24h0m0s ahead",
+		"?deliver_at=tomorrow":   "invalid deliver_at, must be an RFC 3339 timestamp",
+		"?deliver_at=2030-01-02": "invalid deliver_at, must be an RFC 3339 timestamp",
+	} {
+		if w := post(query, body); w.Code != http.StatusBadRequest || w.Body.String() != want {
+			t.Errorf("%s: got %d %s", query, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDeliverAtCapacity(t *testing.T) {
+	messages := make(chan alertMessage, 10)
+	// every request has two messages
+	h := newMessageHandler("alert", messages, func(r *http.Request) (parser.Result, error) {
+		return parser.Result{Results: []parser.Result{{Message: "first"}, {Message: "second"}}}, nil
+	})
+	h.recipients = []jid.JID{jid.MustParse("alice@example.net")}
+	h.scheduler = newScheduler()
+	h.maxScheduleAhead = 24 * time.Hour
+	h.retryAfter = 30 * time.Second
+	at := time.Now().Add(time.Hour)
+	for i := 0; i < maxScheduledMessages-1; i++ {
+		if err := h.scheduler.schedule(alertMessage{}, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only one slot is left, none of the messages is scheduled
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/alert?deliver_at="+at.UTC().Format(time.RFC3339), strings.NewReader("{}")))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" || w.Body.String() != errTooManyScheduled.Error() {
+		t.Errorf("got %d %q, Retry-After %q", w.Code, w.Body.String(), w.Header().Get("Retry-After"))
+	}
+	if n := h.scheduler.len(); n != maxScheduledMessages-1 {
+		t.Errorf("%d messages scheduled, want %d", n, maxScheduledMessages-1)
+	}
+	if err := h.scheduler.reserve(1); err != nil {
+		t.Errorf("the slots of the rejected request weren't released: %s", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// returns the secret from the env var or, if <name>_FILE is set, from that
+// file (e.g. docker / kubernetes secrets), the file is preferred
+func getSecret(name string) string {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name)
+	}
+	if os.Getenv(name) != "" {
+		log.Printf("warning: %s and %s_FILE are set, using %s_FILE", name, name, name)
+	}
+	s, err := readSecret(name, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
+
+// reads the secret from the file of <name>_FILE
+func readSecret(name string, path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.New("failed to read " + name + "_FILE: " + err.Error())
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// secret that can be replaced while running, e.g. the rotated xmpp password
+type rotatingSecret struct {
+	name string // of the env var, e.g. XMPP_PASS
+	path string // of <name>_FILE, empty if the secret was given directly
+
+	mu    sync.Mutex
+	value string
+}
+
+// returns the current value
+func (s *rotatingSecret) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+// reads the secret from its file again, returns true if it changed; env
+// vars can't change while running, so it fails without the file
+func (s *rotatingSecret) reload() (bool, error) {
+	if s.path == "" {
+		return false, errors.New(s.name + "_FILE isn't set, " + s.name + " can't change without a restart")
+	}
+	v, err := readSecret(s.name, s.path)
+	if err != nil {
+		return false, err
+	}
+	if v == "" {
+		return false, errors.New(s.name + "_FILE is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v == s.value {
+		return false, nil
+	}
+	s.value = v
+	return true, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// writes the secret to a file in a temp dir, returns its path
+func secretFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetSecret(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		file string // content of <name>_FILE, unset if empty
+		want string
+	}{
+		{"plain", map[string]string{"TEST_SECRET": "s3cret"}, "", "s3cret"},
+		{"unset", map[string]string{}, "", ""},
+		{"file", map[string]string{}, "from-file", "from-file"},
+		{"file preferred", map[string]string{"TEST_SECRET": "s3cret"}, "from-file", "from-file"},
+		{"trailing newline", map[string]string{}, "from-file\n", "from-file"},
+		{"trailing crlf", map[string]string{}, "from-file\r\n\n", "from-file"},
+		{"inner newline", map[string]string{}, "first\nsecond\n", "first\nsecond"},
+		{"other whitespace kept", map[string]string{}, " from-file \n", " from-file "},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, map[string]string{"TEST_SECRET": "", "TEST_SECRET_FILE": ""})
+			setEnv(t, test.env)
+			if test.file != "" {
+				setEnv(t, map[string]string{"TEST_SECRET_FILE": secretFile(t, test.file)})
+			}
+			if got := getSecret("TEST_SECRET"); got != test.want {
+				t.Errorf("getSecret = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	if _, err := readSecret("TEST_SECRET", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file was read")
+	}
+	if s, err := readSecret("TEST_SECRET", secretFile(t, "s3cret\n")); err != nil || s != "s3cret" {
+		t.Errorf("readSecret = %q, %v", s, err)
+	}
+}
+
+func TestEndpointTokens(t *testing.T) {
+	setEnv(t, map[string]string{
+		"XMPP_ID":                          "bot@example.net",
+		"XMPP_PASS":                        "s3cret",
+		"XMPP_RECIPIENTS":                  "alice@example.net",
+		"XMPP_ENDPOINT_TOKEN_GRAFANA":      "grafana-token",
+		"XMPP_ENDPOINT_TOKEN_TEAM_A_FILE":  secretFile(t, "team-a-token\n"),
+		"XMPP_ENDPOINT_TOKEN_BACKUPS":      "plain-token",
+		"XMPP_ENDPOINT_TOKEN_BACKUPS_FILE": secretFile(t, "file-token"),
+	})
+	tokens := loadConfig(false).Endpoints.Tokens
+	// the _FILE suffix is cut off, the rest is named like the endpoint
+	for endpoint, want := range map[string]string{
+		"grafana": "grafana-token",
+		"team-a":  "team-a-token",
+		"backups": "file-token",
+	} {
+		if got := string(tokens[endpointEnvName(endpoint)]); got != want {
+			t.Errorf("token of /%s is %q, want %q", endpoint, got, want)
+		}
+	}
+	if _, ok := tokens["TEAM_A_FILE"]; ok {
+		t.Error("token named after the _FILE var")
+	}
+}
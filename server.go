@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// tuning of the http listener
+type httpSettings struct {
+	// serve https with this certificate and key if set, http/2 is negotiated automatically
+	certFile string
+	keyFile  string
+	// also accept cleartext http/2 (h2c), e.g. from a proxy talking http/2 to its backends
+	h2c bool
+	// how long idle keep-alive connections stay open, 0 until the client closes them
+	idleTimeout time.Duration
+	// close every connection after its request (http/1.1 only)
+	disableKeepAlives bool
+	// max. number of concurrent requests (streams) per http/2 connection
+	maxConcurrentStreams uint32
+}
+
+// returns the server for the handler, http/1.1 senders work as before
+func newHTTPServer(handler http.Handler, s httpSettings) (*http.Server, error) {
+	h2 := &http2.Server{MaxConcurrentStreams: s.maxConcurrentStreams, IdleTimeout: s.idleTimeout}
+	if s.h2c {
+		// connections upgraded to h2c are hijacked, shutdown doesn't wait for them
+		handler = h2c.NewHandler(handler, h2)
+	}
+	server := &http.Server{Handler: handler, IdleTimeout: s.idleTimeout}
+	server.SetKeepAlivesEnabled(!s.disableKeepAlives)
+	if s.certFile != "" {
+		// the same limits for http/2 over tls
+		err := http2.ConfigureServer(server, h2)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+)
+
+// first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// returns the listening socket passed by systemd (socket activation), nil if
+// the process wasn't started that way
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		return nil, errors.New("systemd passed " + strconv.Itoa(fds) + " sockets, expected one")
+	}
+	// the sockets are meant for this process only, not for its children
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "systemd-socket")
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	// the listener holds its own copy of the descriptor
+	_ = f.Close()
+	return l, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+)
+
+//go:embed status.html
+var statusTemplateSource string
+
+var statusTemplate = template.Must(template.New("status").Parse(statusTemplateSource))
+
+// last error of the bridge, shown on the status page
+type lastError struct {
+	mu   sync.Mutex
+	err  string
+	time time.Time
+}
+
+var bridgeError lastError
+
+// remembers err as the last error
+func (e *lastError) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.err = err.Error()
+	e.time = time.Now()
+}
+
+func (e *lastError) get() (string, time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err, e.time
+}
+
+// serves the status page and the health check
+type statusHandler struct {
+	client     *xmppClient
+	endpoints  []string
+	recipients []jid.JID
+	rooms      []room
+	// endpoints paused due to flooding, optional
+	flood      *floodGuard
+	adminToken string
+}
+
+// state rendered on the status page
+type statusPage struct {
+	Version        string
+	Connected      bool
+	Endpoints      []string
+	Paused         []pausedEndpoint
+	RecipientCount int
+	RoomCount      int
+	MessagesSent   float64
+	LastError      string
+	LastErrorTime  time.Time
+	// only filled for admins
+	Admin      bool
+	Recipients []string
+	Rooms      []string
+}
+
+// http handler for the status page
+func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// everything else isn't found
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// let browsers ask for the admin token
+	admin := isAdmin(r, h.adminToken)
+	if _, login := r.URL.Query()["login"]; login && !admin {
+		w.Header().Set("WWW-Authenticate", `Basic realm="xmpp-webhook"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	page := statusPage{
+		Version:        versionString(),
+		Connected:      h.client.current() != nil,
+		Endpoints:      h.endpoints,
+		Paused:         h.flood.paused(),
+		RecipientCount: len(h.recipients),
+		RoomCount:      len(h.rooms),
+		MessagesSent:   messagesSent.sum(),
+		Admin:          admin,
+	}
+	page.LastError, page.LastErrorTime = bridgeError.get()
+	if page.Admin {
+		for _, recipient := range h.recipients {
+			page.Recipients = append(page.Recipients, recipient.String())
+		}
+		for _, room := range h.rooms {
+			page.Rooms = append(page.Rooms, room.jid.String())
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statusTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("failed to render status page: %s", err)
+	}
+}
+
+// http handler for health checks, 503 while disconnected; paused endpoints
+// are listed, but don't fail the check
+func (h *statusHandler) health(w http.ResponseWriter, _ *http.Request) {
+	connected := h.client.current() != nil
+	status := "ok"
+	w.Header().Set("Content-Type", "application/json")
+	if !connected {
+		status = "disconnected"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(struct {
+		Status    string           `json:"status"`
+		Connected bool             `json:"connected"`
+		Paused    []pausedEndpoint `json:"paused,omitempty"`
+	}{status, connected, h.flood.paused()})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"mellium.im/xmpp"
+)
+
+// amount of received data kept to look up the address of a see-other-host error
+const streamTailSize = 4096
+
+// default client port if the see-other-host address has none
+const defaultXMPPPort = "5222"
+
+// resource used as base for a regenerated one if none is configured
+const defaultResource = "xmpp-webhook"
+
+var seeOtherHostPattern = regexp.MustCompile(`<see-other-host[^>]*>\s*([^<\s]+)\s*</see-other-host>`)
+
+// connection that keeps the end of the data read from the server, mellium
+// parses stream errors but drops the address of a see-other-host error
+type tailConn struct {
+	net.Conn
+
+	mu   sync.Mutex
+	tail []byte
+}
+
+func (c *tailConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.tail = append(c.tail, p[:n]...)
+	if len(c.tail) > streamTailSize {
+		c.tail = c.tail[len(c.tail)-streamTailSize:]
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// passes on the tls state, so mellium still treats the connection as encrypted
+func (c *tailConn) ConnectionState() tls.ConnectionState {
+	if tc, ok := c.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		return tc.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
+// starttls that keeps recording the data read on the encrypted connection
+func recordStartTLS(f xmpp.StreamFeature) xmpp.StreamFeature {
+	negotiate := f.Negotiate
+	f.Negotiate = func(ctx context.Context, s *xmpp.Session, data interface{}) (xmpp.SessionState, io.ReadWriter, error) {
+		mask, rw, err := negotiate(ctx, s, data)
+		if c, ok := rw.(net.Conn); ok {
+			rw = &tailConn{Conn: c}
+		}
+		return mask, rw, err
+	}
+	return f
+}
+
+// returns the host:port of the last see-other-host error received on the
+// session, empty if there is none
+func seeOtherHost(s *xmpp.Session) string {
+	c, ok := s.Conn().(*tailConn)
+	if !ok {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := seeOtherHostPattern.FindAllSubmatch(c.tail, -1)
+	if m == nil {
+		return ""
+	}
+	addr := string(m[len(m)-1][1])
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), defaultXMPPPort)
+}
+
+// returns the resource with a new random suffix, to bind after a resource conflict
+func regenerateResource(resource string) string {
+	if resource == "" {
+		resource = defaultResource
+	}
+	// strip the suffix of a previously regenerated resource
+	if i := strings.LastIndex(resource, "-"); i > 0 && len(resource)-i-1 == 8 {
+		if _, err := hex.DecodeString(resource[i+1:]); err == nil {
+			resource = resource[:i]
+		}
+	}
+	b := make([]byte, 4)
+	_, _ = cryptorand.Read(b)
+	return resource + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// response of the endpoints with synchronous delivery unless XMPP_RESPONSE_TEMPLATE is set
+const defaultSyncResponseTemplate = `{"status":{{json .Status}},"recipients":{{json .Recipients}}}`
+
+var defaultSyncResponse = template.Must(parseResponseTemplate("sync-response", defaultSyncResponseTemplate))
+
+// deliveries of synchronous messages
+const (
+	deliveryOK      = "ok"
+	deliveryPartial = "partially failed"
+	deliveryFailed  = "failed"
+	deliveryExpired = "expired"
+	deliveryPending = "pending"
+	deliverySkipped = "skipped"
+)
+
+// outcome of the delivery of a message, passed back to the waiting handler
+type deliveryResult struct {
+	expired    bool
+	recipients []recipientResult
+}
+
+// delivery of a message to one recipient or room
+type recipientResult struct {
+	ID        string `json:"id"` // stanza id of the message
+	Recipient string `json:"recipient"`
+	Delivery  string `json:"delivery"` // ok, failed or e.g. skipped (offline)
+	Error     string `json:"error,omitempty"`
+
+	notConnected bool
+}
+
+// passes the outcome to the handler waiting for it, if any
+func (m alertMessage) report(r deliveryResult) {
+	if m.result == nil {
+		return
+	}
+	// rollups and retries may report again, nobody waits for them
+	select {
+	case m.result <- r:
+	default:
+	}
+}
+
+// returns the result of a recipient for the outcome of the delivery
+func newRecipientResult(id string, recipient string, skipped string, err error) recipientResult {
+	r := recipientResult{ID: id, Recipient: recipient, Delivery: deliveryOK}
+	switch {
+	case skipped != "":
+		r.Delivery = deliverySkipped + " (" + skipped + ")"
+	case err != nil:
+		r.Delivery, r.Error = deliveryFailed, err.Error()
+		r.notConnected = errors.Is(err, errNotConnected)
+	}
+	return r
+}
+
+// waits for the delivery of the messages of the request and fills in their
+// outcome, returns the status code: 200 if nothing failed, 207 if some
+// recipients failed, 502 (503 while disconnected) if all of them did and
+// 202 if the delivery didn't finish in time
+func (h *messageHandler) awaitDelivery(ctx context.Context, response *responseData, timeout time.Duration) int {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var delivered, failed int
+	var pending, notConnected bool
+	for i := range response.Messages {
+		handled := &response.Messages[i]
+		if handled.result == nil {
+			continue
+		}
+		// the remaining messages are still on their way
+		if pending {
+			handled.Delivery = deliveryPending
+			continue
+		}
+		var result deliveryResult
+		select {
+		case result = <-handled.result:
+		case <-timer.C:
+			pending = true
+		case <-ctx.Done():
+			pending = true
+		}
+		switch {
+		case pending:
+			logf(h.source, "the delivery of message %s from /%s didn't finish within %s", handled.ID, h.endpoint, timeout)
+			handled.Delivery = deliveryPending
+			continue
+		case result.expired:
+			handled.Delivery = deliveryExpired
+			failed++
+			notConnected = true
+			continue
+		}
+		var ok, bad int
+		for _, r := range result.recipients {
+			switch r.Delivery {
+			case deliveryOK:
+				ok++
+			case deliveryFailed:
+				bad++
+				notConnected = notConnected || r.notConnected
+			}
+		}
+		switch {
+		case bad > 0 && ok > 0:
+			handled.Delivery = deliveryPartial
+		case bad > 0:
+			handled.Delivery = deliveryFailed
+		case ok == 0:
+			handled.Delivery = deliverySkipped
+		}
+		if bad > 0 {
+			logf(h.source, "message %s from /%s was delivered to %d of %d recipient(s)", handled.ID, h.endpoint, ok, ok+bad)
+		}
+		delivered += ok
+		failed += bad
+		handled.Recipients = result.recipients
+		response.Recipients = append(response.Recipients, result.recipients...)
+	}
+
+	switch {
+	case failed > 0 && delivered > 0:
+		response.Status = deliveryPartial
+		return http.StatusMultiStatus
+	case failed > 0 && notConnected:
+		response.Status = deliveryFailed
+		return http.StatusServiceUnavailable
+	case failed > 0:
+		response.Status = deliveryFailed
+		return http.StatusBadGateway
+	case pending:
+		response.Status = deliveryPending
+		return http.StatusAccepted
+	}
+	if len(response.Messages) == 1 {
+		response.Status = response.Messages[0].Delivery
+	}
+	return http.StatusOK
+}
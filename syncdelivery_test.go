@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+func TestSyncDelivery(t *testing.T) {
+	alice, bob := jid.MustParse("alice@example.net"), jid.MustParse("bob@example.net")
+	tests := []struct {
+		name   string
+		errs   []error // of alice and bob, nothing is reported if nil
+		code   int
+		status string
+	}{
+		{name: "delivered", errs: []error{nil, nil}, code: http.StatusOK, status: `"status":"ok"`},
+		{name: "partial", errs: []error{nil, errors.New("remote-server-not-found")}, code: http.StatusMultiStatus, status: `"status":"partially failed"`},
+		{name: "failed", errs: []error{errors.New("timeout"), errors.New("timeout")}, code: http.StatusBadGateway, status: `"status":"failed"`},
+		{name: "disconnected", errs: []error{errNotConnected, errNotConnected}, code: http.StatusServiceUnavailable, status: `"status":"failed"`},
+		{name: "pending", code: http.StatusAccepted, status: `"status":"pending"`},
+	}
+	for _, tt := range tests {
+		messages := make(chan alertMessage, 1)
+		h := newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+			return parser.Result{Message: "disk full"}, nil
+		})
+		h.recipients = []jid.JID{alice, bob}
+		h.syncDelivery = true
+		h.syncTimeout = 50 * time.Millisecond
+		h.retryAfter = 30 * time.Second
+		go func(errs []error) {
+			m := <-messages
+			if errs == nil {
+				return
+			}
+			m.report(deliveryResult{recipients: []recipientResult{
+				newRecipientResult(m.id, alice.String(), "", errs[0]),
+				newRecipientResult(m.id, bob.String(), "", errs[1]),
+			}})
+		}(tt.errs)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/grafana", strings.NewReader("{}")))
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, tt.status) {
+			t.Errorf("%s: unexpected response %s", tt.name, body)
+		}
+		if tt.name == "partial" && !strings.Contains(body, `"recipient":"bob@example.net","delivery":"failed","error":"remote-server-not-found"`) {
+			t.Errorf("%s: failed recipient missing in %s", tt.name, body)
+		}
+		if tt.name == "disconnected" && w.Header().Get("Retry-After") != "30" {
+			t.Errorf("%s: Retry-After %q", tt.name, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestDeliverReport(t *testing.T) {
+	server := &fakeServer{}
+	address := jid.MustParse("bot@example.net")
+	presence := newPresenceTracker()
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	defer client.close()
+
+	// not connected yet, every send fails
+	d := &dispatcher{client: client, presence: presence, from: address}
+	alice := jid.MustParse("alice@example.net")
+	ops := room{jid: jid.MustParse("ops@conference.example.net")}
+	result := make(chan deliveryResult, 1)
+	ctx := context.Background()
+	d.deliver(ctx, alertMessage{id: "a", source: "ci", body: "disk full", recipients: []jid.JID{alice}, rooms: []room{ops}, result: result})
+	r := <-result
+	if len(r.recipients) != 2 || r.recipients[0].Delivery != deliveryFailed || !r.recipients[0].notConnected || r.recipients[1].Recipient != "ops@conference.example.net" {
+		t.Errorf("unexpected outcome %+v", r.recipients)
+	}
+
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	server.conn(t, 0)
+	d.deliver(ctx, alertMessage{id: "b", source: "ci", body: "disk full", recipients: []jid.JID{alice}, onlineOnly: true, result: result})
+	if r := <-result; len(r.recipients) != 1 || r.recipients[0].Delivery != "skipped (offline)" {
+		t.Errorf("unexpected outcome %+v", r.recipients)
+	}
+	d.deliver(ctx, alertMessage{id: "c", source: "ci", body: "disk full", recipients: []jid.JID{alice}, result: result})
+	if r := <-result; len(r.recipients) != 1 || r.recipients[0].Delivery != deliveryOK || r.recipients[0].ID != "c" {
+		t.Errorf("unexpected outcome %+v", r.recipients)
+	}
+	d.deliver(ctx, alertMessage{id: "d", source: "ci", body: "disk full", created: time.Now().Add(-time.Hour), ttl: time.Minute, recipients: []jid.JID{alice}, result: result})
+	if r := <-result; !r.expired {
+		t.Errorf("expiry wasn't reported: %+v", r)
+	}
+}
+
+func TestSyncQuery(t *testing.T) {
+	messages := make(chan alertMessage, 2)
+	h := newMessageHandler("grafana", messages, func(*http.Request) (parser.Result, error) {
+		return parser.Result{Message: "disk full"}, nil
+	})
+	h.recipients = []jid.JID{jid.MustParse("alice@example.net")}
+	h.syncTimeout = time.Minute
+	h.parses = make(chan struct{}, 1)
+	handler := h.withMiddlewares(defaultMiddlewares)
+
+	// nobody reports the delivery, the request waits for the timeout of the query
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/grafana?sync=300ms", strings.NewReader("{}")))
+		done <- w
+	}()
+	<-messages
+	// the waiting request doesn't hold its slot
+	waitFor(t, "the slot", func() bool { return len(h.parses) == 0 })
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/grafana", strings.NewReader("{}")))
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"ok"}` {
+		t.Errorf("asynchronous request: got %d %s", w.Code, w.Body.String())
+	}
+	if w := <-done; w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Errorf("synchronous request: got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/grafana?sync=soon", strings.NewReader("{}")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid timeout: got %d", w.Code)
+	}
+}
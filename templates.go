@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+)
+
+// paths served by xmpp-webhook itself
+var reservedEndpoints = map[string]bool{
+	"webhook":   true,
+	"metrics":   true,
+	"healthz":   true,
+	"templates": true,
+	"debug":     true,
+	"broadcast": true,
+}
+
+// endpoints with a built-in parser that isn't in the registry
+var builtinEndpoints = map[string]bool{
+	"command": true,
+	"lines":   true,
+	"json":    true,
+}
+
+// checks that the templated endpoint doesn't clash with a path or parser of xmpp-webhook
+func checkTemplateEndpoint(endpoint string) error {
+	switch {
+	case strings.Contains(endpoint, "/"):
+		return errors.New("template endpoint " + endpoint + " must not contain /")
+	case reservedEndpoints[endpoint]:
+		return errors.New("template endpoint " + endpoint + " is reserved")
+	case parser.Registry[endpoint] != nil || builtinEndpoints[endpoint]:
+		return errors.New("template endpoint " + endpoint + " would replace the built-in parser")
+	}
+	return nil
+}
+
+// parses a comma-separated list of templated endpoints:
+// endpoint=/path/to/template,other=/path/to/other-template
+// translations are given as endpoint:lang=/path/to/translated-template
+func parseTemplates(s string) (map[string]*parser.TemplateFile, error) {
+	templates := make(map[string]*parser.TemplateFile)
+	for _, t := range strings.Split(s, ",") {
+		if t == "" {
+			continue
+		}
+		i := strings.Index(t, "=")
+		if i < 1 {
+			return nil, errors.New("template " + t + " must be given as endpoint=path")
+		}
+		endpoint, path := t[:i], t[i+1:]
+		if j := strings.Index(endpoint, ":"); j == 0 || j == len(endpoint)-1 {
+			return nil, errors.New("translated template " + t + " must be given as endpoint:lang=path")
+		}
+		name, _ := splitTemplateName(endpoint)
+		err := checkTemplateEndpoint(name)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := parser.LoadTemplateFile(path)
+		if err != nil {
+			return nil, errors.New("failed to load template for " + endpoint + ": " + err.Error())
+		}
+		templates[endpoint] = tmpl
+	}
+	for name := range templates {
+		if endpoint, _ := splitTemplateName(name); templates[endpoint] == nil {
+			return nil, errors.New("translated template " + name + " has no template for " + endpoint)
+		}
+	}
+	return templates, nil
+}
+
+// splits endpoint:lang, lang is empty for the default template
+func splitTemplateName(name string) (string, string) {
+	if i := strings.Index(name, ":"); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// returns the translated templates of the endpoint by language
+func templateTranslations(templates map[string]*parser.TemplateFile, endpoint string) map[string]*parser.TemplateFile {
+	translations := make(map[string]*parser.TemplateFile)
+	for name, t := range templates {
+		if e, lang := splitTemplateName(name); e == endpoint && lang != "" {
+			translations[lang] = t
+		}
+	}
+	return translations
+}
+
+// admin api to list and reload the templates
+type templateHandler struct {
+	templates  map[string]*parser.TemplateFile
+	adminToken string
+}
+
+// state of a single template
+type templateState struct {
+	Endpoint string    `json:"endpoint"`
+	Path     string    `json:"path"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// http handler, GET lists the templates, POST reloads them
+func (h *templateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r, h.adminToken) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("unauthorized"))
+		return
+	}
+	reload := false
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		reload = true
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var endpoints []string
+	for endpoint := range h.templates {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	status := http.StatusOK
+	states := []templateState{}
+	for _, endpoint := range endpoints {
+		t := h.templates[endpoint]
+		state := templateState{Endpoint: endpoint, Path: t.Path}
+		if reload {
+			// invalid templates are reported, the old ones stay active
+			err := t.Reload()
+			if err != nil {
+				log.Printf("failed to reload template for %s: %s", endpoint, err)
+				state.Error = err.Error()
+				status = http.StatusInternalServerError
+			} else {
+				log.Printf("reloaded template for %s", endpoint)
+			}
+		}
+		state.LoadedAt = t.LoadedAt()
+		states = append(states, state)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(states)
+}
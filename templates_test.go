@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmpp-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "uptime.tmpl")
+	err = ioutil.WriteFile(path, []byte("{{.host}} is {{.state}}"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		endpoint string
+		err      bool
+	}{
+		{endpoint: "uptime"},
+		{endpoint: "grafana-custom"},
+		{endpoint: "grafana", err: true},
+		{endpoint: "json", err: true},
+		{endpoint: "metrics", err: true},
+		{endpoint: "healthz", err: true},
+		{endpoint: "templates", err: true},
+		{endpoint: "webhook", err: true},
+		{endpoint: "a/b", err: true},
+	}
+	for _, tt := range tests {
+		templates, err := parseTemplates(tt.endpoint + "=" + path)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.endpoint, err)
+		} else if templates[tt.endpoint] == nil {
+			t.Errorf("%s: template missing", tt.endpoint)
+		}
+	}
+
+	// translations of reserved endpoints are rejected too
+	_, err = parseTemplates("uptime=" + path + ",metrics:de=" + path)
+	if err == nil {
+		t.Error("metrics:de: expected an error")
+	}
+}
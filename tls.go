@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"mellium.im/xmpp"
+)
+
+var errTLSRequired = errors.New("the connection to the xmpp server isn't encrypted (the server refused or doesn't support StartTLS), refusing to continue without TLS")
+
+// starttls that fails if the server refuses it, instead of continuing unencrypted
+func requiredStartTLS(cfg *tls.Config) xmpp.StreamFeature {
+	f := xmpp.StartTLS(cfg)
+	negotiate := f.Negotiate
+	f.Negotiate = func(ctx context.Context, s *xmpp.Session, data interface{}) (xmpp.SessionState, io.ReadWriter, error) {
+		mask, rw, err := negotiate(ctx, s, data)
+		if err == nil && mask&xmpp.Secure == 0 {
+			return mask, rw, errTLSRequired
+		}
+		return mask, rw, err
+	}
+	return f
+}
+
+// checks that the negotiated session is encrypted, both for StartTLS and direct TLS
+func checkEncrypted(s *xmpp.Session) error {
+	if s.State()&xmpp.Secure == 0 || !s.ConnectionState().HandshakeComplete {
+		return errTLSRequired
+	}
+	return nil
+}
+
+// ca certificates the xmpp server is verified with instead of the system
+// ones (XMPP_CA_FILE), the file is read again on SIGHUP
+type caBundle struct {
+	path string
+	mu   sync.Mutex
+	pool *x509.CertPool
+	sum  [sha256.Size]byte // of the file, tells if a reload changed it
+}
+
+// loads the bundle from the pem file
+func loadCABundle(path string) (*caBundle, int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	pool, n, err := parseCACerts(b, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &caBundle{path: path, pool: pool, sum: sha256.Sum256(b)}, n, nil
+}
+
+// parses the certificates of the pem file, fails if any of them is invalid
+// or there is none
+func parseCACerts(b []byte, path string) (*x509.CertPool, int, error) {
+	pool := x509.NewCertPool()
+	n := 0
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid certificate %d in %s: %w", n+1, path, err)
+		}
+		pool.AddCert(cert)
+		n++
+	}
+	if n == 0 {
+		return nil, 0, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, n, nil
+}
+
+// returns the certificates to verify the server with, nil (the system ones)
+// without a bundle
+func (b *caBundle) roots() *x509.CertPool {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pool
+}
+
+// reads the file again, the new certificates are used from the next
+// connection on; the previous ones are kept if the file is invalid. Returns
+// true if the file changed.
+func (b *caBundle) reload() (bool, error) {
+	data, err := ioutil.ReadFile(b.path)
+	if err == nil && sha256.Sum256(data) == b.sum {
+		log.Printf("XMPP_CA_FILE unchanged")
+		return false, nil
+	}
+	var pool *x509.CertPool
+	var n int
+	if err == nil {
+		pool, n, err = parseCACerts(data, b.path)
+	}
+	if err != nil {
+		log.Printf("failed to reload XMPP_CA_FILE, keeping the previous certificates: %s", err)
+		return false, err
+	}
+	b.mu.Lock()
+	b.pool = pool
+	b.sum = sha256.Sum256(data)
+	b.mu.Unlock()
+	log.Printf("reloaded XMPP_CA_FILE with %d certificate(s)", n)
+	return true, nil
+}
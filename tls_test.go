@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mellium.im/sasl"
+	"mellium.im/xmpp/jid"
+)
+
+func TestTLSServerName(t *testing.T) {
+	// borrow the self-signed certificate of httptest
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	cert := srv.TLS.Certificates[0]
+	srv.Close()
+
+	names := make(chan string, 2)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			names <- h.ServerName
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	address := jid.MustParse("bot@example.net")
+	for override, want := range map[string]string{"": "", "xmpp.internal.example": "xmpp.internal.example"} {
+		// the handshake succeeds without verification, the stream fails afterwards
+		_, err := initXMPP(address, "secret", true, nil, override, true, true, l.Addr().String(), "tcp", []sasl.Mechanism{sasl.ScramSha256}, nil)
+		if err == nil {
+			t.Fatal("connected to a server without xmpp")
+		}
+		if got := <-names; got != want {
+			t.Errorf("override %q: sni %q, want %q", override, got, want)
+		}
+	}
+}
+
+func TestDialNetwork(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			c.Close()
+		}
+	}()
+
+	address := jid.MustParse("bot@example.net")
+	mechanisms := []sasl.Mechanism{sasl.ScramSha256}
+	// the ipv4 listener can't be reached over ipv6
+	_, err = initXMPP(address, "secret", true, nil, "", false, true, l.Addr().String(), "tcp6", mechanisms, nil)
+	if err == nil || !strings.Contains(err.Error(), "address") {
+		t.Errorf("dialed an ipv4 address with tcp6: %v", err)
+	}
+	_, _ = initXMPP(address, "secret", true, nil, "", false, true, l.Addr().String(), "tcp4", mechanisms, nil)
+	select {
+	case <-accepted:
+	default:
+		t.Error("not connected with tcp4")
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	location := "wss://" + srv.Listener.Addr().String() + "/xmpp-websocket"
+	address := jid.MustParse("bot@example.net")
+	mechanisms := []sasl.Mechanism{sasl.ScramSha256}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	write := func(b []byte) {
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write([]byte("not a certificate"))
+	if _, _, err := loadCABundle(path); err == nil {
+		t.Error("loaded a file without certificates")
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	write(cert)
+	cas, n, err := loadCABundle(path)
+	if err != nil || n != 1 {
+		t.Fatalf("got %d certificate(s): %v", n, err)
+	}
+	// the self-signed certificate is trusted, the upgrade fails afterwards
+	_, err = initXMPPWebSocket(address, "secret", location, false, cas.roots(), "", mechanisms)
+	if err == nil || strings.Contains(err.Error(), "certificate") {
+		t.Errorf("certificate of the bundle wasn't trusted: %v", err)
+	}
+
+	// an invalid file keeps the previous certificates
+	roots := cas.roots()
+	write(append(cert, "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"...))
+	if changed, err := cas.reload(); err == nil || changed || cas.roots() != roots {
+		t.Errorf("invalid bundle was loaded: %v", err)
+	}
+	write(append(cert, cert...))
+	if changed, err := cas.reload(); err != nil || !changed || cas.roots() == roots {
+		t.Errorf("bundle wasn't reloaded: %v", err)
+	}
+	// the same file again doesn't need a new connection
+	roots = cas.roots()
+	if changed, err := cas.reload(); err != nil || changed || cas.roots() != roots {
+		t.Errorf("unchanged bundle was reported as changed: %v", err)
+	}
+	if _, err := initXMPPWebSocket(address, "secret", location, false, (*caBundle)(nil).roots(), "", mechanisms); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("connected to an untrusted server without a bundle: %v", err)
+	}
+}
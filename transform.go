@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+var errTransformEmpty = errors.New("the transform produced nothing")
+
+// jq expression that reshapes the json body of an endpoint before it's
+// parsed, e.g. {title: .event.name, message: .event.detail}
+type transform struct {
+	source string
+	code   *gojq.Code
+}
+
+// compiles the expression, env and input(s) aren't available to it
+func parseTransform(s string) (*transform, error) {
+	q, err := gojq.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, err
+	}
+	return &transform{source: s, code: code}, nil
+}
+
+// shown as the expression in print-config
+func (t *transform) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.source)
+}
+
+// applies the expression to the json body and returns the first result as
+// json, fails if it produces nothing or null
+func (t *transform) apply(ctx context.Context, body []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	// keep large ids exact instead of rounding them to floats
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.New("the body isn't json")
+	}
+	result, ok := t.code.RunWithContext(ctx, v).Next()
+	if !ok || result == nil {
+		return nil, errTransformEmpty
+	}
+	if err, ok := result.(error); ok {
+		return nil, fmt.Errorf("the transform failed: %w", err)
+	}
+	return json.Marshal(result)
+}
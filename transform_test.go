@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmsmr/xmpp-webhook/parser"
+	"mellium.im/xmpp/jid"
+)
+
+func TestTransform(t *testing.T) {
+	if _, err := parseTransform(`{message: .event.name`); err == nil {
+		t.Error("parsed an invalid expression")
+	}
+	tr, err := parseTransform(`.events[] | select(.level == "error") | {message: "\(.host): \(.text)", id}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan alertMessage, 1)
+	var parsed string
+	h := newMessageHandler("generic", messages, func(r *http.Request) (parser.Result, error) {
+		body, _ := ioutil.ReadAll(r.Body)
+		parsed = string(body)
+		return parser.Result{Message: "ok"}, nil
+	})
+	h.recipients = []jid.JID{jid.MustParse("alice@example.net")}
+	h.transform = tr
+	tests := []struct {
+		name string
+		body string
+		code int
+		want string
+	}{
+		{
+			name: "first result",
+			body: `{"events": [{"level": "info", "host": "db1", "text": "up"}, {"level": "error", "host": "db2", "text": "disk full", "id": 9007199254740993}, {"level": "error"}]}`,
+			code: http.StatusOK,
+			want: `{"id":9007199254740993,"message":"db2: disk full"}`,
+		},
+		{name: "nothing", body: `{"events": [{"level": "info"}]}`, code: http.StatusBadRequest},
+		{name: "error", body: `{"events": 1}`, code: http.StatusBadRequest},
+		{name: "not json", body: `events`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		parsed = ""
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/generic", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: got %d %s, want %d", tt.name, w.Code, w.Body.String(), tt.code)
+		}
+		if parsed != tt.want {
+			t.Errorf("%s: parser got %s, want %s", tt.name, parsed, tt.want)
+		}
+		if tt.code == http.StatusOK {
+			<-messages
+		}
+	}
+}
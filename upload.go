@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// namespaces of http file upload (XEP-0363) and service discovery (XEP-0030)
+const (
+	uploadNamespace    = "urn:xmpp:http:upload:0"
+	discoInfoNamespace = "http://jabber.org/protocol/disco#info"
+	discoItemNamespace = "http://jabber.org/protocol/disco#items"
+)
+
+// how long the iq requests of the upload may take if the send timeout is disabled
+const defaultIQTimeout = 30 * time.Second
+
+var imagesUploaded = newCounter("xmpp_images_uploaded_total", "Images of alerts uploaded via HTTP File Upload.", "endpoint", "result")
+
+// headers of the upload slot that may be passed on to the put request (XEP-0363, 5)
+var uploadHeaders = map[string]bool{"Authorization": true, "Cookie": true, "Expires": true}
+
+// link to the uploaded file, shown inline by most clients if it's the body too (XEP-0066)
+type messageOOB struct {
+	URL string `xml:"url"`
+}
+
+// credentials sent when fetching images from a source, e.g. a secured grafana
+type imageAuth struct {
+	prefix string // only urls starting with it get the header
+	header string
+	value  string
+}
+
+// adds the header if the url belongs to the source, so forged payloads can't
+// leak it to other hosts
+func (a *imageAuth) apply(r *http.Request) {
+	if a != nil && strings.HasPrefix(r.URL.String(), a.prefix) {
+		r.Header.Set(a.header, a.value)
+	}
+}
+
+// fetches the images of alerts and uploads them to the http upload service of the server
+type imageUploader struct {
+	client  *xmppClient
+	http    *http.Client
+	maxSize int64 // bytes
+
+	mu      sync.Mutex
+	service jid.JID // discovered on first use unless configured
+}
+
+// fetches the image and uploads it, returns the url to share
+func (u *imageUploader) upload(ctx context.Context, source string, auth *imageAuth) (string, error) {
+	data, contentType, err := u.fetch(ctx, source, auth)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image: %w", err)
+	}
+	service, err := u.uploadService(ctx)
+	if err != nil {
+		return "", err
+	}
+	slot, err := u.requestSlot(ctx, service, imageFilename(source, contentType), int64(len(data)), contentType)
+	if err != nil {
+		return "", err
+	}
+
+	// upload to the slot, with the headers the service asked for
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, slot.Put.URL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for _, h := range slot.Put.Headers {
+		if name := http.CanonicalHeaderKey(h.Name); uploadHeaders[name] {
+			req.Header.Set(name, strings.ReplaceAll(h.Value, "\n", ""))
+		}
+	}
+	resp, err := u.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("failed to upload image: %s", resp.Status)
+	}
+	return slot.Get.URL, nil
+}
+
+// returns the image and its content type, at most maxSize bytes
+func (u *imageUploader) fetch(ctx context.Context, source string, auth *imageAuth) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, "", errors.New("not an http url")
+	}
+	auth.apply(req)
+	resp, err := u.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", errors.New(resp.Status)
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", errors.New("not an image: " + contentType)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, u.maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > u.maxSize {
+		return nil, "", fmt.Errorf("image exceeds %d bytes", u.maxSize)
+	}
+	return data, contentType, nil
+}
+
+// the items of the server, one of them may offer http upload (XEP-0363, 4)
+type discoItems struct {
+	Query struct {
+		Items []struct {
+			JID string `xml:"jid,attr"`
+		} `xml:"item"`
+	} `xml:"http://jabber.org/protocol/disco#items query"`
+}
+
+type discoInfo struct {
+	Query struct {
+		Features []struct {
+			Var string `xml:"var,attr"`
+		} `xml:"feature"`
+	} `xml:"http://jabber.org/protocol/disco#info query"`
+}
+
+// returns the upload service, looks it up among the items of the server on first use
+func (u *imageUploader) uploadService(ctx context.Context) (jid.JID, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.service.Equal(jid.JID{}) {
+		return u.service, nil
+	}
+	s := u.client.current()
+	if s == nil {
+		return jid.JID{}, errNotConnected
+	}
+	domain := s.LocalAddr().Domain()
+	var items discoItems
+	err := u.client.iq(ctx, stanza.IQ{To: domain, Type: stanza.GetIQ}, discoQuery{XMLName: xml.Name{Space: discoItemNamespace, Local: "query"}}, &items)
+	if err != nil {
+		return jid.JID{}, fmt.Errorf("failed to discover the upload service: %w", err)
+	}
+	// the server itself may offer it too
+	candidates := []jid.JID{domain}
+	for _, item := range items.Query.Items {
+		if j, err := jid.Parse(item.JID); err == nil {
+			candidates = append(candidates, j)
+		}
+	}
+	for _, c := range candidates {
+		var info discoInfo
+		err := u.client.iq(ctx, stanza.IQ{To: c, Type: stanza.GetIQ}, discoQuery{XMLName: xml.Name{Space: discoInfoNamespace, Local: "query"}}, &info)
+		if err != nil {
+			continue
+		}
+		for _, f := range info.Query.Features {
+			if f.Var == uploadNamespace {
+				u.service = c
+				return c, nil
+			}
+		}
+	}
+	return jid.JID{}, errors.New("the server offers no http upload service")
+}
+
+// empty disco query, the name gives the namespace
+type discoQuery struct {
+	XMLName xml.Name
+}
+
+// request for an upload slot (XEP-0363, 4)
+type slotRequest struct {
+	XMLName     xml.Name `xml:"urn:xmpp:http:upload:0 request"`
+	Filename    string   `xml:"filename,attr"`
+	Size        int64    `xml:"size,attr"`
+	ContentType string   `xml:"content-type,attr"`
+}
+
+type uploadSlot struct {
+	Put struct {
+		URL     string `xml:"url,attr"`
+		Headers []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"header"`
+	} `xml:"put"`
+	Get struct {
+		URL string `xml:"url,attr"`
+	} `xml:"get"`
+}
+
+type slotResponse struct {
+	Slot uploadSlot `xml:"urn:xmpp:http:upload:0 slot"`
+}
+
+// asks the upload service for a slot to upload the file to
+func (u *imageUploader) requestSlot(ctx context.Context, service jid.JID, filename string, size int64, contentType string) (uploadSlot, error) {
+	var resp slotResponse
+	err := u.client.iq(ctx, stanza.IQ{To: service, Type: stanza.GetIQ}, slotRequest{Filename: filename, Size: size, ContentType: contentType}, &resp)
+	if err != nil {
+		return uploadSlot{}, fmt.Errorf("failed to request an upload slot: %w", err)
+	}
+	if resp.Slot.Put.URL == "" || resp.Slot.Get.URL == "" {
+		return uploadSlot{}, errors.New("the upload service returned no slot")
+	}
+	return resp.Slot, nil
+}
+
+// returns the file name of the image: the last path segment of its url, with
+// an extension matching the content type
+func imageFilename(source string, contentType string) string {
+	name := "image"
+	if u, err := url.Parse(source); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	if path.Ext(name) == "" {
+		switch contentType {
+		case "image/jpeg":
+			name += ".jpg"
+		case "image/svg+xml":
+			name += ".svg"
+		default:
+			name += "." + strings.TrimPrefix(contentType, "image/")
+		}
+	}
+	return name
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+)
+
+var iqRequest = regexp.MustCompile(`(?s)<iq[^>]*\bid="([^"]+)"[^>]*>(.*?)</iq>`)
+
+// answers the iq requests (incl. the iq element) the client sends on the connection until the test ends
+func answerIQs(t *testing.T, c *fakeConn, answer func(request string) string) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		answered := make(map[string]bool)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, m := range iqRequest.FindAllStringSubmatch(c.received(), -1) {
+				if answered[m[1]] {
+					continue
+				}
+				answered[m[1]] = true
+				fmt.Fprintf(c.conn, `<iq xmlns="jabber:client" type="result" id="%s">%s</iq>`, m[1], answer(m[0]))
+			}
+		}
+	}()
+}
+
+func TestImageUpload(t *testing.T) {
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer glsa_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("\x89PNG panel"))
+	}))
+	defer grafana.Close()
+	var mu sync.Mutex
+	var uploaded, uploadAuth, uploadType string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		uploaded, uploadAuth, uploadType = string(body), r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer storage.Close()
+
+	server := &fakeServer{}
+	handler := xmpp.HandlerFunc(func(xmlstream.TokenReadEncoder, *xml.StartElement) error { return nil })
+	client := newXMPPClient(server.dial, func(*xmpp.Session) error { return nil }, handler)
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	go client.serve()
+	defer client.close()
+	var requests []string
+	answerIQs(t, server.conn(t, 0), func(request string) string {
+		mu.Lock()
+		requests = append(requests, request)
+		mu.Unlock()
+		switch {
+		case strings.Contains(request, discoItemNamespace):
+			return `<query xmlns="http://jabber.org/protocol/disco#items"><item jid="conference.example.net"/><item jid="upload.example.net"/></query>`
+		case strings.Contains(request, discoInfoNamespace) && strings.Contains(request, `to="upload.example.net"`):
+			return `<query xmlns="http://jabber.org/protocol/disco#info"><feature var="urn:xmpp:http:upload:0"/></query>`
+		case strings.Contains(request, discoInfoNamespace):
+			return `<query xmlns="http://jabber.org/protocol/disco#info"><feature var="http://jabber.org/protocol/muc"/></query>`
+		case strings.Contains(request, uploadNamespace):
+			return `<slot xmlns="urn:xmpp:http:upload:0"><put url="` + storage.URL + `/put/panel.png"><header name="Authorization">Basic c2xvdA==</header><header name="Host">evil</header></put><get url="https://upload.example.net/get/panel.png"/></slot>`
+		}
+		return ""
+	})
+
+	uploader := &imageUploader{client: client, http: http.DefaultClient, maxSize: 1 << 20}
+	auth := &imageAuth{prefix: grafana.URL + "/", header: "Authorization", value: "Bearer glsa_token"}
+	d := &dispatcher{client: client, presence: newPresenceTracker(), from: jid.MustParse("bot@example.net"), uploader: uploader}
+	ok := d.deliver(context.Background(), alertMessage{
+		id:         "m1",
+		body:       "HighErrorRate",
+		image:      grafana.URL + "/public/img/attachments/panel",
+		imageAuth:  auth,
+		recipients: []jid.JID{jid.MustParse("alice@example.net")},
+	})
+	if !ok {
+		t.Fatal("delivery failed")
+	}
+	waitFor(t, "the image message", func() bool {
+		return strings.Contains(server.conn(t, 0).received(), `<x xmlns="jabber:x:oob"><url>https://upload.example.net/get/panel.png</url></x>`)
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if uploaded != "\x89PNG panel" || uploadAuth != "Basic c2xvdA==" || uploadType != "image/png" {
+		t.Errorf("uploaded %q with authorization %q and content type %q", uploaded, uploadAuth, uploadType)
+	}
+	slot := requests[len(requests)-1]
+	if !strings.Contains(slot, `filename="panel.png"`) || !strings.Contains(slot, `size="10"`) || !strings.Contains(slot, `content-type="image/png"`) {
+		t.Errorf("slot request %s", slot)
+	}
+	if !uploader.service.Equal(jid.MustParse("upload.example.net")) {
+		t.Errorf("discovered service %s", uploader.service)
+	}
+	received := server.conn(t, 0).received()
+	if !strings.Contains(received, "<body>HighErrorRate</body>") || !strings.Contains(received, `id="m1-2"`) {
+		t.Errorf("messages: %s", received)
+	}
+}
+
+func TestImageAuth(t *testing.T) {
+	auth := &imageAuth{prefix: "https://grafana.example.com/", header: "Authorization", value: "Bearer t"}
+	for url, want := range map[string]string{
+		"https://grafana.example.com/public/img/a.png":        "Bearer t",
+		"https://grafana.example.com.evil.example/a.png":      "",
+		"http://grafana.example.com/public/img/a.png":         "",
+		"https://other.example.com/grafana.example.com/a.png": "",
+	} {
+		r := httptest.NewRequest("GET", url, nil)
+		auth.apply(r)
+		if got := r.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: got %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestImageFilename(t *testing.T) {
+	tests := map[[2]string]string{
+		{"https://grafana.example.com/public/img/attachments/x.png", "image/png"}: "x.png",
+		{"https://grafana.example.com/render/d-solo/abc", "image/jpeg"}:           "abc.jpg",
+		{"https://grafana.example.com/", "image/webp"}:                            "image.webp",
+	}
+	for in, want := range tests {
+		if got := imageFilename(in[0], in[1]); got != want {
+			t.Errorf("%v: got %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+)
+
+// build metadata, injected via -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+var buildInfo = newGauge("xmpp_webhook_build_info", "Build metadata of the running xmpp-webhook.", "version", "commit", "date")
+
+// returns the human readable build metadata
+func versionString() string {
+	return fmt.Sprintf("xmpp-webhook %s (commit %s, built %s)", version, commit, date)
+}
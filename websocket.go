@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"mellium.im/sasl"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/websocket"
+)
+
+// checks the url of XMPP_WEBSOCKET_URL, unencrypted ws:// only if tls isn't required
+func parseWebSocketURL(s string, requireTLS bool) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid websocket url %q", s)
+	}
+	switch u.Scheme {
+	case "wss":
+	case "ws":
+		if requireTLS {
+			return nil, errors.New("the websocket url must use wss://, ws:// is unencrypted (XMPP_REQUIRE_TLS=0 allows it)")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q, use wss or ws", u.Scheme)
+	}
+	if u.User != nil {
+		return nil, errors.New("the websocket url must not contain credentials")
+	}
+	return u, nil
+}
+
+// returns the origin sent in the websocket handshake, the http(s) url of the host
+func webSocketOrigin(u *url.URL) string {
+	scheme := "https"
+	if u.Scheme == "ws" {
+		scheme = "http"
+	}
+	return scheme + "://" + u.Host
+}
+
+// connects to the xmpp server over websocket (RFC 7395) instead of tcp, the
+// tls of wss:// replaces starttls
+func initXMPPWebSocket(address jid.JID, pass string, location string, skipTLSVerify bool, rootCAs *x509.CertPool, tlsServerName string, mechanisms []sasl.Mechanism) (*xmpp.Session, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	// the certificate is the one of the web server, verified against the url's host
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: skipTLSVerify, RootCAs: rootCAs}
+	if tlsServerName != "" {
+		tlsConfig.ServerName = tlsServerName
+	}
+	dialer := websocket.Dialer{Origin: webSocketOrigin(u), TLSConfig: tlsConfig}
+	conn, err := dialer.DialDirect(context.TODO(), location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", redactURL(location), err)
+	}
+	// the tls of wss:// isn't visible on the connection, websocket.NewSession
+	// only recognizes it by the scheme of the origin
+	var state xmpp.SessionState
+	auth := xmpp.SASL("", pass, mechanisms...)
+	if u.Scheme == "wss" {
+		state = xmpp.Secure
+	} else {
+		auth.Necessary &^= xmpp.Secure
+	}
+	session, err := xmpp.NewSession(
+		context.TODO(),
+		address.Domain(),
+		address,
+		conn,
+		state,
+		xmpp.NewNegotiator(xmpp.StreamConfig{
+			Features: func(*xmpp.Session, ...xmpp.StreamFeature) []xmpp.StreamFeature {
+				return []xmpp.StreamFeature{xmpp.BindResource(), auth}
+			},
+			WebSocket: true,
+		}),
+	)
+	if err != nil {
+		_ = conn.Close()
+		if strings.Contains(err.Error(), "no matching SASL mechanisms") {
+			return nil, fmt.Errorf("the server supports none of the configured sasl mechanisms (%s): %w", saslMechanismNames(mechanisms), err)
+		}
+		return nil, err
+	}
+	return session, nil
+}